@@ -4,9 +4,16 @@ package config
 type NodeConfig struct {
 	HostAddress string
 	HttpPort    int
+	EventsPort  int
 	GrpcPort    int
 	Libp2pPort  int
 	BaseDir     string
+
+	MaxConcurrentDownloads int // max number of download jobs that run at the same time
+
+	// Global file sharing bandwidth limits in bytes per second, 0 means unlimited
+	UploadRateLimit   int64
+	DownloadRateLimit int64
 }
 
 // RendezvousConfig contains rendezvous nodes to which other rendezvous nodes
@@ -21,6 +28,11 @@ var (
 	ServerHTTPPort   = 5000 // Used for the UI -> Client REST communication
 	ServerGRPCPort   = 5001 // Used for Client <-> Client RPC communication
 	ServerLibp2pPort = 5002 // Used for Client <-> Client network communication
+	ServerEventsPort = 5003 // Used for the Client -> UI event stream
+
+	MaxConcurrentDownloads = 3 // Used for background download jobs
+
+	MinFileAge = 2 // Seconds since the last change before a file is shared, used when a workspace doesn't set one
 )
 
 // Directory names
@@ -28,11 +40,14 @@ var (
 	DirectoryFiles   = "files"
 	DirectoryLibp2p  = "libp2p"
 	DirectoryStorage = "storage"
+	DirectoryBlobs   = "blobs"
 	DirectoryBase    = "app_data"
 
 	// Client local //
-	DirectoryTemp  = "temp"
-	DirectoryShare = "share"
+	DirectoryTemp     = "temp"
+	DirectoryShare    = "share"
+	DirectoryMirror   = "mirror"
+	DirectoryVersions = "versions"
 )
 
 var (
@@ -41,6 +56,15 @@ var (
 	WORKSPACE_TYPE_SEND_RECEIVE = "send-receive"
 )
 
+// Hash algorithms of the file checksums, named after their multihash names
+var (
+	HASH_ALGORITHM_SHA2_256    = "sha2-256"
+	HASH_ALGORITHM_BLAKE2B_256 = "blake2b-256"
+
+	// DefaultHashAlgorithm is used by workspaces that don't set an algorithm
+	DefaultHashAlgorithm = HASH_ALGORITHM_SHA2_256
+)
+
 // Default rendezvous nodes that are already up and running
 var (
 	DefaultRendezvousNodes = []string{
@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// FramingVersion is the version of the chunk framing used for file transfers.
+//
+// Version 1 seals every chunk on its own with AES-256-GCM. The nonce is made out of
+// the first 4 bytes of the transfer IV followed by the chunk index, and the additional data
+// binds the framing version, the chunk index, the chunk flags and the requested range.
+// Keys are unique per transfer, so nonces never repeat for the same key
+const FramingVersion uint32 = 1
+
+// ChunkFlags are the chunk properties that are authenticated along with the chunk
+type ChunkFlags byte
+
+const (
+	ChunkFinal      ChunkFlags = 1 << iota // marks the end of the stream
+	ChunkCompressed                        // the chunk data is compressed
+)
+
+const noncePrefixSize = 4 // B
+
+var (
+	ErrUnsupportedFraming = errors.New("unsupported framing version")
+	ErrInvalidChunk       = errors.New("unable to open chunk")
+)
+
+// ChunkCipher seals and opens individual file transfer chunks
+type ChunkCipher struct {
+	aead        cipher.AEAD
+	noncePrefix []byte
+	offset      int64
+	length      int64
+}
+
+// NewChunkCipher creates a new chunk cipher for the given transfer key, IV and requested range
+func NewChunkCipher(key []byte, iv []byte, offset int64, length int64) (*ChunkCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cipher, %v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create AEAD, %v", err)
+	}
+
+	if len(iv) < noncePrefixSize {
+		return nil, errors.New("invalid IV size")
+	}
+
+	return &ChunkCipher{
+		aead:        aead,
+		noncePrefix: iv[:noncePrefixSize],
+		offset:      offset,
+		length:      length,
+	}, nil
+}
+
+// nonce generates the nonce for the chunk at the given index
+func (cc *ChunkCipher) nonce(index int64) []byte {
+	nonce := make([]byte, cc.aead.NonceSize())
+
+	copy(nonce, cc.noncePrefix)
+	binary.BigEndian.PutUint64(nonce[noncePrefixSize:], uint64(index))
+
+	return nonce
+}
+
+// additionalData generates the authenticated chunk metadata
+func (cc *ChunkCipher) additionalData(index int64, flags ChunkFlags) []byte {
+	data := make([]byte, 4+8+1+8+8)
+
+	binary.BigEndian.PutUint32(data[0:4], FramingVersion)
+	binary.BigEndian.PutUint64(data[4:12], uint64(index))
+	data[12] = byte(flags)
+	binary.BigEndian.PutUint64(data[13:21], uint64(cc.offset))
+	binary.BigEndian.PutUint64(data[21:29], uint64(cc.length))
+
+	return data
+}
+
+// Seal encrypts and authenticates the chunk at the given index
+func (cc *ChunkCipher) Seal(index int64, flags ChunkFlags, plaintext []byte) []byte {
+	return cc.aead.Seal(nil, cc.nonce(index), plaintext, cc.additionalData(index, flags))
+}
+
+// Open decrypts and verifies the chunk at the given index.
+// The returned data reuses the storage of the sealed chunk
+func (cc *ChunkCipher) Open(version uint32, index int64, flags ChunkFlags, sealed []byte) ([]byte, error) {
+	if version != FramingVersion {
+		return nil, ErrUnsupportedFraming
+	}
+
+	plaintext, err := cc.aead.Open(sealed[:0], cc.nonce(index), sealed, cc.additionalData(index, flags))
+	if err != nil {
+		return nil, ErrInvalidChunk
+	}
+
+	return plaintext, nil
+}
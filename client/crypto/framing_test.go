@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestChunkCipher(t *testing.T, offset int64, length int64) *ChunkCipher {
+	t.Helper()
+
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+	for i := range iv {
+		iv[i] = byte(i)
+	}
+
+	chunkCipher, err := NewChunkCipher(key, iv, offset, length)
+	assert.NoError(t, err)
+
+	return chunkCipher
+}
+
+func TestChunkCipher_RoundTrip(t *testing.T) {
+	chunkCipher := newTestChunkCipher(t, 0, 0)
+
+	sealed := chunkCipher.Seal(3, 0, []byte("chunk data"))
+
+	plaintext, err := chunkCipher.Open(FramingVersion, 3, 0, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "chunk data", string(plaintext))
+}
+
+func TestChunkCipher_Open(t *testing.T) {
+	testTable := []struct {
+		name          string
+		version       uint32
+		index         int64
+		flags         ChunkFlags
+		offset        int64
+		tamper        bool
+		expectedError error
+	}{
+		{
+			"Unsupported framing version",
+			FramingVersion + 1,
+			1,
+			0,
+			0,
+			false,
+			ErrUnsupportedFraming,
+		},
+		{
+			"Reordered chunk",
+			FramingVersion,
+			2,
+			0,
+			0,
+			false,
+			ErrInvalidChunk,
+		},
+		{
+			"Truncation marker added",
+			FramingVersion,
+			1,
+			ChunkFinal,
+			0,
+			false,
+			ErrInvalidChunk,
+		},
+		{
+			"Compression flag added",
+			FramingVersion,
+			1,
+			ChunkCompressed,
+			0,
+			false,
+			ErrInvalidChunk,
+		},
+		{
+			"Different range",
+			FramingVersion,
+			1,
+			0,
+			1024,
+			false,
+			ErrInvalidChunk,
+		},
+		{
+			"Tampered data",
+			FramingVersion,
+			1,
+			0,
+			0,
+			true,
+			ErrInvalidChunk,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			sealed := newTestChunkCipher(t, 0, 0).Seal(1, 0, []byte("chunk data"))
+			if testCase.tamper {
+				sealed[0] ^= 0xff
+			}
+
+			_, err := newTestChunkCipher(t, testCase.offset, 0).Open(
+				testCase.version,
+				testCase.index,
+				testCase.flags,
+				sealed,
+			)
+			assert.ErrorIs(t, err, testCase.expectedError)
+		})
+	}
+}
@@ -0,0 +1,603 @@
+package downloads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-hclog"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/networking/client"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+const (
+	maxJobAttempts   = 5                // number of failed attempts after which a job is marked as failed
+	jobRetryDelay    = 30 * time.Second // delay before a failed job is retried, multiplied by the number of attempts
+	scheduleInterval = 5 * time.Second  // interval at which the queue is checked for jobs that can be retried
+)
+
+var (
+	ErrJobNotFound       = errors.New("download job not found")
+	ErrInvalidJobState   = errors.New("invalid download job state")
+	ErrInvalidJobRequest = errors.New("invalid download job request")
+)
+
+// Downloader fetches files from the workspace peers
+type Downloader interface {
+	HandleFileDownload(
+		ctx context.Context,
+		mnemonic string,
+		fileChecksum string,
+		progressFn client.ProgressFn,
+	) (*client.DownloadedFileWrapper, error)
+	DiscardFileDownload(mnemonic string, fileChecksum string) error
+	SeedDownloadedFile(
+		mnemonic string,
+		fileChecksum string,
+		downloadInfo *client.DownloadedFileWrapper,
+		requested bool,
+	) (bool, error)
+}
+
+// JobStore persists the download jobs, so they survive restarts
+type JobStore interface {
+	SaveDownloadJob(job types.DownloadJob) error
+	GetDownloadJobs() ([]*types.DownloadJob, error)
+	DeleteDownloadJob(id string) error
+}
+
+// DownloadManager runs the queued download jobs in the background,
+// with a limit on the number of concurrent downloads
+type DownloadManager struct {
+	logger        hclog.Logger
+	downloader    Downloader
+	store         JobStore
+	maxConcurrent int
+
+	jobs     map[string]*types.DownloadJob // job id -> job
+	running  map[string]context.CancelFunc // job id -> cancel function of the running download
+	retryAt  map[string]time.Time          // job id -> time after which a failed job can be retried
+	jobsMux  sync.Mutex
+	jobsWait sync.WaitGroup
+
+	scheduleChannel chan struct{}
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+}
+
+// NewDownloadManager creates a new instance of the download manager
+func NewDownloadManager(
+	logger hclog.Logger,
+	downloader Downloader,
+	store JobStore,
+	maxConcurrent int,
+) *DownloadManager {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	return &DownloadManager{
+		logger:          logger.Named("download-manager"),
+		downloader:      downloader,
+		store:           store,
+		maxConcurrent:   maxConcurrent,
+		jobs:            make(map[string]*types.DownloadJob),
+		running:         make(map[string]context.CancelFunc),
+		retryAt:         make(map[string]time.Time),
+		scheduleChannel: make(chan struct{}, 1),
+		ctx:             ctx,
+		cancelFunc:      cancelFunc,
+	}
+}
+
+// Start loads the saved jobs and starts the scheduling loop.
+// Blocks until the close channel is notified
+func (dm *DownloadManager) Start(closeChannel chan struct{}) {
+	savedJobs, loadErr := dm.store.GetDownloadJobs()
+	if loadErr != nil {
+		dm.logger.Error(fmt.Sprintf("Unable to load download jobs, %v", loadErr))
+	}
+
+	dm.jobsMux.Lock()
+	for _, job := range savedJobs {
+		if job.Status == types.DOWNLOAD_STATUS_RUNNING {
+			// The node stopped mid-download, the job continues where it left off
+			job.Status = types.DOWNLOAD_STATUS_QUEUED
+		}
+
+		dm.jobs[job.ID] = job
+	}
+	dm.jobsMux.Unlock()
+
+	dm.logger.Info(fmt.Sprintf("Download manager started with %d jobs", len(savedJobs)))
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	dm.schedule()
+
+	for {
+		select {
+		case <-closeChannel:
+			dm.logger.Info("Caught stop signal...")
+			dm.cancelFunc()
+			dm.jobsWait.Wait()
+
+			dm.logger.Info("Download manager stopped gracefully")
+
+			return
+		case <-dm.scheduleChannel:
+			dm.schedule()
+		case <-ticker.C:
+			dm.schedule()
+		}
+	}
+}
+
+// triggerSchedule signals the scheduling loop that the queue changed
+func (dm *DownloadManager) triggerSchedule() {
+	select {
+	case dm.scheduleChannel <- struct{}{}:
+	default:
+		// A schedule is already pending
+	}
+}
+
+// schedule starts queued jobs until the concurrency limit is reached
+func (dm *DownloadManager) schedule() {
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	if dm.ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, job := range dm.sortedJobsLocked() {
+		if len(dm.running) >= dm.maxConcurrent {
+			return
+		}
+
+		if job.Status != types.DOWNLOAD_STATUS_QUEUED {
+			continue
+		}
+
+		if retryAt, ok := dm.retryAt[job.ID]; ok && now.Before(retryAt) {
+			continue
+		}
+
+		dm.startJobLocked(job)
+	}
+}
+
+// sortedJobsLocked returns the jobs in the order they should be started.
+// Jobs with a higher priority go first, and jobs with the same priority go in the order they were added
+func (dm *DownloadManager) sortedJobsLocked() []*types.DownloadJob {
+	jobs := make([]*types.DownloadJob, 0, len(dm.jobs))
+	for _, job := range dm.jobs {
+		jobs = append(jobs, job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Priority != jobs[j].Priority {
+			return jobs[i].Priority > jobs[j].Priority
+		}
+
+		if jobs[i].DateAdded != jobs[j].DateAdded {
+			return jobs[i].DateAdded < jobs[j].DateAdded
+		}
+
+		return jobs[i].ID < jobs[j].ID
+	})
+
+	return jobs
+}
+
+// startJobLocked starts the download of the job in the background
+func (dm *DownloadManager) startJobLocked(job *types.DownloadJob) {
+	ctx, cancelFunc := context.WithCancel(dm.ctx)
+
+	job.Status = types.DOWNLOAD_STATUS_RUNNING
+	job.Error = ""
+	job.ErrorType = ""
+	dm.running[job.ID] = cancelFunc
+	delete(dm.retryAt, job.ID)
+
+	dm.saveJobLocked(job)
+
+	dm.logger.Info(fmt.Sprintf("Starting download job %s for file %s", job.ID, job.FileChecksum))
+
+	dm.jobsWait.Add(1)
+	go func(jobID string, mnemonic string, fileChecksum string) {
+		defer dm.jobsWait.Done()
+
+		downloadInfo, downloadErr := dm.downloader.HandleFileDownload(
+			ctx,
+			mnemonic,
+			fileChecksum,
+			func(downloaded int64, total int64) {
+				dm.updateProgress(jobID, downloaded, total)
+			},
+		)
+
+		cancelFunc()
+
+		dm.finishJob(jobID, mnemonic, fileChecksum, downloadInfo, downloadErr)
+	}(job.ID, job.WorkspaceMnemonic, job.FileChecksum)
+}
+
+// updateProgress updates the in-memory progress of the job
+func (dm *DownloadManager) updateProgress(jobID string, downloaded int64, total int64) {
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	if job, ok := dm.jobs[jobID]; ok {
+		job.BytesDownloaded = downloaded
+		job.BytesTotal = total
+	}
+}
+
+// finishJob updates the job after its download stops
+func (dm *DownloadManager) finishJob(
+	jobID string,
+	mnemonic string,
+	fileChecksum string,
+	downloadInfo *client.DownloadedFileWrapper,
+	downloadErr error,
+) {
+	defer dm.triggerSchedule()
+
+	dm.jobsMux.Lock()
+	completed, seed := dm.finishJobLocked(jobID, mnemonic, fileChecksum, downloadInfo, downloadErr)
+	dm.jobsMux.Unlock()
+
+	// Seeding touches the disk, so it's done without holding up the other jobs
+	if completed {
+		dm.seedJob(jobID, mnemonic, fileChecksum, downloadInfo, seed)
+	}
+}
+
+// finishJobLocked updates the job after its download stopped.
+// Returns true if the job completed, along with its seed flag
+func (dm *DownloadManager) finishJobLocked(
+	jobID string,
+	mnemonic string,
+	fileChecksum string,
+	downloadInfo *client.DownloadedFileWrapper,
+	downloadErr error,
+) (bool, bool) {
+	delete(dm.running, jobID)
+
+	job, ok := dm.jobs[jobID]
+	if !ok {
+		// The job was removed while it was running, clean up after it
+		if downloadInfo != nil {
+			_ = os.Remove(downloadInfo.FilePath)
+		}
+
+		if discardErr := dm.downloader.DiscardFileDownload(mnemonic, fileChecksum); discardErr != nil {
+			dm.logger.Error(fmt.Sprintf("Unable to discard download progress for job %s, %v", jobID, discardErr))
+		}
+
+		return false, false
+	}
+
+	completed := false
+
+	switch {
+	case job.Status == types.DOWNLOAD_STATUS_CANCELED:
+		if downloadInfo != nil {
+			_ = os.Remove(downloadInfo.FilePath)
+		}
+
+		dm.discardProgressLocked(job)
+	case downloadErr == nil:
+		// The download might have finished right as the job was paused
+		job.Status = types.DOWNLOAD_STATUS_COMPLETED
+		job.FileName = downloadInfo.FileName
+		job.FilePath = downloadInfo.FilePath
+		job.BytesDownloaded = job.BytesTotal
+		job.BytesOnWire = downloadInfo.WireSize
+		completed = true
+
+		dm.logger.Info(fmt.Sprintf("Download job %s completed", jobID))
+	case job.Status == types.DOWNLOAD_STATUS_PAUSED:
+		// The progress is kept, so the job can be resumed later
+	case dm.ctx.Err() != nil:
+		// The node is shutting down, the job is picked up on the next start
+		job.Status = types.DOWNLOAD_STATUS_QUEUED
+	default:
+		job.Attempts++
+		job.Error = downloadErr.Error()
+		job.ErrorType = types.DOWNLOAD_ERROR_NETWORK
+
+		// Integrity failures are reported on their own, they point to a misbehaving peer
+		if errors.Is(downloadErr, client.ErrIntegrity) {
+			job.ErrorType = types.DOWNLOAD_ERROR_INTEGRITY
+		}
+
+		dm.logger.Error(fmt.Sprintf("Download job %s failed [attempt %d], %v", jobID, job.Attempts, downloadErr))
+
+		if job.Attempts < maxJobAttempts {
+			job.Status = types.DOWNLOAD_STATUS_QUEUED
+			dm.retryAt[jobID] = time.Now().Add(time.Duration(job.Attempts) * jobRetryDelay)
+		} else {
+			job.Status = types.DOWNLOAD_STATUS_FAILED
+		}
+	}
+
+	dm.saveJobLocked(job)
+
+	return completed, job.Seed
+}
+
+// seedJob shares the file of the completed job back with the workspace
+func (dm *DownloadManager) seedJob(
+	jobID string,
+	mnemonic string,
+	fileChecksum string,
+	downloadInfo *client.DownloadedFileWrapper,
+	seed bool,
+) {
+	seeding, seedErr := dm.downloader.SeedDownloadedFile(mnemonic, fileChecksum, downloadInfo, seed)
+	if seedErr != nil {
+		dm.logger.Error(fmt.Sprintf("Unable to seed file of download job %s, %v", jobID, seedErr))
+	}
+
+	if !seeding {
+		return
+	}
+
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	// The job might have been removed while the file was being linked
+	job, ok := dm.jobs[jobID]
+	if !ok {
+		return
+	}
+
+	job.Seeding = true
+	dm.saveJobLocked(job)
+}
+
+// discardProgressLocked removes the partially downloaded file of the job
+func (dm *DownloadManager) discardProgressLocked(job *types.DownloadJob) {
+	if _, isRunning := dm.running[job.ID]; isRunning {
+		// The job cleans up after itself once it stops
+		return
+	}
+
+	if discardErr := dm.downloader.DiscardFileDownload(job.WorkspaceMnemonic, job.FileChecksum); discardErr != nil {
+		dm.logger.Error(fmt.Sprintf("Unable to discard download progress for job %s, %v", job.ID, discardErr))
+	}
+
+	job.BytesDownloaded = 0
+}
+
+// saveJobLocked persists the job
+func (dm *DownloadManager) saveJobLocked(job *types.DownloadJob) {
+	if saveErr := dm.store.SaveDownloadJob(*job); saveErr != nil {
+		dm.logger.Error(fmt.Sprintf("Unable to save download job %s, %v", job.ID, saveErr))
+	}
+}
+
+// AddJob queues a new file download. If the file is already
+// being downloaded from the workspace, the existing job is returned
+func (dm *DownloadManager) AddJob(
+	mnemonic string,
+	fileChecksum string,
+	priority int,
+	seed bool,
+) (*types.DownloadJob, error) {
+	if mnemonic == "" || priority < 0 {
+		return nil, ErrInvalidJobRequest
+	}
+
+	// The checksum names the files of the download on disk, so it has to be well-formed
+	if _, parseErr := files.ParseFileChecksum(fileChecksum); parseErr != nil {
+		return nil, ErrInvalidJobRequest
+	}
+
+	defer dm.triggerSchedule()
+
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	for _, job := range dm.jobs {
+		if job.WorkspaceMnemonic == mnemonic && job.FileChecksum == fileChecksum && !isFinished(job) {
+			jobCopy := *job
+
+			return &jobCopy, nil
+		}
+	}
+
+	job := &types.DownloadJob{
+		ID:                uuid.New().String(),
+		WorkspaceMnemonic: mnemonic,
+		FileChecksum:      fileChecksum,
+		Status:            types.DOWNLOAD_STATUS_QUEUED,
+		Priority:          priority,
+		DateAdded:         time.Now().Unix(),
+		Seed:              seed,
+	}
+
+	if saveErr := dm.store.SaveDownloadJob(*job); saveErr != nil {
+		return nil, fmt.Errorf("unable to save download job, %v", saveErr)
+	}
+
+	dm.jobs[job.ID] = job
+	jobCopy := *job
+
+	return &jobCopy, nil
+}
+
+// GetJobs returns all download jobs, in the order they are scheduled
+func (dm *DownloadManager) GetJobs() []*types.DownloadJob {
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	jobs := make([]*types.DownloadJob, 0, len(dm.jobs))
+	for _, job := range dm.sortedJobsLocked() {
+		jobCopy := *job
+		jobs = append(jobs, &jobCopy)
+	}
+
+	return jobs
+}
+
+// GetJob returns a single download job
+func (dm *DownloadManager) GetJob(jobID string) (*types.DownloadJob, error) {
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	job, ok := dm.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	jobCopy := *job
+
+	return &jobCopy, nil
+}
+
+// PauseJob pauses a queued or running job. The download progress is kept
+func (dm *DownloadManager) PauseJob(jobID string) error {
+	return dm.updateJob(jobID, func(job *types.DownloadJob) error {
+		if job.Status != types.DOWNLOAD_STATUS_QUEUED && job.Status != types.DOWNLOAD_STATUS_RUNNING {
+			return ErrInvalidJobState
+		}
+
+		job.Status = types.DOWNLOAD_STATUS_PAUSED
+		dm.stopJobLocked(job.ID)
+
+		return nil
+	})
+}
+
+// ResumeJob puts a paused or failed job back in the queue
+func (dm *DownloadManager) ResumeJob(jobID string) error {
+	return dm.updateJob(jobID, func(job *types.DownloadJob) error {
+		if job.Status != types.DOWNLOAD_STATUS_PAUSED && job.Status != types.DOWNLOAD_STATUS_FAILED {
+			return ErrInvalidJobState
+		}
+
+		if _, isRunning := dm.running[job.ID]; isRunning {
+			// The job is still stopping, it can be resumed once it stops
+			return ErrInvalidJobState
+		}
+
+		job.Status = types.DOWNLOAD_STATUS_QUEUED
+		job.Attempts = 0
+		delete(dm.retryAt, job.ID)
+
+		return nil
+	})
+}
+
+// CancelJob stops the job, and discards the download progress
+func (dm *DownloadManager) CancelJob(jobID string) error {
+	return dm.updateJob(jobID, func(job *types.DownloadJob) error {
+		if isFinished(job) {
+			return ErrInvalidJobState
+		}
+
+		job.Status = types.DOWNLOAD_STATUS_CANCELED
+		dm.stopJobLocked(job.ID)
+		dm.discardProgressLocked(job)
+
+		return nil
+	})
+}
+
+// SetJobPriority changes the priority of an unfinished job
+func (dm *DownloadManager) SetJobPriority(jobID string, priority int) error {
+	if priority < 0 {
+		return ErrInvalidJobRequest
+	}
+
+	return dm.updateJob(jobID, func(job *types.DownloadJob) error {
+		if isFinished(job) {
+			return ErrInvalidJobState
+		}
+
+		job.Priority = priority
+
+		return nil
+	})
+}
+
+// RemoveJob removes the job from the list. Unfinished jobs are canceled,
+// and the downloaded file of completed jobs is removed
+func (dm *DownloadManager) RemoveJob(jobID string) error {
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	job, ok := dm.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	if job.Status == types.DOWNLOAD_STATUS_COMPLETED {
+		if removeErr := os.Remove(job.FilePath); removeErr != nil && !os.IsNotExist(removeErr) {
+			dm.logger.Error(fmt.Sprintf("Unable to remove downloaded file for job %s, %v", jobID, removeErr))
+		}
+	} else {
+		// Running jobs clean up after themselves once they stop
+		dm.stopJobLocked(jobID)
+		dm.discardProgressLocked(job)
+	}
+
+	if deleteErr := dm.store.DeleteDownloadJob(jobID); deleteErr != nil {
+		return fmt.Errorf("unable to delete download job, %v", deleteErr)
+	}
+
+	delete(dm.jobs, jobID)
+	delete(dm.retryAt, jobID)
+
+	return nil
+}
+
+// updateJob applies the update to the job, and persists it
+func (dm *DownloadManager) updateJob(jobID string, updateFn func(job *types.DownloadJob) error) error {
+	defer dm.triggerSchedule()
+
+	dm.jobsMux.Lock()
+	defer dm.jobsMux.Unlock()
+
+	job, ok := dm.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	if updateErr := updateFn(job); updateErr != nil {
+		return updateErr
+	}
+
+	dm.saveJobLocked(job)
+
+	return nil
+}
+
+// stopJobLocked stops the download of the job, if it's running
+func (dm *DownloadManager) stopJobLocked(jobID string) {
+	if cancelFunc, isRunning := dm.running[jobID]; isRunning {
+		cancelFunc()
+	}
+}
+
+// isFinished checks if the job reached a final state
+func isFinished(job *types.DownloadJob) bool {
+	return job.Status == types.DOWNLOAD_STATUS_COMPLETED ||
+		job.Status == types.DOWNLOAD_STATUS_FAILED ||
+		job.Status == types.DOWNLOAD_STATUS_CANCELED
+}
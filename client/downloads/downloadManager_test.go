@@ -0,0 +1,315 @@
+package downloads
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/networking/client"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// testChecksum is the checksum of the downloaded test file
+const testChecksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// mockDownloader blocks every download until it's released, failed or stopped
+type mockDownloader struct {
+	started   chan string
+	release   chan struct{}
+	fail      chan error
+	discarded chan string
+}
+
+func newMockDownloader() *mockDownloader {
+	return &mockDownloader{
+		started:   make(chan string, 10),
+		release:   make(chan struct{}),
+		fail:      make(chan error),
+		discarded: make(chan string, 10),
+	}
+}
+
+func (md *mockDownloader) HandleFileDownload(
+	ctx context.Context,
+	_ string,
+	fileChecksum string,
+	_ client.ProgressFn,
+) (*client.DownloadedFileWrapper, error) {
+	md.started <- fileChecksum
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-md.release:
+		return &client.DownloadedFileWrapper{FileName: fileChecksum}, nil
+	case failErr := <-md.fail:
+		return nil, failErr
+	}
+}
+
+func (md *mockDownloader) DiscardFileDownload(_ string, fileChecksum string) error {
+	md.discarded <- fileChecksum
+
+	return nil
+}
+
+func (md *mockDownloader) SeedDownloadedFile(
+	_ string,
+	_ string,
+	_ *client.DownloadedFileWrapper,
+	requested bool,
+) (bool, error) {
+	return requested, nil
+}
+
+// mockStore keeps the jobs in memory
+type mockStore struct {
+	jobs    map[string]types.DownloadJob
+	jobsMux sync.Mutex
+}
+
+func (ms *mockStore) SaveDownloadJob(job types.DownloadJob) error {
+	ms.jobsMux.Lock()
+	defer ms.jobsMux.Unlock()
+
+	ms.jobs[job.ID] = job
+
+	return nil
+}
+
+func (ms *mockStore) GetDownloadJobs() ([]*types.DownloadJob, error) {
+	ms.jobsMux.Lock()
+	defer ms.jobsMux.Unlock()
+
+	jobs := make([]*types.DownloadJob, 0)
+	for _, job := range ms.jobs {
+		jobCopy := job
+		jobs = append(jobs, &jobCopy)
+	}
+
+	return jobs, nil
+}
+
+func (ms *mockStore) DeleteDownloadJob(id string) error {
+	ms.jobsMux.Lock()
+	defer ms.jobsMux.Unlock()
+
+	delete(ms.jobs, id)
+
+	return nil
+}
+
+// startManager starts a download manager, and returns a function that stops it
+func startManager(downloader Downloader, store JobStore, maxConcurrent int) (*DownloadManager, func()) {
+	manager := NewDownloadManager(hclog.NewNullLogger(), downloader, store, maxConcurrent)
+	closeChannel := make(chan struct{})
+	doneChannel := make(chan struct{})
+
+	go func() {
+		manager.Start(closeChannel)
+		close(doneChannel)
+	}()
+
+	return manager, func() {
+		close(closeChannel)
+		<-doneChannel
+	}
+}
+
+// waitForStart waits for a download to start
+func waitForStart(t *testing.T, downloader *mockDownloader) string {
+	t.Helper()
+
+	select {
+	case fileChecksum := <-downloader.started:
+		return fileChecksum
+	case <-time.After(5 * time.Second):
+		t.Fatal("download not started")
+	}
+
+	return ""
+}
+
+// waitForStatus waits for the job to reach the given status
+func waitForStatus(t *testing.T, manager *DownloadManager, jobID string, status string) {
+	t.Helper()
+
+	assert.Eventually(t, func() bool {
+		job, jobErr := manager.GetJob(jobID)
+
+		return jobErr == nil && job.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDownloadManager_Priority(t *testing.T) {
+	downloader := newMockDownloader()
+	store := &mockStore{jobs: make(map[string]types.DownloadJob)}
+
+	// Jobs from a previous run
+	store.jobs["1"] = types.DownloadJob{
+		ID: "1", FileChecksum: "low", Status: types.DOWNLOAD_STATUS_QUEUED, Priority: 0, DateAdded: 1,
+	}
+	store.jobs["2"] = types.DownloadJob{
+		ID: "2", FileChecksum: "high", Status: types.DOWNLOAD_STATUS_QUEUED, Priority: 5, DateAdded: 2,
+	}
+	store.jobs["3"] = types.DownloadJob{
+		ID: "3", FileChecksum: "interrupted", Status: types.DOWNLOAD_STATUS_RUNNING, Priority: 0, DateAdded: 0,
+	}
+	store.jobs["4"] = types.DownloadJob{
+		ID: "4", FileChecksum: "paused", Status: types.DOWNLOAD_STATUS_PAUSED, Priority: 10, DateAdded: 0,
+	}
+
+	_, stop := startManager(downloader, store, 1)
+	defer stop()
+
+	// Higher priority first, then the oldest job
+	for _, expected := range []string{"high", "interrupted", "low"} {
+		assert.Equal(t, expected, waitForStart(t, downloader))
+
+		downloader.release <- struct{}{}
+	}
+
+	select {
+	case fileChecksum := <-downloader.started:
+		t.Fatalf("paused job %s started", fileChecksum)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDownloadManager_PauseResumeCancel(t *testing.T) {
+	downloader := newMockDownloader()
+	store := &mockStore{jobs: make(map[string]types.DownloadJob)}
+
+	manager, stop := startManager(downloader, store, 1)
+	defer stop()
+
+	// Malformed checksums are refused, they would name files outside of the temp directory
+	_, invalidErr := manager.AddJob("mnemonic", "../../checksum", 0, false)
+	assert.ErrorIs(t, invalidErr, ErrInvalidJobRequest)
+
+	job, addErr := manager.AddJob("mnemonic", testChecksum, 0, false)
+	assert.NoError(t, addErr)
+
+	// Adding the same file again returns the existing job
+	sameJob, addErr := manager.AddJob("mnemonic", testChecksum, 0, false)
+	assert.NoError(t, addErr)
+	assert.Equal(t, job.ID, sameJob.ID)
+
+	waitForStart(t, downloader)
+
+	// Pausing stops the download, and keeps the progress
+	assert.NoError(t, manager.PauseJob(job.ID))
+	waitForStatus(t, manager, job.ID, types.DOWNLOAD_STATUS_PAUSED)
+	assert.ErrorIs(t, manager.PauseJob(job.ID), ErrInvalidJobState)
+	assert.Len(t, downloader.discarded, 0)
+
+	// Resuming starts the download again
+	assert.NoError(t, manager.ResumeJob(job.ID))
+	waitForStart(t, downloader)
+
+	// Canceling stops the download, and discards the progress
+	assert.NoError(t, manager.CancelJob(job.ID))
+	waitForStatus(t, manager, job.ID, types.DOWNLOAD_STATUS_CANCELED)
+	assert.Equal(t, testChecksum, <-downloader.discarded)
+	assert.ErrorIs(t, manager.ResumeJob(job.ID), ErrInvalidJobState)
+
+	// Removed jobs are gone from the store
+	assert.NoError(t, manager.RemoveJob(job.ID))
+	_, getErr := manager.GetJob(job.ID)
+	assert.ErrorIs(t, getErr, ErrJobNotFound)
+	assert.Len(t, store.jobs, 0)
+}
+
+func TestDownloadManager_ErrorType(t *testing.T) {
+	testTable := []struct {
+		name              string
+		downloadErr       error
+		expectedErrorType string
+	}{
+		{
+			"Network failure",
+			errors.New("no peers"),
+			types.DOWNLOAD_ERROR_NETWORK,
+		},
+		{
+			"Integrity failure",
+			client.ErrChecksumMismatch,
+			types.DOWNLOAD_ERROR_INTEGRITY,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			downloader := newMockDownloader()
+			store := &mockStore{jobs: make(map[string]types.DownloadJob)}
+
+			manager, stop := startManager(downloader, store, 1)
+			defer stop()
+
+			job, addErr := manager.AddJob("mnemonic", testChecksum, 0, false)
+			assert.NoError(t, addErr)
+
+			waitForStart(t, downloader)
+			downloader.fail <- testCase.downloadErr
+
+			// The job is queued for a retry, with the error type kept for the UI
+			assert.Eventually(t, func() bool {
+				failedJob, jobErr := manager.GetJob(job.ID)
+
+				return jobErr == nil && failedJob.Attempts == 1
+			}, 5*time.Second, 10*time.Millisecond)
+
+			failedJob, _ := manager.GetJob(job.ID)
+			assert.Equal(t, testCase.expectedErrorType, failedJob.ErrorType)
+			assert.Equal(t, testCase.downloadErr.Error(), failedJob.Error)
+		})
+	}
+}
+
+func TestDownloadManager_Seed(t *testing.T) {
+	testTable := []struct {
+		name            string
+		seed            bool
+		expectedSeeding bool
+	}{
+		{
+			"Seeding requested",
+			true,
+			true,
+		},
+		{
+			"Seeding not requested",
+			false,
+			false,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			downloader := newMockDownloader()
+			store := &mockStore{jobs: make(map[string]types.DownloadJob)}
+
+			manager, stop := startManager(downloader, store, 1)
+			defer stop()
+
+			job, addErr := manager.AddJob("mnemonic", testChecksum, 0, testCase.seed)
+			assert.NoError(t, addErr)
+
+			waitForStart(t, downloader)
+			downloader.release <- struct{}{}
+
+			waitForStatus(t, manager, job.ID, types.DOWNLOAD_STATUS_COMPLETED)
+
+			// The file is seeded once the job is completed
+			assert.Eventually(t, func() bool {
+				completedJob, jobErr := manager.GetJob(job.ID)
+
+				return jobErr == nil && completedJob.Seeding == testCase.expectedSeeding
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
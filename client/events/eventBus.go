@@ -0,0 +1,75 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// EventBus fans the client events out to all subscribers.
+// Subscribers that fall behind miss events, instead of blocking the publishers
+type EventBus struct {
+	subscribers    map[uint64]chan types.Event // subscription id -> event channel
+	nextID         uint64
+	subscribersMux sync.RWMutex
+}
+
+// NewEventBus creates a new event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[uint64]chan types.Event),
+	}
+}
+
+// Publish sends the event to every subscriber with room in its buffer
+func (eb *EventBus) Publish(event types.Event) {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+
+	eb.subscribersMux.RLock()
+	defer eb.subscribersMux.RUnlock()
+
+	for _, subscriber := range eb.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// The subscriber is falling behind
+		}
+	}
+}
+
+// Subscribe creates a new subscription that buffers up to bufferSize events.
+// The returned function ends the subscription, and closes the event channel
+func (eb *EventBus) Subscribe(bufferSize int) (<-chan types.Event, func()) {
+	eb.subscribersMux.Lock()
+	defer eb.subscribersMux.Unlock()
+
+	id := eb.nextID
+	eb.nextID++
+
+	subscriber := make(chan types.Event, bufferSize)
+	eb.subscribers[id] = subscriber
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			eb.subscribersMux.Lock()
+			defer eb.subscribersMux.Unlock()
+
+			delete(eb.subscribers, id)
+			close(subscriber)
+		})
+	}
+
+	return subscriber, unsubscribe
+}
+
+// NumSubscribers returns the number of active subscriptions
+func (eb *EventBus) NumSubscribers() int {
+	eb.subscribersMux.RLock()
+	defer eb.subscribersMux.RUnlock()
+
+	return len(eb.subscribers)
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+func TestEventBus_Publish(t *testing.T) {
+	eventBus := NewEventBus()
+
+	first, unsubscribeFirst := eventBus.Subscribe(10)
+	second, unsubscribeSecond := eventBus.Subscribe(10)
+
+	eventBus.Publish(types.Event{Type: types.EVENT_PEER_VERIFIED, WorkspaceMnemonic: "workspace"})
+
+	for _, subscriber := range []<-chan types.Event{first, second} {
+		event := <-subscriber
+
+		assert.Equal(t, types.EVENT_PEER_VERIFIED, event.Type)
+		assert.Equal(t, "workspace", event.WorkspaceMnemonic)
+		assert.NotZero(t, event.Timestamp)
+	}
+
+	// Ended subscriptions don't receive events anymore
+	unsubscribeFirst()
+	unsubscribeFirst()
+
+	_, open := <-first
+	assert.False(t, open)
+	assert.Equal(t, 1, eventBus.NumSubscribers())
+
+	eventBus.Publish(types.Event{Type: types.EVENT_PEER_LEFT})
+	assert.Equal(t, types.EVENT_PEER_LEFT, (<-second).Type)
+
+	unsubscribeSecond()
+	assert.Equal(t, 0, eventBus.NumSubscribers())
+}
+
+func TestEventBus_SlowSubscriber(t *testing.T) {
+	eventBus := NewEventBus()
+
+	subscriber, unsubscribe := eventBus.Subscribe(2)
+	defer unsubscribe()
+
+	// Publishing never blocks, the events over the buffer size are dropped
+	for i := 0; i < 5; i++ {
+		eventBus.Publish(types.Event{Type: types.EVENT_DOWNLOAD_PROGRESS})
+	}
+
+	assert.Len(t, subscriber, 2)
+}
@@ -0,0 +1,684 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	blobIndexFile       = "index.json"
+	blobLeavesSuffix    = ".merkle"   // suffix of the Merkle tree leaves, kept next to the blob
+	blobCleanupInterval = time.Minute // interval at which the blobs no workspace file links to are removed
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// blobEntry is a single file content kept in the blob store
+type blobEntry struct {
+	Size    int64    `json:"size"`
+	ModTime int64    `json:"modTime"` // unix nano, a different value means the content was changed in place
+	Paths   []string `json:"paths"`   // workspace files that are links to the blob
+	Owned   bool     `json:"owned"`   // the blob is linked only to files the client created
+}
+
+// BlobStore keeps the shared and downloaded files addressed by their checksum.
+// Blobs are hard links to the workspace files, so the same content is stored once,
+// and hashed once, no matter how many workspaces share it.
+//
+// Files the user shares are never rewritten or re-permissioned by the store. A blob first added
+// from a shared file is only a link to it, and stops being valid once the file is changed.
+// Downloads are files the client creates, so they are the only files replaced with links to a blob.
+// Workspace files linked to the same blob are the same file on disk, so an edit made in place
+// in one workspace would silently change it in all the others. Blobs linked to downloads are made
+// read-only for that reason: changing one of them means replacing it, which breaks the link,
+// and the new content is hashed and stored on its own
+type BlobStore struct {
+	logger hclog.Logger
+	dir    string
+
+	blobs     map[string]*blobEntry // checksum -> blob
+	pathIndex map[string]string     // linked workspace file path -> checksum
+	blobsMux  sync.Mutex
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+}
+
+// NewBlobStore creates a blob store in the given directory, and loads its index
+func NewBlobStore(logger hclog.Logger, dir string) (*BlobStore, error) {
+	if createErr := os.MkdirAll(dir, os.ModePerm); createErr != nil {
+		return nil, createErr
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	bs := &BlobStore{
+		logger:     logger.Named("blob-store"),
+		dir:        dir,
+		blobs:      make(map[string]*blobEntry),
+		pathIndex:  make(map[string]string),
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+	}
+
+	data, readErr := os.ReadFile(filepath.Join(dir, blobIndexFile))
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return nil, readErr
+	}
+
+	if readErr == nil {
+		if unmarshalErr := json.Unmarshal(data, &bs.blobs); unmarshalErr != nil {
+			return nil, unmarshalErr
+		}
+	}
+
+	for checksum, blob := range bs.blobs {
+		if validateErr := validateBlobChecksum(checksum); validateErr != nil {
+			// Blob paths are derived from the checksum, so malformed entries are never used
+			bs.logger.Error(fmt.Sprintf("Dropping blob %q from the index, %v", checksum, validateErr))
+			delete(bs.blobs, checksum)
+
+			continue
+		}
+
+		for _, filePath := range blob.Paths {
+			bs.pathIndex[filePath] = checksum
+		}
+	}
+
+	return bs, nil
+}
+
+// Start runs the cleanup loop of the blobs no workspace file links to.
+// Blocks until the blob store is stopped
+func (bs *BlobStore) Start() {
+	ticker := time.NewTicker(blobCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bs.ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := bs.RemoveUnused(); removed > 0 {
+				bs.logger.Info(fmt.Sprintf("Removed %d unused blobs", removed))
+			}
+		}
+	}
+}
+
+// Stop stops the cleanup loop
+func (bs *BlobStore) Stop() {
+	bs.cancelFunc()
+}
+
+// validateBlobChecksum checks if the checksum can address a blob
+func validateBlobChecksum(checksum string) error {
+	fileChecksum, parseErr := ParseFileChecksum(checksum)
+	if parseErr != nil {
+		return parseErr
+	}
+
+	if len(fileChecksum.Digest) == 0 {
+		return errors.New("invalid checksum, empty digest")
+	}
+
+	return nil
+}
+
+// blobPath returns the location of the blob with the given checksum.
+// Only checksums of blobs in the index reach it, and those are validated when they're added
+func (bs *BlobStore) blobPath(checksum string) string {
+	// Blobs are spread over directories by the start of their digest,
+	// since the multihash prefix is the same for all checksums of an algorithm
+	fileChecksum, _ := ParseFileChecksum(checksum)
+
+	return filepath.Join(bs.dir, hex.EncodeToString(fileChecksum.Digest[:1]), checksum)
+}
+
+// Has checks if the store holds the content with the given checksum
+func (bs *BlobStore) Has(checksum string) bool {
+	bs.blobsMux.Lock()
+	defer bs.blobsMux.Unlock()
+
+	_, _, found := bs.findLocked(checksum)
+
+	return found
+}
+
+// Lookup returns the checksum and Merkle tree of the workspace file,
+// if it's still a link to the blob it was added as.
+// The tree is loaded from the disk, it's not kept in memory
+func (bs *BlobStore) Lookup(filePath string, info fs.FileInfo) (string, *MerkleTree, bool) {
+	bs.blobsMux.Lock()
+	defer bs.blobsMux.Unlock()
+
+	checksum, ok := bs.pathIndex[filePath]
+	if !ok {
+		return "", nil, false
+	}
+
+	_, blobInfo, found := bs.findLocked(checksum)
+	if !found || !os.SameFile(info, blobInfo) {
+		return "", nil, false
+	}
+
+	data, readErr := os.ReadFile(bs.blobPath(checksum) + blobLeavesSuffix)
+	if readErr != nil {
+		return "", nil, false
+	}
+
+	merkleTree, decodeErr := decodeMerkleLeaves(data)
+	if decodeErr != nil {
+		return "", nil, false
+	}
+
+	return checksum, merkleTree, true
+}
+
+// Add adds the shared workspace file with the given checksum to the store.
+// The file itself is left as it is: it becomes the blob if the content isn't stored yet,
+// and is only recorded if it's already a link to the blob
+func (bs *BlobStore) Add(filePath string, checksum string, merkleTree *MerkleTree) error {
+	bs.blobsMux.Lock()
+	defer bs.blobsMux.Unlock()
+
+	info, statErr := os.Stat(filePath)
+	if statErr != nil {
+		return statErr
+	}
+
+	blob, blobInfo, found := bs.findLocked(checksum)
+	if found {
+		if leavesErr := bs.saveLeavesLocked(checksum, merkleTree); leavesErr != nil {
+			bs.logger.Error(fmt.Sprintf("Unable to save merkle tree of blob %s, %v", checksum, leavesErr))
+		}
+
+		if !os.SameFile(info, blobInfo) || bs.pathIndex[filePath] == checksum {
+			// Separate copies the user shares are not replaced with links
+			return nil
+		}
+
+		bs.addPathLocked(checksum, blob, filePath)
+
+		return bs.saveLocked()
+	}
+
+	return bs.createLocked(checksum, filePath, info, merkleTree, false)
+}
+
+// AddDownload adds the downloaded workspace file with the given checksum to the store.
+// Downloads are files the client created, so a separate copy of stored content
+// is replaced with a link to the blob
+func (bs *BlobStore) AddDownload(filePath string, checksum string, merkleTree *MerkleTree) error {
+	bs.blobsMux.Lock()
+	defer bs.blobsMux.Unlock()
+
+	info, statErr := os.Stat(filePath)
+	if statErr != nil {
+		return statErr
+	}
+
+	blob, blobInfo, found := bs.findLocked(checksum)
+	if !found {
+		return bs.createLocked(checksum, filePath, info, merkleTree, true)
+	}
+
+	if leavesErr := bs.saveLeavesLocked(checksum, merkleTree); leavesErr != nil {
+		bs.logger.Error(fmt.Sprintf("Unable to save merkle tree of blob %s, %v", checksum, leavesErr))
+	}
+
+	switch {
+	case os.SameFile(info, blobInfo):
+		if bs.pathIndex[filePath] == checksum {
+			// The file is already known
+			return nil
+		}
+	case !blob.Owned:
+		// The blob is a link to a file the user shares, the download takes its place
+		return bs.adoptLocked(checksum, blob, filePath)
+	default:
+		// The download is a separate copy of the content, it's replaced with a link to the blob
+		if linkErr := bs.replaceWithLinkLocked(checksum, filePath); linkErr != nil {
+			return linkErr
+		}
+	}
+
+	bs.addPathLocked(checksum, blob, filePath)
+
+	return bs.saveLocked()
+}
+
+// LinkTo places the content with the given checksum at the destination path.
+// The destination is a hard link to the blob, or a copy of it if linking isn't possible
+func (bs *BlobStore) LinkTo(checksum string, destination string) error {
+	bs.blobsMux.Lock()
+	defer bs.blobsMux.Unlock()
+
+	blob, _, found := bs.findLocked(checksum)
+	if !found {
+		return ErrBlobNotFound
+	}
+
+	if createErr := os.MkdirAll(filepath.Dir(destination), os.ModePerm); createErr != nil {
+		return createErr
+	}
+
+	// The blob is linked or copied next to the destination first,
+	// so an existing file is only replaced by the complete content
+	tempPath := fmt.Sprintf("%s.blob-%d", destination, time.Now().UnixNano())
+
+	if !blob.Owned {
+		// A blob that is a link to a file the user shares is never linked elsewhere,
+		// the destination gets a copy, which then takes the place of the blob
+		if copyErr := copyFile(bs.blobPath(checksum), tempPath); copyErr != nil {
+			return copyErr
+		}
+
+		if renameErr := os.Rename(tempPath, destination); renameErr != nil {
+			_ = os.Remove(tempPath)
+
+			return renameErr
+		}
+
+		return bs.adoptLocked(checksum, blob, destination)
+	}
+
+	linked := true
+	if linkErr := os.Link(bs.blobPath(checksum), tempPath); linkErr != nil {
+		linked = false
+
+		if copyErr := copyFile(bs.blobPath(checksum), tempPath); copyErr != nil {
+			return copyErr
+		}
+	}
+
+	if renameErr := os.Rename(tempPath, destination); renameErr != nil {
+		_ = os.Remove(tempPath)
+
+		return renameErr
+	}
+
+	if !linked {
+		return nil
+	}
+
+	if protectErr := bs.protectLocked(checksum); protectErr != nil {
+		bs.logger.Error(fmt.Sprintf("Unable to make blob %s read-only, %v", checksum, protectErr))
+	}
+
+	bs.addPathLocked(checksum, blob, destination)
+
+	return bs.saveLocked()
+}
+
+// RemoveUnused removes the blobs no workspace file links to anymore,
+// along with the blobs that were changed in place, and returns the number of removed blobs
+func (bs *BlobStore) RemoveUnused() int {
+	bs.blobsMux.Lock()
+	defer bs.blobsMux.Unlock()
+
+	removed := 0
+	changed := false
+	for checksum, blob := range bs.blobs {
+		_, blobInfo, found := bs.findLocked(checksum)
+		if !found {
+			// The blob was changed or removed
+			removed++
+			changed = true
+
+			continue
+		}
+
+		linkedPaths := make([]string, 0, len(blob.Paths))
+		for _, filePath := range blob.Paths {
+			info, statErr := os.Stat(filePath)
+			if statErr == nil && os.SameFile(info, blobInfo) {
+				linkedPaths = append(linkedPaths, filePath)
+
+				continue
+			}
+
+			delete(bs.pathIndex, filePath)
+			changed = true
+		}
+
+		blob.Paths = linkedPaths
+
+		if len(linkedPaths) == 0 {
+			bs.removeLocked(checksum)
+			removed++
+		}
+	}
+
+	if changed {
+		if saveErr := bs.saveLocked(); saveErr != nil {
+			bs.logger.Error(fmt.Sprintf("Unable to save blob index, %v", saveErr))
+		}
+	}
+
+	return removed
+}
+
+// createLocked stores the workspace file as the blob of its content.
+// Files the client created are made read-only along with the blob
+func (bs *BlobStore) createLocked(
+	checksum string,
+	filePath string,
+	info fs.FileInfo,
+	merkleTree *MerkleTree,
+	owned bool,
+) error {
+	if validateErr := validateBlobChecksum(checksum); validateErr != nil {
+		return validateErr
+	}
+
+	blobPath := bs.blobPath(checksum)
+	if createErr := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); createErr != nil {
+		return createErr
+	}
+
+	if linkErr := os.Link(filePath, blobPath); linkErr != nil {
+		return linkErr
+	}
+
+	blob := &blobEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Paths:   make([]string, 0, 1),
+		Owned:   owned,
+	}
+	bs.blobs[checksum] = blob
+
+	if owned {
+		if protectErr := bs.protectLocked(checksum); protectErr != nil {
+			bs.logger.Error(fmt.Sprintf("Unable to make blob %s read-only, %v", checksum, protectErr))
+		}
+	}
+
+	if leavesErr := bs.saveLeavesLocked(checksum, merkleTree); leavesErr != nil {
+		bs.logger.Error(fmt.Sprintf("Unable to save merkle tree of blob %s, %v", checksum, leavesErr))
+	}
+	bs.addPathLocked(checksum, blob, filePath)
+
+	return bs.saveLocked()
+}
+
+// adoptLocked makes the file the client created the blob, in place of the link to a file the user shares.
+// The shared file is left as it is, and is no longer linked to the blob
+func (bs *BlobStore) adoptLocked(checksum string, blob *blobEntry, filePath string) error {
+	blobPath := bs.blobPath(checksum)
+
+	same, compareErr := sameContent(filePath, blobPath)
+	if compareErr != nil {
+		return compareErr
+	}
+
+	if !same {
+		return fmt.Errorf("file %s doesn't match blob %s", filePath, checksum)
+	}
+
+	tempPath := fmt.Sprintf("%s.adopt-%d", blobPath, time.Now().UnixNano())
+	if linkErr := os.Link(filePath, tempPath); linkErr != nil {
+		return linkErr
+	}
+
+	if renameErr := os.Rename(tempPath, blobPath); renameErr != nil {
+		_ = os.Remove(tempPath)
+
+		return renameErr
+	}
+
+	for _, linkedPath := range blob.Paths {
+		if bs.pathIndex[linkedPath] == checksum {
+			delete(bs.pathIndex, linkedPath)
+		}
+	}
+
+	blob.Paths = make([]string, 0, 1)
+	blob.Owned = true
+
+	if protectErr := bs.protectLocked(checksum); protectErr != nil {
+		bs.logger.Error(fmt.Sprintf("Unable to make blob %s read-only, %v", checksum, protectErr))
+	}
+
+	blobInfo, statErr := os.Stat(blobPath)
+	if statErr != nil {
+		return statErr
+	}
+
+	blob.Size = blobInfo.Size()
+	blob.ModTime = blobInfo.ModTime().UnixNano()
+
+	bs.addPathLocked(checksum, blob, filePath)
+
+	return bs.saveLocked()
+}
+
+// replaceWithLinkLocked replaces the downloaded copy of the blob content with a link to the blob.
+// The copy is compared to the blob first, so a stale checksum never replaces a file with other content
+func (bs *BlobStore) replaceWithLinkLocked(checksum string, filePath string) error {
+	blobPath := bs.blobPath(checksum)
+
+	same, compareErr := sameContent(filePath, blobPath)
+	if compareErr != nil {
+		return compareErr
+	}
+
+	if !same {
+		return fmt.Errorf("file %s doesn't match blob %s", filePath, checksum)
+	}
+
+	if protectErr := bs.protectLocked(checksum); protectErr != nil {
+		return protectErr
+	}
+
+	// The link is created next to the file first, so the file is replaced in one step
+	tempPath := fmt.Sprintf("%s.blob-%d", filePath, time.Now().UnixNano())
+	if linkErr := os.Link(blobPath, tempPath); linkErr != nil {
+		return linkErr
+	}
+
+	if renameErr := os.Rename(tempPath, filePath); renameErr != nil {
+		_ = os.Remove(tempPath)
+
+		return renameErr
+	}
+
+	return nil
+}
+
+// protectLocked makes the blob, and with it every download linked to it, read-only.
+// Only blobs linked to files the client created are protected
+func (bs *BlobStore) protectLocked(checksum string) error {
+	blobPath := bs.blobPath(checksum)
+
+	blobInfo, statErr := os.Stat(blobPath)
+	if statErr != nil {
+		return statErr
+	}
+
+	if blobInfo.Mode().Perm()&0222 == 0 {
+		return nil
+	}
+
+	return os.Chmod(blobPath, blobInfo.Mode().Perm()&^0222)
+}
+
+// findLocked returns the blob with the given checksum, if its content is unchanged.
+// Blobs that were changed in place are dropped
+func (bs *BlobStore) findLocked(checksum string) (*blobEntry, fs.FileInfo, bool) {
+	blob, ok := bs.blobs[checksum]
+	if !ok {
+		return nil, nil, false
+	}
+
+	blobInfo, statErr := os.Stat(bs.blobPath(checksum))
+	if statErr != nil || blobInfo.Size() != blob.Size || blobInfo.ModTime().UnixNano() != blob.ModTime {
+		bs.removeLocked(checksum)
+
+		return nil, nil, false
+	}
+
+	return blob, blobInfo, true
+}
+
+// addPathLocked records the workspace file as a link to the blob
+func (bs *BlobStore) addPathLocked(checksum string, blob *blobEntry, filePath string) {
+	if previousChecksum, ok := bs.pathIndex[filePath]; ok && previousChecksum != checksum {
+		if previousBlob, found := bs.blobs[previousChecksum]; found {
+			previousBlob.Paths = removePath(previousBlob.Paths, filePath)
+		}
+	}
+
+	blob.Paths = append(removePath(blob.Paths, filePath), filePath)
+	bs.pathIndex[filePath] = checksum
+}
+
+// removeLocked removes the blob from the store
+func (bs *BlobStore) removeLocked(checksum string) {
+	blob, ok := bs.blobs[checksum]
+	if !ok {
+		return
+	}
+
+	for _, filePath := range blob.Paths {
+		if bs.pathIndex[filePath] == checksum {
+			delete(bs.pathIndex, filePath)
+		}
+	}
+
+	delete(bs.blobs, checksum)
+
+	if removeErr := os.Remove(bs.blobPath(checksum)); removeErr != nil && !os.IsNotExist(removeErr) {
+		bs.logger.Error(fmt.Sprintf("Unable to remove blob %s, %v", checksum, removeErr))
+	}
+
+	_ = os.Remove(bs.blobPath(checksum) + blobLeavesSuffix)
+}
+
+// saveLeavesLocked saves the leaves of the blob Merkle tree next to the blob, if they aren't saved yet
+func (bs *BlobStore) saveLeavesLocked(checksum string, merkleTree *MerkleTree) error {
+	if merkleTree == nil {
+		return nil
+	}
+
+	leavesPath := bs.blobPath(checksum) + blobLeavesSuffix
+	if _, statErr := os.Stat(leavesPath); statErr == nil {
+		return nil
+	}
+
+	if writeErr := os.WriteFile(leavesPath+".tmp", encodeMerkleLeaves(merkleTree), 0600); writeErr != nil {
+		return writeErr
+	}
+
+	return os.Rename(leavesPath+".tmp", leavesPath)
+}
+
+// saveLocked saves the blob index
+func (bs *BlobStore) saveLocked() error {
+	data, marshalErr := json.Marshal(bs.blobs)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	indexPath := filepath.Join(bs.dir, blobIndexFile)
+	if writeErr := os.WriteFile(indexPath+".tmp", data, 0600); writeErr != nil {
+		return writeErr
+	}
+
+	return os.Rename(indexPath+".tmp", indexPath)
+}
+
+// removePath removes the path from the list
+func removePath(paths []string, filePath string) []string {
+	filtered := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path != filePath {
+			filtered = append(filtered, path)
+		}
+	}
+
+	return filtered
+}
+
+// copyFile copies the file at the source path to the destination path
+func copyFile(sourcePath string, destination string) error {
+	input, openErr := os.Open(sourcePath)
+	if openErr != nil {
+		return openErr
+	}
+	defer input.Close()
+
+	output, createErr := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if createErr != nil {
+		return createErr
+	}
+
+	_, copyErr := io.Copy(output, input)
+	closeErr := output.Close()
+
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+
+	if copyErr != nil {
+		_ = os.Remove(destination)
+	}
+
+	return copyErr
+}
+
+// sameContent compares the content of the two files
+func sameContent(firstPath string, secondPath string) (bool, error) {
+	first, openErr := os.Open(firstPath)
+	if openErr != nil {
+		return false, openErr
+	}
+	defer first.Close()
+
+	second, openErr := os.Open(secondPath)
+	if openErr != nil {
+		return false, openErr
+	}
+	defer second.Close()
+
+	firstBuf := make([]byte, 64*1024)
+	secondBuf := make([]byte, 64*1024)
+
+	for {
+		firstRead, firstErr := io.ReadFull(first, firstBuf)
+		secondRead, secondErr := io.ReadFull(second, secondBuf)
+
+		if !bytes.Equal(firstBuf[:firstRead], secondBuf[:secondRead]) {
+			return false, nil
+		}
+
+		firstDone := firstErr == io.EOF || firstErr == io.ErrUnexpectedEOF
+		secondDone := secondErr == io.EOF || secondErr == io.ErrUnexpectedEOF
+
+		if firstErr != nil && !firstDone {
+			return false, firstErr
+		}
+
+		if secondErr != nil && !secondDone {
+			return false, secondErr
+		}
+
+		if firstDone || secondDone {
+			return firstDone && secondDone, nil
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestFile writes the content to a new file in the directory
+func writeTestFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(dir, name)
+	if writeErr := os.WriteFile(filePath, []byte(content), 0600); writeErr != nil {
+		t.Fatalf("Unable to write test file, %v", writeErr)
+	}
+
+	return filePath
+}
+
+func TestBlobStore_LinkTo(t *testing.T) {
+	dir := t.TempDir()
+
+	store, openErr := NewBlobStore(hclog.NewNullLogger(), filepath.Join(dir, "blobs"))
+	assert.NoError(t, openErr)
+
+	sourcePath := writeTestFile(t, dir, "shared.txt", "shared content")
+	checksum, merkleTree, checksumErr := (&FileLister{}).checksumFile(sourcePath)
+	assert.NoError(t, checksumErr)
+
+	assert.False(t, store.Has(checksum))
+	assert.NoError(t, store.Add(sourcePath, checksum, merkleTree))
+	assert.True(t, store.Has(checksum))
+
+	// Another workspace gets a copy of the shared file, which takes its place as the blob,
+	// so the shared file is never linked outside of its workspace
+	destination := filepath.Join(dir, "other", "shared.txt")
+	assert.NoError(t, store.LinkTo(checksum, destination))
+
+	sourceInfo, _ := os.Stat(sourcePath)
+	destinationInfo, _ := os.Stat(destination)
+	assert.False(t, os.SameFile(sourceInfo, destinationInfo))
+	assert.Equal(t, os.FileMode(0600), sourceInfo.Mode().Perm())
+
+	// Further workspaces get the content without a copy
+	linkedPath := filepath.Join(dir, "third", "shared.txt")
+	assert.NoError(t, store.LinkTo(checksum, linkedPath))
+
+	linkedInfo, _ := os.Stat(linkedPath)
+	assert.True(t, os.SameFile(destinationInfo, linkedInfo))
+	assert.Equal(t, os.FileMode(0400), linkedInfo.Mode().Perm())
+
+	// The linked file is known without hashing it again
+	foundChecksum, foundTree, found := store.Lookup(destination, destinationInfo)
+	assert.True(t, found)
+	assert.Equal(t, checksum, foundChecksum)
+	assert.Equal(t, merkleTree.Root(), foundTree.Root())
+
+	// The index survives a restart
+	reopened, reopenErr := NewBlobStore(hclog.NewNullLogger(), filepath.Join(dir, "blobs"))
+	assert.NoError(t, reopenErr)
+	assert.True(t, reopened.Has(checksum))
+
+	// So do the Merkle trees, which are kept next to the blobs
+	_, reopenedTree, reopenedFound := reopened.Lookup(destination, destinationInfo)
+	assert.True(t, reopenedFound)
+	assert.Equal(t, merkleTree.Root(), reopenedTree.Root())
+
+	assert.ErrorIs(t, store.LinkTo("unknown", filepath.Join(dir, "unknown.txt")), ErrBlobNotFound)
+}
+
+func TestBlobStore_Deduplicate(t *testing.T) {
+	testTable := []struct {
+		name           string
+		downloaded     bool
+		copyContent    string
+		expectedLinked bool
+		expectedErr    bool
+	}{
+		{
+			"Shared copy of the same content",
+			false,
+			"shared content",
+			false,
+			false,
+		},
+		{
+			"Downloaded copy of the same content",
+			true,
+			"shared content",
+			true,
+			false,
+		},
+		{
+			"Downloaded file with different content under the same checksum",
+			true,
+			"other content",
+			false,
+			true,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			store, openErr := NewBlobStore(hclog.NewNullLogger(), filepath.Join(dir, "blobs"))
+			assert.NoError(t, openErr)
+
+			sourcePath := writeTestFile(t, dir, "shared.txt", "shared content")
+			checksum, merkleTree, _ := (&FileLister{}).checksumFile(sourcePath)
+			assert.NoError(t, store.Add(sourcePath, checksum, merkleTree))
+
+			// A download already in the store is linked to the blob
+			downloadPath := filepath.Join(dir, "download.txt")
+			assert.NoError(t, store.LinkTo(checksum, downloadPath))
+
+			// The same content is shared or downloaded in another workspace
+			copyPath := writeTestFile(t, dir, "copy.txt", testCase.copyContent)
+
+			addFn := store.Add
+			if testCase.downloaded {
+				addFn = store.AddDownload
+			}
+
+			addErr := addFn(copyPath, checksum, merkleTree)
+			assert.Equal(t, testCase.expectedErr, addErr != nil)
+
+			downloadInfo, _ := os.Stat(downloadPath)
+			copyInfo, _ := os.Stat(copyPath)
+			assert.Equal(t, testCase.expectedLinked, os.SameFile(downloadInfo, copyInfo))
+
+			content, _ := os.ReadFile(copyPath)
+			assert.Equal(t, testCase.copyContent, string(content))
+
+			_, _, found := store.Lookup(copyPath, copyInfo)
+			assert.Equal(t, testCase.expectedLinked, found)
+
+			// Only the files the client created are made read-only
+			sourceInfo, _ := os.Stat(sourcePath)
+			assert.Equal(t, os.FileMode(0600), sourceInfo.Mode().Perm())
+			assert.Equal(t, os.FileMode(0400), downloadInfo.Mode().Perm())
+
+			if testCase.expectedLinked {
+				assert.Equal(t, os.FileMode(0400), copyInfo.Mode().Perm())
+			} else {
+				assert.Equal(t, os.FileMode(0600), copyInfo.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestBlobStore_RemoveUnused(t *testing.T) {
+	testTable := []struct {
+		name            string
+		changeFn        func(t *testing.T, paths []string)
+		expectedRemoved int
+	}{
+		{
+			"All links in place",
+			func(t *testing.T, paths []string) {},
+			0,
+		},
+		{
+			"One link removed",
+			func(t *testing.T, paths []string) {
+				assert.NoError(t, os.Remove(paths[1]))
+			},
+			0,
+		},
+		{
+			"All links removed",
+			func(t *testing.T, paths []string) {
+				for _, filePath := range paths {
+					assert.NoError(t, os.Remove(filePath))
+				}
+			},
+			1,
+		},
+		{
+			"Content changed in place",
+			func(t *testing.T, paths []string) {
+				// Linked files are read-only, the user has to make them writable first
+				assert.NoError(t, os.Chmod(paths[1], 0600))
+				assert.NoError(t, os.WriteFile(paths[1], []byte("changed content"), 0600))
+			},
+			1,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			store, openErr := NewBlobStore(hclog.NewNullLogger(), filepath.Join(dir, "blobs"))
+			assert.NoError(t, openErr)
+
+			sourcePath := writeTestFile(t, dir, "shared.txt", "shared content")
+			checksum, merkleTree, _ := (&FileLister{}).checksumFile(sourcePath)
+			assert.NoError(t, store.Add(sourcePath, checksum, merkleTree))
+
+			// The first download takes the place of the shared file as the blob
+			downloadPath := filepath.Join(dir, "download.txt")
+			assert.NoError(t, store.LinkTo(checksum, downloadPath))
+
+			linkedPath := filepath.Join(dir, "linked.txt")
+			assert.NoError(t, store.LinkTo(checksum, linkedPath))
+
+			testCase.changeFn(t, []string{downloadPath, linkedPath})
+
+			assert.Equal(t, testCase.expectedRemoved, store.RemoveUnused())
+			assert.Equal(t, testCase.expectedRemoved == 0, store.Has(checksum))
+		})
+	}
+}
+
+func TestBlobStore_InvalidChecksum(t *testing.T) {
+	dir := t.TempDir()
+
+	store, openErr := NewBlobStore(hclog.NewNullLogger(), filepath.Join(dir, "blobs"))
+	assert.NoError(t, openErr)
+
+	sourcePath := writeTestFile(t, dir, "shared.txt", "shared content")
+
+	// Blob paths are derived from the checksum, so malformed checksums never make it into the store
+	assert.Error(t, store.Add(sourcePath, "../escaped", nil))
+	assert.Error(t, store.AddDownload(sourcePath, "../escaped", nil))
+	assert.False(t, store.Has("../escaped"))
+
+	_, statErr := os.Stat(filepath.Join(dir, "escaped"))
+	assert.True(t, os.IsNotExist(statErr))
+}
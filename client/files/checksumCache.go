@@ -0,0 +1,253 @@
+package files
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+var errInvalidMerkleLeaves = errors.New("invalid cached merkle leaves")
+
+// ChecksumCache persists the checksums of the shared files,
+// so files that didn't change aren't hashed again, even after a restart
+type ChecksumCache interface {
+	GetChecksumEntry(path string) (*types.ChecksumCacheEntry, error)
+	SaveChecksumEntry(entry types.ChecksumCacheEntry) error
+	DeleteChecksumEntries(path string) error
+}
+
+// SetChecksumCache sets the cache of the file checksums.
+// It needs to be set before the file lister is started
+func (fl *FileLister) SetChecksumCache(cache ChecksumCache) {
+	fl.checksumCache = cache
+}
+
+// Rehash drops the cached checksums of the shared files, and sweeps the directory,
+// hashing every file again. The sweep runs in the background
+func (fl *FileLister) Rehash() error {
+	if fl.checksumCache != nil {
+		if deleteErr := fl.checksumCache.DeleteChecksumEntries(fl.baseDir); deleteErr != nil {
+			return deleteErr
+		}
+	}
+
+	fl.rehashRequested.Store(true)
+
+	go fl.sweepDirectory()
+
+	return nil
+}
+
+// getCachedChecksum returns the cached checksum and Merkle tree of the file,
+// if the file didn't change since it was cached
+func (fl *FileLister) getCachedChecksum(path string, info fs.FileInfo) (string, *MerkleTree, bool) {
+	entry := fl.getValidChecksumEntry(path, info)
+	if entry == nil || !fl.isOwnChecksum(entry.Checksum) {
+		return "", nil, false
+	}
+
+	merkleTree, decodeErr := decodeMerkleLeaves(entry.MerkleLeaves)
+	if decodeErr != nil {
+		return "", nil, false
+	}
+
+	return entry.Checksum, merkleTree, true
+}
+
+// getValidChecksumEntry returns the cached checksum entry of the file,
+// if the file didn't change since it was cached
+func (fl *FileLister) getValidChecksumEntry(path string, info fs.FileInfo) *types.ChecksumCacheEntry {
+	if fl.checksumCache == nil {
+		return nil
+	}
+
+	entry, getErr := fl.checksumCache.GetChecksumEntry(path)
+	if getErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to read cached checksum of %s, %v", path, getErr))
+
+		return nil
+	}
+
+	if entry == nil ||
+		entry.Size != info.Size() ||
+		entry.ModTime != info.ModTime().UnixNano() ||
+		entry.Inode != fileInode(info) {
+		return nil
+	}
+
+	return entry
+}
+
+// loadMerkleTree loads the Merkle tree of the file with the given checksum from the blob store
+// or the checksum cache. Files missing from both are hashed again, and cached
+func (fl *FileLister) loadMerkleTree(path string, checksum string) *MerkleTree {
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return nil
+	}
+
+	if fl.blobStore != nil {
+		if blobChecksum, merkleTree, found := fl.blobStore.Lookup(path, info); found && blobChecksum == checksum {
+			return merkleTree
+		}
+	}
+
+	if entry := fl.getValidChecksumEntry(path, info); entry != nil && entry.Checksum == checksum {
+		if merkleTree, decodeErr := decodeMerkleLeaves(entry.MerkleLeaves); decodeErr == nil {
+			return merkleTree
+		}
+	}
+
+	fileChecksum, merkleTree, hashErr := hashFile(path, ChecksumAlgorithm(checksum))
+	if hashErr != nil || !SameChecksum(fileChecksum, checksum) {
+		fl.logger.Error(fmt.Sprintf("Unable to load the merkle tree of %s", path))
+
+		return nil
+	}
+
+	fl.saveCachedChecksum(path, info, fileChecksum, merkleTree)
+
+	return merkleTree
+}
+
+// saveCachedChecksum caches the checksum and Merkle tree of the file
+func (fl *FileLister) saveCachedChecksum(path string, info fs.FileInfo, checksum string, merkleTree *MerkleTree) {
+	if fl.checksumCache == nil {
+		return
+	}
+
+	saveErr := fl.checksumCache.SaveChecksumEntry(types.ChecksumCacheEntry{
+		Path:         path,
+		Size:         info.Size(),
+		ModTime:      info.ModTime().UnixNano(),
+		Inode:        fileInode(info),
+		Checksum:     checksum,
+		MerkleLeaves: encodeMerkleLeaves(merkleTree),
+	})
+	if saveErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to cache checksum of %s, %v", path, saveErr))
+	}
+}
+
+// forgetCachedChecksums drops the cached checksums of the file at the path,
+// or of all files under it if the path is a directory
+func (fl *FileLister) forgetCachedChecksums(path string) {
+	if fl.checksumCache == nil {
+		return
+	}
+
+	if deleteErr := fl.checksumCache.DeleteChecksumEntries(path); deleteErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to drop cached checksums of %s, %v", path, deleteErr))
+	}
+}
+
+// encodeMerkleLeaves joins the leaf hashes of the tree
+func encodeMerkleLeaves(merkleTree *MerkleTree) []byte {
+	leaves := make([]byte, 0, merkleTree.NumLeaves()*sha256.Size)
+	for _, leaf := range merkleTree.levels[0] {
+		leaves = append(leaves, leaf...)
+	}
+
+	return leaves
+}
+
+// decodeMerkleLeaves rebuilds the tree out of the joined leaf hashes
+func decodeMerkleLeaves(data []byte) (*MerkleTree, error) {
+	if len(data) == 0 || len(data)%sha256.Size != 0 {
+		return nil, errInvalidMerkleLeaves
+	}
+
+	leaves := make([][]byte, 0, len(data)/sha256.Size)
+	for offset := 0; offset < len(data); offset += sha256.Size {
+		leaves = append(leaves, data[offset:offset+sha256.Size])
+	}
+
+	return NewMerkleTree(leaves), nil
+}
+
+// recentTreesSize is the number of Merkle trees held in memory
+const recentTreesSize = 8
+
+// recentTrees holds the most recently used Merkle trees,
+// so files that are being downloaded don't load their tree for every request
+type recentTrees struct {
+	trees map[string]*MerkleTree // checksum -> merkle tree
+	order []string               // checksums, from the least recently used
+	mux   sync.Mutex
+}
+
+func newRecentTrees() *recentTrees {
+	return &recentTrees{
+		trees: make(map[string]*MerkleTree),
+		order: make([]string, 0, recentTreesSize),
+	}
+}
+
+// get returns the Merkle tree of the checksum, if it is held
+func (rt *recentTrees) get(checksum string) (*MerkleTree, bool) {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	merkleTree, ok := rt.trees[checksum]
+	if ok {
+		rt.touchLocked(checksum)
+	}
+
+	return merkleTree, ok
+}
+
+// add holds the Merkle tree of the checksum, evicting the least recently used tree
+func (rt *recentTrees) add(checksum string, merkleTree *MerkleTree) {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	if _, ok := rt.trees[checksum]; ok {
+		rt.trees[checksum] = merkleTree
+		rt.touchLocked(checksum)
+
+		return
+	}
+
+	if len(rt.order) >= recentTreesSize {
+		delete(rt.trees, rt.order[0])
+		rt.order = rt.order[1:]
+	}
+
+	rt.trees[checksum] = merkleTree
+	rt.order = append(rt.order, checksum)
+}
+
+// remove drops the Merkle tree of the checksum
+func (rt *recentTrees) remove(checksum string) {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	if _, ok := rt.trees[checksum]; !ok {
+		return
+	}
+
+	delete(rt.trees, checksum)
+	rt.removeOrderLocked(checksum)
+}
+
+// touchLocked marks the checksum as the most recently used one
+func (rt *recentTrees) touchLocked(checksum string) {
+	rt.removeOrderLocked(checksum)
+	rt.order = append(rt.order, checksum)
+}
+
+// removeOrderLocked drops the checksum from the usage order
+func (rt *recentTrees) removeOrderLocked(checksum string) {
+	for index, ordered := range rt.order {
+		if ordered == checksum {
+			rt.order = append(rt.order[:index], rt.order[index+1:]...)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package files
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// mockChecksumCache is an in-memory checksum cache
+type mockChecksumCache struct {
+	entries map[string]types.ChecksumCacheEntry
+	mux     sync.Mutex
+}
+
+func newMockChecksumCache() *mockChecksumCache {
+	return &mockChecksumCache{
+		entries: make(map[string]types.ChecksumCacheEntry),
+	}
+}
+
+func (m *mockChecksumCache) GetChecksumEntry(path string) (*types.ChecksumCacheEntry, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	entry, ok := m.entries[path]
+	if !ok {
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+func (m *mockChecksumCache) SaveChecksumEntry(entry types.ChecksumCacheEntry) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.entries[entry.Path] = entry
+
+	return nil
+}
+
+func (m *mockChecksumCache) DeleteChecksumEntries(path string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for entryPath := range m.entries {
+		if entryPath == path || strings.HasPrefix(entryPath, path+"/") {
+			delete(m.entries, entryPath)
+		}
+	}
+
+	return nil
+}
+
+func TestFileLister_ChecksumCache(t *testing.T) {
+	// A checksum the file doesn't hash to, so cache hits can be told apart
+	cachedChecksum, _ := EncodeFileChecksum(config.HASH_ALGORITHM_SHA2_256, make([]byte, sha256.Size))
+
+	testTable := []struct {
+		name           string
+		changeFn       func(t *testing.T, filePath string)
+		skipLookups    bool
+		expectedCached bool
+	}{
+		{
+			"File unchanged",
+			func(t *testing.T, filePath string) {},
+			false,
+			true,
+		},
+		{
+			"File content changed",
+			func(t *testing.T, filePath string) {
+				assert.NoError(t, os.WriteFile(filePath, []byte("changed content"), 0600))
+			},
+			false,
+			false,
+		},
+		{
+			"File modification time changed",
+			func(t *testing.T, filePath string) {
+				modTime := time.Now().Add(-time.Hour)
+				assert.NoError(t, os.Chtimes(filePath, modTime, modTime))
+			},
+			false,
+			false,
+		},
+		{
+			"File replaced",
+			func(t *testing.T, filePath string) {
+				// Same size and modification time, but a different file
+				info, _ := os.Stat(filePath)
+				replacementPath := writeTestFile(t, filepath.Dir(filePath), "replacement.txt", "shared CONTENT")
+				assert.NoError(t, os.Chtimes(replacementPath, info.ModTime(), info.ModTime()))
+				assert.NoError(t, os.Rename(replacementPath, filePath))
+			},
+			false,
+			runtime.GOOS == "windows", // inodes are only checked where the platform has them
+		},
+		{
+			"Rehash requested",
+			func(t *testing.T, filePath string) {},
+			true,
+			false,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cache := newMockChecksumCache()
+
+			fileLister := NewFileLister(hclog.NewNullLogger(), dir, time.Hour)
+			fileLister.SetChecksumCache(cache)
+
+			filePath := writeTestFile(t, dir, "shared.txt", "shared content")
+			info, _ := os.Stat(filePath)
+
+			// The cached checksum is returned without hashing the file
+			checksum, merkleTree, _ := fileLister.checksumFile(filePath)
+			fileLister.saveCachedChecksum(filePath, info, cachedChecksum, merkleTree)
+
+			testCase.changeFn(t, filePath)
+			fileLister.skipLookups = testCase.skipLookups
+
+			info, _ = os.Stat(filePath)
+			foundChecksum, foundTree, checksumErr := fileLister.checksumStoredFile(filePath, info)
+			assert.NoError(t, checksumErr)
+
+			if testCase.expectedCached {
+				assert.Equal(t, cachedChecksum, foundChecksum)
+				assert.Equal(t, merkleTree.Root(), foundTree.Root())
+
+				return
+			}
+
+			assert.NotEqual(t, cachedChecksum, foundChecksum)
+
+			// The new checksum replaces the stale one
+			entry, _ := cache.GetChecksumEntry(filePath)
+			assert.Equal(t, foundChecksum, entry.Checksum)
+
+			if !testCase.skipLookups && foundChecksum != checksum {
+				assert.NotEqual(t, merkleTree.Root(), foundTree.Root())
+			}
+		})
+	}
+}
+
+func TestMerkleLeaves_Encoding(t *testing.T) {
+	testTable := []struct {
+		name      string
+		leaves    [][]byte
+		encoded   []byte
+		expectErr bool
+	}{
+		{
+			"Single leaf",
+			[][]byte{HashMerkleLeaf([]byte("first"))},
+			nil,
+			false,
+		},
+		{
+			"Multiple leaves",
+			[][]byte{
+				HashMerkleLeaf([]byte("first")),
+				HashMerkleLeaf([]byte("second")),
+				HashMerkleLeaf([]byte("third")),
+			},
+			nil,
+			false,
+		},
+		{
+			"No leaves",
+			nil,
+			[]byte{},
+			true,
+		},
+		{
+			"Truncated leaf",
+			nil,
+			[]byte("truncated"),
+			true,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			encoded := testCase.encoded
+			var merkleTree *MerkleTree
+			if testCase.leaves != nil {
+				merkleTree = NewMerkleTree(testCase.leaves)
+				encoded = encodeMerkleLeaves(merkleTree)
+			}
+
+			decodedTree, decodeErr := decodeMerkleLeaves(encoded)
+			if testCase.expectErr {
+				assert.ErrorIs(t, decodeErr, errInvalidMerkleLeaves)
+
+				return
+			}
+
+			assert.NoError(t, decodeErr)
+			assert.Equal(t, merkleTree.Root(), decodedTree.Root())
+			assert.Equal(t, merkleTree.NumLeaves(), decodedTree.NumLeaves())
+		})
+	}
+}
+
+func TestFileLister_GetMerkleTree(t *testing.T) {
+	dir := t.TempDir()
+	cache := newMockChecksumCache()
+
+	fileLister := NewFileLister(hclog.NewNullLogger(), dir, time.Hour)
+	fileLister.SetChecksumCache(cache)
+
+	filePath := writeTestFile(t, dir, "shared.txt", "shared content")
+	info, _ := os.Stat(filePath)
+
+	checksum, merkleTree, checksumErr := fileLister.checksumStoredFile(filePath, info)
+	assert.NoError(t, checksumErr)
+
+	fileLister.addFile(&proto.File{Name: "shared", Extension: ".txt", FileChecksum: checksum}, checksum)
+
+	// The tree isn't held in memory until it is requested
+	_, held := fileLister.recentTrees.get(checksum)
+	assert.False(t, held)
+
+	loadedTree := fileLister.GetMerkleTree(checksum)
+	assert.NotNil(t, loadedTree)
+	assert.Equal(t, merkleTree.Root(), loadedTree.Root())
+
+	_, held = fileLister.recentTrees.get(checksum)
+	assert.True(t, held)
+
+	// Without a cached entry, the file is hashed again and cached
+	fileLister.recentTrees.remove(checksum)
+	assert.NoError(t, cache.DeleteChecksumEntries(filePath))
+
+	loadedTree = fileLister.GetMerkleTree(checksum)
+	assert.NotNil(t, loadedTree)
+	assert.Equal(t, merkleTree.Root(), loadedTree.Root())
+
+	entry, _ := cache.GetChecksumEntry(filePath)
+	assert.NotNil(t, entry)
+
+	// Removed files have no tree
+	fileLister.removeFile(checksum)
+	assert.Nil(t, fileLister.GetMerkleTree(checksum))
+}
+
+func TestRecentTrees_Eviction(t *testing.T) {
+	trees := newRecentTrees()
+
+	for index := 0; index < recentTreesSize; index++ {
+		trees.add(fmt.Sprintf("checksum-%d", index), NewMerkleTree([][]byte{HashMerkleLeaf([]byte{byte(index)})}))
+	}
+
+	// Using the oldest tree keeps it over the next one
+	_, held := trees.get("checksum-0")
+	assert.True(t, held)
+
+	trees.add("checksum-new", NewMerkleTree([][]byte{HashMerkleLeaf([]byte("new"))}))
+
+	_, held = trees.get("checksum-0")
+	assert.True(t, held)
+
+	_, held = trees.get("checksum-1")
+	assert.False(t, held)
+
+	assert.Len(t, trees.trees, recentTreesSize)
+	assert.Len(t, trees.order, recentTreesSize)
+}
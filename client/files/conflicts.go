@@ -0,0 +1,109 @@
+package files
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zivkovicmilos/peer_drop/proto"
+)
+
+// conflictChecksumLength is the number of checksum characters in conflict file names
+const conflictChecksumLength = 8
+
+// FileConflict groups the different files peers share under the same relative path
+type FileConflict struct {
+	RelativePath string
+	Files        []*proto.File // sorted by checksum
+}
+
+// FindConflicts groups the files by their relative path, and returns the groups
+// where peers share different files under the same path, sorted by path.
+// Retained versions, and files that are older versions of other files in the group, are not conflicts
+func FindConflicts(fileList []*proto.File) []FileConflict {
+	groups := make(map[string][]*proto.File)
+	for _, file := range fileList {
+		if file.Retained {
+			continue
+		}
+
+		relativePath := JoinRelativePath(file.Path, fmt.Sprintf("%s%s", file.Name, file.Extension))
+		groups[relativePath] = append(groups[relativePath], file)
+	}
+
+	conflicts := make([]FileConflict, 0)
+	for relativePath, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+
+		replaced := make(map[string]bool)
+		for _, file := range group {
+			if file.PreviousChecksum != "" {
+				replaced[file.PreviousChecksum] = true
+			}
+		}
+
+		seen := make(map[string]bool)
+		conflicting := make([]*proto.File, 0, len(group))
+		for _, file := range group {
+			if replaced[file.FileChecksum] || seen[file.FileChecksum] {
+				continue
+			}
+
+			seen[file.FileChecksum] = true
+			conflicting = append(conflicting, file)
+		}
+
+		if len(conflicting) < 2 {
+			continue
+		}
+
+		sort.Slice(conflicting, func(i, j int) bool {
+			return conflicting[i].FileChecksum < conflicting[j].FileChecksum
+		})
+
+		conflicts = append(conflicts, FileConflict{
+			RelativePath: relativePath,
+			Files:        conflicting,
+		})
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].RelativePath < conflicts[j].RelativePath
+	})
+
+	return conflicts
+}
+
+// ConflictingChecksums returns the checksums of all files that are in conflict
+func ConflictingChecksums(conflicts []FileConflict) map[string]bool {
+	checksums := make(map[string]bool)
+	for _, conflict := range conflicts {
+		for _, file := range conflict.Files {
+			checksums[file.FileChecksum] = true
+		}
+	}
+
+	return checksums
+}
+
+// ConflictFileName returns the name a conflicting file is saved under.
+// The name is derived from the checksum digest, so every peer picks the same one.
+// The multihash prefix is left out, as it's the same for all files of an algorithm
+func ConflictFileName(fileName string, checksum string) string {
+	extension := filepath.Ext(fileName)
+
+	suffix := checksum
+	if fileChecksum, parseErr := ParseFileChecksum(checksum); parseErr == nil {
+		suffix = hex.EncodeToString(fileChecksum.Digest)
+	}
+
+	if len(suffix) > conflictChecksumLength {
+		suffix = suffix[:conflictChecksumLength]
+	}
+
+	return fmt.Sprintf("%s.conflict-%s%s", strings.TrimSuffix(fileName, extension), suffix, extension)
+}
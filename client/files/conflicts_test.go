@@ -0,0 +1,132 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestFindConflicts(t *testing.T) {
+	testTable := []struct {
+		name              string
+		fileList          []*proto.File
+		expectedConflicts map[string][]string // relative path -> checksums
+	}{
+		{
+			"Different files under the same name",
+			[]*proto.File{
+				{Name: "report", Extension: ".pdf", FileChecksum: "b"},
+				{Name: "report", Extension: ".pdf", FileChecksum: "a"},
+				{Name: "notes", Extension: ".txt", FileChecksum: "c"},
+			},
+			map[string][]string{"report.pdf": {"a", "b"}},
+		},
+		{
+			"Same name in different directories",
+			[]*proto.File{
+				{Name: "report", Extension: ".pdf", Path: "2021", FileChecksum: "a"},
+				{Name: "report", Extension: ".pdf", Path: "2022", FileChecksum: "b"},
+			},
+			map[string][]string{},
+		},
+		{
+			"Older version of the file",
+			[]*proto.File{
+				{Name: "report", Extension: ".pdf", FileChecksum: "a"},
+				{Name: "report", Extension: ".pdf", FileChecksum: "b", PreviousChecksum: "a"},
+			},
+			map[string][]string{},
+		},
+		{
+			"Retained version of the file",
+			[]*proto.File{
+				{Name: "report", Extension: ".pdf", FileChecksum: "a", Retained: true},
+				{Name: "report", Extension: ".pdf", FileChecksum: "b"},
+			},
+			map[string][]string{},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			conflicts := make(map[string][]string)
+			for _, conflict := range FindConflicts(testCase.fileList) {
+				checksums := make([]string, 0)
+				for _, file := range conflict.Files {
+					checksums = append(checksums, file.FileChecksum)
+				}
+
+				conflicts[conflict.RelativePath] = checksums
+			}
+
+			assert.Equal(t, testCase.expectedConflicts, conflicts)
+		})
+	}
+}
+
+func TestConflictFileName(t *testing.T) {
+	sha256Digest := sha256.Sum256([]byte("shared content"))
+	otherDigest := sha256.Sum256([]byte("other content"))
+	blake2bDigest := blake2b.Sum256([]byte("shared content"))
+	otherBlake2bDigest := blake2b.Sum256([]byte("other content"))
+
+	testTable := []struct {
+		name         string
+		fileName     string
+		checksum     string
+		expectedName string
+	}{
+		{
+			"SHA256 multihash",
+			"report.pdf",
+			"1220" + hex.EncodeToString(sha256Digest[:]),
+			"report.conflict-" + hex.EncodeToString(sha256Digest[:4]) + ".pdf",
+		},
+		{
+			"BLAKE2b multihash",
+			"report.pdf",
+			"a0e40220" + hex.EncodeToString(blake2bDigest[:]),
+			"report.conflict-" + hex.EncodeToString(blake2bDigest[:4]) + ".pdf",
+		},
+		{
+			"Legacy SHA256 checksum",
+			"report.pdf",
+			hex.EncodeToString(sha256Digest[:]),
+			"report.conflict-" + hex.EncodeToString(sha256Digest[:4]) + ".pdf",
+		},
+		{
+			"No extension",
+			"Makefile",
+			"1220" + hex.EncodeToString(sha256Digest[:]),
+			"Makefile.conflict-" + hex.EncodeToString(sha256Digest[:4]),
+		},
+		{
+			"Undecodable checksum",
+			"Makefile",
+			"ab",
+			"Makefile.conflict-ab",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedName, ConflictFileName(testCase.fileName, testCase.checksum))
+		})
+	}
+
+	// Different files hashed with the same algorithm don't share a name
+	assert.NotEqual(
+		t,
+		ConflictFileName("report.pdf", "1220"+hex.EncodeToString(sha256Digest[:])),
+		ConflictFileName("report.pdf", "1220"+hex.EncodeToString(otherDigest[:])),
+	)
+	assert.NotEqual(
+		t,
+		ConflictFileName("report.pdf", "a0e40220"+hex.EncodeToString(blake2bDigest[:])),
+		ConflictFileName("report.pdf", "a0e40220"+hex.EncodeToString(otherBlake2bDigest[:])),
+	)
+}
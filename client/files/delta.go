@@ -0,0 +1,448 @@
+package files
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// MinDeltaBlockSize is the smallest block size used for delta signatures
+	MinDeltaBlockSize = 2 * 1024 // 2 KiB
+
+	// MaxDeltaBlockSize is the largest block size used for delta signatures
+	MaxDeltaBlockSize = 1024 * 1024 // 1 MiB
+
+	// MaxDeltaSignatures is the largest number of block signatures in a single delta request
+	MaxDeltaSignatures = 64 * 1024
+
+	// StrongHashSize is the size of the truncated block hash.
+	// Collisions are caught by the checksum of the rebuilt file
+	StrongHashSize = 16
+)
+
+var (
+	ErrInvalidDeltaOp   = errors.New("invalid delta operation")
+	ErrInvalidBlockSize = errors.New("invalid delta block size")
+)
+
+// BlockSignature is the signature of a single block of the previous file version
+type BlockSignature struct {
+	Weak   uint32
+	Strong []byte
+}
+
+// DeltaOp is a single step of rebuilding a file out of its previous version.
+// It either copies BlockCount blocks of the previous version, or holds literal data
+type DeltaOp struct {
+	BlockIndex int64
+	BlockCount int64
+	Data       []byte
+}
+
+// DeltaBlockSize picks the block size for a previous version of the given size.
+// The block size grows with the file, so the signatures stay small
+func DeltaBlockSize(fileSize int64) int {
+	blockSize := int64(math.Sqrt(float64(fileSize)))
+
+	// Keep the number of signatures in check
+	if minSize := (fileSize + MaxDeltaSignatures - 1) / MaxDeltaSignatures; blockSize < minSize {
+		blockSize = minSize
+	}
+
+	// Round up to a whole KiB
+	blockSize = (blockSize + 1023) / 1024 * 1024
+
+	if blockSize < MinDeltaBlockSize {
+		return MinDeltaBlockSize
+	}
+
+	if blockSize > MaxDeltaBlockSize {
+		return MaxDeltaBlockSize
+	}
+
+	return int(blockSize)
+}
+
+// ValidateDeltaBlockSize checks if the block size is within the allowed bounds
+func ValidateDeltaBlockSize(blockSize int64) error {
+	if blockSize < MinDeltaBlockSize || blockSize > MaxDeltaBlockSize {
+		return ErrInvalidBlockSize
+	}
+
+	return nil
+}
+
+// weakChecksum is the rsync rolling checksum of a block
+type weakChecksum struct {
+	a, b uint32
+	size uint32
+}
+
+// newWeakChecksum computes the rolling checksum of the block
+func newWeakChecksum(block []byte) weakChecksum {
+	wc := weakChecksum{size: uint32(len(block))}
+
+	for i, value := range block {
+		wc.a += uint32(value)
+		wc.b += uint32(len(block)-i) * uint32(value)
+	}
+
+	return wc
+}
+
+// roll moves the checksum window one byte forward
+func (wc *weakChecksum) roll(out byte, in byte) {
+	wc.a += uint32(in) - uint32(out)
+	wc.b += wc.a - wc.size*uint32(out)
+}
+
+// sum returns the checksum value
+func (wc *weakChecksum) sum() uint32 {
+	return (wc.a & 0xffff) | (wc.b << 16)
+}
+
+// strongHash returns the truncated SHA256 hash of the block
+func strongHash(block []byte) []byte {
+	hash := sha256.Sum256(block)
+
+	return hash[:StrongHashSize]
+}
+
+// NumDeltaBlocks returns the number of blocks a file of the given size is split into
+func NumDeltaBlocks(fileSize int64, blockSize int) int64 {
+	return (fileSize + int64(blockSize) - 1) / int64(blockSize)
+}
+
+// ComputeSignatures signs every block of the previous file version.
+// The last block can be shorter than the block size
+func ComputeSignatures(r io.Reader, blockSize int) ([]BlockSignature, error) {
+	if err := ValidateDeltaBlockSize(int64(blockSize)); err != nil {
+		return nil, err
+	}
+
+	signatures := make([]BlockSignature, 0)
+	block := make([]byte, blockSize)
+
+	for {
+		n, err := io.ReadFull(r, block)
+		if n > 0 {
+			weak := newWeakChecksum(block[:n])
+			signatures = append(signatures, BlockSignature{
+				Weak:   weak.sum(),
+				Strong: strongHash(block[:n]),
+			})
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(signatures) > MaxDeltaSignatures {
+			return nil, fmt.Errorf("file has more than %d blocks", MaxDeltaSignatures)
+		}
+	}
+
+	return signatures, nil
+}
+
+// deltaMatcher looks up blocks of the previous version by their signatures
+type deltaMatcher struct {
+	blockSize  int
+	lastSize   int // size of the last block of the previous version
+	signatures []BlockSignature
+	weakIndex  map[uint32][]int64 // weak checksum -> block indexes
+}
+
+func newDeltaMatcher(blockSize int, previousSize int64, signatures []BlockSignature) (*deltaMatcher, error) {
+	if NumDeltaBlocks(previousSize, blockSize) != int64(len(signatures)) {
+		return nil, errors.New("signatures don't match the previous version size")
+	}
+
+	lastSize := 0
+	if len(signatures) > 0 {
+		lastSize = int(previousSize - int64(len(signatures)-1)*int64(blockSize))
+	}
+
+	weakIndex := make(map[uint32][]int64)
+	for index, signature := range signatures {
+		weakIndex[signature.Weak] = append(weakIndex[signature.Weak], int64(index))
+	}
+
+	return &deltaMatcher{
+		blockSize:  blockSize,
+		lastSize:   lastSize,
+		signatures: signatures,
+		weakIndex:  weakIndex,
+	}, nil
+}
+
+// lastBlockSize returns the size of the last block of the previous version,
+// or 0 if the previous version is empty or its last block is whole
+func (dm *deltaMatcher) lastBlockSize() int {
+	if dm.lastSize == dm.blockSize {
+		return 0
+	}
+
+	return dm.lastSize
+}
+
+// match returns the index of the previous version block that matches the window
+func (dm *deltaMatcher) match(weak uint32, window []byte) (int64, bool) {
+	candidates, ok := dm.weakIndex[weak]
+	if !ok {
+		return 0, false
+	}
+
+	var strong []byte
+	for _, index := range candidates {
+		expectedSize := dm.blockSize
+		if index == int64(len(dm.signatures))-1 {
+			expectedSize = dm.lastSize
+		}
+
+		if len(window) != expectedSize {
+			continue
+		}
+
+		if strong == nil {
+			strong = strongHash(window)
+		}
+
+		if bytes.Equal(strong, dm.signatures[index].Strong) {
+			return index, true
+		}
+	}
+
+	return 0, false
+}
+
+// deltaEmitter merges consecutive block copies before passing the operations on
+type deltaEmitter struct {
+	pending    *DeltaOp
+	maxLiteral int
+	emit       func(DeltaOp) error
+}
+
+func (de *deltaEmitter) copyBlock(index int64) error {
+	if de.pending != nil && de.pending.BlockIndex+de.pending.BlockCount == index {
+		de.pending.BlockCount++
+
+		return nil
+	}
+
+	if err := de.flush(); err != nil {
+		return err
+	}
+
+	de.pending = &DeltaOp{BlockIndex: index, BlockCount: 1}
+
+	return nil
+}
+
+func (de *deltaEmitter) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := de.flush(); err != nil {
+		return err
+	}
+
+	// The data is copied, since the caller reuses its buffer
+	for len(data) > 0 {
+		size := len(data)
+		if size > de.maxLiteral {
+			size = de.maxLiteral
+		}
+
+		if err := de.emit(DeltaOp{Data: append([]byte(nil), data[:size]...)}); err != nil {
+			return err
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+func (de *deltaEmitter) flush() error {
+	if de.pending == nil {
+		return nil
+	}
+
+	op := *de.pending
+	de.pending = nil
+
+	return de.emit(op)
+}
+
+// ComputeDelta compares the new file version with the signatures of the previous version,
+// and emits the operations that rebuild the new version. Literal data is split into
+// operations of at most maxLiteral bytes
+func ComputeDelta(
+	r io.Reader,
+	blockSize int,
+	previousSize int64,
+	signatures []BlockSignature,
+	maxLiteral int,
+	emit func(DeltaOp) error,
+) error {
+	if err := ValidateDeltaBlockSize(int64(blockSize)); err != nil {
+		return err
+	}
+
+	if maxLiteral < 1 {
+		return errors.New("invalid literal size")
+	}
+
+	matcher, matcherErr := newDeltaMatcher(blockSize, previousSize, signatures)
+	if matcherErr != nil {
+		return matcherErr
+	}
+
+	emitter := &deltaEmitter{maxLiteral: maxLiteral, emit: emit}
+
+	// The buffer holds the pending literal data, followed by the current window
+	buf := make([]byte, 0, 2*blockSize+maxLiteral)
+	literalStart := 0
+	pos := 0
+	eof := false
+
+	var weak weakChecksum
+	weakValid := false
+
+	for {
+		if len(buf)-pos < blockSize && !eof {
+			// Move the unprocessed data to the front, and read some more
+			remaining := copy(buf[:cap(buf)], buf[literalStart:])
+			pos -= literalStart
+			literalStart = 0
+
+			n, err := io.ReadFull(r, buf[remaining:cap(buf)])
+			buf = buf[:remaining+n]
+
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		window := buf[pos:]
+		if len(window) > blockSize {
+			window = window[:blockSize]
+		}
+
+		if len(window) == 0 {
+			break
+		}
+
+		if len(window) < blockSize {
+			// Only the last block of the previous version can match a short window,
+			// so skip straight to the position where the sizes line up
+			lastSize := matcher.lastBlockSize()
+			if lastSize == 0 || len(window) < lastSize {
+				pos = len(buf)
+
+				break
+			}
+
+			if len(window) > lastSize {
+				pos = len(buf) - lastSize
+				window = buf[pos:]
+			}
+
+			weakValid = false
+		}
+
+		if !weakValid {
+			weak = newWeakChecksum(window)
+			weakValid = true
+		}
+
+		if index, found := matcher.match(weak.sum(), window); found {
+			if err := emitter.literal(buf[literalStart:pos]); err != nil {
+				return err
+			}
+
+			if err := emitter.copyBlock(index); err != nil {
+				return err
+			}
+
+			pos += len(window)
+			literalStart = pos
+			weakValid = false
+
+			continue
+		}
+
+		// No match, move the window one byte forward
+		if pos+blockSize < len(buf) {
+			weak.roll(buf[pos], buf[pos+blockSize])
+		} else {
+			// The window is about to shrink, or needs more data
+			weakValid = false
+		}
+		pos++
+
+		if pos-literalStart >= maxLiteral {
+			if err := emitter.literal(buf[literalStart:pos]); err != nil {
+				return err
+			}
+
+			literalStart = pos
+		}
+	}
+
+	if err := emitter.literal(buf[literalStart:pos]); err != nil {
+		return err
+	}
+
+	return emitter.flush()
+}
+
+// ApplyDeltaOp applies a single delta operation, using the previous file version
+// of the given size as the source of the copied blocks
+func ApplyDeltaOp(
+	previous io.ReaderAt,
+	previousSize int64,
+	blockSize int,
+	op DeltaOp,
+	output io.Writer,
+) error {
+	if op.BlockCount == 0 {
+		if len(op.Data) == 0 {
+			return ErrInvalidDeltaOp
+		}
+
+		_, writeErr := output.Write(op.Data)
+
+		return writeErr
+	}
+
+	if len(op.Data) != 0 || op.BlockIndex < 0 || op.BlockCount < 0 {
+		return ErrInvalidDeltaOp
+	}
+
+	start := op.BlockIndex * int64(blockSize)
+	if start >= previousSize || op.BlockCount > (previousSize-start+int64(blockSize)-1)/int64(blockSize) {
+		return ErrInvalidDeltaOp
+	}
+
+	length := op.BlockCount * int64(blockSize)
+	if start+length > previousSize {
+		length = previousSize - start
+	}
+
+	_, copyErr := io.Copy(output, io.NewSectionReader(previous, start, length))
+
+	return copyErr
+}
@@ -0,0 +1,192 @@
+package files
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generateData generates deterministic pseudo-random data
+func generateData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+
+	return data
+}
+
+// concat joins the given byte slices into a new one
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestDelta_Rebuild(t *testing.T) {
+	blockSize := MinDeltaBlockSize
+	previous := generateData(1, 10*blockSize+100)
+
+	testTable := []struct {
+		name       string
+		previous   []byte
+		current    []byte
+		maxLiteral int // upper bound of the literal bytes in the delta
+	}{
+		{
+			"Unchanged file",
+			previous,
+			previous,
+			0,
+		},
+		{
+			"Data appended",
+			previous,
+			concat(previous, generateData(2, 300)),
+			400, // the short last block of the previous version is sent again
+		},
+		{
+			"Data prepended",
+			previous,
+			concat(generateData(3, 10), previous),
+			10,
+		},
+		{
+			"Block in the middle modified",
+			previous,
+			concat(previous[:4*blockSize], generateData(4, blockSize), previous[5*blockSize:]),
+			blockSize,
+		},
+		{
+			"Data inserted in the middle",
+			previous,
+			concat(previous[:3*blockSize+7], generateData(5, 50), previous[3*blockSize+7:]),
+			blockSize + 50,
+		},
+		{
+			"Tail removed",
+			previous,
+			previous[:5*blockSize],
+			0,
+		},
+		{
+			"Completely different file",
+			previous,
+			generateData(6, 3*blockSize),
+			3 * blockSize,
+		},
+		{
+			"Empty previous version",
+			[]byte{},
+			generateData(7, blockSize+1),
+			blockSize + 1,
+		},
+		{
+			"Empty current version",
+			previous,
+			[]byte{},
+			0,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			signatures, signErr := ComputeSignatures(bytes.NewReader(testCase.previous), blockSize)
+			assert.NoError(t, signErr)
+
+			var (
+				rebuilt      bytes.Buffer
+				literalBytes int
+			)
+
+			previousReader := bytes.NewReader(testCase.previous)
+			deltaErr := ComputeDelta(
+				bytes.NewReader(testCase.current),
+				blockSize,
+				int64(len(testCase.previous)),
+				signatures,
+				1024,
+				func(op DeltaOp) error {
+					assert.LessOrEqual(t, len(op.Data), 1024)
+					literalBytes += len(op.Data)
+
+					return ApplyDeltaOp(previousReader, int64(len(testCase.previous)), blockSize, op, &rebuilt)
+				},
+			)
+			assert.NoError(t, deltaErr)
+
+			assert.True(t, bytes.Equal(testCase.current, rebuilt.Bytes()))
+			assert.LessOrEqual(t, literalBytes, testCase.maxLiteral)
+		})
+	}
+}
+
+func TestDelta_InvalidOps(t *testing.T) {
+	blockSize := MinDeltaBlockSize
+	previous := generateData(1, 2*blockSize+10)
+
+	testTable := []struct {
+		name string
+		op   DeltaOp
+	}{
+		{
+			"Empty operation",
+			DeltaOp{},
+		},
+		{
+			"Block out of range",
+			DeltaOp{BlockIndex: 3, BlockCount: 1},
+		},
+		{
+			"Too many blocks",
+			DeltaOp{BlockIndex: 1, BlockCount: 3},
+		},
+		{
+			"Negative block index",
+			DeltaOp{BlockIndex: -1, BlockCount: 1},
+		},
+		{
+			"Copy with literal data",
+			DeltaOp{BlockIndex: 0, BlockCount: 1, Data: []byte("data")},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			assert.ErrorIs(
+				t,
+				ApplyDeltaOp(bytes.NewReader(previous), int64(len(previous)), blockSize, testCase.op, &output),
+				ErrInvalidDeltaOp,
+			)
+		})
+	}
+}
+
+func TestDelta_BlockSize(t *testing.T) {
+	testTable := []struct {
+		name     string
+		fileSize int64
+	}{
+		{
+			"Small file",
+			100,
+		},
+		{
+			"Medium file",
+			100 * 1024 * 1024,
+		},
+		{
+			"Large file",
+			64 * 1024 * 1024 * 1024,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			blockSize := DeltaBlockSize(testCase.fileSize)
+
+			assert.NoError(t, ValidateDeltaBlockSize(int64(blockSize)))
+			assert.LessOrEqual(t, NumDeltaBlocks(testCase.fileSize, blockSize), int64(MaxDeltaSignatures))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package files
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/hashicorp/go-hclog"
@@ -14,17 +15,21 @@ type FileListWrapper struct {
 	PeerID   peer.ID
 }
 
-// FileAggregator aggregates different file lists for workspaces
+// FileAggregator aggregates different file lists for workspaces.
+// Every peer's latest file list is kept as its own set, and the global file list
+// and file map are derived from those sets
 type FileAggregator struct {
 	logger hclog.Logger
 
-	updateChannel chan FileListWrapper // Update channel that's filled by clientServer
-	fileMap       map[string][]peer.ID // Map indicating which peers have a certain file (checksum -> []peerID)
-	peerFileArray map[peer.ID][]string // Map indicating all files that the peer is offering (peerID -> []checksum)
-	fileArray     []*proto.File        // All files available to the client in the workspace
+	updateChannel chan FileListWrapper               // Update channel that's filled by clientServer
+	stopChannel   chan struct{}                      // Closed when the aggregator is stopped
+	peerFiles     map[peer.ID]map[string]*proto.File // Latest file set of each peer (peerID -> checksum -> file)
+	fileMap       map[string][]peer.ID               // Map indicating which peers have a certain file (checksum -> []peerID)
+	fileArray     []*proto.File                      // All files available to the client in the workspace
 
-	fileMapMuxMap map[string]sync.RWMutex
-	fileArrayMux  sync.Mutex
+	changeHandler func(numFiles int) // Notified when files are added to or removed from the file array
+
+	filesMux sync.RWMutex
 }
 
 // NewFileAggregator creates a new instance of the file aggregator
@@ -35,21 +40,45 @@ func NewFileAggregator(
 ) *FileAggregator {
 	return &FileAggregator{
 		logger:        logger.Named(fmt.Sprintf("file-aggregator [%s]", workspaceName)),
+		peerFiles:     make(map[peer.ID]map[string]*proto.File),
 		fileMap:       make(map[string][]peer.ID),
-		peerFileArray: make(map[peer.ID][]string),
 		fileArray:     make([]*proto.File, 0),
 		updateChannel: updateChannel,
+		stopChannel:   make(chan struct{}),
 	}
 }
 
 // GetFilePeers fetches all peers who serve a specific file
 func (fa *FileAggregator) GetFilePeers(fileChecksum string) []peer.ID {
+	fa.filesMux.RLock()
+	defer fa.filesMux.RUnlock()
+
 	peers, ok := fa.fileMap[fileChecksum]
 	if !ok {
 		return []peer.ID{}
 	}
 
-	return peers
+	return append([]peer.ID{}, peers...)
+}
+
+// GetFile fetches the file information for a specific checksum
+func (fa *FileAggregator) GetFile(fileChecksum string) *proto.File {
+	fa.filesMux.RLock()
+	defer fa.filesMux.RUnlock()
+
+	for _, file := range fa.fileArray {
+		if file.FileChecksum == fileChecksum {
+			return file
+		}
+	}
+
+	return nil
+}
+
+// SetChangeHandler sets the handler that's notified when the available files change.
+// It needs to be set before the aggregator is started
+func (fa *FileAggregator) SetChangeHandler(changeHandler func(numFiles int)) {
+	fa.changeHandler = changeHandler
 }
 
 // Start starts the File aggregator loop
@@ -57,116 +86,133 @@ func (fa *FileAggregator) Start() {
 	go fa.aggregateFilesLoop()
 }
 
-// Stop stops the file aggregator service
+// Stop stops the file aggregator service.
+// The update channel is left open, since it belongs to the sender
 func (fa *FileAggregator) Stop() {
-	close(fa.updateChannel)
+	close(fa.stopChannel)
+}
+
+// Update hands the file list to the aggregator loop, and returns false
+// if the aggregator was stopped before it could take it
+func (fa *FileAggregator) Update(fileListWrapper FileListWrapper) bool {
+	select {
+	case fa.updateChannel <- fileListWrapper:
+		return true
+	case <-fa.stopChannel:
+		return false
+	}
 }
 
 // aggregateFilesLoop listens for new file list events
 func (fa *FileAggregator) aggregateFilesLoop() {
 	for {
-		fileListWrapper, more := <-fa.updateChannel
-		fa.logger.Info("Message received")
-		if more {
-			fa.logger.Info("New file list received received")
-			// Parse the file list
-
-			// Find the differences
-			fa.fileArrayMux.Lock()
-			fileDifferencesAB := fa.findFileDifference(fa.fileArray, fileListWrapper.FileList.FileList)
-			fileDifferencesBA := fa.findFileDifference(fileListWrapper.FileList.FileList, fa.fileArray)
-			fileDifferences := append(fileDifferencesBA, fileDifferencesAB...)
-			fa.logger.Debug(fmt.Sprintf("File differences found: %d", len(fileDifferences)))
-			fa.logger.Debug(fmt.Sprintf("Size of local records: %d", len(fa.fileArray)))
-
-			fa.fileArrayMux.Unlock()
-
-			// Update all the relevant structures
-			fa.pruneFileMap(fileDifferences, fileListWrapper.PeerID)
-		} else {
+		var fileListWrapper FileListWrapper
+
+		select {
+		case <-fa.stopChannel:
 			fa.logger.Info("Exit signal received")
 			// exit signal caught
 			return
+		case fileListWrapper = <-fa.updateChannel:
+		}
+
+		fa.logger.Debug(fmt.Sprintf("New file list received from peer %s", fileListWrapper.PeerID))
+
+		if changed := fa.replacePeerFiles(fileListWrapper); changed && fa.changeHandler != nil {
+			fa.changeHandler(len(fa.GetFileList()))
 		}
 	}
 }
 
-// findFileDifference finds which files are different between the arrays
-func (fa *FileAggregator) findFileDifference(a, b []*proto.File) []*proto.File {
-	// Make a list of all new files
-	mb := make(map[string]struct{}, len(b))
-	for _, x := range b {
-		mb[x.FileChecksum] = struct{}{}
-	}
+// replacePeerFiles replaces the file set of the peer with the received file list,
+// and returns true if the global file array changed
+func (fa *FileAggregator) replacePeerFiles(fileListWrapper FileListWrapper) bool {
+	peerID := fileListWrapper.PeerID
 
-	diff := make([]*proto.File, 0)
-	for _, x := range a {
-		if _, found := mb[x.FileChecksum]; !found {
-			diff = append(diff, x)
+	newFiles := make(map[string]*proto.File)
+	if fileListWrapper.FileList != nil {
+		for _, file := range fileListWrapper.FileList.FileList {
+			newFiles[file.FileChecksum] = file
 		}
 	}
 
-	return diff
-}
+	fa.filesMux.Lock()
+	defer fa.filesMux.Unlock()
 
-// pruneFileMap updates file structures based on the file differences
-func (fa *FileAggregator) pruneFileMap(fileDifferences []*proto.File, peerID peer.ID) {
-	for _, file := range fileDifferences {
-		mux, _ := fa.fileMapMuxMap[file.FileChecksum]
-		mux.Lock()
-		// Check if the file mapping to peerID exists.
-		peerArray, ok := fa.fileMap[file.FileChecksum]
+	oldFiles := fa.peerFiles[peerID]
 
-		fa.logger.Debug(fmt.Sprintf("%v %v", peerArray, ok))
-		if !ok {
-			fa.logger.Debug(fmt.Sprintf("New file received: %s", file.Name))
-			// If it doesn't exist, that means the file was added
-			fa.addFileToFileArray(file)
-			newArray := make([]peer.ID, 0)
-			newArray = append(newArray, peerID)
+	// Update the file map only for the files the peer stopped or started serving
+	for checksum := range oldFiles {
+		if _, ok := newFiles[checksum]; ok {
+			continue
+		}
 
-			fa.fileMap[file.FileChecksum] = newArray
+		peers := fa.pruneFromPeerArray(fa.fileMap[checksum], peerID)
+		if len(peers) == 0 {
+			delete(fa.fileMap, checksum)
 		} else {
-			// If it exists, that means the file was removed
-			fa.logger.Debug(fmt.Sprintf("File removed: %s", file.Name))
-			newArray := fa.pruneFromPeerArray(peerArray, peerID)
-			fa.fileMap[file.FileChecksum] = newArray
-			if len(newArray) == 0 {
-				fa.logger.Debug(fmt.Sprintf("File removed globally received: %s", file.Name))
-				// Remove the file from the global array as nobody serves it
-				fa.pruneFileFromFileArray(file)
-			}
+			fa.fileMap[checksum] = peers
+		}
+	}
 
+	for checksum := range newFiles {
+		if _, ok := oldFiles[checksum]; !ok {
+			fa.fileMap[checksum] = append(fa.fileMap[checksum], peerID)
 		}
+	}
 
-		mux.Unlock()
+	if len(newFiles) == 0 {
+		delete(fa.peerFiles, peerID)
+	} else {
+		fa.peerFiles[peerID] = newFiles
 	}
-}
 
-// addFileToFileArray adds a new file to the global file array. [Thread safe]
-func (fa *FileAggregator) addFileToFileArray(file *proto.File) {
-	fa.fileArrayMux.Lock()
-	defer fa.fileArrayMux.Unlock()
+	fa.logger.Debug(
+		fmt.Sprintf("Peer %s serves %d files, %d files available", peerID, len(newFiles), len(fa.fileMap)),
+	)
 
-	fa.fileArray = append(fa.fileArray, file)
+	return fa.rebuildFileArray()
 }
 
-// pruneFileFromFileArray removes a specific file from the global file array/ [Thread safe]
-func (fa *FileAggregator) pruneFileFromFileArray(file *proto.File) {
-	fa.fileArrayMux.Lock()
-	defer fa.fileArrayMux.Unlock()
+// rebuildFileArray derives the global file array from the peer file sets.
+// Files keep their position in the array, and new files are appended sorted by checksum.
+// Returns true if files were added or removed
+func (fa *FileAggregator) rebuildFileArray() bool {
+	fileArray := make([]*proto.File, 0, len(fa.fileMap))
+	listed := make(map[string]bool, len(fa.fileMap))
+
+	for _, file := range fa.fileArray {
+		if _, ok := fa.fileMap[file.FileChecksum]; ok {
+			fileArray = append(fileArray, fa.representativeFile(file.FileChecksum))
+			listed[file.FileChecksum] = true
+		}
+	}
 
-	index := -1
-	for searchIndex, searchFile := range fa.fileArray {
-		if searchFile.FileChecksum == file.FileChecksum {
-			index = searchIndex
-			break
+	changed := len(fileArray) != len(fa.fileArray)
+
+	added := make([]string, 0)
+	for checksum := range fa.fileMap {
+		if !listed[checksum] {
+			added = append(added, checksum)
 		}
 	}
 
-	if index >= 0 {
-		fa.fileArray = append(fa.fileArray[:index], fa.fileArray[index+1:]...)
+	sort.Strings(added)
+
+	for _, checksum := range added {
+		fileArray = append(fileArray, fa.representativeFile(checksum))
+		changed = true
 	}
+
+	fa.fileArray = fileArray
+
+	return changed
+}
+
+// representativeFile returns the file information for the checksum,
+// as announced by the first peer that still serves it
+func (fa *FileAggregator) representativeFile(fileChecksum string) *proto.File {
+	return fa.peerFiles[fa.fileMap[fileChecksum][0]][fileChecksum]
 }
 
 // pruneFromPeerArray removes a peer ID from the peer array
@@ -180,16 +226,21 @@ func (fa *FileAggregator) pruneFromPeerArray(peerArray []peer.ID, peerID peer.ID
 	}
 
 	if index >= 0 {
-		return append(peerArray[:index], peerArray[index+1:]...)
+		return append(peerArray[:index:index], peerArray[index+1:]...)
 	}
 
 	return peerArray
 }
 
+// GetConflicts returns the files that peers share under the same relative path
+func (fa *FileAggregator) GetConflicts() []FileConflict {
+	return FindConflicts(fa.GetFileList())
+}
+
 // GetFileList returns the available file list
 func (fa *FileAggregator) GetFileList() []*proto.File {
-	fa.fileArrayMux.Lock()
-	defer fa.fileArrayMux.Unlock()
+	fa.filesMux.RLock()
+	defer fa.filesMux.RUnlock()
 
 	return fa.fileArray
 }
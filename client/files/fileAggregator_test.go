@@ -0,0 +1,239 @@
+package files
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/proto"
+)
+
+// peerFileList is a file list announcement of a peer in the aggregator tests
+type peerFileList struct {
+	peerID    peer.ID
+	checksums []string
+}
+
+// newAggregatorFileList creates a file list wrapper with a file for every checksum
+func newAggregatorFileList(peerID peer.ID, checksums ...string) FileListWrapper {
+	fileList := make([]*proto.File, 0, len(checksums))
+	for _, checksum := range checksums {
+		fileList = append(fileList, &proto.File{
+			Name:         "file-" + checksum,
+			FileChecksum: checksum,
+		})
+	}
+
+	return FileListWrapper{
+		FileList: &proto.FileList{FileList: fileList},
+		PeerID:   peerID,
+	}
+}
+
+// aggregatedChecksums returns the sorted checksums of the aggregated files
+func aggregatedChecksums(fileList []*proto.File) []string {
+	checksums := make([]string, 0, len(fileList))
+	for _, file := range fileList {
+		checksums = append(checksums, file.FileChecksum)
+	}
+
+	sort.Strings(checksums)
+
+	return checksums
+}
+
+func TestFileAggregator_ReplacePeerFiles(t *testing.T) {
+	testTable := []struct {
+		name              string
+		announcements     []peerFileList
+		expectedChanged   bool // for the last announcement
+		expectedChecksums []string
+		expectedPeers     map[string][]peer.ID // checksum -> peers
+	}{
+		{
+			"Files of different peers",
+			[]peerFileList{
+				{"A", []string{"a1", "a2"}},
+				{"B", []string{"b1"}},
+			},
+			true,
+			[]string{"a1", "a2", "b1"},
+			map[string][]peer.ID{"a1": {"A"}, "a2": {"A"}, "b1": {"B"}},
+		},
+		{
+			"Peer list without the files of other peers",
+			[]peerFileList{
+				{"A", []string{"a1"}},
+				{"B", []string{"b1"}},
+				{"A", []string{"a1"}},
+			},
+			false,
+			[]string{"a1", "b1"},
+			map[string][]peer.ID{"a1": {"A"}, "b1": {"B"}},
+		},
+		{
+			"File shared by multiple peers",
+			[]peerFileList{
+				{"A", []string{"shared", "a1"}},
+				{"B", []string{"shared"}},
+			},
+			false,
+			[]string{"a1", "shared"},
+			map[string][]peer.ID{"a1": {"A"}, "shared": {"A", "B"}},
+		},
+		{
+			"Shared file removed by one peer",
+			[]peerFileList{
+				{"A", []string{"shared"}},
+				{"B", []string{"shared"}},
+				{"A", []string{"a1"}},
+			},
+			true,
+			[]string{"a1", "shared"},
+			map[string][]peer.ID{"a1": {"A"}, "shared": {"B"}},
+		},
+		{
+			"Shared file removed by all peers",
+			[]peerFileList{
+				{"A", []string{"shared"}},
+				{"B", []string{"shared", "b1"}},
+				{"A", []string{}},
+				{"B", []string{"b1"}},
+			},
+			true,
+			[]string{"b1"},
+			map[string][]peer.ID{"b1": {"B"}},
+		},
+		{
+			"Removed file shared again",
+			[]peerFileList{
+				{"A", []string{"a1"}},
+				{"A", []string{}},
+				{"B", []string{"a1"}},
+			},
+			true,
+			[]string{"a1"},
+			map[string][]peer.ID{"a1": {"B"}},
+		},
+		{
+			"Peer left",
+			[]peerFileList{
+				{"A", []string{"a1", "shared"}},
+				{"B", []string{"b1", "shared"}},
+				{"A", []string{}},
+			},
+			true,
+			[]string{"b1", "shared"},
+			map[string][]peer.ID{"b1": {"B"}, "shared": {"B"}},
+		},
+		{
+			"Same list announced again",
+			[]peerFileList{
+				{"A", []string{"a1", "a2"}},
+				{"A", []string{"a2", "a1"}},
+			},
+			false,
+			[]string{"a1", "a2"},
+			map[string][]peer.ID{"a1": {"A"}, "a2": {"A"}},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			fileAggregator := NewFileAggregator(hclog.NewNullLogger(), "test", make(chan FileListWrapper))
+
+			changed := false
+			for _, announcement := range testCase.announcements {
+				changed = fileAggregator.replacePeerFiles(
+					newAggregatorFileList(announcement.peerID, announcement.checksums...),
+				)
+			}
+
+			assert.Equal(t, testCase.expectedChanged, changed)
+			assert.Equal(t, testCase.expectedChecksums, aggregatedChecksums(fileAggregator.GetFileList()))
+
+			for checksum, expectedPeers := range testCase.expectedPeers {
+				assert.Equal(t, expectedPeers, fileAggregator.GetFilePeers(checksum))
+				assert.NotNil(t, fileAggregator.GetFile(checksum))
+			}
+
+			assert.Len(t, fileAggregator.fileMap, len(testCase.expectedPeers))
+		})
+	}
+}
+
+func TestFileAggregator_FileOrder(t *testing.T) {
+	fileAggregator := NewFileAggregator(hclog.NewNullLogger(), "test", make(chan FileListWrapper))
+
+	fileAggregator.replacePeerFiles(newAggregatorFileList("A", "c", "a"))
+	fileAggregator.replacePeerFiles(newAggregatorFileList("B", "b"))
+	fileAggregator.replacePeerFiles(newAggregatorFileList("A", "c"))
+
+	// Files keep their position when other files come and go
+	fileList := fileAggregator.GetFileList()
+	assert.Equal(t, []string{"c", "b"}, []string{fileList[0].FileChecksum, fileList[1].FileChecksum})
+
+	// The file information follows the peers that still serve the file
+	fileAggregator.replacePeerFiles(FileListWrapper{
+		FileList: &proto.FileList{FileList: []*proto.File{{Name: "renamed", FileChecksum: "b"}}},
+		PeerID:   "C",
+	})
+	fileAggregator.replacePeerFiles(newAggregatorFileList("B"))
+
+	assert.Equal(t, "renamed", fileAggregator.GetFile("b").Name)
+}
+
+func TestFileAggregator_ChangeHandler(t *testing.T) {
+	updateChannel := make(chan FileListWrapper)
+	changes := make(chan int, 10)
+
+	fileAggregator := NewFileAggregator(hclog.NewNullLogger(), "test", updateChannel)
+	fileAggregator.SetChangeHandler(func(numFiles int) {
+		changes <- numFiles
+	})
+
+	fileAggregator.Start()
+	defer fileAggregator.Stop()
+
+	updateChannel <- newAggregatorFileList("A", "a1", "a2")
+	updateChannel <- newAggregatorFileList("B", "a1")
+	updateChannel <- newAggregatorFileList("A", "a1")
+
+	for _, expectedFiles := range []int{2, 1} {
+		select {
+		case numFiles := <-changes:
+			assert.Equal(t, expectedFiles, numFiles)
+		case <-time.After(5 * time.Second):
+			t.Fatal("change not reported")
+		}
+	}
+
+	// Announcements that don't change the available files aren't reported
+	assert.Len(t, changes, 0)
+}
+
+func TestFileAggregator_UpdateAfterStop(t *testing.T) {
+	fileAggregator := NewFileAggregator(hclog.NewNullLogger(), "test", make(chan FileListWrapper))
+	fileAggregator.Start()
+
+	assert.True(t, fileAggregator.Update(newAggregatorFileList("A", "a1")))
+
+	// Senders racing with the stop neither panic nor block
+	updated := make(chan bool)
+	go func() {
+		updated <- fileAggregator.Update(newAggregatorFileList("A", "a2"))
+	}()
+
+	fileAggregator.Stop()
+
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("update blocked after stop")
+	}
+
+	assert.False(t, fileAggregator.Update(newAggregatorFileList("B", "b1")))
+}
@@ -0,0 +1,136 @@
+package files
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/multiformats/go-multihash"
+	"github.com/zivkovicmilos/peer_drop/config"
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrUnknownHashAlgorithm is returned when a checksum uses an algorithm the node can't compute
+var ErrUnknownHashAlgorithm = errors.New("unknown hash algorithm")
+
+// legacyChecksumLength is the length of the bare hex SHA256 checksums
+// that were used before the checksums were multihash encoded
+const legacyChecksumLength = sha256.Size * 2
+
+// hashAlgorithms are the algorithms file checksums can be computed with,
+// keyed by their multihash names
+var hashAlgorithms = map[string]func() hash.Hash{
+	config.HASH_ALGORITHM_SHA2_256: sha256.New,
+	config.HASH_ALGORITHM_BLAKE2B_256: func() hash.Hash {
+		h, _ := blake2b.New256(nil) // only fails for keys that are too long
+
+		return h
+	},
+}
+
+// IsHashAlgorithm checks if file checksums can be computed with the algorithm
+func IsHashAlgorithm(algorithm string) bool {
+	_, ok := hashAlgorithms[algorithm]
+
+	return ok
+}
+
+// FileChecksum is a decoded file checksum.
+// Checksums are hex encoded multihashes, so peers can tell which algorithm a file was hashed with
+type FileChecksum struct {
+	Algorithm string // multihash name of the algorithm
+	Digest    []byte
+}
+
+// NewFileHash returns a new hash of the algorithm, or of the default algorithm if none is set
+func NewFileHash(algorithm string) (hash.Hash, error) {
+	if algorithm == "" {
+		algorithm = config.DefaultHashAlgorithm
+	}
+
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return nil, ErrUnknownHashAlgorithm
+	}
+
+	return newHash(), nil
+}
+
+// EncodeFileChecksum encodes the digest computed with the algorithm into a file checksum
+func EncodeFileChecksum(algorithm string, digest []byte) (string, error) {
+	if algorithm == "" {
+		algorithm = config.DefaultHashAlgorithm
+	}
+
+	encoded, encodeErr := multihash.EncodeName(digest, algorithm)
+	if encodeErr != nil {
+		return "", fmt.Errorf("unable to encode checksum, %v", encodeErr)
+	}
+
+	return hex.EncodeToString(encoded), nil
+}
+
+// ParseFileChecksum decodes the file checksum.
+// Bare hex checksums from before the multihash encoding are read as SHA256 digests
+func ParseFileChecksum(checksum string) (*FileChecksum, error) {
+	decoded, decodeErr := hex.DecodeString(checksum)
+	if decodeErr != nil {
+		return nil, fmt.Errorf("invalid checksum, %v", decodeErr)
+	}
+
+	if len(checksum) == legacyChecksumLength {
+		return &FileChecksum{
+			Algorithm: config.HASH_ALGORITHM_SHA2_256,
+			Digest:    decoded,
+		}, nil
+	}
+
+	decodedHash, castErr := multihash.Decode(decoded)
+	if castErr != nil {
+		return nil, fmt.Errorf("invalid checksum, %v", castErr)
+	}
+
+	if !IsHashAlgorithm(decodedHash.Name) {
+		return nil, ErrUnknownHashAlgorithm
+	}
+
+	return &FileChecksum{
+		Algorithm: decodedHash.Name,
+		Digest:    decodedHash.Digest,
+	}, nil
+}
+
+// ChecksumAlgorithm returns the algorithm the file checksum was computed with,
+// or an empty string if the checksum can't be decoded
+func ChecksumAlgorithm(checksum string) string {
+	fileChecksum, parseErr := ParseFileChecksum(checksum)
+	if parseErr != nil {
+		return ""
+	}
+
+	return fileChecksum.Algorithm
+}
+
+// SameChecksum checks if both checksums hold the same digest of the same algorithm,
+// regardless of how they are encoded
+func SameChecksum(first string, second string) bool {
+	firstChecksum, firstErr := ParseFileChecksum(first)
+	secondChecksum, secondErr := ParseFileChecksum(second)
+
+	return firstErr == nil && secondErr == nil &&
+		firstChecksum.Algorithm == secondChecksum.Algorithm &&
+		firstChecksum.Matches(secondChecksum.Digest)
+}
+
+// NewHash returns a new hash of the checksum algorithm, for verifying the file content
+func (fc *FileChecksum) NewHash() hash.Hash {
+	return hashAlgorithms[fc.Algorithm]()
+}
+
+// Matches checks if the digest matches the checksum
+func (fc *FileChecksum) Matches(digest []byte) bool {
+	return bytes.Equal(fc.Digest, digest)
+}
@@ -0,0 +1,179 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/config"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestParseFileChecksum(t *testing.T) {
+	sha256Digest := sha256.Sum256([]byte("shared content"))
+	blake2bDigest := blake2b.Sum256([]byte("shared content"))
+
+	testTable := []struct {
+		name              string
+		checksum          string
+		expectedAlgorithm string
+		expectedDigest    []byte
+		expectErr         bool
+	}{
+		{
+			"Legacy SHA256 checksum",
+			hex.EncodeToString(sha256Digest[:]),
+			config.HASH_ALGORITHM_SHA2_256,
+			sha256Digest[:],
+			false,
+		},
+		{
+			"SHA256 multihash",
+			"1220" + hex.EncodeToString(sha256Digest[:]),
+			config.HASH_ALGORITHM_SHA2_256,
+			sha256Digest[:],
+			false,
+		},
+		{
+			"BLAKE2b multihash",
+			"a0e40220" + hex.EncodeToString(blake2bDigest[:]),
+			config.HASH_ALGORITHM_BLAKE2B_256,
+			blake2bDigest[:],
+			false,
+		},
+		{
+			"Unsupported algorithm",
+			"1620" + hex.EncodeToString(sha256Digest[:]), // sha3-256
+			"",
+			nil,
+			true,
+		},
+		{
+			"Truncated digest",
+			"1220" + hex.EncodeToString(sha256Digest[:16]),
+			"",
+			nil,
+			true,
+		},
+		{
+			"Not hex encoded",
+			"not a checksum",
+			"",
+			nil,
+			true,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			fileChecksum, parseErr := ParseFileChecksum(testCase.checksum)
+			if testCase.expectErr {
+				assert.Error(t, parseErr)
+
+				return
+			}
+
+			assert.NoError(t, parseErr)
+			assert.Equal(t, testCase.expectedAlgorithm, fileChecksum.Algorithm)
+			assert.True(t, fileChecksum.Matches(testCase.expectedDigest))
+		})
+	}
+}
+
+func TestFileLister_HashAlgorithm(t *testing.T) {
+	testTable := []struct {
+		name           string
+		algorithm      string
+		expectedPrefix string
+	}{
+		{
+			"Default algorithm",
+			"",
+			"1220",
+		},
+		{
+			"SHA256",
+			config.HASH_ALGORITHM_SHA2_256,
+			"1220",
+		},
+		{
+			"BLAKE2b",
+			config.HASH_ALGORITHM_BLAKE2B_256,
+			"a0e40220",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := writeTestFile(t, dir, "shared.txt", "shared content")
+
+			fileLister := &FileLister{hashAlgorithm: testCase.algorithm}
+			checksum, _, checksumErr := fileLister.checksumFile(filePath)
+			assert.NoError(t, checksumErr)
+			assert.Regexp(t, "^"+testCase.expectedPrefix, checksum)
+
+			// The checksum tells peers how to verify the file
+			fileChecksum, parseErr := ParseFileChecksum(checksum)
+			assert.NoError(t, parseErr)
+
+			hash := fileChecksum.NewHash()
+			hash.Write([]byte("shared content"))
+			assert.True(t, fileChecksum.Matches(hash.Sum(nil)))
+
+			// Only checksums of the lister algorithm are reused
+			assert.True(t, fileLister.isOwnChecksum(checksum))
+
+			otherLister := &FileLister{hashAlgorithm: config.HASH_ALGORITHM_BLAKE2B_256}
+			if testCase.algorithm == config.HASH_ALGORITHM_BLAKE2B_256 {
+				otherLister.hashAlgorithm = config.HASH_ALGORITHM_SHA2_256
+			}
+
+			assert.False(t, otherLister.isOwnChecksum(checksum))
+		})
+	}
+}
+
+func TestSameChecksum(t *testing.T) {
+	digest := sha256.Sum256([]byte("shared content"))
+	otherDigest := sha256.Sum256([]byte("other content"))
+
+	testTable := []struct {
+		name     string
+		first    string
+		second   string
+		expected bool
+	}{
+		{
+			"Same multihash",
+			"1220" + hex.EncodeToString(digest[:]),
+			"1220" + hex.EncodeToString(digest[:]),
+			true,
+		},
+		{
+			"Legacy and multihash encoding",
+			hex.EncodeToString(digest[:]),
+			"1220" + hex.EncodeToString(digest[:]),
+			true,
+		},
+		{
+			"Different digests",
+			"1220" + hex.EncodeToString(digest[:]),
+			"1220" + hex.EncodeToString(otherDigest[:]),
+			false,
+		},
+		{
+			"Invalid checksum",
+			"1220" + hex.EncodeToString(digest[:]),
+			"invalid",
+			false,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, SameChecksum(testCase.first, testCase.second))
+		})
+	}
+}
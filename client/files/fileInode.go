@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package files
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileInode returns the inode of the file, or 0 if it's unknown
+func fileInode(info fs.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+
+	return 0
+}
@@ -0,0 +1,8 @@
+package files
+
+import "io/fs"
+
+// fileInode returns 0, as the file info doesn't carry the file index on Windows
+func fileInode(_ fs.FileInfo) uint64 {
+	return 0
+}
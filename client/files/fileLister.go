@@ -1,24 +1,34 @@
 package files
 
 import (
-	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/hashicorp/go-hclog"
+	"github.com/zivkovicmilos/peer_drop/config"
 	"github.com/zivkovicmilos/peer_drop/proto"
 	"go.uber.org/atomic"
 )
 
+// maxHashWorkers is the max number of files hashed at the same time
+const maxHashWorkers = 8
+
+// ErrInvalidPath is returned for relative paths that leave their base directory
+var ErrInvalidPath = errors.New("invalid relative path")
+
 // FileLister gathers all files in the workspace
-// directory, and returns them as available for sharing
+// directory tree, and returns them as available for sharing
 type FileLister struct {
 	logger  hclog.Logger
 	baseDir string
@@ -26,6 +36,56 @@ type FileLister struct {
 	fileMap    map[string]*proto.File // checksum -> file
 	fileMapMux sync.RWMutex
 
+	// Merkle trees are kept on the disk, in the checksum cache and the blob store,
+	// and only the recently requested ones are held in memory
+	recentTrees *recentTrees
+
+	// Versions //
+	// Files are linked to their previous versions by their relative path,
+	// so peers can download only the changes
+	nameChecksums     map[string]string // relative file path -> checksum of the current version
+	previousChecksums map[string]string // relative file path -> checksum of the previous version
+	versionsMux       sync.RWMutex
+
+	// Retained versions //
+	// Previous versions are kept in the versions directory,
+	// and shared next to the current versions of the files
+	versionStore  *versionStore
+	retention     RetentionPolicy
+	retainedFiles map[string]*proto.File // checksum -> retained previous version
+	retainedMux   sync.RWMutex
+
+	// Checksum lookups //
+	// Files already added to the blob store, or with a cached checksum,
+	// are looked up instead of hashed again, unless a rehash was requested.
+	// Checksums computed with another algorithm are never reused
+	hashAlgorithm   string // multihash name of the algorithm the files are hashed with
+	blobStore       *BlobStore
+	checksumCache   ChecksumCache
+	rehashRequested atomic.Bool
+	skipLookups     bool // set for the duration of a rehash sweep
+
+	// Ignore rules //
+	// Patterns set for the workspace are applied before the ones in the ignore file,
+	// and files modified too recently are left out until they are done being written
+	ignorePatterns []string
+	minFileAge     time.Duration
+	ignoreMux      sync.RWMutex
+
+	// Scanned files //
+	// Files found by the last sweep, kept up to date with the changes the watcher reports
+	scannedFiles map[string]*proto.File // relative file path -> file
+	scanMux      sync.Mutex
+
+	// Change detection //
+	// The watcher reports the changed paths, which are scanned once they settle
+	watcher        *fsnotify.Watcher
+	pendingChanges map[string]bool // changed paths waiting to be scanned
+	changeTimer    *time.Timer
+	changesSince   time.Time              // time the oldest pending change was queued
+	youngFiles     map[string]*time.Timer // files that are too young to share -> recheck timer
+	changesMux     sync.Mutex
+
 	sweepInterval   time.Duration
 	sweepInProgress atomic.Bool
 	serviceRunning  atomic.Bool
@@ -40,17 +100,28 @@ func NewFileLister(
 	sweepInterval time.Duration,
 ) *FileLister {
 	return &FileLister{
-		logger:        logger.Named(fmt.Sprintf("file-lister [%s]", baseDir)),
-		baseDir:       baseDir,
-		fileMap:       make(map[string]*proto.File),
-		sweepInterval: sweepInterval,
-		stopChannel:   make(chan struct{}),
+		logger:            logger.Named(fmt.Sprintf("file-lister [%s]", baseDir)),
+		baseDir:           baseDir,
+		fileMap:           make(map[string]*proto.File),
+		recentTrees:       newRecentTrees(),
+		nameChecksums:     make(map[string]string),
+		previousChecksums: make(map[string]string),
+		retainedFiles:     make(map[string]*proto.File),
+		scannedFiles:      make(map[string]*proto.File),
+		pendingChanges:    make(map[string]bool),
+		youngFiles:        make(map[string]*time.Timer),
+		sweepInterval:     sweepInterval,
+		stopChannel:       make(chan struct{}),
 	}
 }
 
 // Start starts the file lister
 func (fl *FileLister) Start() {
-	fl.serviceRunning.Store(true)
+	if !fl.serviceRunning.CAS(false, true) {
+		// The file lister is already running
+		return
+	}
+
 	go fl.sweepDirectoryLoop()
 }
 
@@ -87,54 +158,242 @@ func (fl *FileLister) pruneRemovedFiles(currentFiles []*proto.File) {
 // sweepDirectory goes over all the files in the sharing directory
 // and updates the file map
 func (fl *FileLister) sweepDirectory() {
-	if fl.sweepInProgress.Load() {
+	if !fl.sweepInProgress.CAS(false, true) {
 		// Sweep already in progress
 		return
 	}
-	fl.sweepInProgress.Store(true)
-	fl.logger.Info("Directory sweep started")
-	var filesFound atomic.Int64
+	defer fl.sweepInProgress.Store(false)
 
-	var wg sync.WaitGroup
+	fl.scanMux.Lock()
+	defer fl.scanMux.Unlock()
+
+	fl.logger.Info("Directory sweep started")
 
+	fl.skipLookups = fl.rehashRequested.Swap(false)
 	defer func() {
-		fl.logger.Info(fmt.Sprintf("Directory sweep finished with %d files", filesFound.Load()))
-		fl.sweepInProgress.Store(false)
+		fl.skipLookups = false
 	}()
 
-	// Sweep directory for files
-	directoryFiles, err := ioutil.ReadDir(fl.baseDir)
-	if err != nil {
-		fl.logger.Error(fmt.Sprintf("Unable to read directory, %v", err))
-		return
+	ignoreRules, minFileAge := fl.getIgnoreRules()
+
+	// Sweep the directory tree for files
+	scannedFiles := make(map[string]*proto.File)
+	versionsChanged := fl.scanTree(fl.baseDir, ignoreRules, minFileAge, scannedFiles)
+
+	fl.scannedFiles = scannedFiles
+	fl.publishScan(versionsChanged)
+
+	fl.logger.Info(fmt.Sprintf("Directory sweep finished with %d files", len(scannedFiles)))
+}
+
+// scanTree goes over all the files in the directory tree, and adds them to the scanned files.
+// Directories are watched for changes as they are found. Returns if any file version changed
+func (fl *FileLister) scanTree(
+	root string,
+	ignoreRules *IgnoreRules,
+	minFileAge time.Duration,
+	scannedFiles map[string]*proto.File,
+) bool {
+	now := time.Now()
+	foundFiles := make([]*hashedFile, 0)
+
+	walkErr := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			fl.logger.Error(fmt.Sprintf("Unable to read %s, %v", filePath, err))
+
+			// Skip the unreadable directory, and keep going
+			return nil
+		}
+
+		if relativePath, relErr := filepath.Rel(fl.baseDir, filePath); relErr == nil &&
+			ignoreRules.Ignored(relativePath, entry.IsDir()) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.IsDir() {
+			// The directory is watched before its files are read, so no change is missed
+			fl.watchDirectory(filePath)
+
+			return nil
+		}
+
+		f, infoErr := entry.Info()
+		if infoErr != nil {
+			fl.logger.Error(fmt.Sprintf("Unable to read file info %s, %v", filePath, infoErr))
+
+			return nil
+		}
+
+		if now.Sub(f.ModTime()) < minFileAge {
+			// The file might still be written to, it's checked again once it's old enough
+			fl.queueChange(filePath, minFileAge-now.Sub(f.ModTime()))
+
+			return nil
+		}
+
+		foundFiles = append(foundFiles, &hashedFile{filePath: filePath, info: f})
+
+		return nil
+	})
+	if walkErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to read directory, %v", walkErr))
+	}
+
+	return fl.addHashedFiles(foundFiles, scannedFiles)
+}
+
+// hashedFile is a file found in the sharing directory, along with its checksum
+type hashedFile struct {
+	filePath string
+	info     fs.FileInfo
+
+	checksum   string
+	merkleTree *MerkleTree
+	err        error
+}
+
+// addHashedFiles checksums the found files on a bounded pool of workers,
+// and adds them to the file map and the scanned files. Returns if any file version changed
+func (fl *FileLister) addHashedFiles(foundFiles []*hashedFile, scannedFiles map[string]*proto.File) bool {
+	numWorkers := runtime.NumCPU()
+	if numWorkers > maxHashWorkers {
+		numWorkers = maxHashWorkers
 	}
 
-	currentFiles := make([]*proto.File, 0)
-	// Construct the directory files
-	for _, f := range directoryFiles {
-		if !f.IsDir() {
-			wg.Add(1)
+	fileChannel := make(chan *hashedFile)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
 
-			filePath := filepath.Join(fl.baseDir, f.Name())
-			checksum, checksumErr := fl.checksumFile(filePath)
-			if checksumErr != nil {
-				fl.logger.Error(fmt.Sprintf("Unable to checksum file %s", filePath))
+		go func() {
+			defer wg.Done()
+
+			for file := range fileChannel {
+				file.checksum, file.merkleTree, file.err = fl.checksumStoredFile(file.filePath, file.info)
 			}
+		}()
+	}
+
+	for _, file := range foundFiles {
+		fileChannel <- file
+	}
+
+	close(fileChannel)
+	wg.Wait()
+
+	// The file versions are linked one file at a time
+	versionsChanged := false
+	for _, file := range foundFiles {
+		protoFile, changed := fl.addHashedFile(file)
+		if protoFile == nil {
+			continue
+		}
+
+		scannedFiles[JoinRelativePath(protoFile.Path, file.info.Name())] = protoFile
+		versionsChanged = versionsChanged || changed
+	}
+
+	return versionsChanged
+}
+
+// addHashedFile adds the hashed file to the file map.
+// Returns the shared form of the file, and if a new version of the file was retained
+func (fl *FileLister) addHashedFile(file *hashedFile) (*proto.File, bool) {
+	filePath, f := file.filePath, file.info
+	checksum, merkleTree, checksumErr := file.checksum, file.merkleTree, file.err
 
-			protoFile := fileInfoToFileProto(f)
-			protoFile.FileChecksum = checksum
+	relativeDir, relErr := filepath.Rel(fl.baseDir, filepath.Dir(filePath))
+	if relErr != nil {
+		return nil, false
+	}
+
+	if checksumErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to checksum file %s", filePath))
+	}
+
+	protoFile := fileInfoToFileProto(f)
+	protoFile.Path = toRelativePath(relativeDir)
+	protoFile.FileChecksum = checksum
+	protoFile.PreviousChecksum = fl.linkVersion(JoinRelativePath(protoFile.Path, f.Name()), checksum)
+
+	versionChanged := false
+	if checksumErr == nil {
+		protoFile.Version, versionChanged = fl.retainVersion(
+			JoinRelativePath(protoFile.Path, f.Name()),
+			filePath,
+			protoFile,
+		)
+	}
+
+	if merkleTree != nil {
+		protoFile.MerkleRoot = hex.EncodeToString(merkleTree.Root())
+		protoFile.ChunkSize = MerkleChunkSize
+	}
 
-			fl.addFile(protoFile, checksum)
-			currentFiles = append(currentFiles, protoFile)
-			filesFound.Inc()
+	fl.addFile(protoFile, checksum)
 
-			wg.Done()
+	return protoFile, versionChanged
+}
+
+// publishScan drops the files that are no longer in the scanned files from the file map,
+// and applies the retention policy to the versions of the files that are gone
+func (fl *FileLister) publishScan(versionsChanged bool) {
+	currentFiles := make([]*proto.File, 0, len(fl.scannedFiles))
+	sharedPaths := make(map[string]bool)
+
+	for relativePath, file := range fl.scannedFiles {
+		currentFiles = append(currentFiles, file)
+
+		if file.FileChecksum != "" {
+			sharedPaths[relativePath] = true
 		}
 	}
 
 	fl.pruneRemovedFiles(currentFiles)
+	fl.applyRetention(sharedPaths, versionsChanged)
+}
 
-	wg.Wait()
+// toRelativePath converts the OS specific relative directory into the shared form,
+// which uses forward slashes, and is empty for the base directory
+func toRelativePath(relativeDir string) string {
+	if relativeDir == "." {
+		return ""
+	}
+
+	return filepath.ToSlash(relativeDir)
+}
+
+// JoinRelativePath joins the relative directory and the file name
+func JoinRelativePath(relativeDir string, fileName string) string {
+	return path.Join(relativeDir, fileName)
+}
+
+// CleanRelativePath checks if the relative path received from a peer stays within
+// the directory it's relative to, and returns its clean form
+func CleanRelativePath(relativePath string) (string, error) {
+	if relativePath == "" {
+		return "", nil
+	}
+
+	if strings.Contains(relativePath, "\\") || strings.ContainsRune(relativePath, 0) {
+		return "", ErrInvalidPath
+	}
+
+	cleanPath := path.Clean(relativePath)
+	if path.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+		return "", ErrInvalidPath
+	}
+
+	if cleanPath == "." {
+		return "", nil
+	}
+
+	return cleanPath, nil
 }
 
 func fileNameWithoutExtension(fileName string) string {
@@ -159,50 +418,117 @@ func (fl *FileLister) Stop() {
 	fl.stopChannel <- struct{}{}
 }
 
-// sweepDirectoryLoop is triggered periodically to update the file map
+// sweepDirectoryLoop is triggered periodically to update the file map.
+// While the directory is watched, the sweeps only reconcile the changes the watcher missed
 func (fl *FileLister) sweepDirectoryLoop() {
+	sweepInterval := fl.sweepInterval
+	if fl.startWatcher() {
+		sweepInterval = reconcileInterval
+		defer fl.stopWatcher()
+	}
+
 	// Do an initial sweep
 	fl.sweepDirectory()
 
 	// Start the loop
-	ticker := time.NewTicker(fl.sweepInterval)
-
-	go func() {
-		<-fl.stopChannel
-		fl.logger.Info("Stop message received")
-		ticker.Stop()
-
-		fl.serviceRunning.Store(false)
-	}()
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case _ = <-ticker.C:
-			if !fl.serviceRunning.Load() {
-				break
-			}
+		case <-fl.stopChannel:
+			fl.logger.Info("Stop message received")
+			fl.serviceRunning.Store(false)
 
+			return
+		case <-ticker.C:
 			fl.sweepDirectory()
-
 		}
 	}
 }
 
-// checksumFile checksums the file at the given path
-// Generates a SHA256 hash of the file
-func (fl *FileLister) checksumFile(path string) (string, error) {
+// checksumFile checksums the file at the given path with the workspace algorithm
+func (fl *FileLister) checksumFile(path string) (string, *MerkleTree, error) {
+	return hashFile(path, fl.hashAlgorithm)
+}
+
+// hashFile generates a hash of the file with the given algorithm, and the Merkle tree of its chunks in the same pass
+func hashFile(path string, algorithm string) (string, *MerkleTree, error) {
+	h, hashErr := NewFileHash(algorithm)
+	if hashErr != nil {
+		return "", nil, hashErr
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer f.Close()
 
-	h := sha256.New()
-	if _, err = io.Copy(h, f); err != nil {
-		return "", err
+	merkleTree, err := NewMerkleTreeFromReader(io.TeeReader(f, h), MerkleChunkSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	checksum, err := EncodeFileChecksum(algorithm, h.Sum(nil))
+	if err != nil {
+		return "", nil, err
 	}
 
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+	return checksum, merkleTree, nil
+}
+
+// isOwnChecksum checks if the checksum was computed with the algorithm the file lister hashes files with.
+// Bare checksums from before the multihash encoding are never reused
+func (fl *FileLister) isOwnChecksum(checksum string) bool {
+	algorithm := fl.hashAlgorithm
+	if algorithm == "" {
+		algorithm = config.DefaultHashAlgorithm
+	}
+
+	fileChecksum, parseErr := ParseFileChecksum(checksum)
+	if parseErr != nil || fileChecksum.Algorithm != algorithm {
+		return false
+	}
+
+	encoded, encodeErr := EncodeFileChecksum(algorithm, fileChecksum.Digest)
+
+	return encodeErr == nil && encoded == checksum
+}
+
+// checksumStoredFile returns the checksum and Merkle tree of the file from the blob store,
+// if the file is linked to a blob, or from the checksum cache, if the file didn't change.
+// Other files are hashed and cached. Every file is added to the blob store
+func (fl *FileLister) checksumStoredFile(path string, info fs.FileInfo) (string, *MerkleTree, error) {
+	if !fl.skipLookups && fl.blobStore != nil {
+		if checksum, merkleTree, found := fl.blobStore.Lookup(path, info); found && fl.isOwnChecksum(checksum) {
+			return checksum, merkleTree, nil
+		}
+	}
+
+	checksum, merkleTree, cached := "", (*MerkleTree)(nil), false
+	if !fl.skipLookups {
+		checksum, merkleTree, cached = fl.getCachedChecksum(path, info)
+	}
+
+	if !cached {
+		var err error
+		if checksum, merkleTree, err = fl.checksumFile(path); err != nil {
+			return "", nil, err
+		}
+
+		fl.saveCachedChecksum(path, info, checksum, merkleTree)
+	}
+
+	if fl.blobStore == nil {
+		return checksum, merkleTree, nil
+	}
+
+	if addErr := fl.blobStore.Add(path, checksum, merkleTree); addErr != nil {
+		fl.logger.Debug(fmt.Sprintf("Unable to add file %s to the blob store, %v", path, addErr))
+	}
+
+	return checksum, merkleTree, nil
 }
 
 // GetFileInfo returns the file information
@@ -210,9 +536,90 @@ func (fl *FileLister) GetFileInfo(checksum string) (*proto.File, error) {
 	fl.fileMapMux.RLock()
 	defer fl.fileMapMux.RUnlock()
 
-	file, _ := fl.fileMap[checksum]
+	file, ok := fl.fileMap[checksum]
+	if ok {
+		return file, nil
+	}
+
+	fl.retainedMux.RLock()
+	defer fl.retainedMux.RUnlock()
+
+	return fl.retainedFiles[checksum], nil
+}
+
+// GetFilePath returns the location on disk of the shared file
+// or retained version with the given checksum, if any
+func (fl *FileLister) GetFilePath(checksum string) string {
+	fl.fileMapMux.RLock()
+	file, ok := fl.fileMap[checksum]
+	fl.fileMapMux.RUnlock()
+
+	if ok {
+		return filepath.Join(
+			fl.baseDir,
+			filepath.FromSlash(file.Path),
+			fmt.Sprintf("%s%s", file.Name, file.Extension),
+		)
+	}
+
+	fl.retainedMux.RLock()
+	_, retained := fl.retainedFiles[checksum]
+	fl.retainedMux.RUnlock()
+
+	if retained {
+		return fl.versionStore.blobPath(checksum)
+	}
 
-	return file, nil
+	return ""
+}
+
+// GetMerkleTree returns the Merkle tree of the shared file or retained version, if any
+func (fl *FileLister) GetMerkleTree(checksum string) *MerkleTree {
+	if merkleTree, ok := fl.recentTrees.get(checksum); ok {
+		return merkleTree
+	}
+
+	filePath := fl.GetFilePath(checksum)
+	if filePath == "" {
+		return nil
+	}
+
+	merkleTree := fl.loadMerkleTree(filePath, checksum)
+	if merkleTree != nil {
+		fl.recentTrees.add(checksum, merkleTree)
+	}
+
+	return merkleTree
+}
+
+// linkVersion records the checksum of the file at the given relative path,
+// and returns the checksum of its previous version, if any
+func (fl *FileLister) linkVersion(fileName string, checksum string) string {
+	fl.versionsMux.Lock()
+	defer fl.versionsMux.Unlock()
+
+	if currentChecksum, ok := fl.nameChecksums[fileName]; ok && currentChecksum != checksum {
+		fl.previousChecksums[fileName] = currentChecksum
+	}
+
+	fl.nameChecksums[fileName] = checksum
+
+	return fl.previousChecksums[fileName]
+}
+
+// GetFileByPath returns the current version of the file at the given relative path, if any
+func (fl *FileLister) GetFileByPath(relativePath string) *proto.File {
+	fl.versionsMux.RLock()
+	checksum, ok := fl.nameChecksums[relativePath]
+	fl.versionsMux.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	file, _ := fl.GetFileInfo(checksum)
+
+	return file
 }
 
 // addFile adds a file to the file map
@@ -229,6 +636,7 @@ func (fl *FileLister) removeFile(checksum string) {
 	defer fl.fileMapMux.Unlock()
 
 	delete(fl.fileMap, checksum)
+	fl.recentTrees.remove(checksum)
 }
 
 // GetAvailableFiles returns the available files for sharing in the workspace
@@ -242,5 +650,208 @@ func (fl *FileLister) GetAvailableFiles() []*proto.File {
 		fileList = append(fileList, file)
 	}
 
+	fl.retainedMux.RLock()
+	defer fl.retainedMux.RUnlock()
+
+	for checksum, file := range fl.retainedFiles {
+		// The same content can be both a retained version and a current file
+		if _, current := fl.fileMap[checksum]; !current {
+			fileList = append(fileList, file)
+		}
+	}
+
 	return fileList
 }
+
+// SetVersionsDir sets the directory the previous file versions are kept in.
+// It needs to be set before the file lister is started
+func (fl *FileLister) SetVersionsDir(versionsDir string) error {
+	store, loadErr := loadVersionStore(versionsDir)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	fl.versionStore = store
+
+	return nil
+}
+
+// SetHashAlgorithm sets the algorithm the files are hashed with.
+// It needs to be set before the file lister is started
+func (fl *FileLister) SetHashAlgorithm(algorithm string) {
+	fl.hashAlgorithm = algorithm
+}
+
+// SetBlobStore sets the blob store shared by the file listers of all workspaces.
+// It needs to be set before the file lister is started
+func (fl *FileLister) SetBlobStore(blobStore *BlobStore) {
+	fl.blobStore = blobStore
+}
+
+// SetIgnoreSettings sets the ignore patterns of the workspace, and the minimum age of shared files.
+// The settings are applied on the next directory sweep
+func (fl *FileLister) SetIgnoreSettings(patterns []string, minFileAge time.Duration) {
+	fl.ignoreMux.Lock()
+	defer fl.ignoreMux.Unlock()
+
+	fl.ignorePatterns = patterns
+	fl.minFileAge = minFileAge
+}
+
+// getIgnoreRules returns the ignore rules of the workspace combined with the patterns
+// in the ignore file of the sharing directory, along with the minimum age of shared files
+func (fl *FileLister) getIgnoreRules() (*IgnoreRules, time.Duration) {
+	fl.ignoreMux.RLock()
+	patterns := fl.ignorePatterns
+	minFileAge := fl.minFileAge
+	fl.ignoreMux.RUnlock()
+
+	filePatterns, readErr := readIgnoreFile(fl.baseDir)
+	if readErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to read %s, %v", IgnoreFileName, readErr))
+	}
+
+	return NewIgnoreRules(patterns, filePatterns), minFileAge
+}
+
+// SetRetentionPolicy sets which previous file versions are kept.
+// The policy is applied on the next directory sweep
+func (fl *FileLister) SetRetentionPolicy(policy RetentionPolicy) {
+	fl.retainedMux.Lock()
+	defer fl.retainedMux.Unlock()
+
+	fl.retention = policy
+}
+
+// getRetentionPolicy returns the current retention policy
+func (fl *FileLister) getRetentionPolicy() RetentionPolicy {
+	fl.retainedMux.RLock()
+	defer fl.retainedMux.RUnlock()
+
+	return fl.retention
+}
+
+// retainVersion records the file as the current version of its lineage,
+// and returns its version number, which is 0 if versions aren't retained
+func (fl *FileLister) retainVersion(relativePath string, filePath string, file *proto.File) (int64, bool) {
+	if fl.versionStore == nil || !fl.getRetentionPolicy().Enabled {
+		return 0, false
+	}
+
+	version, changed, recordErr := fl.versionStore.recordCurrent(
+		relativePath,
+		filePath,
+		file.FileChecksum,
+		file.Size,
+		file.DateModified,
+		time.Now(),
+	)
+	if recordErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to retain version of file %s, %v", relativePath, recordErr))
+
+		return 0, false
+	}
+
+	return version.Version, changed
+}
+
+// applyRetention drops the previous versions the retention policy doesn't keep,
+// and updates the retained versions that are shared
+func (fl *FileLister) applyRetention(sharedPaths map[string]bool, changed bool) {
+	if fl.versionStore == nil {
+		return
+	}
+
+	now := time.Now()
+
+	// Files that are gone from the directory are replaced by nothing
+	if fl.versionStore.markRemoved(sharedPaths, now) {
+		changed = true
+	}
+
+	pruned, pruneErr := fl.versionStore.prune(fl.getRetentionPolicy(), now)
+	if pruneErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to remove dropped versions, %v", pruneErr))
+	}
+
+	if changed || pruned {
+		if saveErr := fl.versionStore.save(); saveErr != nil {
+			fl.logger.Error(fmt.Sprintf("Unable to save version index, %v", saveErr))
+		}
+	}
+
+	fl.updateRetainedFiles()
+}
+
+// updateRetainedFiles rebuilds the retained versions that are shared out of the version index
+func (fl *FileLister) updateRetainedFiles() {
+	fl.retainedMux.RLock()
+	previousFiles := fl.retainedFiles
+	fl.retainedMux.RUnlock()
+
+	retainedFiles := make(map[string]*proto.File)
+
+	for relativePath, lineage := range fl.versionStore.lineages {
+		for index, version := range lineage {
+			if version.ReplacedAt == 0 {
+				continue
+			}
+
+			if _, found := retainedFiles[version.Checksum]; found {
+				// The same content is retained more than once
+				continue
+			}
+
+			protoFile := versionToFileProto(relativePath, version)
+			if index > 0 {
+				protoFile.PreviousChecksum = lineage[index-1].Checksum
+			}
+
+			if previousFile, verified := previousFiles[version.Checksum]; verified {
+				protoFile.MerkleRoot = previousFile.MerkleRoot
+				protoFile.ChunkSize = previousFile.ChunkSize
+			} else {
+				// The copy is hashed again, so a damaged copy is never shared.
+				// Versions retained before the workspace algorithm changed keep their own algorithm
+				blobPath := fl.versionStore.blobPath(version.Checksum)
+
+				checksum, merkleTree, checksumErr := hashFile(blobPath, ChecksumAlgorithm(version.Checksum))
+				if checksumErr != nil || !SameChecksum(checksum, version.Checksum) {
+					fl.logger.Error(fmt.Sprintf("Unable to verify retained version %s of file %s", version.Checksum, relativePath))
+
+					continue
+				}
+
+				if info, statErr := os.Stat(blobPath); statErr == nil {
+					fl.saveCachedChecksum(blobPath, info, checksum, merkleTree)
+				}
+
+				protoFile.MerkleRoot = hex.EncodeToString(merkleTree.Root())
+				protoFile.ChunkSize = MerkleChunkSize
+			}
+
+			retainedFiles[version.Checksum] = protoFile
+		}
+	}
+
+	fl.retainedMux.Lock()
+	defer fl.retainedMux.Unlock()
+
+	fl.retainedFiles = retainedFiles
+}
+
+// versionToFileProto converts the retained version of the file at the relative path into proto format
+func versionToFileProto(relativePath string, version *fileVersion) *proto.File {
+	relativeDir, fileName := path.Split(relativePath)
+
+	return &proto.File{
+		Name:         fileNameWithoutExtension(fileName),
+		Extension:    filepath.Ext(fileName),
+		Size:         version.Size,
+		DateModified: version.DateModified,
+		FileChecksum: version.Checksum,
+		Path:         strings.TrimSuffix(relativeDir, "/"),
+		Version:      version.Version,
+		Retained:     true,
+	}
+}
@@ -0,0 +1,151 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanRelativePath(t *testing.T) {
+	testTable := []struct {
+		name         string
+		relativePath string
+		expectedPath string
+		expectedErr  error
+	}{
+		{
+			"Root directory",
+			"",
+			"",
+			nil,
+		},
+		{
+			"Nested directory",
+			"datasets/2021/",
+			"datasets/2021",
+			nil,
+		},
+		{
+			"Directory that stays within the base",
+			"datasets/../sources",
+			"sources",
+			nil,
+		},
+		{
+			"Absolute path",
+			"/etc",
+			"",
+			ErrInvalidPath,
+		},
+		{
+			"Path that leaves the base",
+			"datasets/../../etc",
+			"",
+			ErrInvalidPath,
+		},
+		{
+			"Backslash separators",
+			"..\\etc",
+			"",
+			ErrInvalidPath,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cleanPath, cleanErr := CleanRelativePath(testCase.relativePath)
+
+			assert.Equal(t, testCase.expectedPath, cleanPath)
+			assert.ErrorIs(t, cleanErr, testCase.expectedErr)
+		})
+	}
+}
+
+func TestFileLister_SweepDirectoryTree(t *testing.T) {
+	baseDir := t.TempDir()
+
+	filePaths := map[string]string{
+		"readme.md":                  "readme",
+		"datasets/train.csv":         "a,b,c",
+		"datasets/2021/validate.csv": "d,e,f",
+	}
+
+	for filePath, content := range filePaths {
+		fullPath := filepath.Join(baseDir, filepath.FromSlash(filePath))
+
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0700))
+		assert.NoError(t, os.WriteFile(fullPath, []byte(content), 0600))
+	}
+
+	fileLister := NewFileLister(hclog.NewNullLogger(), baseDir, time.Minute)
+	fileLister.sweepDirectory()
+
+	availableFiles := fileLister.GetAvailableFiles()
+	assert.Len(t, availableFiles, len(filePaths))
+
+	for _, file := range availableFiles {
+		relativePath := JoinRelativePath(file.Path, file.Name+file.Extension)
+
+		content, ok := filePaths[relativePath]
+		assert.True(t, ok, relativePath)
+		assert.Equal(t, int64(len(content)), file.Size)
+
+		assert.Equal(t, file, fileLister.GetFileByPath(relativePath))
+	}
+}
+
+func TestFileLister_RetainVersions(t *testing.T) {
+	baseDir := t.TempDir()
+	versionsDir := t.TempDir()
+	filePath := filepath.Join(baseDir, "notes", "todo.txt")
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0700))
+
+	fileLister := NewFileLister(hclog.NewNullLogger(), baseDir, time.Minute)
+	assert.NoError(t, fileLister.SetVersionsDir(versionsDir))
+	fileLister.SetRetentionPolicy(RetentionPolicy{Enabled: true, MaxVersions: 1})
+
+	checksums := make([]string, 0)
+	for _, content := range []string{"first", "second", "third"} {
+		assert.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+		fileLister.sweepDirectory()
+
+		current := fileLister.GetFileByPath("notes/todo.txt")
+		checksums = append(checksums, current.FileChecksum)
+
+		assert.Equal(t, int64(len(checksums)), current.Version)
+		assert.False(t, current.Retained)
+	}
+
+	// Only the newest previous version is kept
+	availableFiles := fileLister.GetAvailableFiles()
+	assert.Len(t, availableFiles, 2)
+
+	retained, _ := fileLister.GetFileInfo(checksums[1])
+	assert.True(t, retained.Retained)
+	assert.Equal(t, int64(2), retained.Version)
+	assert.Equal(t, "notes", retained.Path)
+	assert.Equal(t, "todo", retained.Name)
+	assert.Equal(t, "", retained.PreviousChecksum)
+	assert.Equal(t, checksums[1], fileLister.GetFileByPath("notes/todo.txt").PreviousChecksum)
+	assert.NotNil(t, fileLister.GetMerkleTree(checksums[1]))
+
+	content, readErr := os.ReadFile(fileLister.GetFilePath(checksums[1]))
+	assert.NoError(t, readErr)
+	assert.Equal(t, "second", string(content))
+
+	dropped, _ := fileLister.GetFileInfo(checksums[0])
+	assert.Nil(t, dropped)
+	assert.NoFileExists(t, filepath.Join(versionsDir, checksums[0]))
+
+	// Disabling the retention drops the previous versions
+	fileLister.SetRetentionPolicy(RetentionPolicy{})
+	fileLister.sweepDirectory()
+
+	assert.Len(t, fileLister.GetAvailableFiles(), 1)
+	assert.Equal(t, int64(0), fileLister.GetFileByPath("notes/todo.txt").Version)
+}
@@ -0,0 +1,253 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	changeDebounce    = 500 * time.Millisecond // time the changes need to settle before they are scanned
+	maxChangeDelay    = 5 * time.Second        // max time changes wait for a busy directory to settle
+	reconcileInterval = 5 * time.Minute        // interval of the sweeps that catch the changes the watcher missed
+)
+
+// startWatcher starts watching the sharing directory for changes.
+// Returns false if changes can't be watched, in which case the directory is only swept
+func (fl *FileLister) startWatcher() bool {
+	watcher, watchErr := fsnotify.NewWatcher()
+	if watchErr != nil {
+		fl.logger.Error(fmt.Sprintf("Unable to watch directory for changes, %v", watchErr))
+
+		return false
+	}
+
+	fl.changesMux.Lock()
+	fl.watcher = watcher
+	fl.changesMux.Unlock()
+
+	go fl.watchLoop(watcher)
+
+	return true
+}
+
+// stopWatcher stops watching the sharing directory, and drops the changes that weren't scanned
+func (fl *FileLister) stopWatcher() {
+	fl.changesMux.Lock()
+	watcher := fl.watcher
+	fl.watcher = nil
+
+	if fl.changeTimer != nil {
+		fl.changeTimer.Stop()
+		fl.changeTimer = nil
+	}
+
+	for _, recheckTimer := range fl.youngFiles {
+		recheckTimer.Stop()
+	}
+
+	fl.pendingChanges = make(map[string]bool)
+	fl.youngFiles = make(map[string]*time.Timer)
+	fl.changesMux.Unlock()
+
+	if watcher != nil {
+		_ = watcher.Close()
+	}
+}
+
+// watchDirectory adds the directory to the watched directories, if the directory is watched.
+// Directories are watched one by one, as the watches don't cover subdirectories
+func (fl *FileLister) watchDirectory(dirPath string) {
+	fl.changesMux.Lock()
+	watcher := fl.watcher
+	fl.changesMux.Unlock()
+
+	if watcher == nil {
+		return
+	}
+
+	if watchErr := watcher.Add(dirPath); watchErr != nil {
+		// Changes in the directory are picked up by the reconciliation sweeps
+		fl.logger.Error(fmt.Sprintf("Unable to watch directory %s, %v", dirPath, watchErr))
+	}
+}
+
+// watchLoop queues the changes the watcher reports, until the watcher is closed
+func (fl *FileLister) watchLoop(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op == fsnotify.Chmod {
+				// Permission changes don't change the shared content
+				continue
+			}
+
+			fl.queueChange(event.Name, changeDebounce)
+		case watchErr, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			// Changes might have been dropped, so the whole directory is checked again
+			fl.logger.Error(fmt.Sprintf("Directory watcher error, %v", watchErr))
+
+			go fl.sweepDirectory()
+		}
+	}
+}
+
+// queueChange queues the changed path to be scanned after the delay.
+// Every new change restarts the delay, up to the max change delay
+func (fl *FileLister) queueChange(changedPath string, delay time.Duration) {
+	fl.changesMux.Lock()
+	defer fl.changesMux.Unlock()
+
+	if fl.watcher == nil {
+		// Without the watcher, the change is picked up by the next sweep
+		return
+	}
+
+	if len(fl.pendingChanges) == 0 {
+		fl.changesSince = time.Now()
+	}
+
+	fl.pendingChanges[changedPath] = true
+
+	if fl.changeTimer != nil {
+		if time.Since(fl.changesSince) >= maxChangeDelay {
+			// The directory is busy, the queued changes are scanned without waiting further
+			return
+		}
+
+		fl.changeTimer.Stop()
+	}
+
+	fl.changeTimer = time.AfterFunc(delay, fl.processChanges)
+}
+
+// queueYoungFile queues the file again once it's old enough to be shared.
+// Young files wait on their own timers, so they don't hold up the other changes
+func (fl *FileLister) queueYoungFile(filePath string, delay time.Duration) {
+	fl.changesMux.Lock()
+	defer fl.changesMux.Unlock()
+
+	if fl.watcher == nil {
+		return
+	}
+
+	if previousTimer, ok := fl.youngFiles[filePath]; ok {
+		previousTimer.Stop()
+	}
+
+	var recheckTimer *time.Timer
+	recheckTimer = time.AfterFunc(delay, func() {
+		fl.changesMux.Lock()
+		if fl.youngFiles[filePath] == recheckTimer {
+			delete(fl.youngFiles, filePath)
+		}
+		fl.changesMux.Unlock()
+
+		fl.queueChange(filePath, changeDebounce)
+	})
+
+	fl.youngFiles[filePath] = recheckTimer
+}
+
+// processChanges scans the queued changes
+func (fl *FileLister) processChanges() {
+	fl.changesMux.Lock()
+	changedPaths := fl.pendingChanges
+	fl.pendingChanges = make(map[string]bool)
+	fl.changeTimer = nil
+	fl.changesMux.Unlock()
+
+	if len(changedPaths) == 0 {
+		return
+	}
+
+	if changedPaths[filepath.Join(fl.baseDir, IgnoreFileName)] {
+		// Changed ignore patterns can affect any file in the directory
+		fl.sweepDirectory()
+
+		return
+	}
+
+	fl.scanChanges(changedPaths)
+}
+
+// scanChanges scans the changed paths, and updates the file map.
+// Only the changed files are hashed, the rest of the scanned files are kept as they are
+func (fl *FileLister) scanChanges(changedPaths map[string]bool) {
+	fl.scanMux.Lock()
+	defer fl.scanMux.Unlock()
+
+	ignoreRules, minFileAge := fl.getIgnoreRules()
+	now := time.Now()
+
+	versionsChanged := false
+	changedFiles := make([]*hashedFile, 0, len(changedPaths))
+	for changedPath := range changedPaths {
+		relativePath, relErr := filepath.Rel(fl.baseDir, changedPath)
+		if relErr != nil || relativePath == "." || strings.HasPrefix(relativePath, "..") {
+			continue
+		}
+
+		relativePath = filepath.ToSlash(relativePath)
+
+		// Whatever was at the path before is replaced with what is there now
+		fl.forgetScannedPath(relativePath)
+
+		info, statErr := os.Lstat(changedPath)
+		if statErr != nil {
+			// The path was removed
+			fl.forgetCachedChecksums(changedPath)
+
+			continue
+		}
+
+		if ignoreRules.Ignored(relativePath, info.IsDir()) {
+			continue
+		}
+
+		if info.IsDir() {
+			// The directory was created or moved in, along with its files
+			versionsChanged = fl.scanTree(changedPath, ignoreRules, minFileAge, fl.scannedFiles) || versionsChanged
+
+			continue
+		}
+
+		if now.Sub(info.ModTime()) < minFileAge {
+			// The file might still be written to, it's checked again once it's old enough
+			fl.queueYoungFile(changedPath, minFileAge-now.Sub(info.ModTime()))
+
+			continue
+		}
+
+		changedFiles = append(changedFiles, &hashedFile{filePath: changedPath, info: info})
+	}
+
+	versionsChanged = fl.addHashedFiles(changedFiles, fl.scannedFiles) || versionsChanged
+
+	fl.publishScan(versionsChanged)
+}
+
+// forgetScannedPath drops the scanned file at the relative path,
+// or all scanned files under it if the path was a directory
+func (fl *FileLister) forgetScannedPath(relativePath string) {
+	delete(fl.scannedFiles, relativePath)
+
+	dirPrefix := relativePath + "/"
+	for scannedPath := range fl.scannedFiles {
+		if strings.HasPrefix(scannedPath, dirPrefix) {
+			delete(fl.scannedFiles, scannedPath)
+		}
+	}
+}
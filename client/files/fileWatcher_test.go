@@ -0,0 +1,153 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLister_WatchChanges(t *testing.T) {
+	baseDir := t.TempDir()
+
+	fileLister := NewFileLister(hclog.NewNullLogger(), baseDir, time.Hour)
+	fileLister.SetIgnoreSettings(nil, 0)
+	fileLister.Start()
+	defer fileLister.Stop()
+
+	// Wait for the watcher to start
+	assert.Eventually(t, func() bool {
+		fileLister.changesMux.Lock()
+		defer fileLister.changesMux.Unlock()
+
+		return fileLister.watcher != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	fileLister.watchDirectory(baseDir)
+
+	sharedFile := func(relativePath string) func() bool {
+		return func() bool {
+			return fileLister.GetFileByPath(relativePath) != nil
+		}
+	}
+
+	testTable := []struct {
+		name         string
+		changeFn     func()
+		relativePath string
+		shared       bool
+	}{
+		{
+			"File created",
+			func() {
+				assert.NoError(t, os.WriteFile(filepath.Join(baseDir, "readme.md"), []byte("readme"), 0600))
+			},
+			"readme.md",
+			true,
+		},
+		{
+			"Directory moved in",
+			func() {
+				outsideDir := filepath.Join(t.TempDir(), "datasets")
+				assert.NoError(t, os.MkdirAll(filepath.Join(outsideDir, "2021"), 0700))
+				assert.NoError(t, os.WriteFile(filepath.Join(outsideDir, "2021", "train.csv"), []byte("a,b"), 0600))
+
+				assert.NoError(t, os.Rename(outsideDir, filepath.Join(baseDir, "datasets")))
+			},
+			"datasets/2021/train.csv",
+			true,
+		},
+		{
+			"File created in a new directory",
+			func() {
+				assert.NoError(t, os.WriteFile(filepath.Join(baseDir, "datasets", "2021", "test.csv"), []byte("c,d"), 0600))
+			},
+			"datasets/2021/test.csv",
+			true,
+		},
+		{
+			"File removed",
+			func() {
+				assert.NoError(t, os.Remove(filepath.Join(baseDir, "readme.md")))
+			},
+			"readme.md",
+			false,
+		},
+		{
+			"Directory removed",
+			func() {
+				assert.NoError(t, os.RemoveAll(filepath.Join(baseDir, "datasets")))
+			},
+			"datasets/2021/test.csv",
+			false,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.changeFn()
+
+			if testCase.shared {
+				assert.Eventually(t, sharedFile(testCase.relativePath), 5*time.Second, 50*time.Millisecond)
+			} else {
+				assert.Eventually(t, func() bool {
+					return !sharedFile(testCase.relativePath)()
+				}, 5*time.Second, 50*time.Millisecond)
+			}
+		})
+	}
+
+	assert.Empty(t, fileLister.GetAvailableFiles())
+}
+
+func TestFileLister_WatchYoungFiles(t *testing.T) {
+	const minFileAge = 2 * time.Second
+
+	baseDir := t.TempDir()
+
+	fileLister := NewFileLister(hclog.NewNullLogger(), baseDir, time.Hour)
+	fileLister.SetIgnoreSettings(nil, minFileAge)
+	fileLister.Start()
+	defer fileLister.Stop()
+
+	assert.Eventually(t, func() bool {
+		fileLister.changesMux.Lock()
+		defer fileLister.changesMux.Unlock()
+
+		return fileLister.watcher != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	fileLister.watchDirectory(baseDir)
+
+	// The young file is still being written to
+	writeStart := time.Now()
+	assert.NoError(t, os.WriteFile(filepath.Join(baseDir, "recording.wav"), []byte("partial"), 0600))
+
+	assert.Eventually(t, func() bool {
+		fileLister.changesMux.Lock()
+		defer fileLister.changesMux.Unlock()
+
+		_, waiting := fileLister.youngFiles[filepath.Join(baseDir, "recording.wav")]
+
+		return waiting
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A file that's old enough is shared without waiting for the young file
+	oldFile := filepath.Join(baseDir, "notes.txt")
+	assert.NoError(t, os.WriteFile(oldFile, []byte("notes"), 0600))
+
+	oldTime := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(oldFile, oldTime, oldTime))
+
+	assert.Eventually(t, func() bool {
+		return fileLister.GetFileByPath("notes.txt") != nil
+	}, minFileAge, 10*time.Millisecond)
+	assert.Nil(t, fileLister.GetFileByPath("recording.wav"))
+
+	// The young file is shared once it's old enough
+	assert.Eventually(t, func() bool {
+		return fileLister.GetFileByPath("recording.wav") != nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(writeStart), minFileAge)
+}
@@ -0,0 +1,191 @@
+package files
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the name of the file with the ignore patterns of a sharing directory
+const IgnoreFileName = ".peerdropignore"
+
+// defaultIgnorePatterns are files that are never worth sharing.
+// They can be shared anyway with a negated pattern
+var defaultIgnorePatterns = []string{
+	".DS_Store",
+	"Thumbs.db",
+	"desktop.ini",
+	"*.swp",
+	"*.swo",
+	"*~",
+	".#*",
+}
+
+// ignorePattern is a single gitignore-style pattern
+type ignorePattern struct {
+	segments []string // pattern split on slashes, "**" matches any number of directories
+	negate   bool     // the pattern includes the paths an earlier pattern excluded
+	dirOnly  bool     // the pattern only matches directories
+	anchored bool     // the pattern is matched from the base directory, not at any depth
+}
+
+// IgnoreRules decide which files in the sharing directory are not shared.
+// Patterns follow the gitignore syntax, and the last pattern that matches a path wins
+type IgnoreRules struct {
+	patterns []ignorePattern
+}
+
+// NewIgnoreRules parses the gitignore-style patterns, on top of the default ones.
+// Empty lines and lines starting with # are skipped
+func NewIgnoreRules(patterns ...[]string) *IgnoreRules {
+	rules := &IgnoreRules{
+		patterns: make([]ignorePattern, 0),
+	}
+
+	rules.add(defaultIgnorePatterns)
+
+	for _, patternList := range patterns {
+		rules.add(patternList)
+	}
+
+	return rules
+}
+
+// add parses and adds the patterns to the rules
+func (ir *IgnoreRules) add(patterns []string) {
+	for _, line := range patterns {
+		if pattern, ok := parseIgnorePattern(line); ok {
+			ir.patterns = append(ir.patterns, pattern)
+		}
+	}
+}
+
+// parseIgnorePattern parses a single line of an ignore file
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	pattern := ignorePattern{}
+
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	}
+
+	// Escaped leading characters are taken literally
+	if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// Patterns with a slash anywhere but at the end are relative to the base directory
+	if strings.Contains(line, "/") {
+		pattern.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	pattern.segments = strings.Split(line, "/")
+
+	return pattern, true
+}
+
+// Ignored checks if the path, relative to the sharing directory, is left out of sharing.
+// Only the path itself is checked, paths in ignored directories need to be skipped by the caller
+func (ir *IgnoreRules) Ignored(relativePath string, isDir bool) bool {
+	relativePath = strings.Trim(filepath.ToSlash(relativePath), "/")
+	if relativePath == "" || relativePath == "." {
+		return false
+	}
+
+	if relativePath == IgnoreFileName {
+		// The patterns themselves are never shared
+		return true
+	}
+
+	pathSegments := strings.Split(relativePath, "/")
+
+	ignored := false
+	for _, pattern := range ir.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+
+		if pattern.matches(pathSegments) {
+			ignored = !pattern.negate
+		}
+	}
+
+	return ignored
+}
+
+// matches checks if the pattern matches the path
+func (p ignorePattern) matches(pathSegments []string) bool {
+	if !p.anchored {
+		// Patterns without a slash match the name at any depth
+		matched, _ := path.Match(p.segments[0], pathSegments[len(pathSegments)-1])
+
+		return matched
+	}
+
+	return matchSegments(p.segments, pathSegments)
+}
+
+// matchSegments matches the pattern segments against the path segments.
+// A "**" segment matches any number of path segments, including none
+func matchSegments(patternSegments []string, pathSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(pathSegments) == 0
+	}
+
+	if patternSegments[0] == "**" {
+		for i := 0; i <= len(pathSegments); i++ {
+			if matchSegments(patternSegments[1:], pathSegments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(pathSegments) == 0 {
+		return false
+	}
+
+	matched, _ := path.Match(patternSegments[0], pathSegments[0])
+
+	return matched && matchSegments(patternSegments[1:], pathSegments[1:])
+}
+
+// readIgnoreFile reads the patterns from the ignore file in the directory, if there is one
+func readIgnoreFile(dir string) ([]string, error) {
+	f, openErr := os.Open(filepath.Join(dir, IgnoreFileName))
+	if openErr != nil {
+		if os.IsNotExist(openErr) {
+			return nil, nil
+		}
+
+		return nil, openErr
+	}
+	defer f.Close()
+
+	patterns := make([]string, 0)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+
+	return patterns, scanner.Err()
+}
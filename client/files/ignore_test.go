@@ -0,0 +1,156 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreRules_Ignored(t *testing.T) {
+	testTable := []struct {
+		name         string
+		patterns     []string
+		relativePath string
+		isDir        bool
+		ignored      bool
+	}{
+		{
+			"Default pattern",
+			nil,
+			"notes/.DS_Store",
+			false,
+			true,
+		},
+		{
+			"Editor swap file",
+			nil,
+			"notes/.todo.md.swp",
+			false,
+			true,
+		},
+		{
+			"Ignore file",
+			nil,
+			IgnoreFileName,
+			false,
+			true,
+		},
+		{
+			"Regular file",
+			[]string{"*.log"},
+			"notes/todo.md",
+			false,
+			false,
+		},
+		{
+			"Name pattern at any depth",
+			[]string{"*.log"},
+			"build/logs/debug.log",
+			false,
+			true,
+		},
+		{
+			"Negated pattern",
+			[]string{"*.log", "!keep.log"},
+			"logs/keep.log",
+			false,
+			false,
+		},
+		{
+			"Directory pattern on a directory",
+			[]string{"node_modules/"},
+			"web/node_modules",
+			true,
+			true,
+		},
+		{
+			"Directory pattern on a file",
+			[]string{"node_modules/"},
+			"web/node_modules",
+			false,
+			false,
+		},
+		{
+			"Anchored pattern",
+			[]string{"/build"},
+			"web/build",
+			true,
+			false,
+		},
+		{
+			"Double star pattern",
+			[]string{"datasets/**/*.tmp"},
+			"datasets/2021/raw/part.tmp",
+			false,
+			true,
+		},
+		{
+			"Comments and empty lines",
+			[]string{"# *.csv", ""},
+			"datasets/train.csv",
+			false,
+			false,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			rules := NewIgnoreRules(testCase.patterns)
+
+			assert.Equal(t, testCase.ignored, rules.Ignored(testCase.relativePath, testCase.isDir))
+		})
+	}
+}
+
+func TestFileLister_IgnoredFiles(t *testing.T) {
+	baseDir := t.TempDir()
+
+	filePaths := map[string]string{
+		IgnoreFileName:           "*.tmp\nbuild/\n",
+		"readme.md":              "readme",
+		"draft.tmp":              "draft",
+		"notes.txt":              "notes",
+		"build/output.bin":       "output",
+		"datasets/.DS_Store":     "finder",
+		"datasets/train.csv":     "a,b,c",
+		"datasets/partial.csv":   "d,e",
+		"datasets/2021/test.log": "log",
+	}
+
+	for filePath, content := range filePaths {
+		fullPath := filepath.Join(baseDir, filepath.FromSlash(filePath))
+
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0700))
+		assert.NoError(t, os.WriteFile(fullPath, []byte(content), 0600))
+
+		// Files are old enough to be shared, unless they are still being written
+		if filePath != "datasets/partial.csv" {
+			past := time.Now().Add(-time.Minute)
+			assert.NoError(t, os.Chtimes(fullPath, past, past))
+		}
+	}
+
+	fileLister := NewFileLister(hclog.NewNullLogger(), baseDir, time.Minute)
+	fileLister.SetIgnoreSettings([]string{"*.log", "notes.txt"}, 10*time.Second)
+	fileLister.sweepDirectory()
+
+	sharedPaths := make([]string, 0)
+	for _, file := range fileLister.GetAvailableFiles() {
+		sharedPaths = append(sharedPaths, JoinRelativePath(file.Path, file.Name+file.Extension))
+	}
+
+	sort.Strings(sharedPaths)
+	assert.Equal(t, []string{"datasets/train.csv", "readme.md"}, sharedPaths)
+
+	// The ignore file can share what the workspace patterns leave out
+	assert.NoError(t, os.WriteFile(filepath.Join(baseDir, IgnoreFileName), []byte("!notes.txt\n"), 0600))
+	fileLister.sweepDirectory()
+
+	assert.NotNil(t, fileLister.GetFileByPath("notes.txt"))
+	assert.NotNil(t, fileLister.GetFileByPath("build/output.bin"))
+}
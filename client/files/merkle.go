@@ -0,0 +1,178 @@
+package files
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// MerkleChunkSize is the size of a single Merkle tree leaf.
+// It matches the size of the chunks sent during file transfers,
+// so every received chunk can be checked against its own leaf
+const MerkleChunkSize = int64(64 * 1024) // 64 KiB
+
+// Leaves and inner nodes are hashed with different prefixes,
+// so an inner node can never be passed off as a leaf
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+var errInvalidLeafIndex = errors.New("invalid leaf index")
+
+// MerkleTree is a binary hash tree built over the file chunks.
+// When a level has an odd number of nodes, the last node is promoted to the next level
+type MerkleTree struct {
+	levels [][][]byte // levels[0] are the leaves, the last level is the root
+}
+
+// HashMerkleLeaf hashes the chunk data into a Merkle tree leaf
+func HashMerkleLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(data)
+
+	return h.Sum(nil)
+}
+
+// hashMerkleNode hashes two child nodes into their parent node
+func hashMerkleNode(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+
+	return h.Sum(nil)
+}
+
+// NewMerkleTree builds a Merkle tree out of the given leaf hashes
+func NewMerkleTree(leaves [][]byte) *MerkleTree {
+	if len(leaves) == 0 {
+		// Empty files still have a root
+		leaves = [][]byte{HashMerkleLeaf(nil)}
+	}
+
+	levels := [][][]byte{leaves}
+	for level := leaves; len(level) > 1; {
+		nextLevel := make([][]byte, 0, (len(level)+1)/2)
+
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				nextLevel = append(nextLevel, level[i])
+
+				continue
+			}
+
+			nextLevel = append(nextLevel, hashMerkleNode(level[i], level[i+1]))
+		}
+
+		levels = append(levels, nextLevel)
+		level = nextLevel
+	}
+
+	return &MerkleTree{
+		levels: levels,
+	}
+}
+
+// NewMerkleTreeFromReader builds a Merkle tree over the reader data,
+// split into chunks of the given size
+func NewMerkleTreeFromReader(reader io.Reader, chunkSize int64) (*MerkleTree, error) {
+	leaves := make([][]byte, 0)
+	buf := make([]byte, chunkSize)
+
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			leaves = append(leaves, HashMerkleLeaf(buf[:n]))
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewMerkleTree(leaves), nil
+}
+
+// Root returns the root hash of the tree
+func (mt *MerkleTree) Root() []byte {
+	return mt.levels[len(mt.levels)-1][0]
+}
+
+// NumLeaves returns the number of leaves in the tree
+func (mt *MerkleTree) NumLeaves() int64 {
+	return int64(len(mt.levels[0]))
+}
+
+// Leaf returns the leaf hash at the given index
+func (mt *MerkleTree) Leaf(index int64) ([]byte, error) {
+	if index < 0 || index >= mt.NumLeaves() {
+		return nil, errInvalidLeafIndex
+	}
+
+	return mt.levels[0][index], nil
+}
+
+// Proof returns the sibling hashes needed to get from the leaf at the given index to the root
+func (mt *MerkleTree) Proof(index int64) ([][]byte, error) {
+	if index < 0 || index >= mt.NumLeaves() {
+		return nil, errInvalidLeafIndex
+	}
+
+	proof := make([][]byte, 0)
+	for _, level := range mt.levels[:len(mt.levels)-1] {
+		sibling := index ^ 1
+		if sibling < int64(len(level)) {
+			proof = append(proof, level[sibling])
+		}
+
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof checks if the leaf hash is at the given index
+// of the tree with the given root and number of leaves
+func VerifyMerkleProof(root []byte, leaf []byte, index int64, numLeaves int64, proof [][]byte) bool {
+	if index < 0 || index >= numLeaves {
+		return false
+	}
+
+	hash := leaf
+	for levelSize := numLeaves; levelSize > 1; levelSize = (levelSize + 1) / 2 {
+		sibling := index ^ 1
+		if sibling < levelSize {
+			if len(proof) == 0 {
+				return false
+			}
+
+			if index%2 == 0 {
+				hash = hashMerkleNode(hash, proof[0])
+			} else {
+				hash = hashMerkleNode(proof[0], hash)
+			}
+
+			proof = proof[1:]
+		}
+
+		index /= 2
+	}
+
+	return len(proof) == 0 && bytes.Equal(hash, root)
+}
+
+// NumMerkleLeaves returns the number of Merkle tree leaves for a file of the given size
+func NumMerkleLeaves(fileSize int64, chunkSize int64) int64 {
+	if fileSize == 0 {
+		return 1
+	}
+
+	return (fileSize + chunkSize - 1) / chunkSize
+}
@@ -0,0 +1,104 @@
+package files
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generateLeaves generates a number of distinct leaf hashes
+func generateLeaves(numLeaves int) [][]byte {
+	leaves := make([][]byte, numLeaves)
+	for i := range leaves {
+		leaves[i] = HashMerkleLeaf([]byte{byte(i)})
+	}
+
+	return leaves
+}
+
+func TestMerkleTree_Proof(t *testing.T) {
+	testTable := []struct {
+		name      string
+		numLeaves int
+	}{
+		{
+			"Single leaf",
+			1,
+		},
+		{
+			"Even number of leaves",
+			8,
+		},
+		{
+			"Odd number of leaves",
+			7,
+		},
+		{
+			"Promoted node on multiple levels",
+			11,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			leaves := generateLeaves(testCase.numLeaves)
+			tree := NewMerkleTree(leaves)
+
+			for index, leaf := range leaves {
+				proof, proofErr := tree.Proof(int64(index))
+				assert.NoError(t, proofErr)
+
+				// The leaf is valid at its own position
+				assert.True(
+					t,
+					VerifyMerkleProof(tree.Root(), leaf, int64(index), tree.NumLeaves(), proof),
+				)
+
+				// The leaf is not valid at any other position
+				for otherIndex := range leaves {
+					if otherIndex != index {
+						assert.False(
+							t,
+							VerifyMerkleProof(tree.Root(), leaf, int64(otherIndex), tree.NumLeaves(), proof),
+						)
+					}
+				}
+
+				// A different leaf is not valid at this position
+				assert.False(
+					t,
+					VerifyMerkleProof(tree.Root(), HashMerkleLeaf([]byte("tampered")), int64(index), tree.NumLeaves(), proof),
+				)
+			}
+		})
+	}
+}
+
+func TestMerkleTree_FromReader(t *testing.T) {
+	data := bytes.Repeat([]byte("peer_drop"), 100)
+	chunkSize := int64(64)
+
+	tree, treeErr := NewMerkleTreeFromReader(bytes.NewReader(data), chunkSize)
+	assert.NoError(t, treeErr)
+
+	assert.Equal(t, NumMerkleLeaves(int64(len(data)), chunkSize), tree.NumLeaves())
+
+	// The leaves match the chunks
+	for index := int64(0); index < tree.NumLeaves(); index++ {
+		end := (index + 1) * chunkSize
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+
+		leaf, leafErr := tree.Leaf(index)
+		assert.NoError(t, leafErr)
+		assert.Equal(t, HashMerkleLeaf(data[index*chunkSize:end]), leaf)
+	}
+
+	// Empty data still has a single leaf
+	emptyTree, emptyErr := NewMerkleTreeFromReader(bytes.NewReader(nil), chunkSize)
+	assert.NoError(t, emptyErr)
+	assert.Equal(t, int64(1), emptyTree.NumLeaves())
+	assert.Equal(t, HashMerkleLeaf(nil), emptyTree.Root())
+}
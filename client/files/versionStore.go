@@ -0,0 +1,277 @@
+package files
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// versionIndexFile is the name of the version index in the versions directory
+const versionIndexFile = "index.json"
+
+// RetentionPolicy decides which previous versions of the shared files are kept
+type RetentionPolicy struct {
+	Enabled     bool
+	MaxVersions int           // max number of previous versions kept per file, 0 means no limit
+	MaxAge      time.Duration // time a replaced version is kept for, 0 means no limit
+}
+
+// fileVersion is a single version in the lineage of a shared file
+type fileVersion struct {
+	Checksum     string `json:"checksum"`
+	Version      int64  `json:"version"`
+	Size         int64  `json:"size"`
+	DateModified int64  `json:"dateModified"` // unix
+	ReplacedAt   int64  `json:"replacedAt"`   // unix, 0 while the version is the current one
+}
+
+// versionStore keeps a copy of every version of the shared files in the versions directory.
+// The copies are named by their checksum, and the lineages are saved in the version index
+type versionStore struct {
+	dir      string
+	lineages map[string][]*fileVersion // relative file path -> versions, oldest first
+}
+
+// loadVersionStore loads the version index from the versions directory
+func loadVersionStore(dir string) (*versionStore, error) {
+	vs := &versionStore{
+		dir:      dir,
+		lineages: make(map[string][]*fileVersion),
+	}
+
+	data, readErr := os.ReadFile(filepath.Join(dir, versionIndexFile))
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
+			return vs, nil
+		}
+
+		return nil, readErr
+	}
+
+	if unmarshalErr := json.Unmarshal(data, &vs.lineages); unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return vs, nil
+}
+
+// save saves the version index
+func (vs *versionStore) save() error {
+	data, marshalErr := json.Marshal(vs.lineages)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	indexPath := filepath.Join(vs.dir, versionIndexFile)
+	if writeErr := os.WriteFile(indexPath+".tmp", data, 0600); writeErr != nil {
+		return writeErr
+	}
+
+	return os.Rename(indexPath+".tmp", indexPath)
+}
+
+// blobPath returns the path of the copy of the version with the given checksum
+func (vs *versionStore) blobPath(checksum string) string {
+	return filepath.Join(vs.dir, checksum)
+}
+
+// current returns the current version of the file at the relative path, if any
+func (vs *versionStore) current(relativePath string) *fileVersion {
+	lineage := vs.lineages[relativePath]
+	if len(lineage) == 0 || lineage[len(lineage)-1].ReplacedAt != 0 {
+		return nil
+	}
+
+	return lineage[len(lineage)-1]
+}
+
+// recordCurrent saves the file at the source path as the current version of its lineage.
+// The previous current version, if any, is marked as replaced
+func (vs *versionStore) recordCurrent(
+	relativePath string,
+	sourcePath string,
+	checksum string,
+	size int64,
+	dateModified int64,
+	now time.Time,
+) (*fileVersion, bool, error) {
+	current := vs.current(relativePath)
+	if current != nil && current.Checksum == checksum {
+		return current, false, nil
+	}
+
+	if current != nil && SameChecksum(current.Checksum, checksum) {
+		// The content didn't change, only the encoding of its checksum did
+		if copyErr := vs.copyBlob(sourcePath, checksum); copyErr != nil {
+			return nil, false, copyErr
+		}
+
+		current.Checksum = checksum
+
+		return current, true, nil
+	}
+
+	if copyErr := vs.copyBlob(sourcePath, checksum); copyErr != nil {
+		return nil, false, copyErr
+	}
+
+	lineage := vs.lineages[relativePath]
+
+	newVersion := &fileVersion{
+		Checksum:     checksum,
+		Version:      1,
+		Size:         size,
+		DateModified: dateModified,
+	}
+
+	if len(lineage) > 0 {
+		newVersion.Version = lineage[len(lineage)-1].Version + 1
+	}
+
+	if current != nil {
+		current.ReplacedAt = now.Unix()
+	}
+
+	vs.lineages[relativePath] = append(lineage, newVersion)
+
+	return newVersion, true, nil
+}
+
+// markRemoved marks the current versions of the files that are no longer shared as replaced
+func (vs *versionStore) markRemoved(sharedPaths map[string]bool, now time.Time) bool {
+	changed := false
+	for relativePath := range vs.lineages {
+		if sharedPaths[relativePath] {
+			continue
+		}
+
+		if current := vs.current(relativePath); current != nil {
+			current.ReplacedAt = now.Unix()
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// prune drops the replaced versions the retention policy doesn't keep,
+// along with the copies no version refers to anymore
+func (vs *versionStore) prune(policy RetentionPolicy, now time.Time) (bool, error) {
+	changed := false
+	for relativePath, lineage := range vs.lineages {
+		kept := make([]*fileVersion, 0, len(lineage))
+
+		// Go from the newest version to the oldest one
+		numReplaced := 0
+		for i := len(lineage) - 1; i >= 0; i-- {
+			version := lineage[i]
+
+			if policy.Enabled && version.ReplacedAt == 0 {
+				kept = append(kept, version)
+
+				continue
+			}
+
+			numReplaced++
+
+			if !policy.Enabled ||
+				(policy.MaxVersions > 0 && numReplaced > policy.MaxVersions) ||
+				(policy.MaxAge > 0 && now.Sub(time.Unix(version.ReplacedAt, 0)) > policy.MaxAge) {
+				changed = true
+
+				continue
+			}
+
+			kept = append(kept, version)
+		}
+
+		if len(kept) == 0 {
+			delete(vs.lineages, relativePath)
+
+			continue
+		}
+
+		// Restore the oldest first order
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].Version < kept[j].Version
+		})
+
+		vs.lineages[relativePath] = kept
+	}
+
+	return changed, vs.removeUnusedBlobs()
+}
+
+// removeUnusedBlobs removes the copies no version refers to
+func (vs *versionStore) removeUnusedBlobs() error {
+	used := make(map[string]bool)
+	for _, lineage := range vs.lineages {
+		for _, version := range lineage {
+			used[version.Checksum] = true
+		}
+	}
+
+	entries, readErr := os.ReadDir(vs.dir)
+	if readErr != nil {
+		return readErr
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == versionIndexFile || used[entry.Name()] {
+			continue
+		}
+
+		if removeErr := os.Remove(filepath.Join(vs.dir, entry.Name())); removeErr != nil && !os.IsNotExist(removeErr) {
+			return removeErr
+		}
+	}
+
+	return nil
+}
+
+// copyBlob copies the file into the versions directory, unless a copy already exists
+func (vs *versionStore) copyBlob(sourcePath string, checksum string) error {
+	destination := vs.blobPath(checksum)
+	if _, statErr := os.Stat(destination); statErr == nil {
+		return nil
+	}
+
+	input, openErr := os.Open(sourcePath)
+	if openErr != nil {
+		return openErr
+	}
+	defer input.Close()
+
+	output, createErr := os.CreateTemp(vs.dir, ".version-*")
+	if createErr != nil {
+		return createErr
+	}
+
+	_, copyErr := io.Copy(output, input)
+	closeErr := output.Close()
+
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+
+	if copyErr != nil {
+		_ = os.Remove(output.Name())
+
+		return copyErr
+	}
+
+	return os.Rename(output.Name(), destination)
+}
+
+// VersionFileName returns the name a retained version of the file is saved under,
+// so it doesn't take the place of the current version
+func VersionFileName(fileName string, version int64) string {
+	extension := filepath.Ext(fileName)
+
+	return fmt.Sprintf("%s.v%d%s", strings.TrimSuffix(fileName, extension), version, extension)
+}
@@ -0,0 +1,75 @@
+package files
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionStore_Prune(t *testing.T) {
+	now := time.Now()
+
+	testTable := []struct {
+		name             string
+		policy           RetentionPolicy
+		expectedVersions []int64
+	}{
+		{
+			"No limits",
+			RetentionPolicy{Enabled: true},
+			[]int64{1, 2, 3, 4},
+		},
+		{
+			"Limited by count",
+			RetentionPolicy{Enabled: true, MaxVersions: 2},
+			[]int64{2, 3, 4},
+		},
+		{
+			"Limited by age",
+			RetentionPolicy{Enabled: true, MaxAge: 90 * time.Minute},
+			[]int64{3, 4},
+		},
+		{
+			"Limited by count and age",
+			RetentionPolicy{Enabled: true, MaxVersions: 2, MaxAge: 30 * time.Minute},
+			[]int64{4},
+		},
+		{
+			"Retention disabled",
+			RetentionPolicy{},
+			[]int64{},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			vs := &versionStore{
+				dir: t.TempDir(),
+				lineages: map[string][]*fileVersion{
+					"todo.txt": {
+						{Checksum: "a", Version: 1, ReplacedAt: now.Add(-3 * time.Hour).Unix()},
+						{Checksum: "b", Version: 2, ReplacedAt: now.Add(-2 * time.Hour).Unix()},
+						{Checksum: "c", Version: 3, ReplacedAt: now.Add(-time.Hour).Unix()},
+						{Checksum: "d", Version: 4},
+					},
+				},
+			}
+
+			_, pruneErr := vs.prune(testCase.policy, now)
+			assert.NoError(t, pruneErr)
+
+			versions := make([]int64, 0)
+			for _, version := range vs.lineages["todo.txt"] {
+				versions = append(versions, version.Version)
+			}
+
+			assert.Equal(t, testCase.expectedVersions, versions)
+		})
+	}
+}
+
+func TestVersionFileName(t *testing.T) {
+	assert.Equal(t, "report.v3.pdf", VersionFileName("report.pdf", 3))
+	assert.Equal(t, "Makefile.v2", VersionFileName("Makefile", 2))
+}
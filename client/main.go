@@ -11,6 +11,8 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/downloads"
+	"github.com/zivkovicmilos/peer_drop/mirror"
 	"github.com/zivkovicmilos/peer_drop/networking/client"
 	"github.com/zivkovicmilos/peer_drop/rendezvous"
 	"github.com/zivkovicmilos/peer_drop/rest/dispatcher"
@@ -51,15 +53,30 @@ func main() {
 	httpPortPtr := flag.Int("http-port", config.ServerHTTPPort,
 		fmt.Sprintf("HTTP port of the client. Default %d", config.ServerHTTPPort),
 	)
+	eventsPortPtr := flag.Int("events-port", config.ServerEventsPort,
+		fmt.Sprintf("HTTP port of the client event stream. Default %d", config.ServerEventsPort),
+	)
 	grpcPortPtr := flag.Int("grpc-port", config.ServerGRPCPort,
 		fmt.Sprintf("GRPC port of the client. Defualt %d", config.ServerGRPCPort),
 	)
 	libp2pPortPtr := flag.Int("libp2p-port", config.ServerLibp2pPort,
 		fmt.Sprintf("GRPC port of the client. Defualt %d", config.ServerLibp2pPort),
 	)
+	maxDownloadsPtr := flag.Int("max-downloads", config.MaxConcurrentDownloads,
+		fmt.Sprintf("Max number of concurrent background downloads. Default %d", config.MaxConcurrentDownloads),
+	)
+	uploadLimitPtr := flag.Int64("upload-limit", 0,
+		"Global file sharing upload limit in KiB/s. Default 0 (unlimited)",
+	)
+	downloadLimitPtr := flag.Int64("download-limit", 0,
+		"Global file sharing download limit in KiB/s. Default 0 (unlimited)",
+	)
 	rendezvousMode := flag.Bool("rendezvous", false,
 		fmt.Sprintf("server mode of the client. Default %t", false),
 	)
+	rehashPtr := flag.Bool("rehash", false,
+		"Drop the cached file checksums, so all shared files are hashed again. Default false",
+	)
 	var rendezvousNodes RendezvousNodes
 	flag.Var(&rendezvousNodes, "rendezvous-node",
 		fmt.Sprintf("server mode of the client. Default %t", false),
@@ -93,6 +110,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *rehashPtr {
+		if clearErr := storage.GetStorageHandler().ClearChecksumCache(); clearErr != nil {
+			logger.Error(fmt.Sprintf("Unable to clear checksum cache, %v", clearErr))
+			os.Exit(1)
+		}
+	}
+
 	// Set up the close mechanism
 	closeChannel := make(chan os.Signal, 1)
 	signal.Notify(closeChannel, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
@@ -108,9 +132,14 @@ func main() {
 	nodeConfig := &config.NodeConfig{
 		HostAddress: *hostPtr,
 		HttpPort:    *httpPortPtr,
+		EventsPort:  *eventsPortPtr,
 		GrpcPort:    *grpcPortPtr,
 		Libp2pPort:  *libp2pPortPtr,
 		BaseDir:     *baseDirPtr,
+
+		MaxConcurrentDownloads: *maxDownloadsPtr,
+		UploadRateLimit:        *uploadLimitPtr * 1024,
+		DownloadRateLimit:      *downloadLimitPtr * 1024,
 	}
 
 	if *rendezvousMode {
@@ -153,6 +182,28 @@ func setupAsClient(logger hclog.Logger, nodeConfig *config.NodeConfig) {
 	clientServer := client.NewClientServer(logger, nodeConfig)
 	servicehandler.GetServiceHandler().SetClientServer(clientServer)
 
+	// Set up the background download manager
+	downloadManager := downloads.NewDownloadManager(
+		logger,
+		clientServer,
+		storage.GetStorageHandler(),
+		nodeConfig.MaxConcurrentDownloads,
+	)
+	servicehandler.GetServiceHandler().SetDownloadManager(downloadManager)
+
+	go downloadManager.Start(servicehandler.GetServiceHandler().RegisterCloseListener("download-manager"))
+
+	// Set up the workspace mirror service
+	mirrorService := mirror.NewMirrorService(
+		logger,
+		clientServer,
+		downloadManager,
+		storage.GetStorageHandler(),
+	)
+	servicehandler.GetServiceHandler().SetMirrorService(mirrorService)
+
+	go mirrorService.Start(servicehandler.GetServiceHandler().RegisterCloseListener("mirror-service"))
+
 	clientServer.Start(servicehandler.GetServiceHandler().RegisterCloseListener("client-server"))
 }
 
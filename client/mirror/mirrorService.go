@@ -0,0 +1,725 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+const (
+	syncInterval      = 10 * time.Second // interval at which the mirrored workspaces are synced
+	mirrorJobPriority = 0                // priority of the mirror download jobs
+	indexFileSuffix   = ".json"          // suffix of the mirror index, kept next to the mirror directory
+	skippedFileSuffix = ".skipped.json"  // suffix of the skipped checksums, kept next to the mirror directory
+	pendingFileSuffix = ".pending.json"  // suffix of the pending downloads, kept next to the mirror directory
+)
+
+var ErrInvalidSettings = errors.New("invalid mirror settings")
+
+// FileSource provides the files advertised in the workspaces
+type FileSource interface {
+	GetFileList(mnemonic string) []*proto.File
+	GetNumberOfPeers(mnemonic string) int
+	GetWorkspaceMirrorDir(mnemonic string) (string, error)
+}
+
+// JobQueue runs the downloads of the mirrored files
+type JobQueue interface {
+	AddJob(mnemonic string, fileChecksum string, priority int, seed bool) (*types.DownloadJob, error)
+	GetJob(jobID string) (*types.DownloadJob, error)
+	RemoveJob(jobID string) error
+}
+
+// SettingsStore persists the mirror settings, so they survive restarts
+type SettingsStore interface {
+	SaveMirrorSettings(settings types.MirrorSettings) error
+	GetMirrorSettings() ([]*types.MirrorSettings, error)
+	DeleteMirrorSettings(mnemonic string) error
+}
+
+// pendingFile is a file that's being downloaded into the mirror.
+// Pending files are saved, so the downloads that finish while the node is down are still collected
+type pendingFile struct {
+	JobID    string `json:"jobId"`
+	Checksum string `json:"checksum"`
+}
+
+// workspaceMirror is the mirror state of a single workspace
+type workspaceMirror struct {
+	settings types.MirrorSettings
+
+	index   map[string]string      // relative file path -> checksum of the mirrored file
+	pending map[string]pendingFile // relative file path -> file being downloaded
+	skipped map[string]bool        // checksum -> true if its download was canceled or removed
+	failed  int                    // number of pending files whose download failed
+}
+
+func newWorkspaceMirror(settings types.MirrorSettings) *workspaceMirror {
+	return &workspaceMirror{
+		settings: settings,
+		pending:  make(map[string]pendingFile),
+	}
+}
+
+// clone copies the mirror state, so it can be synced without holding the mirrors lock
+func (wm *workspaceMirror) clone() *workspaceMirror {
+	mirrorCopy := &workspaceMirror{
+		settings: wm.settings,
+		pending:  make(map[string]pendingFile, len(wm.pending)),
+		failed:   wm.failed,
+	}
+
+	for relativePath, pending := range wm.pending {
+		mirrorCopy.pending[relativePath] = pending
+	}
+
+	// The index, the skipped checksums and the saved pending files are loaded together on the first sync
+	if wm.index != nil {
+		mirrorCopy.index = make(map[string]string, len(wm.index))
+		for relativePath, checksum := range wm.index {
+			mirrorCopy.index[relativePath] = checksum
+		}
+
+		mirrorCopy.skipped = make(map[string]bool, len(wm.skipped))
+		for checksum := range wm.skipped {
+			mirrorCopy.skipped[checksum] = true
+		}
+	}
+
+	return mirrorCopy
+}
+
+// MirrorService keeps a local copy of the files advertised in the mirrored workspaces.
+// New files are downloaded in the background, and moved into the workspace mirror directory
+type MirrorService struct {
+	logger hclog.Logger
+	source FileSource
+	queue  JobQueue
+	store  SettingsStore
+
+	mirrors    map[string]*workspaceMirror // mnemonic -> mirror
+	mirrorsMux sync.Mutex
+
+	syncChannel chan struct{}
+}
+
+// NewMirrorService creates a new instance of the mirror service
+func NewMirrorService(
+	logger hclog.Logger,
+	source FileSource,
+	queue JobQueue,
+	store SettingsStore,
+) *MirrorService {
+	return &MirrorService{
+		logger:      logger.Named("mirror-service"),
+		source:      source,
+		queue:       queue,
+		store:       store,
+		mirrors:     make(map[string]*workspaceMirror),
+		syncChannel: make(chan struct{}, 1),
+	}
+}
+
+// Start loads the saved settings and starts the sync loop.
+// Blocks until the close channel is notified
+func (ms *MirrorService) Start(closeChannel chan struct{}) {
+	savedSettings, loadErr := ms.store.GetMirrorSettings()
+	if loadErr != nil {
+		ms.logger.Error(fmt.Sprintf("Unable to load mirror settings, %v", loadErr))
+	}
+
+	ms.mirrorsMux.Lock()
+	for _, settings := range savedSettings {
+		ms.mirrors[settings.WorkspaceMnemonic] = newWorkspaceMirror(*settings)
+	}
+	ms.mirrorsMux.Unlock()
+
+	ms.logger.Info(fmt.Sprintf("Mirror service started with %d workspaces", len(savedSettings)))
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closeChannel:
+			ms.logger.Info("Mirror service stopped gracefully")
+
+			return
+		case <-ms.syncChannel:
+			ms.sync()
+		case <-ticker.C:
+			ms.sync()
+		}
+	}
+}
+
+// triggerSync signals the sync loop that the settings changed
+func (ms *MirrorService) triggerSync() {
+	select {
+	case ms.syncChannel <- struct{}{}:
+	default:
+	}
+}
+
+// SetSettings changes the mirror settings of the workspace.
+// Disabling the mirror stops the pending downloads, but keeps the mirrored files
+func (ms *MirrorService) SetSettings(settings types.MirrorSettings) error {
+	if settings.WorkspaceMnemonic == "" {
+		return ErrInvalidSettings
+	}
+
+	defer ms.triggerSync()
+
+	ms.mirrorsMux.Lock()
+	defer ms.mirrorsMux.Unlock()
+
+	if saveErr := ms.store.SaveMirrorSettings(settings); saveErr != nil {
+		return fmt.Errorf("unable to save mirror settings, %v", saveErr)
+	}
+
+	mirror, ok := ms.mirrors[settings.WorkspaceMnemonic]
+	if !ok {
+		ms.mirrors[settings.WorkspaceMnemonic] = newWorkspaceMirror(settings)
+
+		return nil
+	}
+
+	mirror.settings = settings
+
+	if !settings.Enabled {
+		for relativePath, pending := range mirror.pending {
+			ms.removeJob(pending.JobID)
+			delete(mirror.pending, relativePath)
+		}
+
+		mirror.failed = 0
+
+		ms.savePending(settings.WorkspaceMnemonic, mirror.pending)
+	}
+
+	return nil
+}
+
+// RemoveWorkspace stops mirroring the workspace, and drops its settings.
+// The workspace directory, along with the mirrored files, is wiped separately
+func (ms *MirrorService) RemoveWorkspace(mnemonic string) error {
+	ms.mirrorsMux.Lock()
+	defer ms.mirrorsMux.Unlock()
+
+	if mirror, ok := ms.mirrors[mnemonic]; ok {
+		for _, pending := range mirror.pending {
+			ms.removeJob(pending.JobID)
+		}
+
+		delete(ms.mirrors, mnemonic)
+	}
+
+	if deleteErr := ms.store.DeleteMirrorSettings(mnemonic); deleteErr != nil {
+		return fmt.Errorf("unable to delete mirror settings, %v", deleteErr)
+	}
+
+	return nil
+}
+
+// GetStatuses returns the mirror status of every workspace with mirror settings
+func (ms *MirrorService) GetStatuses() []types.MirrorStatus {
+	ms.mirrorsMux.Lock()
+	mnemonics := make([]string, 0, len(ms.mirrors))
+	for mnemonic := range ms.mirrors {
+		mnemonics = append(mnemonics, mnemonic)
+	}
+	ms.mirrorsMux.Unlock()
+
+	sort.Strings(mnemonics)
+
+	statuses := make([]types.MirrorStatus, 0, len(mnemonics))
+	for _, mnemonic := range mnemonics {
+		statuses = append(statuses, ms.GetStatus(mnemonic))
+	}
+
+	return statuses
+}
+
+// GetStatus returns the mirror settings and state of the workspace
+func (ms *MirrorService) GetStatus(mnemonic string) types.MirrorStatus {
+	ms.mirrorsMux.Lock()
+	defer ms.mirrorsMux.Unlock()
+
+	status := types.MirrorStatus{
+		MirrorSettings: types.MirrorSettings{WorkspaceMnemonic: mnemonic},
+	}
+
+	if mirrorDir, dirErr := ms.source.GetWorkspaceMirrorDir(mnemonic); dirErr == nil {
+		status.MirrorDirectory = mirrorDir
+	}
+
+	mirror, ok := ms.mirrors[mnemonic]
+	if !ok {
+		return status
+	}
+
+	status.MirrorSettings = mirror.settings
+	status.MirroredFiles = len(mirror.index)
+	status.PendingFiles = len(mirror.pending)
+	status.FailedFiles = mirror.failed
+	status.SkippedFiles = len(mirror.skipped)
+
+	return status
+}
+
+// sync syncs all the mirrored workspaces. The workspaces are synced on copies of their state,
+// so the downloads and file copies don't block the status and settings requests
+func (ms *MirrorService) sync() {
+	ms.mirrorsMux.Lock()
+	mirrors := make(map[string]*workspaceMirror)
+	for mnemonic, mirror := range ms.mirrors {
+		if mirror.settings.Enabled {
+			mirrors[mnemonic] = mirror
+		}
+	}
+
+	syncedMirrors := make(map[string]*workspaceMirror, len(mirrors))
+	for mnemonic, mirror := range mirrors {
+		syncedMirrors[mnemonic] = mirror.clone()
+	}
+	ms.mirrorsMux.Unlock()
+
+	for mnemonic, syncedMirror := range syncedMirrors {
+		ms.syncWorkspace(mnemonic, syncedMirror)
+		ms.commitSync(mnemonic, mirrors[mnemonic], syncedMirror)
+	}
+}
+
+// commitSync saves the synced state of the workspace mirror. If the mirror
+// was disabled or removed in the meantime, the newly queued downloads are dropped
+func (ms *MirrorService) commitSync(mnemonic string, mirror *workspaceMirror, syncedMirror *workspaceMirror) {
+	ms.mirrorsMux.Lock()
+	current, ok := ms.mirrors[mnemonic]
+	stale := !ok || current != mirror || !current.settings.Enabled
+
+	if ok && current == mirror {
+		// The placed files are in the mirror directory either way
+		current.index = syncedMirror.index
+		current.skipped = syncedMirror.skipped
+	}
+
+	if !stale {
+		current.pending = syncedMirror.pending
+		current.failed = syncedMirror.failed
+	}
+
+	// The sync saved the pending files it queued, which are dropped again
+	if stale && ok {
+		ms.savePending(mnemonic, current.pending)
+	}
+	ms.mirrorsMux.Unlock()
+
+	if stale {
+		for _, pending := range syncedMirror.pending {
+			ms.removeJob(pending.JobID)
+		}
+	}
+}
+
+// syncWorkspace moves the finished downloads into the mirror directory,
+// queues the downloads of new files, and removes the files no peer advertises anymore
+func (ms *MirrorService) syncWorkspace(mnemonic string, mirror *workspaceMirror) {
+	mirrorDir, dirErr := ms.source.GetWorkspaceMirrorDir(mnemonic)
+	if dirErr != nil {
+		// The workspace is not initialized yet
+		return
+	}
+
+	if mirror.index == nil {
+		index, loadErr := loadIndex(mirrorDir)
+		if loadErr != nil {
+			ms.logger.Error(fmt.Sprintf("Unable to load mirror index of %s, %v", mnemonic, loadErr))
+
+			return
+		}
+
+		skipped, skippedErr := loadSkipped(mirrorDir)
+		if skippedErr != nil {
+			ms.logger.Error(fmt.Sprintf("Unable to load skipped mirror files of %s, %v", mnemonic, skippedErr))
+
+			return
+		}
+
+		pending, pendingErr := loadPending(mirrorDir)
+		if pendingErr != nil {
+			ms.logger.Error(fmt.Sprintf("Unable to load pending mirror files of %s, %v", mnemonic, pendingErr))
+
+			return
+		}
+
+		mirror.index = index
+		mirror.skipped = skipped
+
+		for relativePath, pendingFile := range pending {
+			if _, isPending := mirror.pending[relativePath]; !isPending {
+				mirror.pending[relativePath] = pendingFile
+			}
+		}
+	}
+
+	previousPending := make(map[string]pendingFile, len(mirror.pending))
+	for relativePath, pending := range mirror.pending {
+		previousPending[relativePath] = pending
+	}
+
+	indexChanged, skippedChanged := ms.collectDownloads(mirrorDir, mirror)
+
+	// Queue the files that aren't mirrored yet
+	fileList := ms.source.GetFileList(mnemonic)
+	conflicting := files.ConflictingChecksums(files.FindConflicts(fileList))
+
+	advertised := make(map[string]bool)
+	advertisedChecksums := make(map[string]bool)
+	for _, file := range fileList {
+		if file.Retained {
+			// Only the current versions are mirrored
+			continue
+		}
+
+		advertisedChecksums[file.FileChecksum] = true
+
+		fileName := fmt.Sprintf("%s%s", file.Name, file.Extension)
+		if conflicting[file.FileChecksum] {
+			// Different files shared under the same name are mirrored next to each other
+			fileName = files.ConflictFileName(fileName, file.FileChecksum)
+		}
+
+		relativePath, pathErr := files.CleanRelativePath(files.JoinRelativePath(file.Path, fileName))
+		if pathErr != nil || relativePath == "" {
+			continue
+		}
+
+		advertised[relativePath] = true
+
+		if mirror.index[relativePath] == file.FileChecksum || mirror.skipped[file.FileChecksum] {
+			continue
+		}
+
+		pending, isPending := mirror.pending[relativePath]
+		if isPending && pending.Checksum == file.FileChecksum {
+			continue
+		}
+
+		if isPending {
+			// A newer version showed up while the previous one was downloading
+			ms.removeJob(pending.JobID)
+		}
+
+		job, addErr := ms.queue.AddJob(mnemonic, file.FileChecksum, mirrorJobPriority, false)
+		if addErr != nil {
+			ms.logger.Error(fmt.Sprintf("Unable to queue mirror download of %s, %v", relativePath, addErr))
+
+			continue
+		}
+
+		mirror.pending[relativePath] = pendingFile{
+			JobID:    job.ID,
+			Checksum: file.FileChecksum,
+		}
+	}
+
+	// Nothing is forgotten while there are no peers,
+	// since an empty file list doesn't mean the files are gone
+	hasPeers := ms.source.GetNumberOfPeers(mnemonic) > 0
+
+	// Files that are skipped and no longer advertised are mirrored again if they come back
+	if hasPeers {
+		for checksum := range mirror.skipped {
+			if !advertisedChecksums[checksum] {
+				delete(mirror.skipped, checksum)
+				skippedChanged = true
+			}
+		}
+	}
+
+	// Remove the files no peer advertises anymore
+	if mirror.settings.RemoveMissing && hasPeers {
+		for relativePath := range mirror.index {
+			if advertised[relativePath] {
+				continue
+			}
+
+			filePath := filepath.Join(mirrorDir, filepath.FromSlash(relativePath))
+			if removeErr := os.Remove(filePath); removeErr != nil && !os.IsNotExist(removeErr) {
+				ms.logger.Error(fmt.Sprintf("Unable to remove mirrored file %s, %v", relativePath, removeErr))
+
+				continue
+			}
+
+			removeEmptyDirectories(mirrorDir, filepath.Dir(filePath))
+
+			delete(mirror.index, relativePath)
+			indexChanged = true
+
+			ms.logger.Info(fmt.Sprintf("Removed mirrored file %s", relativePath))
+		}
+	}
+
+	if indexChanged {
+		if saveErr := saveIndex(mirrorDir, mirror.index); saveErr != nil {
+			ms.logger.Error(fmt.Sprintf("Unable to save mirror index of %s, %v", mnemonic, saveErr))
+		}
+	}
+
+	if skippedChanged {
+		if saveErr := saveSkipped(mirrorDir, mirror.skipped); saveErr != nil {
+			ms.logger.Error(fmt.Sprintf("Unable to save skipped mirror files of %s, %v", mnemonic, saveErr))
+		}
+	}
+
+	if !samePending(previousPending, mirror.pending) {
+		if saveErr := savePendingFiles(mirrorDir, mirror.pending); saveErr != nil {
+			ms.logger.Error(fmt.Sprintf("Unable to save pending mirror files of %s, %v", mnemonic, saveErr))
+		}
+	}
+}
+
+// collectDownloads moves the completed downloads into the mirror directory.
+// Returns true if the mirror index changed, and true if the skipped checksums changed
+func (ms *MirrorService) collectDownloads(mirrorDir string, mirror *workspaceMirror) (bool, bool) {
+	// The same file can be advertised under multiple paths, and downloaded only once
+	jobPaths := make(map[string][]string)
+	for relativePath, pending := range mirror.pending {
+		jobPaths[pending.JobID] = append(jobPaths[pending.JobID], relativePath)
+	}
+
+	indexChanged := false
+	skippedChanged := false
+	mirror.failed = 0
+
+	for jobID, relativePaths := range jobPaths {
+		job, jobErr := ms.queue.GetJob(jobID)
+		if jobErr != nil || job.Status == types.DOWNLOAD_STATUS_CANCELED {
+			// The download was stopped by the user, don't start it again
+			for _, relativePath := range relativePaths {
+				mirror.skipped[mirror.pending[relativePath].Checksum] = true
+				delete(mirror.pending, relativePath)
+			}
+
+			skippedChanged = true
+
+			continue
+		}
+
+		if job.Status == types.DOWNLOAD_STATUS_FAILED {
+			// The job stays pending, in case it's resumed
+			mirror.failed += len(relativePaths)
+
+			continue
+		}
+
+		if job.Status != types.DOWNLOAD_STATUS_COMPLETED {
+			continue
+		}
+
+		for _, relativePath := range relativePaths {
+			if placeErr := placeFile(job.FilePath, mirrorDir, relativePath); placeErr != nil {
+				ms.logger.Error(fmt.Sprintf("Unable to mirror file %s, %v", relativePath, placeErr))
+
+				continue
+			}
+
+			mirror.index[relativePath] = job.FileChecksum
+			indexChanged = true
+
+			ms.logger.Info(fmt.Sprintf("Mirrored file %s", relativePath))
+		}
+
+		for _, relativePath := range relativePaths {
+			delete(mirror.pending, relativePath)
+		}
+
+		// Removes the downloaded file as well, if it's still around
+		ms.removeJob(jobID)
+	}
+
+	return indexChanged, skippedChanged
+}
+
+// savePending saves the pending files of the workspace mirror, if the workspace is initialized
+func (ms *MirrorService) savePending(mnemonic string, pending map[string]pendingFile) {
+	mirrorDir, dirErr := ms.source.GetWorkspaceMirrorDir(mnemonic)
+	if dirErr != nil {
+		return
+	}
+
+	if saveErr := savePendingFiles(mirrorDir, pending); saveErr != nil {
+		ms.logger.Error(fmt.Sprintf("Unable to save pending mirror files of %s, %v", mnemonic, saveErr))
+	}
+}
+
+// removeJob removes the download job, if it still exists
+func (ms *MirrorService) removeJob(jobID string) {
+	if removeErr := ms.queue.RemoveJob(jobID); removeErr != nil {
+		ms.logger.Debug(fmt.Sprintf("Unable to remove mirror download job %s, %v", jobID, removeErr))
+	}
+}
+
+// placeFile copies the downloaded file to its relative path in the mirror directory.
+// Any previous version of the file is replaced
+func placeFile(sourcePath string, mirrorDir string, relativePath string) error {
+	destination := filepath.Join(mirrorDir, filepath.FromSlash(relativePath))
+	if createErr := os.MkdirAll(filepath.Dir(destination), os.ModePerm); createErr != nil {
+		return createErr
+	}
+
+	source, openErr := os.Open(sourcePath)
+	if openErr != nil {
+		return openErr
+	}
+	defer source.Close()
+
+	// Write next to the destination first, so a half copied file never replaces the previous version
+	output, createErr := os.CreateTemp(filepath.Dir(destination), ".mirror-*")
+	if createErr != nil {
+		return createErr
+	}
+
+	defer func() {
+		_ = output.Close()
+		_ = os.Remove(output.Name())
+	}()
+
+	if _, copyErr := io.Copy(output, source); copyErr != nil {
+		return copyErr
+	}
+
+	if closeErr := output.Close(); closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(output.Name(), destination)
+}
+
+// removeEmptyDirectories removes the directory and its parents
+// up to the mirror directory, as long as they are empty
+func removeEmptyDirectories(mirrorDir string, directory string) {
+	for directory != mirrorDir && len(directory) > len(mirrorDir) {
+		if removeErr := os.Remove(directory); removeErr != nil {
+			// The directory is not empty
+			return
+		}
+
+		directory = filepath.Dir(directory)
+	}
+}
+
+// loadIndex loads the index of the mirrored files, kept next to the mirror directory
+func loadIndex(mirrorDir string) (map[string]string, error) {
+	index := make(map[string]string)
+
+	if loadErr := loadJSON(mirrorDir+indexFileSuffix, &index); loadErr != nil {
+		return nil, loadErr
+	}
+
+	return index, nil
+}
+
+// saveIndex saves the index of the mirrored files
+func saveIndex(mirrorDir string, index map[string]string) error {
+	return saveJSON(mirrorDir+indexFileSuffix, index)
+}
+
+// loadSkipped loads the checksums of the files that are not mirrored
+// because their download was stopped by the user
+func loadSkipped(mirrorDir string) (map[string]bool, error) {
+	checksums := make([]string, 0)
+
+	if loadErr := loadJSON(mirrorDir+skippedFileSuffix, &checksums); loadErr != nil {
+		return nil, loadErr
+	}
+
+	skipped := make(map[string]bool, len(checksums))
+	for _, checksum := range checksums {
+		skipped[checksum] = true
+	}
+
+	return skipped, nil
+}
+
+// saveSkipped saves the checksums of the skipped files
+func saveSkipped(mirrorDir string, skipped map[string]bool) error {
+	checksums := make([]string, 0, len(skipped))
+	for checksum := range skipped {
+		checksums = append(checksums, checksum)
+	}
+
+	sort.Strings(checksums)
+
+	return saveJSON(mirrorDir+skippedFileSuffix, checksums)
+}
+
+// loadPending loads the files that were being downloaded into the mirror
+func loadPending(mirrorDir string) (map[string]pendingFile, error) {
+	pending := make(map[string]pendingFile)
+
+	if loadErr := loadJSON(mirrorDir+pendingFileSuffix, &pending); loadErr != nil {
+		return nil, loadErr
+	}
+
+	return pending, nil
+}
+
+// savePendingFiles saves the files that are being downloaded into the mirror
+func savePendingFiles(mirrorDir string, pending map[string]pendingFile) error {
+	return saveJSON(mirrorDir+pendingFileSuffix, pending)
+}
+
+// samePending checks if the two sets of pending files are the same
+func samePending(first map[string]pendingFile, second map[string]pendingFile) bool {
+	if len(first) != len(second) {
+		return false
+	}
+
+	for relativePath, pending := range first {
+		if otherPending, ok := second[relativePath]; !ok || otherPending != pending {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadJSON decodes the file into the value. A missing file leaves the value as it is
+func loadJSON(filePath string, value interface{}) error {
+	data, readErr := os.ReadFile(filePath)
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
+			return nil
+		}
+
+		return readErr
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+// saveJSON encodes the value into the file, replacing it at once
+func saveJSON(filePath string, value interface{}) error {
+	data, marshalErr := json.Marshal(value)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	if writeErr := os.WriteFile(filePath+".tmp", data, 0600); writeErr != nil {
+		return writeErr
+	}
+
+	return os.Rename(filePath+".tmp", filePath)
+}
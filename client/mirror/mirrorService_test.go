@@ -0,0 +1,444 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+const testMnemonic = "mirror test workspace"
+
+// mockSource advertises a fixed file list
+type mockSource struct {
+	files     []*proto.File
+	numPeers  int
+	mirrorDir string
+}
+
+func (ms *mockSource) GetFileList(_ string) []*proto.File {
+	return ms.files
+}
+
+func (ms *mockSource) GetNumberOfPeers(_ string) int {
+	return ms.numPeers
+}
+
+func (ms *mockSource) GetWorkspaceMirrorDir(_ string) (string, error) {
+	return ms.mirrorDir, nil
+}
+
+// mockQueue keeps the download jobs in memory, the tests finish them by hand
+type mockQueue struct {
+	jobs map[string]*types.DownloadJob
+}
+
+func (mq *mockQueue) AddJob(mnemonic string, fileChecksum string, _ int, _ bool) (*types.DownloadJob, error) {
+	job := &types.DownloadJob{
+		ID:                fmt.Sprintf("job-%d", len(mq.jobs)),
+		WorkspaceMnemonic: mnemonic,
+		FileChecksum:      fileChecksum,
+		Status:            types.DOWNLOAD_STATUS_QUEUED,
+	}
+	mq.jobs[job.ID] = job
+
+	return job, nil
+}
+
+func (mq *mockQueue) GetJob(jobID string) (*types.DownloadJob, error) {
+	job, ok := mq.jobs[jobID]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+
+	return job, nil
+}
+
+func (mq *mockQueue) RemoveJob(jobID string) error {
+	delete(mq.jobs, jobID)
+
+	return nil
+}
+
+// findJob returns the job downloading the file
+func (mq *mockQueue) findJob(fileChecksum string) *types.DownloadJob {
+	for _, job := range mq.jobs {
+		if job.FileChecksum == fileChecksum {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// complete finishes the job, with the downloaded file holding the given content
+func (mq *mockQueue) complete(t *testing.T, job *types.DownloadJob, content string) {
+	job.FilePath = filepath.Join(t.TempDir(), job.FileChecksum)
+	job.Status = types.DOWNLOAD_STATUS_COMPLETED
+
+	assert.NoError(t, os.WriteFile(job.FilePath, []byte(content), 0600))
+}
+
+// mockSettingsStore keeps the settings in memory
+type mockSettingsStore struct {
+	settings map[string]types.MirrorSettings
+}
+
+func (ms *mockSettingsStore) SaveMirrorSettings(settings types.MirrorSettings) error {
+	ms.settings[settings.WorkspaceMnemonic] = settings
+
+	return nil
+}
+
+func (ms *mockSettingsStore) GetMirrorSettings() ([]*types.MirrorSettings, error) {
+	foundSettings := make([]*types.MirrorSettings, 0)
+	for _, settings := range ms.settings {
+		settingsCopy := settings
+		foundSettings = append(foundSettings, &settingsCopy)
+	}
+
+	return foundSettings, nil
+}
+
+func (ms *mockSettingsStore) DeleteMirrorSettings(mnemonic string) error {
+	delete(ms.settings, mnemonic)
+
+	return nil
+}
+
+func newTestService(t *testing.T) (*MirrorService, *mockSource, *mockQueue) {
+	source := &mockSource{
+		numPeers:  1,
+		mirrorDir: filepath.Join(t.TempDir(), "mirror"),
+	}
+	queue := &mockQueue{jobs: make(map[string]*types.DownloadJob)}
+	store := &mockSettingsStore{settings: make(map[string]types.MirrorSettings)}
+
+	return NewMirrorService(hclog.NewNullLogger(), source, queue, store), source, queue
+}
+
+func TestMirrorService_MirrorFiles(t *testing.T) {
+	service, source, queue := newTestService(t)
+
+	source.files = []*proto.File{
+		{Name: "readme", Extension: ".md", FileChecksum: "checksum-1"},
+		{Name: "train", Extension: ".csv", Path: "datasets", FileChecksum: "checksum-2"},
+	}
+
+	assert.NoError(t, service.SetSettings(types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           true,
+		RemoveMissing:     true,
+	}))
+
+	// Every advertised file is queued once
+	service.sync()
+	service.sync()
+
+	assert.Len(t, queue.jobs, 2)
+	assert.Equal(t, 2, service.GetStatus(testMnemonic).PendingFiles)
+
+	// Finished downloads end up in the mirror directory
+	queue.complete(t, queue.findJob("checksum-1"), "readme")
+	queue.complete(t, queue.findJob("checksum-2"), "a,b,c")
+
+	service.sync()
+
+	content, readErr := os.ReadFile(filepath.Join(source.mirrorDir, "datasets", "train.csv"))
+	assert.NoError(t, readErr)
+	assert.Equal(t, "a,b,c", string(content))
+
+	status := service.GetStatus(testMnemonic)
+	assert.Equal(t, 2, status.MirroredFiles)
+	assert.Equal(t, 0, status.PendingFiles)
+	assert.Len(t, queue.jobs, 0)
+
+	// The index survives restarts
+	index, loadErr := loadIndex(source.mirrorDir)
+	assert.NoError(t, loadErr)
+	assert.Equal(t, map[string]string{"readme.md": "checksum-1", "datasets/train.csv": "checksum-2"}, index)
+
+	// A new version replaces the mirrored file
+	source.files[0].FileChecksum = "checksum-3"
+	service.sync()
+
+	queue.complete(t, queue.findJob("checksum-3"), "new readme")
+	service.sync()
+
+	content, readErr = os.ReadFile(filepath.Join(source.mirrorDir, "readme.md"))
+	assert.NoError(t, readErr)
+	assert.Equal(t, "new readme", string(content))
+
+	// Files no peer advertises anymore are removed
+	source.files = source.files[:1]
+	service.sync()
+
+	_, statErr := os.Stat(filepath.Join(source.mirrorDir, "datasets"))
+	assert.True(t, os.IsNotExist(statErr))
+	assert.Equal(t, 1, service.GetStatus(testMnemonic).MirroredFiles)
+}
+
+func TestMirrorService_KeepMissingFiles(t *testing.T) {
+	testTable := []struct {
+		name          string
+		removeMissing bool
+		numPeers      int
+	}{
+		{
+			"Removal disabled",
+			false,
+			1,
+		},
+		{
+			"No peers connected",
+			true,
+			0,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			service, source, queue := newTestService(t)
+
+			source.files = []*proto.File{{Name: "readme", Extension: ".md", FileChecksum: "checksum-1"}}
+
+			assert.NoError(t, service.SetSettings(types.MirrorSettings{
+				WorkspaceMnemonic: testMnemonic,
+				Enabled:           true,
+				RemoveMissing:     testCase.removeMissing,
+			}))
+
+			service.sync()
+			queue.complete(t, queue.findJob("checksum-1"), "readme")
+			service.sync()
+
+			source.files = nil
+			source.numPeers = testCase.numPeers
+			service.sync()
+
+			_, statErr := os.Stat(filepath.Join(source.mirrorDir, "readme.md"))
+			assert.NoError(t, statErr)
+		})
+	}
+}
+
+func TestMirrorService_DisableMirror(t *testing.T) {
+	service, source, queue := newTestService(t)
+
+	source.files = []*proto.File{{Name: "readme", Extension: ".md", FileChecksum: "checksum-1"}}
+
+	assert.NoError(t, service.SetSettings(types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           true,
+	}))
+
+	service.sync()
+	assert.Len(t, queue.jobs, 1)
+
+	// Disabling the mirror drops the pending downloads
+	assert.NoError(t, service.SetSettings(types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           false,
+	}))
+
+	service.sync()
+	assert.Len(t, queue.jobs, 0)
+	assert.Equal(t, 0, service.GetStatus(testMnemonic).PendingFiles)
+
+	// Canceled downloads aren't started again
+	assert.NoError(t, service.SetSettings(types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           true,
+	}))
+
+	service.sync()
+	queue.findJob("checksum-1").Status = types.DOWNLOAD_STATUS_CANCELED
+
+	service.sync()
+	service.sync()
+	assert.Len(t, queue.jobs, 1)
+
+	status := service.GetStatus(testMnemonic)
+	assert.Equal(t, 0, status.FailedFiles)
+	assert.Equal(t, 1, status.SkippedFiles)
+}
+
+func TestMirrorService_SkippedFiles(t *testing.T) {
+	service, source, queue := newTestService(t)
+
+	source.files = []*proto.File{{Name: "readme", Extension: ".md", FileChecksum: "checksum-1"}}
+
+	settings := types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           true,
+	}
+	assert.NoError(t, service.SetSettings(settings))
+
+	service.sync()
+	assert.NoError(t, queue.RemoveJob(queue.findJob("checksum-1").ID))
+	service.sync()
+
+	// The skipped file isn't downloaded again after a restart
+	restarted := NewMirrorService(hclog.NewNullLogger(), source, queue, service.store)
+	assert.NoError(t, restarted.SetSettings(settings))
+
+	restarted.sync()
+	assert.Len(t, queue.jobs, 0)
+	assert.Equal(t, 1, restarted.GetStatus(testMnemonic).SkippedFiles)
+
+	// The file is forgotten once no peer advertises it
+	source.files = nil
+	restarted.sync()
+	assert.Equal(t, 0, restarted.GetStatus(testMnemonic).SkippedFiles)
+
+	skipped, loadErr := loadSkipped(source.mirrorDir)
+	assert.NoError(t, loadErr)
+	assert.Len(t, skipped, 0)
+
+	// And mirrored again if it comes back
+	source.files = []*proto.File{{Name: "readme", Extension: ".md", FileChecksum: "checksum-1"}}
+	restarted.sync()
+	assert.Len(t, queue.jobs, 1)
+}
+
+func TestMirrorService_PendingFilesAfterRestart(t *testing.T) {
+	service, source, queue := newTestService(t)
+
+	source.files = []*proto.File{{Name: "readme", Extension: ".md", FileChecksum: "checksum-1"}}
+
+	settings := types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           true,
+	}
+	assert.NoError(t, service.SetSettings(settings))
+
+	service.sync()
+	assert.Len(t, queue.jobs, 1)
+
+	// The download finishes while the node is down
+	queue.complete(t, queue.findJob("checksum-1"), "readme")
+
+	restarted := NewMirrorService(hclog.NewNullLogger(), source, queue, service.store)
+	assert.NoError(t, restarted.SetSettings(settings))
+
+	// The restarted service collects the download instead of queueing the file again
+	restarted.sync()
+
+	content, readErr := os.ReadFile(filepath.Join(source.mirrorDir, "readme.md"))
+	assert.NoError(t, readErr)
+	assert.Equal(t, "readme", string(content))
+	assert.Len(t, queue.jobs, 0)
+
+	status := restarted.GetStatus(testMnemonic)
+	assert.Equal(t, 1, status.MirroredFiles)
+	assert.Equal(t, 0, status.PendingFiles)
+
+	pending, loadErr := loadPending(source.mirrorDir)
+	assert.NoError(t, loadErr)
+	assert.Len(t, pending, 0)
+}
+
+// blockingQueue holds up new downloads until it's released
+type blockingQueue struct {
+	*mockQueue
+
+	adding  chan struct{}
+	release chan struct{}
+}
+
+func (bq *blockingQueue) AddJob(mnemonic string, fileChecksum string, priority int, seed bool) (*types.DownloadJob, error) {
+	bq.adding <- struct{}{}
+	<-bq.release
+
+	return bq.mockQueue.AddJob(mnemonic, fileChecksum, priority, seed)
+}
+
+func TestMirrorService_StatusDuringSync(t *testing.T) {
+	service, source, queue := newTestService(t)
+
+	blocking := &blockingQueue{
+		mockQueue: queue,
+		adding:    make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	service.queue = blocking
+
+	source.files = []*proto.File{{Name: "readme", Extension: ".md", FileChecksum: "checksum-1"}}
+
+	assert.NoError(t, service.SetSettings(types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           true,
+	}))
+
+	syncDone := make(chan struct{})
+	go func() {
+		service.sync()
+		close(syncDone)
+	}()
+
+	<-blocking.adding
+
+	// The status and settings are available while the download is being queued
+	statusDone := make(chan struct{})
+	go func() {
+		_ = service.GetStatus(testMnemonic)
+		_ = service.SetSettings(types.MirrorSettings{
+			WorkspaceMnemonic: testMnemonic,
+			Enabled:           true,
+			RemoveMissing:     true,
+		})
+		close(statusDone)
+	}()
+
+	select {
+	case <-statusDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("status blocked by the sync")
+	}
+
+	close(blocking.release)
+	<-syncDone
+
+	status := service.GetStatus(testMnemonic)
+	assert.Equal(t, 1, status.PendingFiles)
+	assert.True(t, status.RemoveMissing)
+}
+
+func TestMirrorService_Conflicts(t *testing.T) {
+	service, source, queue := newTestService(t)
+
+	source.files = []*proto.File{
+		{Name: "report", Extension: ".pdf", FileChecksum: "aaaaaaaaaa"},
+		{Name: "report", Extension: ".pdf", FileChecksum: "bbbbbbbbbb"},
+	}
+
+	assert.NoError(t, service.SetSettings(types.MirrorSettings{
+		WorkspaceMnemonic: testMnemonic,
+		Enabled:           true,
+	}))
+
+	service.sync()
+	assert.Len(t, queue.jobs, 2)
+
+	queue.complete(t, queue.findJob("aaaaaaaaaa"), "first report")
+	queue.complete(t, queue.findJob("bbbbbbbbbb"), "second report")
+
+	service.sync()
+
+	// Both files are kept, under their conflict names
+	for fileName, expectedContent := range map[string]string{
+		"report.conflict-aaaaaaaa.pdf": "first report",
+		"report.conflict-bbbbbbbb.pdf": "second report",
+	} {
+		content, readErr := os.ReadFile(filepath.Join(source.mirrorDir, fileName))
+		assert.NoError(t, readErr)
+		assert.Equal(t, expectedContent, string(content))
+	}
+}
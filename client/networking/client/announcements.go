@@ -0,0 +1,380 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	announcementInterval = 5 * time.Second       // interval of the checks for local file changes to announce
+	heartbeatInterval    = 30 * time.Second      // interval of the heartbeats that carry the current sequence number
+	peerTimeout          = 3 * heartbeatInterval // time after which the files of a silent peer are dropped
+	snapshotCooldown     = 5 * time.Second       // min time between two snapshots of the same publisher
+	resyncBackoff        = 10 * time.Second      // min time between two resync requests to the same peer
+	maxAnnouncedFiles    = 1000                  // max number of files in a single announcement
+)
+
+// announcementPublisher keeps track of the file list a node announced to a workspace
+type announcementPublisher struct {
+	session   uint64
+	sequence  uint64
+	published map[string]*proto.File // checksum -> announced file
+
+	lastSnapshot    time.Time
+	snapshotPending bool          // a snapshot was requested during the cooldown
+	requests        chan struct{} // snapshot requests
+}
+
+// newAnnouncementPublisher creates a new publisher, with a new session
+func newAnnouncementPublisher() *announcementPublisher {
+	return &announcementPublisher{
+		session:   newAnnouncementSession(),
+		published: make(map[string]*proto.File),
+		requests:  make(chan struct{}, 1),
+	}
+}
+
+// newAnnouncementSession generates a random, non-zero session.
+// Session 0 is left for the full file lists of older peers
+func newAnnouncementSession() uint64 {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+
+	if session := binary.BigEndian.Uint64(buf); session != 0 {
+		return session
+	}
+
+	return 1
+}
+
+// requestSnapshot asks for a snapshot to be published. Requests made before
+// the snapshot is published are merged into one
+func (ap *announcementPublisher) requestSnapshot() {
+	select {
+	case ap.requests <- struct{}{}:
+	default:
+	}
+}
+
+// deltas compares the files against the announced ones, and returns the deltas
+// that bring the peers up to date. Every delta takes the next sequence number
+func (ap *announcementPublisher) deltas(fileList []*proto.File) []*proto.FileListAnnouncement {
+	current := make(map[string]*proto.File, len(fileList))
+	for _, file := range fileList {
+		current[file.FileChecksum] = file
+	}
+
+	added := make([]*proto.File, 0)
+	for _, file := range fileList {
+		if announced, ok := ap.published[file.FileChecksum]; !ok || !protobuf.Equal(announced, file) {
+			added = append(added, file)
+		}
+	}
+
+	removed := make([]string, 0)
+	for checksum := range ap.published {
+		if _, ok := current[checksum]; !ok {
+			removed = append(removed, checksum)
+		}
+	}
+
+	sort.Strings(removed)
+
+	ap.published = current
+
+	deltas := make([]*proto.FileListAnnouncement, 0)
+	for len(added) > 0 || len(removed) > 0 {
+		ap.sequence++
+
+		delta := &proto.FileListAnnouncement{
+			Type:     proto.FileListAnnouncement_DELTA,
+			Session:  ap.session,
+			Sequence: ap.sequence,
+		}
+
+		numAdded := len(added)
+		if numAdded > maxAnnouncedFiles {
+			numAdded = maxAnnouncedFiles
+		}
+
+		numRemoved := len(removed)
+		if numRemoved > maxAnnouncedFiles-numAdded {
+			numRemoved = maxAnnouncedFiles - numAdded
+		}
+
+		delta.Added, added = added[:numAdded], added[numAdded:]
+		delta.Removed, removed = removed[:numRemoved], removed[numRemoved:]
+
+		deltas = append(deltas, delta)
+	}
+
+	return deltas
+}
+
+// snapshot returns the announced files, split into parts
+func (ap *announcementPublisher) snapshot() []*proto.FileListAnnouncement {
+	fileList := make([]*proto.File, 0, len(ap.published))
+	for _, file := range ap.published {
+		fileList = append(fileList, file)
+	}
+
+	sort.Slice(fileList, func(i, j int) bool {
+		return fileList[i].FileChecksum < fileList[j].FileChecksum
+	})
+
+	numParts := (len(fileList) + maxAnnouncedFiles - 1) / maxAnnouncedFiles
+	if numParts == 0 {
+		// Peers still need to know the publisher has no files
+		numParts = 1
+	}
+
+	parts := make([]*proto.FileListAnnouncement, 0, numParts)
+	for part := 0; part < numParts; part++ {
+		start := part * maxAnnouncedFiles
+		end := start + maxAnnouncedFiles
+		if end > len(fileList) {
+			end = len(fileList)
+		}
+
+		parts = append(parts, &proto.FileListAnnouncement{
+			Type:     proto.FileListAnnouncement_SNAPSHOT,
+			Session:  ap.session,
+			Sequence: ap.sequence,
+			Added:    fileList[start:end],
+			Part:     int32(part),
+			NumParts: int32(numParts),
+		})
+	}
+
+	ap.lastSnapshot = time.Now()
+	ap.snapshotPending = false
+
+	return parts
+}
+
+// heartbeat returns the announcement of the current sequence number
+func (ap *announcementPublisher) heartbeat() *proto.FileListAnnouncement {
+	return &proto.FileListAnnouncement{
+		Type:     proto.FileListAnnouncement_HEARTBEAT,
+		Session:  ap.session,
+		Sequence: ap.sequence,
+	}
+}
+
+// peerFileList is the file list of a single peer, as put together from its announcements
+type peerFileList struct {
+	session  uint64
+	sequence uint64
+	files    map[string]*proto.File // checksum -> file
+	synced   bool                   // the file list is complete up to the sequence number
+
+	lastSeen   time.Time
+	lastResync time.Time
+
+	// Snapshot parts received so far
+	pendingSession  uint64
+	pendingSequence uint64
+	pendingNumParts int32
+	pendingParts    map[int32][]*proto.File
+}
+
+// announcementReceiver puts together the file lists of the peers out of their announcements.
+// It's used by a single subscription listener, so it's not thread safe
+type announcementReceiver struct {
+	peers map[peer.ID]*peerFileList
+}
+
+// newAnnouncementReceiver creates a new announcement receiver
+func newAnnouncementReceiver() *announcementReceiver {
+	return &announcementReceiver{
+		peers: make(map[peer.ID]*peerFileList),
+	}
+}
+
+// handle applies the announcement to the file list of the peer.
+// Returns if the file list changed, and if a resync should be requested from the peer
+func (ar *announcementReceiver) handle(
+	peerID peer.ID,
+	announcement *proto.FileListAnnouncement,
+	now time.Time,
+) (bool, bool) {
+	state, ok := ar.peers[peerID]
+	if !ok {
+		state = &peerFileList{
+			files: make(map[string]*proto.File),
+		}
+		ar.peers[peerID] = state
+	}
+
+	state.lastSeen = now
+
+	sameSession := state.synced && state.session == announcement.Session
+
+	switch announcement.Type {
+	case proto.FileListAnnouncement_SNAPSHOT:
+		if sameSession && announcement.Sequence < state.sequence {
+			// The snapshot is older than the deltas already applied
+			return false, false
+		}
+
+		fileList, complete := state.addSnapshotPart(announcement)
+		if !complete {
+			return false, false
+		}
+
+		state.files = make(map[string]*proto.File, len(fileList))
+		for _, file := range fileList {
+			state.files[file.FileChecksum] = file
+		}
+
+		state.session = announcement.Session
+		state.sequence = announcement.Sequence
+		state.synced = true
+
+		return true, false
+	case proto.FileListAnnouncement_DELTA:
+		if sameSession && announcement.Sequence <= state.sequence {
+			// The delta was already applied
+			return false, false
+		}
+
+		if !sameSession || announcement.Sequence != state.sequence+1 {
+			// Deltas were missed, the file list is kept as it is until the snapshot arrives
+			state.synced = false
+
+			return false, state.shouldResync(now)
+		}
+
+		for _, checksum := range announcement.Removed {
+			delete(state.files, checksum)
+		}
+
+		for _, file := range announcement.Added {
+			state.files[file.FileChecksum] = file
+		}
+
+		state.sequence = announcement.Sequence
+
+		return true, false
+	case proto.FileListAnnouncement_HEARTBEAT:
+		if !sameSession || announcement.Sequence > state.sequence {
+			state.synced = false
+
+			return false, state.shouldResync(now)
+		}
+	}
+
+	return false, false
+}
+
+// addSnapshotPart adds the part to the snapshot being put together.
+// Returns the snapshot files once all parts are received.
+// Parts outside of the snapshot, or with a different part count than the first part seen, are dropped
+func (pfl *peerFileList) addSnapshotPart(announcement *proto.FileListAnnouncement) ([]*proto.File, bool) {
+	if announcement.NumParts <= 1 {
+		return announcement.Added, announcement.Part == 0
+	}
+
+	if announcement.Part < 0 || announcement.Part >= announcement.NumParts {
+		return nil, false
+	}
+
+	if pfl.pendingParts == nil ||
+		pfl.pendingSession != announcement.Session ||
+		pfl.pendingSequence != announcement.Sequence {
+		// Parts of an older snapshot are dropped
+		pfl.pendingSession = announcement.Session
+		pfl.pendingSequence = announcement.Sequence
+		pfl.pendingNumParts = announcement.NumParts
+		pfl.pendingParts = make(map[int32][]*proto.File)
+	}
+
+	if announcement.NumParts != pfl.pendingNumParts {
+		return nil, false
+	}
+
+	pfl.pendingParts[announcement.Part] = announcement.Added
+	if int32(len(pfl.pendingParts)) < announcement.NumParts {
+		return nil, false
+	}
+
+	fileList := make([]*proto.File, 0)
+	for part := int32(0); part < announcement.NumParts; part++ {
+		fileList = append(fileList, pfl.pendingParts[part]...)
+	}
+
+	pfl.pendingParts = nil
+
+	return fileList, true
+}
+
+// shouldResync checks if a resync can be requested from the peer,
+// so a peer isn't asked for a snapshot again while the previous one is on its way
+func (pfl *peerFileList) shouldResync(now time.Time) bool {
+	if now.Sub(pfl.lastResync) < resyncBackoff {
+		return false
+	}
+
+	pfl.lastResync = now
+
+	return true
+}
+
+// fileList returns the current file list of the peer
+func (ar *announcementReceiver) fileList(peerID peer.ID) []*proto.File {
+	state, ok := ar.peers[peerID]
+	if !ok {
+		return []*proto.File{}
+	}
+
+	fileList := make([]*proto.File, 0, len(state.files))
+	for _, file := range state.files {
+		fileList = append(fileList, file)
+	}
+
+	return fileList
+}
+
+// expirePeers drops the peers that didn't announce anything for too long.
+// Returns the dropped peers
+func (ar *announcementReceiver) expirePeers(now time.Time) []peer.ID {
+	expired := make([]peer.ID, 0)
+	for peerID, state := range ar.peers {
+		if now.Sub(state.lastSeen) > peerTimeout {
+			delete(ar.peers, peerID)
+			expired = append(expired, peerID)
+		}
+	}
+
+	return expired
+}
+
+// decodeAnnouncement decodes the announcement in the pubsub message.
+// Full file lists published by older peers are read as single part snapshots
+func decodeAnnouncement(data []byte) (*proto.FileListAnnouncement, error) {
+	announcement := new(proto.FileListAnnouncement)
+	unmarshalErr := protobuf.Unmarshal(data, announcement)
+	if unmarshalErr == nil {
+		return announcement, nil
+	}
+
+	fileList := new(proto.FileList)
+	if legacyErr := jsonpb.Unmarshal(bytes.NewReader(data), fileList); legacyErr != nil {
+		return nil, unmarshalErr
+	}
+
+	return &proto.FileListAnnouncement{
+		Type:  proto.FileListAnnouncement_SNAPSHOT,
+		Added: fileList.FileList,
+	}, nil
+}
@@ -0,0 +1,425 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// generateAnnouncedFiles generates the given number of files with unique checksums
+func generateAnnouncedFiles(count int) []*proto.File {
+	fileList := make([]*proto.File, 0, count)
+	for i := 0; i < count; i++ {
+		fileList = append(fileList, &proto.File{
+			Name:         fmt.Sprintf("file-%d.txt", i),
+			FileChecksum: fmt.Sprintf("checksum-%05d", i),
+		})
+	}
+
+	return fileList
+}
+
+// announcedChecksums returns the sorted checksums of the files
+func announcedChecksums(fileList []*proto.File) []string {
+	checksums := make([]string, 0, len(fileList))
+	for _, file := range fileList {
+		checksums = append(checksums, file.FileChecksum)
+	}
+
+	sort.Strings(checksums)
+
+	return checksums
+}
+
+func TestAnnouncementPublisher_Deltas(t *testing.T) {
+	publisher := newAnnouncementPublisher()
+	fileList := generateAnnouncedFiles(3)
+
+	// New files are announced in a single delta
+	deltas := publisher.deltas(fileList)
+	assert.Len(t, deltas, 1)
+	assert.Equal(t, uint64(1), deltas[0].Sequence)
+	assert.Equal(t, announcedChecksums(fileList), announcedChecksums(deltas[0].Added))
+
+	// Nothing changed, nothing is announced
+	assert.Len(t, publisher.deltas(fileList), 0)
+	assert.Equal(t, uint64(1), publisher.heartbeat().Sequence)
+
+	// Changed and removed files are announced in the next delta
+	renamed := protobuf.Clone(fileList[1]).(*proto.File)
+	renamed.Name = "renamed.txt"
+
+	deltas = publisher.deltas([]*proto.File{fileList[0], renamed})
+	assert.Len(t, deltas, 1)
+	assert.Equal(t, uint64(2), deltas[0].Sequence)
+	assert.Equal(t, []string{renamed.FileChecksum}, announcedChecksums(deltas[0].Added))
+	assert.Equal(t, []string{fileList[2].FileChecksum}, deltas[0].Removed)
+
+	// Large changes are split into consecutive deltas.
+	// The first file is already announced, so one more is needed for the last delta
+	deltas = publisher.deltas(generateAnnouncedFiles(2*maxAnnouncedFiles + 2))
+	assert.Len(t, deltas, 3)
+
+	for index, delta := range deltas {
+		assert.Equal(t, uint64(3+index), delta.Sequence)
+		assert.LessOrEqual(t, len(delta.Added)+len(delta.Removed), maxAnnouncedFiles)
+	}
+}
+
+func TestAnnouncementReceiver_Handle(t *testing.T) {
+	const session = uint64(10)
+
+	snapshot := func(sequence uint64, checksums ...string) *proto.FileListAnnouncement {
+		announcement := &proto.FileListAnnouncement{
+			Type:     proto.FileListAnnouncement_SNAPSHOT,
+			Session:  session,
+			Sequence: sequence,
+		}
+
+		for _, checksum := range checksums {
+			announcement.Added = append(announcement.Added, &proto.File{FileChecksum: checksum})
+		}
+
+		return announcement
+	}
+
+	delta := func(sequence uint64, added []string, removed []string) *proto.FileListAnnouncement {
+		announcement := &proto.FileListAnnouncement{
+			Type:     proto.FileListAnnouncement_DELTA,
+			Session:  session,
+			Sequence: sequence,
+			Removed:  removed,
+		}
+
+		for _, checksum := range added {
+			announcement.Added = append(announcement.Added, &proto.File{FileChecksum: checksum})
+		}
+
+		return announcement
+	}
+
+	heartbeat := func(session uint64, sequence uint64) *proto.FileListAnnouncement {
+		return &proto.FileListAnnouncement{
+			Type:     proto.FileListAnnouncement_HEARTBEAT,
+			Session:  session,
+			Sequence: sequence,
+		}
+	}
+
+	testTable := []struct {
+		name              string
+		announcements     []*proto.FileListAnnouncement
+		expectedChanged   bool // for the last announcement
+		expectedResync    bool // for the last announcement
+		expectedChecksums []string
+	}{
+		{
+			"Snapshot",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a", "b"),
+			},
+			true,
+			false,
+			[]string{"a", "b"},
+		},
+		{
+			"Consecutive deltas",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a", "b"),
+				delta(1, []string{"c"}, nil),
+				delta(2, nil, []string{"a"}),
+			},
+			true,
+			false,
+			[]string{"b", "c"},
+		},
+		{
+			"Duplicate delta",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a"),
+				delta(1, []string{"b"}, nil),
+				delta(1, []string{"b"}, nil),
+			},
+			false,
+			false,
+			[]string{"a", "b"},
+		},
+		{
+			"Missed delta",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a"),
+				delta(2, []string{"c"}, nil),
+			},
+			false,
+			true,
+			[]string{"a"},
+		},
+		{
+			"Delta before any snapshot",
+			[]*proto.FileListAnnouncement{
+				delta(5, []string{"c"}, nil),
+			},
+			false,
+			true,
+			[]string{},
+		},
+		{
+			"Resync requested once per backoff",
+			[]*proto.FileListAnnouncement{
+				delta(5, []string{"c"}, nil),
+				delta(6, []string{"d"}, nil),
+			},
+			false,
+			false,
+			[]string{},
+		},
+		{
+			"Snapshot after a missed delta",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a"),
+				delta(2, []string{"c"}, nil),
+				snapshot(2, "a", "b", "c"),
+			},
+			true,
+			false,
+			[]string{"a", "b", "c"},
+		},
+		{
+			"Outdated snapshot",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a"),
+				delta(1, []string{"b"}, nil),
+				snapshot(0, "a"),
+			},
+			false,
+			false,
+			[]string{"a", "b"},
+		},
+		{
+			"Heartbeat in sync",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a"),
+				delta(1, []string{"b"}, nil),
+				heartbeat(session, 1),
+			},
+			false,
+			false,
+			[]string{"a", "b"},
+		},
+		{
+			"Heartbeat after a missed delta",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a"),
+				heartbeat(session, 1),
+			},
+			false,
+			true,
+			[]string{"a"},
+		},
+		{
+			"Heartbeat of a restarted peer",
+			[]*proto.FileListAnnouncement{
+				snapshot(0, "a"),
+				heartbeat(session+1, 0),
+			},
+			false,
+			true,
+			[]string{"a"},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			receiver := newAnnouncementReceiver()
+			peerID := peer.ID("publisher")
+			now := time.Now()
+
+			var changed, resync bool
+			for _, announcement := range testCase.announcements {
+				changed, resync = receiver.handle(peerID, announcement, now)
+			}
+
+			assert.Equal(t, testCase.expectedChanged, changed)
+			assert.Equal(t, testCase.expectedResync, resync)
+			assert.Equal(t, testCase.expectedChecksums, announcedChecksums(receiver.fileList(peerID)))
+		})
+	}
+}
+
+func TestAnnouncementReceiver_SnapshotParts(t *testing.T) {
+	publisher := newAnnouncementPublisher()
+	fileList := generateAnnouncedFiles(maxAnnouncedFiles + 10)
+	publisher.deltas(fileList)
+
+	parts := publisher.snapshot()
+	assert.Len(t, parts, 2)
+
+	receiver := newAnnouncementReceiver()
+	peerID := peer.ID("publisher")
+
+	// The file list is only replaced once all parts arrive, in any order
+	changed, _ := receiver.handle(peerID, parts[1], time.Now())
+	assert.False(t, changed)
+
+	changed, _ = receiver.handle(peerID, parts[0], time.Now())
+	assert.True(t, changed)
+	assert.Equal(t, announcedChecksums(fileList), announcedChecksums(receiver.fileList(peerID)))
+
+	// The receiver follows the deltas from the snapshot on
+	for _, delta := range publisher.deltas(fileList[:5]) {
+		changed, resync := receiver.handle(peerID, delta, time.Now())
+		assert.True(t, changed)
+		assert.False(t, resync)
+	}
+
+	assert.Equal(t, announcedChecksums(fileList[:5]), announcedChecksums(receiver.fileList(peerID)))
+}
+
+func TestAnnouncementReceiver_InvalidSnapshotParts(t *testing.T) {
+	// snapshotPart creates a part of the snapshot holding a single file
+	snapshotPart := func(part int32, numParts int32) *proto.FileListAnnouncement {
+		return &proto.FileListAnnouncement{
+			Type:     proto.FileListAnnouncement_SNAPSHOT,
+			Session:  1,
+			Sequence: 1,
+			Part:     part,
+			NumParts: numParts,
+			Added:    []*proto.File{{FileChecksum: fmt.Sprintf("checksum-part-%d", part)}},
+		}
+	}
+
+	testTable := []struct {
+		name              string
+		parts             []*proto.FileListAnnouncement
+		expectedChanged   bool
+		expectedChecksums []string
+	}{
+		{
+			"All parts received",
+			[]*proto.FileListAnnouncement{snapshotPart(0, 2), snapshotPart(1, 2)},
+			true,
+			[]string{"checksum-part-0", "checksum-part-1"},
+		},
+		{
+			"Part outside of the snapshot",
+			[]*proto.FileListAnnouncement{snapshotPart(0, 2), snapshotPart(2, 2)},
+			false,
+			[]string{},
+		},
+		{
+			"Negative part",
+			[]*proto.FileListAnnouncement{snapshotPart(0, 2), snapshotPart(-1, 2)},
+			false,
+			[]string{},
+		},
+		{
+			"Part outside of a single part snapshot",
+			[]*proto.FileListAnnouncement{snapshotPart(1, 1)},
+			false,
+			[]string{},
+		},
+		{
+			"Part count differs from the first part",
+			[]*proto.FileListAnnouncement{snapshotPart(0, 3), snapshotPart(1, 2), snapshotPart(2, 2)},
+			false,
+			[]string{},
+		},
+		{
+			"Mismatched part is ignored",
+			[]*proto.FileListAnnouncement{snapshotPart(0, 2), snapshotPart(2, 3), snapshotPart(1, 2)},
+			true,
+			[]string{"checksum-part-0", "checksum-part-1"},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			receiver := newAnnouncementReceiver()
+			peerID := peer.ID("publisher")
+
+			changed := false
+			for _, part := range testCase.parts {
+				partChanged, _ := receiver.handle(peerID, part, time.Now())
+				changed = changed || partChanged
+			}
+
+			assert.Equal(t, testCase.expectedChanged, changed)
+			assert.Equal(t, testCase.expectedChecksums, announcedChecksums(receiver.fileList(peerID)))
+		})
+	}
+}
+
+func TestAnnouncementReceiver_ExpirePeers(t *testing.T) {
+	receiver := newAnnouncementReceiver()
+	now := time.Now()
+
+	receiver.handle("silent", &proto.FileListAnnouncement{Session: 1}, now.Add(-peerTimeout-time.Second))
+	receiver.handle("active", &proto.FileListAnnouncement{Session: 2}, now)
+
+	assert.Equal(t, []peer.ID{"silent"}, receiver.expirePeers(now))
+	assert.Len(t, receiver.fileList("silent"), 0)
+	assert.Len(t, receiver.expirePeers(now), 0)
+}
+
+func TestDecodeAnnouncement(t *testing.T) {
+	fileList := generateAnnouncedFiles(2)
+
+	announcementData, _ := protobuf.Marshal(&proto.FileListAnnouncement{
+		Type:     proto.FileListAnnouncement_DELTA,
+		Session:  1,
+		Sequence: 2,
+		Added:    fileList,
+	})
+
+	legacyData := new(bytes.Buffer)
+	_ = (&jsonpb.Marshaler{}).Marshal(legacyData, &proto.FileList{FileList: fileList})
+
+	testTable := []struct {
+		name         string
+		data         []byte
+		expectedType proto.FileListAnnouncement_Type
+		expectErr    bool
+	}{
+		{
+			"Announcement",
+			announcementData,
+			proto.FileListAnnouncement_DELTA,
+			false,
+		},
+		{
+			"File list of an older peer",
+			legacyData.Bytes(),
+			proto.FileListAnnouncement_SNAPSHOT,
+			false,
+		},
+		{
+			"Invalid message",
+			[]byte("{invalid"),
+			proto.FileListAnnouncement_SNAPSHOT,
+			true,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			announcement, decodeErr := decodeAnnouncement(testCase.data)
+			if testCase.expectErr {
+				assert.Error(t, decodeErr)
+
+				return
+			}
+
+			assert.NoError(t, decodeErr)
+			assert.Equal(t, testCase.expectedType, announcement.Type)
+			assert.Equal(t, announcedChecksums(fileList), announcedChecksums(announcement.Added))
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// setupBlobStore opens the blob store shared by all workspaces.
+// Without it, every workspace hashes and stores its files on its own
+func (cs *ClientServer) setupBlobStore() {
+	blobStore, openErr := files.NewBlobStore(
+		cs.logger,
+		filepath.Join(cs.nodeConfig.BaseDir, config.DirectoryBlobs),
+	)
+	if openErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to open blob store, %v", openErr))
+
+		return
+	}
+
+	cs.blobStore = blobStore
+}
+
+// downloadFileName returns the name the downloaded file is saved under in the workspace
+func (cs *ClientServer) downloadFileName(
+	mnemonic string,
+	file *proto.File,
+	fileChecksum string,
+	fileName string,
+) string {
+	fileName = filepath.Base(fileName)
+
+	switch {
+	case file != nil && file.Retained:
+		// Previous versions don't take the place of the current version
+		return files.VersionFileName(fileName, file.Version)
+	case cs.isConflictingFile(mnemonic, fileChecksum):
+		// Different files shared under the same name don't overwrite each other
+		return files.ConflictFileName(fileName, fileChecksum)
+	default:
+		return fileName
+	}
+}
+
+// linkStoredFile places a file that is already in the blob store into the download directory,
+// without fetching it from peers
+func (cs *ClientServer) linkStoredFile(
+	mnemonic string,
+	downloadDir string,
+	file *proto.File,
+	start time.Time,
+) (*DownloadedFileWrapper, error) {
+	relativeDir, pathErr := files.CleanRelativePath(file.Path)
+	if pathErr != nil {
+		return nil, pathErr
+	}
+
+	fileName := cs.downloadFileName(mnemonic, file, file.FileChecksum, file.Name+file.Extension)
+	downloadFilePath := filepath.Join(downloadDir, filepath.FromSlash(relativeDir), fileName)
+
+	if linkErr := cs.blobStore.LinkTo(file.FileChecksum, downloadFilePath); linkErr != nil {
+		return nil, linkErr
+	}
+
+	cs.logger.Info(
+		fmt.Sprintf("Linked file %s from the blob store in %s (%d bytes)", fileName, time.Since(start), file.Size),
+	)
+
+	cs.publishEvent(types.EVENT_DOWNLOAD_COMPLETE, mnemonic, types.DownloadEventData{
+		FileChecksum:    file.FileChecksum,
+		FileName:        fileName,
+		BytesDownloaded: file.Size,
+		BytesTotal:      file.Size,
+	})
+
+	return &DownloadedFileWrapper{
+		FileName: fileName,
+		FilePath: downloadFilePath,
+		Path:     relativeDir,
+		FileSize: file.Size,
+	}, nil
+}
+
+// addDownloadedFile adds the verified download to the blob store,
+// so other workspaces can use it without downloading it again
+func (cs *ClientServer) addDownloadedFile(downloadFilePath string, fileChecksum string) {
+	if cs.blobStore == nil {
+		return
+	}
+
+	if addErr := cs.blobStore.AddDownload(downloadFilePath, fileChecksum, nil); addErr != nil {
+		cs.logger.Debug(fmt.Sprintf("Unable to add file %s to the blob store, %v", downloadFilePath, addErr))
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/files"
+)
+
+var (
+	// ErrIntegrity is wrapped by every error of downloaded data that failed verification,
+	// which points to a peer that served corrupted data
+	ErrIntegrity = errors.New("integrity check failed")
+
+	// ErrChecksumMismatch is returned when the downloaded file doesn't hash to the requested checksum
+	ErrChecksumMismatch = fmt.Errorf("%w, downloaded file doesn't match its checksum", ErrIntegrity)
+)
+
+const (
+	badPeerExpiry = 6 * time.Hour // time after which a peer that served corrupted data is tried again
+	maxBadPeers   = 1000          // max number of bad peer records kept in memory
+)
+
+// syncHash brings the running hash of the partial file up to the given offset,
+// reading whatever was written before the hash started following the download
+func (ds *downloadState) syncHash(offset int64) error {
+	if ds.hasher == nil || ds.hashedOffset > offset {
+		fileChecksum, parseErr := files.ParseFileChecksum(ds.FileChecksum)
+		if parseErr != nil {
+			return parseErr
+		}
+
+		ds.hasher = fileChecksum.NewHash()
+		ds.hashedOffset = 0
+	}
+
+	if ds.hashedOffset == offset {
+		return nil
+	}
+
+	partialFile, openErr := os.Open(ds.partialPath)
+	if openErr != nil {
+		return openErr
+	}
+	defer partialFile.Close()
+
+	hashed, copyErr := io.Copy(ds.hasher, io.NewSectionReader(partialFile, ds.hashedOffset, offset-ds.hashedOffset))
+	ds.hashedOffset += hashed
+
+	if copyErr != nil {
+		ds.hasher = nil
+
+		return copyErr
+	}
+
+	if ds.hashedOffset != offset {
+		ds.hasher = nil
+
+		return fmt.Errorf("partial file is shorter than %d bytes", offset)
+	}
+
+	return nil
+}
+
+// verifyChecksum checks the finished partial file against the requested checksum
+func (ds *downloadState) verifyChecksum() error {
+	if syncErr := ds.syncHash(ds.FileSize); syncErr != nil {
+		return fmt.Errorf("unable to hash downloaded file, %v", syncErr)
+	}
+
+	if !matchesChecksum(ds.FileChecksum, ds.hasher.Sum(nil)) {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
+
+// matchesChecksum checks if the digest matches the file checksum
+func matchesChecksum(checksum string, digest []byte) bool {
+	fileChecksum, parseErr := files.ParseFileChecksum(checksum)
+
+	return parseErr == nil && fileChecksum.Matches(digest)
+}
+
+// addUnverifiedSource records the peer as one of the sources of partial file data
+// that wasn't checked against a Merkle proof
+func (ds *downloadState) addUnverifiedSource(peerID peer.ID) {
+	for _, source := range ds.UnverifiedSources {
+		if source == peerID.Pretty() {
+			return
+		}
+	}
+
+	ds.UnverifiedSources = append(ds.UnverifiedSources, peerID.Pretty())
+}
+
+// badPeerKey identifies a peer that served corrupted data for a file
+type badPeerKey struct {
+	fileChecksum string
+	peerID       string
+}
+
+// recordBadPeer marks the peer as a source of corrupted data for the file.
+// It's skipped in later downloads of the same file, until the record expires
+func (cs *ClientServer) recordBadPeer(fileChecksum string, peerID string) {
+	cs.badPeersMux.Lock()
+	defer cs.badPeersMux.Unlock()
+
+	now := time.Now()
+	key := badPeerKey{fileChecksum: fileChecksum, peerID: peerID}
+
+	if _, ok := cs.badPeers[key]; !ok && len(cs.badPeers) >= maxBadPeers {
+		cs.pruneBadPeersLocked(now)
+	}
+
+	cs.badPeers[key] = now
+
+	cs.logger.Error(fmt.Sprintf("Peer %s served corrupted data for file %s", peerID, fileChecksum))
+}
+
+// pruneBadPeersLocked drops the expired bad peer records,
+// and the oldest record if there is still no room for a new one
+func (cs *ClientServer) pruneBadPeersLocked(now time.Time) {
+	var (
+		oldestKey  badPeerKey
+		oldestTime time.Time
+	)
+
+	for key, recorded := range cs.badPeers {
+		if now.Sub(recorded) > badPeerExpiry {
+			delete(cs.badPeers, key)
+
+			continue
+		}
+
+		if oldestTime.IsZero() || recorded.Before(oldestTime) {
+			oldestKey = key
+			oldestTime = recorded
+		}
+	}
+
+	if len(cs.badPeers) >= maxBadPeers {
+		delete(cs.badPeers, oldestKey)
+	}
+}
+
+// blameFetchError marks the peer as bad if the fetched range failed its Merkle proofs.
+// Proofs are checked chunk by chunk, so a failure can only come from the peer that sent the chunk
+func (cs *ClientServer) blameFetchError(fileChecksum string, peerID peer.ID, fetchErr error) {
+	if errors.Is(fetchErr, errChunkHashMismatch) || errors.Is(fetchErr, errInvalidChunkProof) {
+		cs.recordBadPeer(fileChecksum, peerID.Pretty())
+	}
+}
+
+// blameChecksumMismatch marks the peer that corrupted the finished file as bad, if it can be told apart.
+// Data checked against Merkle proofs is known to be good, so only the peers that sent unverified data
+// are suspects, and a peer is only blamed if it's the single one
+func (cs *ClientServer) blameChecksumMismatch(state *downloadState) {
+	if len(state.UnverifiedSources) != 1 {
+		cs.logger.Error(
+			fmt.Sprintf(
+				"Unable to tell which of %d peers corrupted file %s",
+				len(state.UnverifiedSources),
+				state.FileChecksum,
+			),
+		)
+
+		return
+	}
+
+	cs.recordBadPeer(state.FileChecksum, state.UnverifiedSources[0])
+}
+
+// isBadPeer checks if the peer served corrupted data for the file recently
+func (cs *ClientServer) isBadPeer(fileChecksum string, peerID peer.ID) bool {
+	cs.badPeersMux.Lock()
+	defer cs.badPeersMux.Unlock()
+
+	key := badPeerKey{fileChecksum: fileChecksum, peerID: peerID.Pretty()}
+
+	recorded, ok := cs.badPeers[key]
+	if ok && time.Since(recorded) > badPeerExpiry {
+		delete(cs.badPeers, key)
+
+		return false
+	}
+
+	return ok
+}
+
+// filterBadPeers returns the peers that didn't serve corrupted data for the file
+func (cs *ClientServer) filterBadPeers(fileChecksum string, peers []peer.ID) []peer.ID {
+	filtered := make([]peer.ID, 0, len(peers))
+	for _, peerID := range peers {
+		if !cs.isBadPeer(fileChecksum, peerID) {
+			filtered = append(filtered, peerID)
+		}
+	}
+
+	return filtered
+}
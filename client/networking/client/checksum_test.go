@@ -0,0 +1,117 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+// newBadPeersServer creates a client server that only keeps track of bad peers
+func newBadPeersServer() *ClientServer {
+	return &ClientServer{
+		logger:   hclog.NewNullLogger(),
+		badPeers: make(map[badPeerKey]time.Time),
+	}
+}
+
+func TestClientServer_BlameBadPeers(t *testing.T) {
+	const fileChecksum = "checksum"
+
+	seeders := []peer.ID{peer.ID("seeder-1"), peer.ID("seeder-2"), peer.ID("seeder-3")}
+
+	testTable := []struct {
+		name              string
+		fetchErrs         []error // fetch result of every seeder
+		unverifiedSources []peer.ID
+		expectedPeers     []peer.ID
+	}{
+		{
+			"Seeder serving a chunk that doesn't match its proof",
+			[]error{nil, fmt.Errorf("piece 3, %w", errChunkHashMismatch), nil},
+			nil,
+			[]peer.ID{seeders[0], seeders[2]},
+		},
+		{
+			"Seeder serving invalid proofs",
+			[]error{errInvalidChunkProof, nil, nil},
+			nil,
+			[]peer.ID{seeders[1], seeders[2]},
+		},
+		{
+			"Seeder dropping the connection",
+			[]error{nil, errors.New("stream reset"), errTruncatedStream},
+			nil,
+			seeders,
+		},
+		{
+			"Single seeder of unverified data",
+			[]error{nil, nil, nil},
+			[]peer.ID{seeders[1]},
+			[]peer.ID{seeders[0], seeders[2]},
+		},
+		{
+			"Multiple seeders of unverified data",
+			[]error{nil, nil, nil},
+			[]peer.ID{seeders[0], seeders[1]},
+			seeders,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cs := newBadPeersServer()
+
+			for index, fetchErr := range testCase.fetchErrs {
+				if fetchErr != nil {
+					cs.blameFetchError(fileChecksum, seeders[index], fetchErr)
+				}
+			}
+
+			// The finished file doesn't match its checksum
+			state := newDownloadState(t.TempDir(), fileChecksum)
+			for _, source := range testCase.unverifiedSources {
+				state.addUnverifiedSource(source)
+			}
+
+			cs.blameChecksumMismatch(state)
+
+			assert.Equal(t, testCase.expectedPeers, cs.filterBadPeers(fileChecksum, seeders))
+
+			// Bad peers are only skipped for the file they corrupted
+			assert.Equal(t, seeders, cs.filterBadPeers("other", seeders))
+		})
+	}
+}
+
+func TestClientServer_BadPeerLimits(t *testing.T) {
+	t.Run("Expired records", func(t *testing.T) {
+		cs := newBadPeersServer()
+
+		cs.recordBadPeer("checksum", peer.ID("seeder").Pretty())
+		assert.True(t, cs.isBadPeer("checksum", peer.ID("seeder")))
+
+		cs.badPeers[badPeerKey{fileChecksum: "checksum", peerID: peer.ID("seeder").Pretty()}] =
+			time.Now().Add(-badPeerExpiry - time.Minute)
+
+		assert.False(t, cs.isBadPeer("checksum", peer.ID("seeder")))
+		assert.Len(t, cs.badPeers, 0)
+	})
+
+	t.Run("Max records", func(t *testing.T) {
+		cs := newBadPeersServer()
+
+		for i := 0; i < maxBadPeers+10; i++ {
+			cs.recordBadPeer(fmt.Sprintf("checksum-%d", i), peer.ID("seeder").Pretty())
+		}
+
+		assert.Len(t, cs.badPeers, maxBadPeers)
+
+		// The latest record is always kept
+		assert.True(t, cs.isBadPeer(fmt.Sprintf("checksum-%d", maxBadPeers+9), peer.ID("seeder")))
+	})
+}
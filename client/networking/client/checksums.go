@@ -0,0 +1,23 @@
+package client
+
+import (
+	"fmt"
+)
+
+// RehashWorkspaceFiles drops the cached checksums of the workspace files, and hashes them again
+func (cs *ClientServer) RehashWorkspaceFiles(mnemonic string) error {
+	mux := &cs.fileListerMux
+	mux.RLock()
+	fileLister := cs.fileListerMap[mnemonic]
+	mux.RUnlock()
+
+	if fileLister == nil {
+		return fmt.Errorf("unable to find file lister %s", mnemonic)
+	}
+
+	if rehashErr := fileLister.Rehash(); rehashErr != nil {
+		return fmt.Errorf("unable to drop cached checksums, %v", rehashErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	codecGzip = "gzip"
+
+	// maxIncompressibleChunks is the number of chunks in a row that don't shrink,
+	// after which the sender stops trying to compress the rest of the stream
+	maxIncompressibleChunks = 4
+)
+
+// supportedCodecs are the compression codecs this node supports, in order of preference
+var supportedCodecs = []string{codecGzip}
+
+var errChunkTooLarge = errors.New("decompressed chunk is too large")
+
+// compressedExtensions are the extensions of files whose content is already compressed
+var compressedExtensions = map[string]bool{
+	".gz": true, ".tgz": true, ".zip": true, ".xz": true, ".bz2": true, ".zst": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".flac": true,
+	".mp4": true, ".mkv": true, ".avi": true, ".mov": true, ".webm": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".jar": true, ".apk": true,
+}
+
+// compressedMagics are the leading bytes of common compressed formats
+var compressedMagics = [][]byte{
+	{0x1f, 0x8b},                         // gzip
+	{0x50, 0x4b, 0x03, 0x04},             // zip
+	{0x28, 0xb5, 0x2f, 0xfd},             // zstd
+	{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}, // xz
+	{0x42, 0x5a, 0x68},                   // bzip2
+	{0x37, 0x7a, 0xbc, 0xaf, 0x27, 0x1c}, // 7z
+	{0xff, 0xd8, 0xff},                   // jpeg
+	{0x89, 0x50, 0x4e, 0x47},             // png
+}
+
+// negotiateCodec picks the first accepted codec this node supports
+func negotiateCodec(acceptedCodecs []string) string {
+	for _, accepted := range acceptedCodecs {
+		for _, supported := range supportedCodecs {
+			if accepted == supported {
+				return supported
+			}
+		}
+	}
+
+	return ""
+}
+
+// isCompressedContent checks if the file content is already compressed,
+// based on the file extension and the leading bytes of the file
+func isCompressedContent(fileName string, head []byte) bool {
+	if compressedExtensions[strings.ToLower(filepath.Ext(fileName))] {
+		return true
+	}
+
+	for _, magic := range compressedMagics {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chunkCompressor compresses the chunks of a single stream,
+// and gives up once the content proves to be incompressible
+type chunkCompressor struct {
+	codec          string
+	incompressible int
+	buffer         bytes.Buffer
+	gzipWriter     *gzip.Writer
+}
+
+// newChunkCompressor creates a compressor for the codec.
+// An empty codec disables compression
+func newChunkCompressor(codec string) *chunkCompressor {
+	return &chunkCompressor{
+		codec: codec,
+	}
+}
+
+// compress returns the compressed chunk, and true if the
+// chunk was compressed. Chunks that don't shrink are returned as is
+func (cc *chunkCompressor) compress(data []byte) ([]byte, bool) {
+	if cc.codec != codecGzip || cc.incompressible >= maxIncompressibleChunks {
+		return data, false
+	}
+
+	cc.buffer.Reset()
+	if cc.gzipWriter == nil {
+		cc.gzipWriter, _ = gzip.NewWriterLevel(&cc.buffer, gzip.BestSpeed)
+	} else {
+		cc.gzipWriter.Reset(&cc.buffer)
+	}
+
+	if _, writeErr := cc.gzipWriter.Write(data); writeErr != nil {
+		return data, false
+	}
+
+	if closeErr := cc.gzipWriter.Close(); closeErr != nil {
+		return data, false
+	}
+
+	if cc.buffer.Len() >= len(data) {
+		cc.incompressible++
+
+		return data, false
+	}
+
+	cc.incompressible = 0
+
+	return cc.buffer.Bytes(), true
+}
+
+// decompressChunk decompresses a single chunk, which can't be larger than the max size
+func decompressChunk(codec string, data []byte, maxSize int64) ([]byte, error) {
+	if codec != codecGzip {
+		return nil, errors.New("unsupported compression codec")
+	}
+
+	gzipReader, readerErr := gzip.NewReader(bytes.NewReader(data))
+	if readerErr != nil {
+		return nil, readerErr
+	}
+
+	// Read one byte past the max size, so oversized chunks can be detected
+	decompressed, readErr := io.ReadAll(io.LimitReader(gzipReader, maxSize+1))
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	if int64(len(decompressed)) > maxSize {
+		return nil, errChunkTooLarge
+	}
+
+	return decompressed, nil
+}
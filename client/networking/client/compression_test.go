@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression_NegotiateCodec(t *testing.T) {
+	testTable := []struct {
+		name           string
+		acceptedCodecs []string
+		expectedCodec  string
+	}{
+		{
+			"No codecs accepted",
+			nil,
+			"",
+		},
+		{
+			"Unsupported codecs accepted",
+			[]string{"zstd", "brotli"},
+			"",
+		},
+		{
+			"Supported codec accepted",
+			[]string{"zstd", codecGzip},
+			codecGzip,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expectedCodec, negotiateCodec(testCase.acceptedCodecs))
+		})
+	}
+}
+
+func TestCompression_IsCompressedContent(t *testing.T) {
+	testTable := []struct {
+		name       string
+		fileName   string
+		head       []byte
+		compressed bool
+	}{
+		{
+			"Plain text",
+			"server.log",
+			[]byte("level=info msg=started"),
+			false,
+		},
+		{
+			"Compressed extension",
+			"backup.TAR.GZ",
+			[]byte("anything"),
+			true,
+		},
+		{
+			"Compressed content without an extension",
+			"archive",
+			[]byte{0x50, 0x4b, 0x03, 0x04, 0x14},
+			true,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.compressed, isCompressedContent(testCase.fileName, testCase.head))
+		})
+	}
+}
+
+func TestCompression_Roundtrip(t *testing.T) {
+	data := bytes.Repeat([]byte("timestamp,level,message\n"), 2048)
+
+	compressor := newChunkCompressor(codecGzip)
+	compressed, ok := compressor.compress(data)
+	assert.True(t, ok)
+	assert.Less(t, len(compressed), len(data))
+
+	decompressed, decompressErr := decompressChunk(codecGzip, compressed, int64(len(data)))
+	assert.NoError(t, decompressErr)
+	assert.Equal(t, data, decompressed)
+
+	// Chunks can't decompress past the max size
+	_, decompressErr = decompressChunk(codecGzip, compressed, int64(len(data)-1))
+	assert.ErrorIs(t, decompressErr, errChunkTooLarge)
+}
+
+func TestCompression_Incompressible(t *testing.T) {
+	data := make([]byte, 4096)
+	_, _ = rand.Read(data)
+
+	compressor := newChunkCompressor(codecGzip)
+	for i := 0; i < maxIncompressibleChunks; i++ {
+		output, ok := compressor.compress(data)
+		assert.False(t, ok)
+		assert.Equal(t, data, output)
+	}
+
+	// The compressor gives up, even on compressible data
+	_, ok := compressor.compress(bytes.Repeat([]byte("a"), 4096))
+	assert.False(t, ok)
+}
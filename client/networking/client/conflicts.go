@@ -0,0 +1,92 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	localCrypto "github.com/zivkovicmilos/peer_drop/crypto"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/utils"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+// recordPeerIdentity saves the identity the peer passed verification with
+func (cs *ClientServer) recordPeerIdentity(peerID peer.ID, publicKeyPEM string) {
+	publicKeyID, keyErr := localCrypto.GetKeyIDFromPEM(publicKeyPEM)
+	if keyErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to parse public key of peer %s, %v", peerID.Pretty(), keyErr))
+
+		return
+	}
+
+	cs.peerIdentitiesMux.Lock()
+	defer cs.peerIdentitiesMux.Unlock()
+
+	cs.peerIdentities[peerID] = publicKeyID
+}
+
+// getPeerIdentity returns the public key ID the peer passed verification with, if any
+func (cs *ClientServer) getPeerIdentity(peerID peer.ID) string {
+	cs.peerIdentitiesMux.RLock()
+	defer cs.peerIdentitiesMux.RUnlock()
+
+	return cs.peerIdentities[peerID]
+}
+
+// GetFileConflicts returns the different files peers share under the same relative path in the workspace
+func (cs *ClientServer) GetFileConflicts(mnemonic string) []files.FileConflict {
+	mux := &cs.fileAggregatorMux
+	mux.RLock()
+	fileAggregator, ok := cs.fileAggregatorMap[mnemonic]
+	mux.RUnlock()
+
+	if !ok {
+		return []files.FileConflict{}
+	}
+
+	return fileAggregator.GetConflicts()
+}
+
+// isConflictingFile checks if peers share a different file under the same relative path
+func (cs *ClientServer) isConflictingFile(mnemonic string, fileChecksum string) bool {
+	return files.ConflictingChecksums(cs.GetFileConflicts(mnemonic))[fileChecksum]
+}
+
+// GetFileSources returns the peers that share the file in the workspace,
+// along with the identities they passed verification with
+func (cs *ClientServer) GetFileSources(mnemonic string, fileChecksum string) []types.FilePeer {
+	mux := &cs.fileAggregatorMux
+	mux.RLock()
+	fileAggregator, ok := cs.fileAggregatorMap[mnemonic]
+	mux.RUnlock()
+
+	if !ok {
+		return []types.FilePeer{}
+	}
+
+	// Identities are matched against the saved contacts
+	contactMap := make(map[string]*types.Contact)
+	if contacts, _, contactsErr := storage.GetStorageHandler().GetContacts(utils.NoPagination); contactsErr == nil {
+		for _, contact := range contacts {
+			contactMap[contact.PublicKeyID] = contact
+		}
+	}
+
+	sources := make([]types.FilePeer, 0)
+	for _, peerID := range fileAggregator.GetFilePeers(fileChecksum) {
+		source := types.FilePeer{
+			PeerID:      peerID.Pretty(),
+			PublicKeyID: cs.getPeerIdentity(peerID),
+		}
+
+		if contact, found := contactMap[source.PublicKeyID]; found && source.PublicKeyID != "" {
+			source.ContactID = contact.ID
+			source.ContactName = contact.Name
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources
+}
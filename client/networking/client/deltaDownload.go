@@ -0,0 +1,355 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	// minDeltaFileSize is the smallest file size for which a delta download is attempted
+	minDeltaFileSize = int64(1024 * 1024) // 1 MiB
+
+	// maxDeltaOperationSize is the largest size of a serialized delta operation,
+	// which holds at most a chunk of literal data
+	maxDeltaOperationSize = chunkSize + 1024
+)
+
+// findPreviousVersion finds a local version of the file at the same relative path,
+// which can be used as the base of a delta download
+func (cs *ClientServer) findPreviousVersion(mnemonic string, file *proto.File) string {
+	relativePath, pathErr := files.CleanRelativePath(
+		files.JoinRelativePath(file.Path, fmt.Sprintf("%s%s", file.Name, file.Extension)),
+	)
+	if pathErr != nil {
+		return ""
+	}
+
+	candidates := make([]string, 0)
+
+	// The file might be shared locally
+	mux := &cs.fileListerMux
+	mux.RLock()
+	fileLister := cs.fileListerMap[mnemonic]
+	mux.RUnlock()
+
+	if fileLister != nil {
+		if localFile := fileLister.GetFileByPath(relativePath); localFile != nil {
+			candidates = append(candidates, filepath.Join(fileLister.GetBaseDir(), filepath.FromSlash(relativePath)))
+		}
+	}
+
+	// The file might have been mirrored or downloaded before
+	if mirrorDir, dirErr := cs.GetWorkspaceMirrorDir(mnemonic); dirErr == nil {
+		candidates = append(candidates, filepath.Join(mirrorDir, filepath.FromSlash(relativePath)))
+	}
+
+	if tempDir, dirErr := cs.GetWorkspaceTempDir(mnemonic); dirErr == nil {
+		candidates = append(candidates, filepath.Join(tempDir, filepath.FromSlash(relativePath)))
+	}
+
+	for _, candidate := range candidates {
+		info, statErr := os.Stat(candidate)
+		if statErr != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+			continue
+		}
+
+		return candidate
+	}
+
+	return ""
+}
+
+// downloadDelta downloads the file described by the download state,
+// by rebuilding it out of the previous version at the given path.
+// Only the blocks that changed since the previous version are transferred.
+// The peers are tried one by one, until one of them delivers the file
+func (cs *ClientServer) downloadDelta(
+	ctx context.Context,
+	peers []peer.ID,
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	state *downloadState,
+	previousPath string,
+) error {
+	previous, openErr := os.Open(previousPath)
+	if openErr != nil {
+		return openErr
+	}
+	defer previous.Close()
+
+	previousInfo, statErr := previous.Stat()
+	if statErr != nil {
+		return statErr
+	}
+
+	// Sign the previous version
+	blockSize := files.DeltaBlockSize(previousInfo.Size())
+	signatures, signErr := files.ComputeSignatures(previous, blockSize)
+	if signErr != nil {
+		return fmt.Errorf("unable to sign previous version, %v", signErr)
+	}
+
+	return cs.tryPeers(ctx, peers, func(peerID peer.ID) error {
+		return cs.downloadDeltaFromPeer(
+			ctx,
+			peerID,
+			workspaceInfo,
+			credentials,
+			state,
+			previous,
+			previousInfo.Size(),
+			blockSize,
+			signatures,
+		)
+	})
+}
+
+// downloadDeltaFromPeer rebuilds the file out of the signed previous version,
+// with the delta operations received from a single peer
+func (cs *ClientServer) downloadDeltaFromPeer(
+	ctx context.Context,
+	peerID peer.ID,
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	state *downloadState,
+	previous io.ReaderAt,
+	previousSize int64,
+	blockSize int,
+	signatures []files.BlockSignature,
+) error {
+	clientProto, closeFn, clientErr := cs.newFileSharingClient(ctx, peerID)
+	if clientErr != nil {
+		return clientErr
+	}
+	defer closeFn()
+
+	fileChecksum, parseErr := files.ParseFileChecksum(state.FileChecksum)
+	if parseErr != nil {
+		return parseErr
+	}
+
+	partialFile, openErr := os.OpenFile(state.partialPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if openErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to open partial file, %v", openErr))
+
+		return openErr
+	}
+
+	// The rebuilt file is checked against its checksum, since nothing else covers the copied blocks
+	hash := fileChecksum.NewHash()
+	output := &countingWriter{writer: io.MultiWriter(partialFile, hash)}
+
+	fileMetadata, wireBytes, fetchErr := cs.fetchDelta(
+		ctx,
+		peerID,
+		clientProto,
+		workspaceInfo,
+		credentials,
+		state.FileChecksum,
+		previous,
+		previousSize,
+		blockSize,
+		signatures,
+		output,
+	)
+	state.WireBytes += wireBytes
+
+	if closeErr := partialFile.Close(); fetchErr == nil && closeErr != nil {
+		fetchErr = closeErr
+	}
+
+	if fetchErr == nil && output.written != fileMetadata.FileSize {
+		fetchErr = fmt.Errorf("file size mismatch, expected %d found %d", fileMetadata.FileSize, output.written)
+	}
+
+	if fetchErr == nil && !fileChecksum.Matches(hash.Sum(nil)) {
+		fetchErr = ErrChecksumMismatch
+	}
+
+	if fetchErr != nil {
+		// Nothing in the partial file can be trusted
+		if truncateErr := os.Truncate(state.partialPath, 0); truncateErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to truncate partial file, %v", truncateErr))
+		}
+
+		return fetchErr
+	}
+
+	state.Offset = output.written
+	state.FileName = fileMetadata.FileName
+	state.FileSize = fileMetadata.FileSize
+	state.addUnverifiedSource(peerID)
+
+	// The rebuilt file is already hashed
+	state.hasher = hash
+	state.hashedOffset = output.written
+
+	if saveErr := state.save(); saveErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to save download state, %v", saveErr))
+	}
+
+	cs.logger.Info(
+		fmt.Sprintf(
+			"Rebuilt %s out of its previous version with %d bytes on the wire",
+			state.FileName,
+			wireBytes,
+		),
+	)
+
+	return nil
+}
+
+// fetchDelta requests the file from the peer, and rebuilds it into the output writer
+// out of the previous version and the received delta operations.
+// The number of bytes received from the peer is returned even if the fetch fails
+func (cs *ClientServer) fetchDelta(
+	ctx context.Context,
+	peerID peer.ID,
+	clientProto proto.FileSharingClient,
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	fileChecksum string,
+	previous io.ReaderAt,
+	previousSize int64,
+	blockSize int,
+	signatures []files.BlockSignature,
+	output io.Writer,
+) (*proto.FileDownloadMetadata, int64, error) {
+	// Number of bytes received from the peer, after compression
+	wireBytes := int64(0)
+
+	// Request the whole file
+	fileMetadata, requestErr := clientProto.RequestFile(ctx, &proto.FileRequest{
+		Mnemonic:       workspaceInfo.Mnemonic,
+		FileChecksum:   fileChecksum,
+		PublicKey:      credentials.PublicKey,
+		AcceptedCodecs: supportedCodecs,
+	})
+	if requestErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to request file, %v", requestErr))
+
+		return nil, wireBytes, requestErr
+	}
+
+	if checkErr := checkTransferMetadata(fileMetadata); checkErr != nil {
+		return nil, wireBytes, checkErr
+	}
+
+	chunkCipher, err := newReceiveCipher(workspaceInfo, credentials, fileMetadata)
+	if err != nil {
+		return nil, wireBytes, err
+	}
+
+	protoSignatures := make([]*proto.BlockSignature, len(signatures))
+	for i, signature := range signatures {
+		protoSignatures[i] = &proto.BlockSignature{
+			Weak:   signature.Weak,
+			Strong: signature.Strong,
+		}
+	}
+
+	deltaDownload, downloadErr := clientProto.DownloadDelta(ctx, &proto.DeltaRequest{
+		RequestId:    fileMetadata.RequestId,
+		BlockSize:    int64(blockSize),
+		Signatures:   protoSignatures,
+		PreviousSize: previousSize,
+	})
+	if downloadErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to download delta, %v", downloadErr))
+
+		return nil, wireBytes, downloadErr
+	}
+
+	// The rebuilt file can't grow past the size announced by the peer
+	rebuilt := &countingWriter{writer: output}
+
+	// Every chunk holds a single operation, which is applied as soon as it arrives
+	expectedIndex := int64(0)
+	finalReceived := false
+	for {
+		chunk, err := deltaDownload.Recv()
+		if err != nil {
+			if err == io.EOF {
+				cs.logger.Debug("Delta transfer complete")
+				break
+			}
+			cs.logger.Error("Error with delta download")
+
+			return nil, wireBytes, err
+		}
+
+		wireBytes += int64(len(chunk.Chunk))
+
+		if finalReceived {
+			return nil, wireBytes, errUnexpectedChunk
+		}
+
+		// Stay within the download limits
+		if waitErr := cs.throttler.WaitDownload(ctx, workspaceInfo.Mnemonic, peerID.String(), len(chunk.Chunk)); waitErr != nil {
+			return nil, wireBytes, waitErr
+		}
+
+		if chunk.Index != expectedIndex {
+			cs.logger.Error(fmt.Sprintf("Chunk out of order, expected %d found %d", expectedIndex, chunk.Index))
+
+			return nil, wireBytes, errUnexpectedChunk
+		}
+
+		data, openErr := openChunk(chunkCipher, fileMetadata.Codec, chunk, maxDeltaOperationSize)
+		if openErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to open chunk %d, %v", chunk.Index, openErr))
+
+			return nil, wireBytes, openErr
+		}
+
+		expectedIndex++
+		finalReceived = chunk.Final
+
+		if chunk.Final {
+			continue
+		}
+
+		operation := &proto.DeltaOperation{}
+		if unmarshalErr := protobuf.Unmarshal(data, operation); unmarshalErr != nil {
+			return nil, wireBytes, fmt.Errorf("unable to read delta operation, %v", unmarshalErr)
+		}
+
+		if applyErr := files.ApplyDeltaOp(
+			previous,
+			previousSize,
+			blockSize,
+			files.DeltaOp{
+				BlockIndex: operation.BlockIndex,
+				BlockCount: operation.BlockCount,
+				Data:       operation.Data,
+			},
+			rebuilt,
+		); applyErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to apply delta operation %d, %v", chunk.Index, applyErr))
+
+			return nil, wireBytes, applyErr
+		}
+
+		if rebuilt.written > fileMetadata.FileSize {
+			return nil, wireBytes, errors.New("rebuilt file is larger than expected")
+		}
+	}
+
+	if !finalReceived {
+		cs.logger.Error("Delta stream ended without the final chunk")
+
+		return nil, wireBytes, errTruncatedStream
+	}
+
+	return fileMetadata, wireBytes, nil
+}
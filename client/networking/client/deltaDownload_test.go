@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+func TestClientServer_DownloadDelta(t *testing.T) {
+	data := testDownloadData()
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// The previous version differs from the file in its first chunk
+	previous := append([]byte{}, data...)
+	previous[0] ^= 0xff
+
+	// The corrupted peer serves a file that differs in its last byte
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	workspaceInfo := &proto.WorkspaceInfo{Mnemonic: "mnemonic", SecurityType: "password"}
+	password := testPassword
+	credentials := &types.WorkspaceCredentials{Password: &password}
+
+	testTable := []struct {
+		name           string
+		peers          []peer.ID
+		expectedErrs   []error
+		expectedSource peer.ID
+	}{
+		{
+			"First candidates fail, a later one succeeds",
+			[]peer.ID{"broken", "corrupted", "good"},
+			nil,
+			"good",
+		},
+		{
+			"All candidates fail",
+			[]peer.ID{"broken", "corrupted"},
+			[]error{errStreamReset, ErrChecksumMismatch},
+			"",
+		},
+		{
+			"No candidates",
+			[]peer.ID{},
+			[]error{errNoPeers},
+			"",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			seeders := map[peer.ID]*mockFileSharingClient{
+				"broken":    newMockFileSharingClient(t, data),
+				"corrupted": newMockFileSharingClient(t, corrupted),
+				"good":      newMockFileSharingClient(t, data),
+			}
+			seeders["broken"].deltaErr = errStreamReset
+
+			cs := newTestDownloadServer()
+			cs.fileSharingClientFn = func(_ context.Context, peerID peer.ID) (proto.FileSharingClient, func(), error) {
+				return seeders[peerID], func() {}, nil
+			}
+
+			tempDir := t.TempDir()
+			previousPath := filepath.Join(tempDir, "previous.bin")
+			assert.NoError(t, os.WriteFile(previousPath, previous, 0600))
+
+			state := newDownloadState(tempDir, checksum)
+
+			deltaErr := cs.downloadDelta(
+				context.Background(),
+				testCase.peers,
+				workspaceInfo,
+				credentials,
+				state,
+				previousPath,
+			)
+
+			if testCase.expectedErrs != nil {
+				// The failure of every candidate is reported, not only the last one
+				for _, expectedErr := range testCase.expectedErrs {
+					assert.ErrorIs(t, deltaErr, expectedErr)
+				}
+
+				for _, peerID := range testCase.peers {
+					assert.Contains(t, deltaErr.Error(), peerID.String())
+				}
+
+				assert.Equal(t, int64(0), state.Offset)
+
+				return
+			}
+
+			assert.NoError(t, deltaErr)
+			assert.Equal(t, int64(len(data)), state.Offset)
+			assert.Equal(t, []string{testCase.expectedSource.Pretty()}, state.UnverifiedSources)
+
+			rebuilt, readErr := os.ReadFile(state.partialPath)
+			assert.NoError(t, readErr)
+			assert.True(t, bytes.Equal(data, rebuilt))
+		})
+	}
+}
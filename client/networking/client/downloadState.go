@@ -0,0 +1,173 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+)
+
+const (
+	partialFileSuffix = ".part"  // suffix of the partially downloaded file
+	stateFileSuffix   = ".state" // suffix of the sidecar state file
+)
+
+// downloadState is the sidecar information saved next to
+// a partially downloaded file, used for resuming the download
+type downloadState struct {
+	FileChecksum string `json:"fileChecksum"`
+	FileName     string `json:"fileName"`
+	Path         string `json:"path,omitempty"` // relative directory of the file
+	FileSize     int64  `json:"fileSize"`
+	Offset       int64  `json:"offset"` // number of bytes safely written to the partial file
+	MerkleRoot   string `json:"merkleRoot,omitempty"`
+	WireBytes    int64  `json:"wireBytes,omitempty"` // number of bytes received from peers, after compression
+
+	// Peers that served data written to the partial file without Merkle proofs,
+	// which are suspects if the finished file doesn't match its checksum
+	UnverifiedSources []string `json:"unverifiedSources,omitempty"`
+
+	// Multi-source downloads //
+	// The file is split into pieces which are downloaded out of order
+	PieceSize       int64   `json:"pieceSize,omitempty"`
+	CompletedPieces []int64 `json:"completedPieces,omitempty"`
+
+	partialPath string
+	statePath   string
+	onProgress  ProgressFn // notified every time the progress is saved
+
+	// Running hash of the partial file, up to the hashed offset.
+	// It follows sequential downloads, so the finished file isn't read again
+	hasher       hash.Hash
+	hashedOffset int64
+}
+
+// ProgressFn is called with the number of verified bytes, and the total file size
+type ProgressFn func(downloaded int64, total int64)
+
+// newDownloadState creates a new download state for the given checksum
+// in the given temporary directory
+func newDownloadState(tempDir string, fileChecksum string) *downloadState {
+	partialPath := filepath.Join(tempDir, fileChecksum+partialFileSuffix)
+
+	return &downloadState{
+		FileChecksum: fileChecksum,
+		partialPath:  partialPath,
+		statePath:    partialPath + stateFileSuffix,
+	}
+}
+
+// loadDownloadState loads the download state for the given checksum, if any.
+// The partial file is truncated to the last saved offset,
+// so the download can resume from a known good position
+func loadDownloadState(tempDir string, fileChecksum string) (*downloadState, error) {
+	state := newDownloadState(tempDir, fileChecksum)
+
+	data, readErr := os.ReadFile(state.statePath)
+	if readErr != nil {
+		if os.IsNotExist(readErr) {
+			// No previous download attempt, start from scratch
+			return state, state.reset()
+		}
+
+		return nil, fmt.Errorf("unable to read download state, %v", readErr)
+	}
+
+	if unmarshalErr := json.Unmarshal(data, state); unmarshalErr != nil || state.FileChecksum != fileChecksum {
+		// The state file is unusable, start from scratch
+		return state, state.reset()
+	}
+
+	partialInfo, statErr := os.Stat(state.partialPath)
+	if statErr != nil {
+		// The partial file is gone, start from scratch
+		return state, state.reset()
+	}
+
+	if state.PieceSize > 0 {
+		// Pieces are written out of order, and only after they are verified,
+		// so there is nothing to truncate
+		return state, nil
+	}
+
+	// The partial file can be ahead of the saved state if the
+	// node stopped mid-transfer, but it can never be behind it
+	if partialInfo.Size() < state.Offset {
+		state.Offset = partialInfo.Size()
+	}
+
+	if truncateErr := os.Truncate(state.partialPath, state.Offset); truncateErr != nil {
+		return nil, fmt.Errorf("unable to truncate partial file, %v", truncateErr)
+	}
+
+	return state, nil
+}
+
+// reset clears the download progress
+func (ds *downloadState) reset() error {
+	ds.Offset = 0
+	ds.FileSize = 0
+	ds.PieceSize = 0
+	ds.CompletedPieces = nil
+	ds.WireBytes = 0
+	ds.UnverifiedSources = nil
+	ds.hasher = nil
+
+	if removeErr := os.Remove(ds.partialPath); removeErr != nil && !os.IsNotExist(removeErr) {
+		return removeErr
+	}
+
+	return ds.save()
+}
+
+// downloaded returns the number of verified bytes in the partial file
+func (ds *downloadState) downloaded() int64 {
+	if ds.PieceSize == 0 {
+		return ds.Offset
+	}
+
+	downloaded := int64(0)
+	for _, piece := range ds.CompletedPieces {
+		pieceSize := ds.PieceSize
+		if remaining := ds.FileSize - piece*ds.PieceSize; remaining < pieceSize {
+			pieceSize = remaining
+		}
+
+		downloaded += pieceSize
+	}
+
+	return downloaded
+}
+
+// save writes the download state to disk
+func (ds *downloadState) save() error {
+	if ds.onProgress != nil {
+		ds.onProgress(ds.downloaded(), ds.FileSize)
+	}
+
+	data, marshalErr := json.Marshal(ds)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	return os.WriteFile(ds.statePath, data, 0600)
+}
+
+// remove removes the partial file and the sidecar state file
+func (ds *downloadState) remove() {
+	_ = os.Remove(ds.partialPath)
+	_ = os.Remove(ds.statePath)
+}
+
+// promote moves the finished partial file to its final destination,
+// and removes the sidecar state file
+func (ds *downloadState) promote(destination string) error {
+	if renameErr := os.Rename(ds.partialPath, destination); renameErr != nil {
+		return renameErr
+	}
+
+	_ = os.Remove(ds.statePath)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadState_Resume(t *testing.T) {
+	testTable := []struct {
+		name           string
+		savedOffset    int64
+		partialData    []byte
+		expectedOffset int64
+	}{
+		{
+			"Partial file matches the saved offset",
+			4,
+			[]byte("data"),
+			4,
+		},
+		{
+			"Partial file is ahead of the saved offset",
+			2,
+			[]byte("data"),
+			2,
+		},
+		{
+			"Partial file is behind the saved offset",
+			10,
+			[]byte("data"),
+			4,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			state := newDownloadState(tempDir, "checksum")
+			state.FileName = "file.txt"
+			state.Offset = testCase.savedOffset
+
+			assert.NoError(t, os.WriteFile(state.partialPath, testCase.partialData, 0600))
+			assert.NoError(t, state.save())
+
+			loadedState, loadErr := loadDownloadState(tempDir, "checksum")
+			assert.NoError(t, loadErr)
+
+			assert.Equal(t, "file.txt", loadedState.FileName)
+			assert.Equal(t, testCase.expectedOffset, loadedState.Offset)
+
+			partialInfo, statErr := os.Stat(loadedState.partialPath)
+			assert.NoError(t, statErr)
+			assert.Equal(t, testCase.expectedOffset, partialInfo.Size())
+		})
+	}
+}
+
+func TestDownloadState_NoPreviousAttempt(t *testing.T) {
+	tempDir := t.TempDir()
+
+	state, loadErr := loadDownloadState(tempDir, "checksum")
+	assert.NoError(t, loadErr)
+
+	assert.Equal(t, int64(0), state.Offset)
+	assert.Equal(t, "checksum", state.FileChecksum)
+}
+
+func TestDownloadState_VerifyChecksum(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	testTable := []struct {
+		name         string
+		partialData  []byte
+		hashedOffset int64 // bytes hashed while the file was downloading, -1 if none
+		expectedErr  error
+	}{
+		{
+			"File hashed while downloading",
+			data,
+			int64(len(data)),
+			nil,
+		},
+		{
+			"File partially hashed while downloading",
+			data,
+			10,
+			nil,
+		},
+		{
+			"File not hashed while downloading",
+			data,
+			-1,
+			nil,
+		},
+		{
+			"Corrupted file",
+			append(append([]byte{}, data[:len(data)-1]...), 'x'),
+			-1,
+			ErrChecksumMismatch,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			state := newDownloadState(t.TempDir(), checksum)
+			state.FileSize = int64(len(testCase.partialData))
+
+			assert.NoError(t, os.WriteFile(state.partialPath, testCase.partialData, 0600))
+
+			if testCase.hashedOffset >= 0 {
+				assert.NoError(t, state.syncHash(testCase.hashedOffset))
+			}
+
+			assert.ErrorIs(t, state.verifyChecksum(), testCase.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/events"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// downloadProgressInterval is the shortest time between two progress events of a download
+const downloadProgressInterval = 500 * time.Millisecond
+
+// GetEventBus returns the bus the client events are published on
+func (cs *ClientServer) GetEventBus() *events.EventBus {
+	return cs.eventBus
+}
+
+// publishEvent publishes a workspace event on the event bus
+func (cs *ClientServer) publishEvent(eventType string, mnemonic string, data interface{}) {
+	cs.eventBus.Publish(types.Event{
+		Type:              eventType,
+		WorkspaceMnemonic: mnemonic,
+		Data:              data,
+	})
+}
+
+// newProgressPublisher wraps the download progress callback,
+// so the progress is also published as download events
+func (cs *ClientServer) newProgressPublisher(
+	mnemonic string,
+	fileChecksum string,
+	progressFn ProgressFn,
+) ProgressFn {
+	var (
+		lastPublished time.Time
+		publishMux    sync.Mutex
+	)
+
+	return func(downloaded int64, total int64) {
+		if progressFn != nil {
+			progressFn(downloaded, total)
+		}
+
+		publishMux.Lock()
+		defer publishMux.Unlock()
+
+		// Progress is saved after every chunk, the events are spaced out
+		if downloaded < total && time.Since(lastPublished) < downloadProgressInterval {
+			return
+		}
+
+		lastPublished = time.Now()
+
+		cs.publishEvent(types.EVENT_DOWNLOAD_PROGRESS, mnemonic, types.DownloadEventData{
+			FileChecksum:    fileChecksum,
+			BytesDownloaded: downloaded,
+			BytesTotal:      total,
+		})
+	}
+}
+
+// watchPeerDisconnects removes the verified status of peers that disconnect,
+// so they go through verification again when they're found next
+func (cs *ClientServer) watchPeerDisconnects() {
+	cs.host.Network().Notify(&network.NotifyBundle{
+		DisconnectedF: func(_ network.Network, conn network.Conn) {
+			go cs.handlePeerDisconnect(conn.RemotePeer())
+		},
+	})
+}
+
+// handlePeerDisconnect cancels the sessions of the peer,
+// and drops it from every workspace it was verified in
+func (cs *ClientServer) handlePeerDisconnect(peerID peer.ID) {
+	if cs.host.Network().Connectedness(peerID) == network.Connected {
+		// Other connections to the peer are still open
+		return
+	}
+
+	// Pending challenges and transfers of the peer can't finish anymore
+	if canceled := cs.sessionManager.CancelPeer(peerID); canceled > 0 {
+		cs.logger.Debug(fmt.Sprintf("Canceled %d sessions of peer %s", canceled, peerID.Pretty()))
+	}
+
+	// The bandwidth buckets of the peer are created again if it reconnects
+	cs.throttler.RemovePeer(peerID.String())
+
+	for _, mnemonic := range cs.verifiedWorkspaces(peerID) {
+		if cs.removeVerifiedPeer(mnemonic, peerID) {
+			cs.logger.Info(fmt.Sprintf("Peer %s left workspace [%s]", peerID.Pretty(), mnemonic))
+
+			cs.publishEvent(types.EVENT_PEER_LEFT, mnemonic, types.PeerEventData{PeerID: peerID.Pretty()})
+		}
+	}
+}
+
+// verifiedWorkspaces returns the mnemonics of the workspaces the peer is verified in
+func (cs *ClientServer) verifiedWorkspaces(peerID peer.ID) []string {
+	cs.verifiedPeersMux.RLock()
+	defer cs.verifiedPeersMux.RUnlock()
+
+	mnemonics := make([]string, 0)
+	for mnemonic, verifiedPeers := range cs.verifiedPeers {
+		if containsPeer(verifiedPeers, peerID) {
+			mnemonics = append(mnemonics, mnemonic)
+		}
+	}
+
+	return mnemonics
+}
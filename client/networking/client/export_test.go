@@ -0,0 +1,43 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// DownloadFromForgingPeer downloads the test data from a peer that forges the proof of a chunk,
+// and returns the checksum of the data along with the download error
+func DownloadFromForgingPeer(t *testing.T) (string, error) {
+	t.Helper()
+
+	data := testDownloadData()
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	state := newDownloadState(t.TempDir(), checksum)
+
+	merkleTree, _ := files.NewMerkleTreeFromReader(bytes.NewReader(data), chunkSize)
+	state.MerkleRoot = fmt.Sprintf("%x", merkleTree.Root())
+
+	seeder := newMockFileSharingClient(t, data)
+	seeder.forgeChunk = 1
+
+	password := testPassword
+
+	return checksum, newTestDownloadServer().downloadSegments(
+		context.Background(),
+		peer.ID("seeder"),
+		seeder,
+		&proto.WorkspaceInfo{Mnemonic: "mnemonic", SecurityType: "password"},
+		&types.WorkspaceCredentials{Password: &password},
+		state,
+		int64(len(data)),
+	)
+}
@@ -0,0 +1,398 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/utils"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+const (
+	// maxPendingOffers is the largest number of incoming offers waiting for an answer.
+	// Offers over the limit are refused, so peers can't flood the list
+	maxPendingOffers = 100
+
+	// maxAcceptedOffers is the largest number of accepted offers kept around,
+	// the oldest ones are dropped first
+	maxAcceptedOffers = 100
+
+	// acceptedOfferRetention is the time an accepted offer is kept, so its sender
+	// can be used as a source of the file while the download is running
+	acceptedOfferRetention = 24 * time.Hour
+)
+
+var (
+	ErrOfferNotFound     = errors.New("file offer not found")
+	ErrInvalidOfferState = errors.New("invalid file offer state")
+	ErrUnknownPeer       = errors.New("peer is not verified in the workspace")
+	ErrUnknownFile       = errors.New("file is not shared in the workspace")
+)
+
+// incomingOffer is a file pushed to this node by a verified peer
+type incomingOffer struct {
+	offer      types.FileOffer
+	senderID   peer.ID
+	file       *proto.File
+	acceptedAt time.Time
+}
+
+// OfferFile handles the file pushed by a verified peer.
+// The offer waits for the user to accept or reject it
+func (cs *ClientServer) OfferFile(
+	context context.Context,
+	offer *proto.FileOffer,
+) (*proto.FileOfferAck, error) {
+	typedContext := context.(*WrappedContext)
+	if !cs.isVerifiedPeer(typedContext.PeerID, offer.Mnemonic) {
+		// Peer unverified
+		cs.logger.Error(fmt.Sprintf("Unverified peer offered file %s", typedContext.PeerID.Pretty()))
+
+		return nil, errors.New("unverified peer offer")
+	}
+
+	file := offer.File
+	if file == nil || file.Size < 0 {
+		return nil, errors.New("invalid file offer")
+	}
+
+	if _, parseErr := files.ParseFileChecksum(file.FileChecksum); parseErr != nil {
+		return nil, errors.New("invalid file offer checksum")
+	}
+
+	if _, pathErr := files.CleanRelativePath(
+		files.JoinRelativePath(file.Path, fmt.Sprintf("%s%s", file.Name, file.Extension)),
+	); pathErr != nil {
+		return nil, errors.New("invalid file offer path")
+	}
+
+	// The sender is identified by the key it passed verification with, not by what it claims.
+	// The contacts are looked up before taking the lock
+	senderPublicKeyID := cs.getPeerIdentity(typedContext.PeerID)
+	senderName := offer.SenderName
+
+	contact := findContact(senderPublicKeyID)
+	contactID := ""
+	if contact != nil {
+		contactID = contact.ID
+		senderName = contact.Name
+	}
+
+	cs.offersMux.Lock()
+	defer cs.offersMux.Unlock()
+
+	cs.pruneAcceptedOffersLocked(time.Now())
+
+	numPending := 0
+	for _, incoming := range cs.incomingOffers {
+		if incoming.offer.Status == types.OFFER_STATUS_PENDING {
+			numPending++
+		}
+	}
+
+	if numPending >= maxPendingOffers {
+		cs.logger.Error(fmt.Sprintf("Refused file offer from %s, too many pending offers", typedContext.PeerID.Pretty()))
+
+		return nil, errors.New("too many pending offers")
+	}
+
+	incoming := &incomingOffer{
+		offer: types.FileOffer{
+			ID:                uuid.New().String(),
+			WorkspaceMnemonic: offer.Mnemonic,
+			FileChecksum:      file.FileChecksum,
+			FileName:          fmt.Sprintf("%s%s", file.Name, file.Extension),
+			FileSize:          file.Size,
+			Status:            types.OFFER_STATUS_PENDING,
+			DateReceived:      time.Now().Unix(),
+			SenderPeerID:      typedContext.PeerID.Pretty(),
+			SenderName:        senderName,
+			SenderPublicKeyID: senderPublicKeyID,
+			SenderContactID:   contactID,
+		},
+		senderID: typedContext.PeerID,
+		file:     file,
+	}
+
+	cs.incomingOffers[incoming.offer.ID] = incoming
+
+	cs.logger.Info(
+		fmt.Sprintf(
+			"File %s (%d bytes) offered by %s",
+			incoming.offer.FileName,
+			incoming.offer.FileSize,
+			incoming.offer.SenderPeerID,
+		),
+	)
+
+	return &proto.FileOfferAck{OfferId: incoming.offer.ID}, nil
+}
+
+// findContact returns the contact with the given public key ID, if any
+func findContact(publicKeyID string) *types.Contact {
+	if publicKeyID == "" {
+		return nil
+	}
+
+	contacts, _, contactsErr := storage.GetStorageHandler().GetContacts(utils.NoPagination)
+	if contactsErr != nil {
+		return nil
+	}
+
+	for _, contact := range contacts {
+		if contact.PublicKeyID == publicKeyID {
+			return contact
+		}
+	}
+
+	return nil
+}
+
+// SendFileOffer pushes a file shared in the workspace to a single verified peer,
+// and returns the ID of the offer on the receiving side
+func (cs *ClientServer) SendFileOffer(
+	ctx context.Context,
+	mnemonic string,
+	fileChecksum string,
+	receiver string,
+) (string, error) {
+	peerID, decodeErr := peer.Decode(receiver)
+	if decodeErr != nil || !cs.isVerifiedPeer(peerID, mnemonic) {
+		return "", ErrUnknownPeer
+	}
+
+	// Only shared files can be offered, since the receiver requests them like any other file
+	mux := &cs.fileListerMux
+	mux.RLock()
+	fileLister := cs.fileListerMap[mnemonic]
+	mux.RUnlock()
+
+	if fileLister == nil {
+		return "", ErrUnknownFile
+	}
+
+	file, _ := fileLister.GetFileInfo(fileChecksum)
+	if file == nil {
+		return "", ErrUnknownFile
+	}
+
+	offer := &proto.FileOffer{
+		Mnemonic: mnemonic,
+		File:     file,
+	}
+
+	// Let the receiver know who the file is from
+	if primaryID := storage.GetStorageHandler().GetPrimaryIdentity(); primaryID != "" {
+		identity, identityErr := storage.GetStorageHandler().GetIdentity(primaryID)
+		if identityErr == nil && identity != nil {
+			offer.SenderName = identity.Name
+			offer.SenderPublicKeyId = identity.PublicKeyID
+		}
+	}
+
+	clientProto, closeFn, clientErr := cs.newFileSharingClient(ctx, peerID)
+	if clientErr != nil {
+		return "", clientErr
+	}
+	defer closeFn()
+
+	ack, offerErr := clientProto.OfferFile(ctx, offer)
+	if offerErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to offer file, %v", offerErr))
+
+		return "", offerErr
+	}
+
+	cs.logger.Info(fmt.Sprintf("File %s offered to %s", fileChecksum, peerID.Pretty()))
+
+	return ack.OfferId, nil
+}
+
+// GetFileOffers returns the incoming file offers, newest first
+func (cs *ClientServer) GetFileOffers() []*types.FileOffer {
+	cs.offersMux.RLock()
+	defer cs.offersMux.RUnlock()
+
+	offers := make([]*types.FileOffer, 0, len(cs.incomingOffers))
+	for _, incoming := range cs.incomingOffers {
+		offer := incoming.offer
+		offers = append(offers, &offer)
+	}
+
+	sort.Slice(offers, func(i, j int) bool {
+		if offers[i].DateReceived != offers[j].DateReceived {
+			return offers[i].DateReceived > offers[j].DateReceived
+		}
+
+		return offers[i].ID < offers[j].ID
+	})
+
+	return offers
+}
+
+// GetFileOffer returns a single incoming file offer
+func (cs *ClientServer) GetFileOffer(offerID string) (*types.FileOffer, error) {
+	cs.offersMux.RLock()
+	defer cs.offersMux.RUnlock()
+
+	incoming, ok := cs.incomingOffers[offerID]
+	if !ok {
+		return nil, ErrOfferNotFound
+	}
+
+	offer := incoming.offer
+
+	return &offer, nil
+}
+
+// AcceptFileOffer claims the pending offer, and returns it.
+// Only one caller can accept an offer, so the file download is queued once
+func (cs *ClientServer) AcceptFileOffer(offerID string) (*types.FileOffer, error) {
+	cs.offersMux.Lock()
+	defer cs.offersMux.Unlock()
+
+	incoming, ok := cs.incomingOffers[offerID]
+	if !ok {
+		return nil, ErrOfferNotFound
+	}
+
+	if incoming.offer.Status != types.OFFER_STATUS_PENDING {
+		return nil, ErrInvalidOfferState
+	}
+
+	incoming.offer.Status = types.OFFER_STATUS_ACCEPTED
+	incoming.acceptedAt = time.Now()
+
+	cs.pruneAcceptedOffersLocked(incoming.acceptedAt)
+
+	offer := incoming.offer
+
+	return &offer, nil
+}
+
+// SetFileOfferJob records the job that downloads the file of the accepted offer.
+// The sender is used as a source of the file from then on
+func (cs *ClientServer) SetFileOfferJob(offerID string, downloadJobID string) error {
+	cs.offersMux.Lock()
+	defer cs.offersMux.Unlock()
+
+	incoming, ok := cs.incomingOffers[offerID]
+	if !ok {
+		return ErrOfferNotFound
+	}
+
+	if incoming.offer.Status != types.OFFER_STATUS_ACCEPTED {
+		return ErrInvalidOfferState
+	}
+
+	incoming.offer.DownloadJobID = downloadJobID
+
+	return nil
+}
+
+// ReleaseFileOffer puts the accepted offer back in the pending state,
+// if its file download couldn't be queued
+func (cs *ClientServer) ReleaseFileOffer(offerID string) {
+	cs.offersMux.Lock()
+	defer cs.offersMux.Unlock()
+
+	incoming, ok := cs.incomingOffers[offerID]
+	if !ok || incoming.offer.Status != types.OFFER_STATUS_ACCEPTED || incoming.offer.DownloadJobID != "" {
+		return
+	}
+
+	incoming.offer.Status = types.OFFER_STATUS_PENDING
+	incoming.acceptedAt = time.Time{}
+}
+
+// pruneAcceptedOffersLocked drops the accepted offers that are past their retention,
+// and the oldest accepted offers over the limit
+func (cs *ClientServer) pruneAcceptedOffersLocked(now time.Time) {
+	accepted := make([]*incomingOffer, 0)
+	for offerID, incoming := range cs.incomingOffers {
+		if incoming.offer.Status != types.OFFER_STATUS_ACCEPTED {
+			continue
+		}
+
+		if now.Sub(incoming.acceptedAt) > acceptedOfferRetention {
+			delete(cs.incomingOffers, offerID)
+
+			continue
+		}
+
+		accepted = append(accepted, incoming)
+	}
+
+	if len(accepted) <= maxAcceptedOffers {
+		return
+	}
+
+	sort.Slice(accepted, func(i, j int) bool {
+		return accepted[i].acceptedAt.Before(accepted[j].acceptedAt)
+	})
+
+	for _, incoming := range accepted[:len(accepted)-maxAcceptedOffers] {
+		delete(cs.incomingOffers, incoming.offer.ID)
+	}
+}
+
+// RejectFileOffer removes the pending offer
+func (cs *ClientServer) RejectFileOffer(offerID string) error {
+	cs.offersMux.Lock()
+	defer cs.offersMux.Unlock()
+
+	incoming, ok := cs.incomingOffers[offerID]
+	if !ok {
+		return ErrOfferNotFound
+	}
+
+	if incoming.offer.Status != types.OFFER_STATUS_PENDING {
+		return ErrInvalidOfferState
+	}
+
+	delete(cs.incomingOffers, offerID)
+
+	return nil
+}
+
+// getOfferedFile returns the file info and the senders of the accepted offers for the file.
+// Senders can be asked for the file even if it hasn't shown up in the aggregated file list yet
+func (cs *ClientServer) getOfferedFile(mnemonic string, fileChecksum string) (*proto.File, []peer.ID) {
+	cs.offersMux.RLock()
+	defer cs.offersMux.RUnlock()
+
+	var file *proto.File
+	senders := make([]peer.ID, 0)
+
+	for _, incoming := range cs.incomingOffers {
+		if incoming.offer.Status != types.OFFER_STATUS_ACCEPTED ||
+			incoming.offer.WorkspaceMnemonic != mnemonic ||
+			incoming.offer.FileChecksum != fileChecksum {
+			continue
+		}
+
+		file = incoming.file
+		senders = append(senders, incoming.senderID)
+	}
+
+	return file, senders
+}
+
+// containsPeer checks if the peer is in the list
+func containsPeer(peers []peer.ID, peerID peer.ID) bool {
+	for _, listedPeer := range peers {
+		if listedPeer == peerID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// testOfferChecksum is the checksum of the offered test file
+const testOfferChecksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestFileOffers_Answer(t *testing.T) {
+	newServer := func(status string) *ClientServer {
+		return &ClientServer{
+			incomingOffers: map[string]*incomingOffer{
+				"offer": {
+					offer: types.FileOffer{
+						ID:                "offer",
+						WorkspaceMnemonic: "workspace",
+						FileChecksum:      "checksum",
+						Status:            status,
+					},
+					senderID: peer.ID("sender"),
+					file:     &proto.File{FileChecksum: "checksum"},
+				},
+			},
+		}
+	}
+
+	testTable := []struct {
+		name        string
+		status      string
+		answer      func(cs *ClientServer, offerID string) error
+		offerID     string
+		expectedErr error
+	}{
+		{
+			"Accept pending offer",
+			types.OFFER_STATUS_PENDING,
+			func(cs *ClientServer, offerID string) error {
+				_, acceptErr := cs.AcceptFileOffer(offerID)
+
+				return acceptErr
+			},
+			"offer",
+			nil,
+		},
+		{
+			"Accept accepted offer",
+			types.OFFER_STATUS_ACCEPTED,
+			func(cs *ClientServer, offerID string) error {
+				_, acceptErr := cs.AcceptFileOffer(offerID)
+
+				return acceptErr
+			},
+			"offer",
+			ErrInvalidOfferState,
+		},
+		{
+			"Reject pending offer",
+			types.OFFER_STATUS_PENDING,
+			(*ClientServer).RejectFileOffer,
+			"offer",
+			nil,
+		},
+		{
+			"Reject accepted offer",
+			types.OFFER_STATUS_ACCEPTED,
+			(*ClientServer).RejectFileOffer,
+			"offer",
+			ErrInvalidOfferState,
+		},
+		{
+			"Unknown offer",
+			types.OFFER_STATUS_PENDING,
+			(*ClientServer).RejectFileOffer,
+			"unknown",
+			ErrOfferNotFound,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cs := newServer(testCase.status)
+
+			assert.ErrorIs(t, testCase.answer(cs, testCase.offerID), testCase.expectedErr)
+		})
+	}
+}
+
+func TestFileOffers_AcceptedSenders(t *testing.T) {
+	cs := &ClientServer{incomingOffers: make(map[string]*incomingOffer)}
+	cs.incomingOffers["offer"] = &incomingOffer{
+		offer: types.FileOffer{
+			ID:                "offer",
+			WorkspaceMnemonic: "workspace",
+			FileChecksum:      "checksum",
+			Status:            types.OFFER_STATUS_PENDING,
+		},
+		senderID: peer.ID("sender"),
+		file:     &proto.File{FileChecksum: "checksum"},
+	}
+
+	// Pending offers are not a source of the file
+	file, senders := cs.getOfferedFile("workspace", "checksum")
+	assert.Nil(t, file)
+	assert.Len(t, senders, 0)
+
+	_, acceptErr := cs.AcceptFileOffer("offer")
+	assert.NoError(t, acceptErr)
+	assert.NoError(t, cs.SetFileOfferJob("offer", "job"))
+
+	file, senders = cs.getOfferedFile("workspace", "checksum")
+	assert.Equal(t, "checksum", file.FileChecksum)
+	assert.Equal(t, []peer.ID{peer.ID("sender")}, senders)
+
+	// Offers in other workspaces don't count
+	_, senders = cs.getOfferedFile("other workspace", "checksum")
+	assert.Len(t, senders, 0)
+}
+
+func TestFileOffers_ConcurrentAccept(t *testing.T) {
+	cs := &ClientServer{incomingOffers: make(map[string]*incomingOffer)}
+	cs.incomingOffers["offer"] = &incomingOffer{
+		offer: types.FileOffer{
+			ID:     "offer",
+			Status: types.OFFER_STATUS_PENDING,
+		},
+	}
+
+	const numAccepts = 10
+
+	var (
+		wg       sync.WaitGroup
+		accepted int32
+	)
+
+	for i := 0; i < numAccepts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, acceptErr := cs.AcceptFileOffer("offer"); acceptErr == nil {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Only one caller gets to queue the download
+	assert.Equal(t, int32(1), accepted)
+
+	// An offer whose download couldn't be queued can be accepted again
+	cs.ReleaseFileOffer("offer")
+
+	_, acceptErr := cs.AcceptFileOffer("offer")
+	assert.NoError(t, acceptErr)
+	assert.NoError(t, cs.SetFileOfferJob("offer", "job"))
+
+	// Offers with a queued download stay accepted
+	cs.ReleaseFileOffer("offer")
+
+	offer, _ := cs.GetFileOffer("offer")
+	assert.Equal(t, types.OFFER_STATUS_ACCEPTED, offer.Status)
+}
+
+func TestFileOffers_PruneAccepted(t *testing.T) {
+	cs := &ClientServer{incomingOffers: make(map[string]*incomingOffer)}
+	now := time.Now()
+
+	for i := 0; i < maxAcceptedOffers+5; i++ {
+		offerID := fmt.Sprintf("accepted-%d", i)
+		cs.incomingOffers[offerID] = &incomingOffer{
+			offer: types.FileOffer{
+				ID:     offerID,
+				Status: types.OFFER_STATUS_ACCEPTED,
+			},
+			acceptedAt: now.Add(time.Duration(i) * time.Second),
+		}
+	}
+
+	cs.incomingOffers["expired"] = &incomingOffer{
+		offer: types.FileOffer{
+			ID:     "expired",
+			Status: types.OFFER_STATUS_ACCEPTED,
+		},
+		acceptedAt: now.Add(-acceptedOfferRetention - time.Minute),
+	}
+
+	cs.incomingOffers["pending"] = &incomingOffer{
+		offer: types.FileOffer{
+			ID:     "pending",
+			Status: types.OFFER_STATUS_PENDING,
+		},
+	}
+
+	cs.pruneAcceptedOffersLocked(now)
+
+	assert.Len(t, cs.incomingOffers, maxAcceptedOffers+1)
+	assert.NotContains(t, cs.incomingOffers, "expired")
+	assert.NotContains(t, cs.incomingOffers, "accepted-0")
+	assert.Contains(t, cs.incomingOffers, fmt.Sprintf("accepted-%d", maxAcceptedOffers+4))
+	assert.Contains(t, cs.incomingOffers, "pending")
+}
+
+func TestFileOffers_SenderIdentity(t *testing.T) {
+	senderID := peer.ID("sender")
+
+	cs := &ClientServer{
+		logger:         hclog.NewNullLogger(),
+		incomingOffers: make(map[string]*incomingOffer),
+		verifiedPeers:  map[string][]peer.ID{"workspace": {senderID}},
+		peerIdentities: make(map[peer.ID]string),
+	}
+
+	// The sender claims to be a trusted contact, but didn't verify with that key
+	ack, offerErr := cs.OfferFile(
+		&WrappedContext{Context: context.Background(), PeerID: senderID},
+		&proto.FileOffer{
+			Mnemonic:          "workspace",
+			File:              &proto.File{Name: "report", Extension: ".pdf", FileChecksum: testOfferChecksum},
+			SenderName:        "Trusted contact",
+			SenderPublicKeyId: "trusted-key",
+		},
+	)
+	assert.NoError(t, offerErr)
+
+	offer, _ := cs.GetFileOffer(ack.OfferId)
+	assert.Equal(t, "", offer.SenderPublicKeyID)
+	assert.Equal(t, "", offer.SenderContactID)
+	assert.Equal(t, senderID.Pretty(), offer.SenderPeerID)
+}
+
+func TestFileOffers_InvalidChecksum(t *testing.T) {
+	senderID := peer.ID("sender")
+
+	testTable := []struct {
+		name        string
+		checksum    string
+		expectedErr bool
+	}{
+		{
+			"Valid checksum",
+			testOfferChecksum,
+			false,
+		},
+		{
+			"Missing checksum",
+			"",
+			true,
+		},
+		{
+			"Checksum that escapes the temp directory",
+			"../../" + testOfferChecksum,
+			true,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cs := &ClientServer{
+				logger:         hclog.NewNullLogger(),
+				incomingOffers: make(map[string]*incomingOffer),
+				verifiedPeers:  map[string][]peer.ID{"workspace": {senderID}},
+				peerIdentities: make(map[peer.ID]string),
+			}
+
+			_, offerErr := cs.OfferFile(
+				&WrappedContext{Context: context.Background(), PeerID: senderID},
+				&proto.FileOffer{
+					Mnemonic: "workspace",
+					File:     &proto.File{Name: "report", Extension: ".pdf", FileChecksum: testCase.checksum},
+				},
+			)
+			assert.Equal(t, testCase.expectedErr, offerErr != nil)
+			assert.Equal(t, !testCase.expectedErr, len(cs.GetFileOffers()) == 1)
+		})
+	}
+}
@@ -56,6 +56,21 @@ func interceptor(
 	return h, err
 }
 
+// streamPeerID returns the id of the peer that opened the stream with the given context
+func streamPeerID(ctx context.Context) (peer.ID, bool) {
+	streamPeer, ok := grpcPeer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	addr, ok := streamPeer.Addr.(*libp2pInfoWrapper)
+	if !ok {
+		return "", false
+	}
+
+	return addr.peerID, true
+}
+
 func (g *GRPCProtocol) Client(stream network.Stream) interface{} {
 	return WrapStreamInClient(stream)
 }
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+// getIgnoreSettings returns the saved ignore settings of the workspace, or the default ones
+func getIgnoreSettings(mnemonic string) (types.IgnoreSettings, error) {
+	settings, findErr := storage.GetStorageHandler().GetIgnoreSettings(mnemonic)
+	if findErr != nil || settings == nil {
+		return types.IgnoreSettings{
+			WorkspaceMnemonic: mnemonic,
+			Patterns:          make([]string, 0),
+			MinFileAge:        int64(config.MinFileAge),
+		}, findErr
+	}
+
+	return *settings, nil
+}
+
+// SetIgnoreSettings sets which files in the sharing directory of the workspace are not shared
+func (cs *ClientServer) SetIgnoreSettings(settings types.IgnoreSettings) error {
+	mux := &cs.fileListerMux
+	mux.RLock()
+	fileLister := cs.fileListerMap[settings.WorkspaceMnemonic]
+	mux.RUnlock()
+
+	if fileLister == nil {
+		return fmt.Errorf("unable to find file lister %s", settings.WorkspaceMnemonic)
+	}
+
+	fileLister.SetIgnoreSettings(settings.Patterns, time.Duration(settings.MinFileAge)*time.Second)
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/downloads"
+	"github.com/zivkovicmilos/peer_drop/networking/client"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/workspaces"
+)
+
+// failingDownloader fails every download with the given error
+type failingDownloader struct {
+	downloadErr error
+}
+
+func (fd *failingDownloader) HandleFileDownload(
+	_ context.Context,
+	_ string,
+	_ string,
+	_ client.ProgressFn,
+) (*client.DownloadedFileWrapper, error) {
+	return nil, fd.downloadErr
+}
+
+func (fd *failingDownloader) DiscardFileDownload(_ string, _ string) error {
+	return nil
+}
+
+func (fd *failingDownloader) SeedDownloadedFile(
+	_ string,
+	_ string,
+	_ *client.DownloadedFileWrapper,
+	_ bool,
+) (bool, error) {
+	return false, nil
+}
+
+// memoryJobStore keeps the download jobs in memory
+type memoryJobStore struct {
+	jobs    map[string]types.DownloadJob
+	jobsMux sync.Mutex
+}
+
+func (ms *memoryJobStore) SaveDownloadJob(job types.DownloadJob) error {
+	ms.jobsMux.Lock()
+	defer ms.jobsMux.Unlock()
+
+	ms.jobs[job.ID] = job
+
+	return nil
+}
+
+func (ms *memoryJobStore) GetDownloadJobs() ([]*types.DownloadJob, error) {
+	return []*types.DownloadJob{}, nil
+}
+
+func (ms *memoryJobStore) DeleteDownloadJob(id string) error {
+	ms.jobsMux.Lock()
+	defer ms.jobsMux.Unlock()
+
+	delete(ms.jobs, id)
+
+	return nil
+}
+
+func TestIntegrityError_ForgedProof(t *testing.T) {
+	checksum, downloadErr := client.DownloadFromForgingPeer(t)
+	assert.ErrorIs(t, downloadErr, client.ErrIntegrity)
+
+	// The REST download reports the forged proof as an integrity failure
+	recorder := httptest.NewRecorder()
+	workspaces.WriteDownloadError(recorder, downloadErr)
+	assert.Equal(t, http.StatusBadGateway, recorder.Code)
+
+	// So does the download job
+	manager := downloads.NewDownloadManager(
+		hclog.NewNullLogger(),
+		&failingDownloader{downloadErr: downloadErr},
+		&memoryJobStore{jobs: make(map[string]types.DownloadJob)},
+		1,
+	)
+
+	closeChannel := make(chan struct{})
+	doneChannel := make(chan struct{})
+
+	go func() {
+		manager.Start(closeChannel)
+		close(doneChannel)
+	}()
+
+	defer func() {
+		close(closeChannel)
+		<-doneChannel
+	}()
+
+	job, addErr := manager.AddJob("mnemonic", checksum, 0, false)
+	assert.NoError(t, addErr)
+
+	assert.Eventually(t, func() bool {
+		failedJob, jobErr := manager.GetJob(job.ID)
+
+		return jobErr == nil && failedJob.Attempts == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	failedJob, _ := manager.GetJob(job.ID)
+	assert.Equal(t, types.DOWNLOAD_ERROR_INTEGRITY, failedJob.ErrorType)
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+var errNoPeers = errors.New("no peers to download from")
+
+// peerFailure is the error a single peer failed the download with
+type peerFailure struct {
+	peerID peer.ID
+	err    error
+}
+
+// peersError is returned when the download failed with every peer it was tried with.
+// It matches any error one of the peers failed with, so an integrity failure
+// of a single peer is still reported as such
+type peersError struct {
+	failures []peerFailure
+}
+
+func (pe *peersError) Error() string {
+	messages := make([]string, len(pe.failures))
+	for i, failure := range pe.failures {
+		messages[i] = fmt.Sprintf("peer %s: %v", failure.peerID, failure.err)
+	}
+
+	return fmt.Sprintf("unable to download from any of %d peers, %s", len(pe.failures), strings.Join(messages, "; "))
+}
+
+func (pe *peersError) Is(target error) bool {
+	for _, failure := range pe.failures {
+		if errors.Is(failure.err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tryPeers runs the download with the peers one by one, until one of them delivers the file.
+// A stopped download returns the context error, otherwise the failures of all peers are returned together
+func (cs *ClientServer) tryPeers(
+	ctx context.Context,
+	peers []peer.ID,
+	downloadFn func(peerID peer.ID) error,
+) error {
+	if len(peers) == 0 {
+		return errNoPeers
+	}
+
+	failures := make([]peerFailure, 0, len(peers))
+	for _, peerID := range peers {
+		downloadErr := downloadFn(peerID)
+		if downloadErr == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		cs.logger.Error(fmt.Sprintf("Unable to download from peer %s, %v", peerID, downloadErr))
+
+		failures = append(failures, peerFailure{peerID: peerID, err: downloadErr})
+	}
+
+	return &peersError{failures: failures}
+}
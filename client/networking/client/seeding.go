@@ -0,0 +1,102 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+// ErrSeedingUnavailable is returned when downloaded files can't be shared back with the workspace
+var ErrSeedingUnavailable = errors.New("seeding is only available in send-receive workspaces")
+
+// SeedDownloadedFile shares the downloaded file back with the workspace, if seeding was requested
+// for the download or is enabled for the whole workspace. The file is linked into the sharing
+// directory, and advertised by the file lister from its next sweep on
+func (cs *ClientServer) SeedDownloadedFile(
+	mnemonic string,
+	fileChecksum string,
+	downloadInfo *DownloadedFileWrapper,
+	requested bool,
+) (bool, error) {
+	if !requested {
+		settings, settingsErr := storage.GetStorageHandler().GetSeedSettings(mnemonic)
+		if settingsErr != nil {
+			return false, fmt.Errorf("unable to fetch seed settings, %v", settingsErr)
+		}
+
+		if settings == nil || !settings.Enabled {
+			return false, nil
+		}
+	}
+
+	workspaceInfo, findErr := storage.GetStorageHandler().GetWorkspaceInfo(mnemonic)
+	if findErr != nil {
+		return false, findErr
+	}
+
+	if workspaceInfo == nil {
+		return false, errors.New("unknown workspace requested")
+	}
+
+	// Only nodes that publish their file list can act as a source
+	if workspaceInfo.WorkspaceType != config.WORKSPACE_TYPE_SEND_RECEIVE {
+		return false, ErrSeedingUnavailable
+	}
+
+	// Previous versions and conflicting files are saved under names of their own,
+	// sharing them would introduce a new file into the workspace
+	if cs.isConflictingFile(mnemonic, fileChecksum) || cs.isRetainedFile(mnemonic, fileChecksum) {
+		return false, nil
+	}
+
+	shareDir, dirErr := cs.GetWorkspaceSaveDir(mnemonic)
+	if dirErr != nil {
+		return false, dirErr
+	}
+
+	seedPath := filepath.Join(shareDir, filepath.FromSlash(downloadInfo.Path), downloadInfo.FileName)
+	if createErr := os.MkdirAll(filepath.Dir(seedPath), os.ModePerm); createErr != nil {
+		return false, createErr
+	}
+
+	// Linking never overwrites a file the node already shares under the same name
+	if linkErr := os.Link(downloadInfo.FilePath, seedPath); linkErr != nil {
+		if os.IsExist(linkErr) {
+			return isSameFile(downloadInfo.FilePath, seedPath), nil
+		}
+
+		return false, linkErr
+	}
+
+	cs.logger.Info(fmt.Sprintf("Seeding downloaded file %s", seedPath))
+
+	return true, nil
+}
+
+// isRetainedFile checks if the file is a previous version of a file in the workspace
+func (cs *ClientServer) isRetainedFile(mnemonic string, fileChecksum string) bool {
+	mux := &cs.fileAggregatorMux
+	mux.RLock()
+	fileAggregator := cs.fileAggregatorMap[mnemonic]
+	mux.RUnlock()
+
+	if fileAggregator == nil {
+		return false
+	}
+
+	file := fileAggregator.GetFile(fileChecksum)
+
+	return file != nil && file.Retained
+}
+
+// isSameFile checks if both paths point to the same file on disk
+func isSameFile(firstPath string, secondPath string) bool {
+	firstInfo, firstErr := os.Stat(firstPath)
+	secondInfo, secondErr := os.Stat(secondPath)
+
+	return firstErr == nil && secondErr == nil && os.SameFile(firstInfo, secondInfo)
+}
@@ -3,10 +3,6 @@ package client
 import (
 	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,7 +14,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/golang/protobuf/jsonpb"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-hclog"
 	"github.com/libp2p/go-libp2p"
@@ -33,13 +28,17 @@ import (
 	"github.com/multiformats/go-multiaddr"
 	"github.com/zivkovicmilos/peer_drop/config"
 	localCrypto "github.com/zivkovicmilos/peer_drop/crypto"
+	"github.com/zivkovicmilos/peer_drop/events"
 	"github.com/zivkovicmilos/peer_drop/files"
 	"github.com/zivkovicmilos/peer_drop/proto"
 	"github.com/zivkovicmilos/peer_drop/rest/types"
 	"github.com/zivkovicmilos/peer_drop/rest/utils"
+	"github.com/zivkovicmilos/peer_drop/sessions"
 	"github.com/zivkovicmilos/peer_drop/storage"
+	"github.com/zivkovicmilos/peer_drop/throttle"
 	globalUtils "github.com/zivkovicmilos/peer_drop/utils"
 	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
 )
 
 type ClientServer struct {
@@ -61,21 +60,37 @@ type ClientServer struct {
 	pubsubSubscriptionsStop map[string]chan struct{}        // Stop channel map
 	pubsubTopicsStop        map[string]chan struct{}        // Stop channel map
 	findPeersStop           map[string]chan struct{}        // Stop channel map
-	downloadRequestMap      map[string]fileMetadataWrapper  // Download request map
+	sessionManager          *sessions.SessionManager        // Challenge and download sessions opened by remote peers
 
 	// File handling //
-	fileListerMap     map[string]*files.FileLister     // In memory map of file lister services (mnemonic -> fileLister)
-	fileAggregatorMap map[string]*files.FileAggregator // In memory map of file aggregator services (mnemonic -> fileAggregator)
+	fileListerMap     map[string]*files.FileLister      // In memory map of file lister services (mnemonic -> fileLister)
+	throttler         *throttle.Throttler               // Bandwidth limits for file sharing
+	fileAggregatorMap map[string]*files.FileAggregator  // In memory map of file aggregator services (mnemonic -> fileAggregator)
+	incomingOffers    map[string]*incomingOffer         // Files pushed by other peers (offer id -> offer)
+	badPeers          map[badPeerKey]time.Time          // Peers that served corrupted files, and when it was recorded
+	peerIdentities    map[peer.ID]string                // Identities the peers passed verification with (peer ID -> public key ID)
+	blobStore         *files.BlobStore                  // Content shared by all workspaces, stored once
+	announcers        map[string]*announcementPublisher // File list announcement state of the workspaces (mnemonic -> publisher)
+
+	// fileSharingClientFn opens file sharing streams in place of the host, if set
+	fileSharingClientFn func(ctx context.Context, peerID peer.ID) (proto.FileSharingClient, func(), error)
+
+	// Events //
+	eventBus *events.EventBus // Bus the peer, file list and download events are published on
 
 	// Workspace handler //
 	newWorkspaceChannel chan *proto.WorkspaceInfo
 
 	// Locks //
-	rendezvousMux            sync.RWMutex
-	verifiedPeersMuxMap      map[string]sync.RWMutex // mnemonic -> rwmutex
-	fileListerMuxMap         map[string]sync.RWMutex // mnemonic -> rwmutex
-	fileAggregatorMuxMap     map[string]sync.RWMutex // mnemonic -> rwmutex
-	workspaceDirectoryMuxMap map[string]sync.RWMutex // mnemonic -> rwmutex
+	rendezvousMux         sync.RWMutex
+	verifiedPeersMux      sync.RWMutex
+	fileListerMux         sync.RWMutex
+	fileAggregatorMux     sync.RWMutex
+	workspaceDirectoryMux sync.RWMutex
+	offersMux             sync.RWMutex
+	badPeersMux           sync.Mutex
+	peerIdentitiesMux     sync.RWMutex
+	announcersMux         sync.Mutex
 
 	// Context //
 	ctx        context.Context
@@ -84,9 +99,6 @@ type ClientServer struct {
 	// GRPC //
 	proto.UnimplementedVerificationServiceServer
 	proto.UnimplementedFileSharingServer
-
-	// challenge id -> join request
-	joinRequests map[string]*joinRequest // holds pending join requests TODO add garbage collector for stale requests
 }
 
 // NewClientServer returns a new client networking instance
@@ -95,22 +107,26 @@ func NewClientServer(
 	nodeConfig *config.NodeConfig,
 ) *ClientServer {
 	return &ClientServer{
-		logger:                   logger.Named("networking"),
-		nodeConfig:               nodeConfig,
-		rendezvousIDs:            make([]peer.ID, 0),
-		verifiedPeers:            make(map[string][]peer.ID),
-		joinRequests:             make(map[string]*joinRequest),
-		newWorkspaceChannel:      make(chan *proto.WorkspaceInfo),
-		workspaceDirectoryMap:    make(map[string]string),
-		pubsubTopics:             make(map[string]*pubsub.Topic),
-		pubsubSubscriptions:      make(map[string]*pubsub.Subscription),
-		fileListerMap:            make(map[string]*files.FileLister),
-		fileAggregatorMap:        make(map[string]*files.FileAggregator),
-		fileListerMuxMap:         make(map[string]sync.RWMutex),
-		verifiedPeersMuxMap:      make(map[string]sync.RWMutex),
-		fileAggregatorMuxMap:     make(map[string]sync.RWMutex),
-		workspaceDirectoryMuxMap: make(map[string]sync.RWMutex),
-		downloadRequestMap:       make(map[string]fileMetadataWrapper),
+		logger:                logger.Named("networking"),
+		nodeConfig:            nodeConfig,
+		rendezvousIDs:         make([]peer.ID, 0),
+		verifiedPeers:         make(map[string][]peer.ID),
+		newWorkspaceChannel:   make(chan *proto.WorkspaceInfo),
+		workspaceDirectoryMap: make(map[string]string),
+		pubsubTopics:          make(map[string]*pubsub.Topic),
+		pubsubSubscriptions:   make(map[string]*pubsub.Subscription),
+		fileListerMap:         make(map[string]*files.FileLister),
+		fileAggregatorMap:     make(map[string]*files.FileAggregator),
+		sessionManager:        sessions.NewSessionManager(logger, sessionLimits),
+		incomingOffers:        make(map[string]*incomingOffer),
+		badPeers:              make(map[badPeerKey]time.Time),
+		peerIdentities:        make(map[peer.ID]string),
+		announcers:            make(map[string]*announcementPublisher),
+		eventBus:              events.NewEventBus(),
+		throttler: throttle.NewThrottler(throttle.Limits{
+			UploadRate:   nodeConfig.UploadRateLimit,
+			DownloadRate: nodeConfig.DownloadRateLimit,
+		}),
 
 		pubsubSubscriptionsStop: make(map[string]chan struct{}),
 		pubsubTopicsStop:        make(map[string]chan struct{}),
@@ -155,6 +171,9 @@ func (cs *ClientServer) Start(closeChannel chan struct{}) {
 		os.Exit(1)
 	}
 
+	// Restore the bandwidth limits set before the restart
+	cs.loadBandwidthLimits()
+
 	// Base libp2p setup
 	libp2pKey, keyError := localCrypto.ReadLibp2pKey(
 		filepath.Join(cs.nodeConfig.BaseDir, config.DirectoryLibp2p),
@@ -195,6 +214,9 @@ func (cs *ClientServer) Start(closeChannel chan struct{}) {
 	cs.host = clientHost
 	cs.me = clientHost.ID()
 
+	// Keep the verified peers in sync with the open connections
+	cs.watchPeerDisconnects()
+
 	// Set up the local DHT
 	options := []dht.Option{dht.Mode(dht.ModeServer)}
 
@@ -223,6 +245,15 @@ func (cs *ClientServer) Start(closeChannel chan struct{}) {
 	// Set GRPC protocol handlers
 	cs.setupProtocols()
 
+	// Start the cleanup loop of stale sessions
+	go cs.sessionManager.Start()
+
+	// Open the blob store before any workspace starts sharing files
+	cs.setupBlobStore()
+	if cs.blobStore != nil {
+		go cs.blobStore.Start()
+	}
+
 	// Start the workspace handler loop
 	go cs.workspaceJoinHandler()
 
@@ -243,6 +274,13 @@ func (cs *ClientServer) Stop() {
 	// Cancel the context
 	cs.cancelFunc()
 
+	// Cancel the pending sessions and transfers
+	cs.sessionManager.Stop()
+
+	if cs.blobStore != nil {
+		cs.blobStore.Stop()
+	}
+
 	// Close the libp2p host
 	_ = cs.host.Close()
 
@@ -347,7 +385,11 @@ func (cs *ClientServer) startPeerDropService() error {
 func (cs *ClientServer) initializeWorkspace(workspaceInfo *proto.WorkspaceInfo) error {
 	mnemonic := workspaceInfo.Mnemonic
 	// Create the folder structure if it doesn't exist
-	if directoryErr := cs.initializeWorkspaceDirectory(workspaceInfo.Name, workspaceInfo.Mnemonic); directoryErr != nil {
+	if directoryErr := cs.initializeWorkspaceDirectory(
+		workspaceInfo.Name,
+		workspaceInfo.Mnemonic,
+		workspaceInfo.HashAlgorithm,
+	); directoryErr != nil {
 		cs.logger.Error(
 			fmt.Sprintf("Unable to initialize directory for %s, %v", workspaceInfo.Name, directoryErr),
 		)
@@ -384,8 +426,10 @@ func (cs *ClientServer) initializeWorkspace(workspaceInfo *proto.WorkspaceInfo)
 	switch workspaceInfo.WorkspaceType {
 	case config.WORKSPACE_TYPE_SEND_ONLY:
 		if amOwner {
-			// If we are the owner of this workspace, we only send messages
+			// If we are the owner of this workspace, we only send messages,
+			// and answer the resync requests of the peers
 			go cs.startTopicPublisher(mnemonic)
+			go cs.startResyncListener(mnemonic)
 		} else {
 			// If we are not the owner of this workspace, we only receive messages
 			go cs.startSubscriptionListener(mnemonic)
@@ -395,8 +439,10 @@ func (cs *ClientServer) initializeWorkspace(workspaceInfo *proto.WorkspaceInfo)
 			// If we are the owner of this workspace, we only receive messages
 			go cs.startSubscriptionListener(mnemonic)
 		} else {
-			// If we are not the owner of this workspace, we only send messages
+			// If we are not the owner of this workspace, we only send messages,
+			// and answer the resync requests of the peers
 			go cs.startTopicPublisher(mnemonic)
+			go cs.startResyncListener(mnemonic)
 		}
 	default:
 		// Send & Receive
@@ -406,17 +452,21 @@ func (cs *ClientServer) initializeWorkspace(workspaceInfo *proto.WorkspaceInfo)
 
 	cs.logger.Info(fmt.Sprintf("Workspace with mnemonic [%s] initialized", mnemonic))
 
+	cs.publishEvent(types.EVENT_WORKSPACE_INITIALIZED, mnemonic, nil)
+
 	return nil
 }
 
 // initializeWorkspaceDirectory creates the workspace directory in the folder structure
-func (cs *ClientServer) initializeWorkspaceDirectory(name string, mnemonic string) error {
+func (cs *ClientServer) initializeWorkspaceDirectory(name string, mnemonic string, hashAlgorithm string) error {
 	// Lowercase the directory name
 	dirName := strings.ToLower(name)
 	dirName = strings.Replace(dirName, " ", "-", -1)
 
 	pathCommon := fmt.Sprintf("%s/%s/%s", cs.nodeConfig.BaseDir, config.DirectoryFiles, dirName)
+	cs.workspaceDirectoryMux.Lock()
 	cs.workspaceDirectoryMap[mnemonic] = pathCommon
+	cs.workspaceDirectoryMux.Unlock()
 
 	// baseDir/files/workspace-mnemonic/temp
 	// Directory is used for temporary download data
@@ -432,12 +482,58 @@ func (cs *ClientServer) initializeWorkspaceDirectory(name string, mnemonic strin
 		return createErr
 	}
 
-	// Start the file lister service for this directory
+	// baseDir/files/workspace-mnemonic/mirror
+	// Directory is used for files mirrored from other peers
+	mirrorDirectory := fmt.Sprintf("%s/%s", pathCommon, config.DirectoryMirror)
+	if createErr := globalUtils.CreateDirectory(mirrorDirectory); createErr != nil {
+		return createErr
+	}
+
+	// baseDir/files/workspace-mnemonic/versions
+	// Directory is used for the retained previous versions of the shared files
+	versionsDirectory := fmt.Sprintf("%s/%s", pathCommon, config.DirectoryVersions)
+	if createErr := globalUtils.CreateDirectory(versionsDirectory); createErr != nil {
+		return createErr
+	}
+
+	// Start the file lister service for this directory.
+	// Changes are picked up as they happen, the directory is only swept
+	// this often if the file system doesn't report them
 	fileLister := files.NewFileLister(
 		cs.logger,
 		shareDirectory,
 		time.Second*5,
 	)
+
+	// The retention policy needs to be in place before the first sweep,
+	// otherwise the versions kept so far are dropped
+	if versionsErr := fileLister.SetVersionsDir(versionsDirectory); versionsErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to load file versions, %v", versionsErr))
+	}
+
+	versionSettings, settingsErr := storage.GetStorageHandler().GetVersionSettings(mnemonic)
+	if settingsErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to load version settings, %v", settingsErr))
+	}
+
+	if versionSettings != nil {
+		fileLister.SetRetentionPolicy(toRetentionPolicy(*versionSettings))
+	}
+
+	if cs.blobStore != nil {
+		fileLister.SetBlobStore(cs.blobStore)
+	}
+
+	fileLister.SetHashAlgorithm(hashAlgorithm)
+	fileLister.SetChecksumCache(storage.GetStorageHandler())
+
+	ignoreSettings, ignoreErr := getIgnoreSettings(mnemonic)
+	if ignoreErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to load ignore settings, %v", ignoreErr))
+	}
+
+	fileLister.SetIgnoreSettings(ignoreSettings.Patterns, time.Duration(ignoreSettings.MinFileAge)*time.Second)
+
 	fileLister.Start()
 
 	cs.registerFileLister(mnemonic, fileLister)
@@ -447,7 +543,7 @@ func (cs *ClientServer) initializeWorkspaceDirectory(name string, mnemonic strin
 
 // registerFileLister registers a new file lister
 func (cs *ClientServer) registerFileLister(mnemonic string, fileLister *files.FileLister) {
-	mux, _ := cs.fileListerMuxMap[mnemonic]
+	mux := &cs.fileListerMux
 	mux.Lock()
 	defer mux.Unlock()
 
@@ -458,7 +554,7 @@ func (cs *ClientServer) registerFileLister(mnemonic string, fileLister *files.Fi
 
 // unregisterFileLister unregisters a file lister
 func (cs *ClientServer) unregisterFileLister(mnemonic string) {
-	mux, _ := cs.fileListerMuxMap[mnemonic]
+	mux := &cs.fileListerMux
 	mux.Lock()
 	defer mux.Unlock()
 
@@ -493,7 +589,7 @@ func (cs *ClientServer) findPeersWrapper(workspaceInfo *proto.WorkspaceInfo) err
 
 // unregisterFileAggregator removes / stops a file aggregator service
 func (cs *ClientServer) unregisterFileAggregator(mnemonic string) {
-	mux, _ := cs.fileAggregatorMuxMap[mnemonic]
+	mux := &cs.fileAggregatorMux
 	mux.Lock()
 	fileAggregator := cs.fileAggregatorMap[mnemonic]
 
@@ -514,14 +610,34 @@ func (cs *ClientServer) startSubscriptionListener(mnemonic string) {
 	// Create the file aggregator instance
 	updateChannel := make(chan files.FileListWrapper)
 	fileAggregator := files.NewFileAggregator(cs.logger, mnemonic, updateChannel)
+	fileAggregator.SetChangeHandler(func(numFiles int) {
+		cs.publishEvent(types.EVENT_FILE_LIST_CHANGED, mnemonic, types.FileListEventData{NumFiles: numFiles})
+	})
 
-	mux, _ := cs.fileAggregatorMuxMap[mnemonic]
+	mux := &cs.fileAggregatorMux
 	mux.Lock()
 	cs.fileAggregatorMap[mnemonic] = fileAggregator
 	mux.Unlock()
 
 	fileAggregator.Start()
 
+	// Peer file lists are put together from their announcements
+	receiver := newAnnouncementReceiver()
+	forwardFileList := func(peerID peer.ID) {
+		mux.RLock()
+		fileAggregator, ok := cs.fileAggregatorMap[mnemonic]
+		mux.RUnlock()
+
+		// The aggregator can be stopped at any point after the lookup,
+		// in which case the file list is dropped instead of blocking the listener
+		if ok {
+			fileAggregator.Update(files.FileListWrapper{
+				FileList: &proto.FileList{FileList: receiver.fileList(peerID)},
+				PeerID:   peerID,
+			})
+		}
+	}
+
 	for {
 		select {
 		case _ = <-stopChannel:
@@ -530,89 +646,261 @@ func (cs *ClientServer) startSubscriptionListener(mnemonic string) {
 			return
 		default:
 		}
-		fileListMessage, err := subscription.Next(subContext)
+
+		// Peers that went silent lose their files, even if nothing else is received
+		for _, peerID := range receiver.expirePeers(time.Now()) {
+			cs.logger.Info(fmt.Sprintf("Peer %s stopped announcing files for mnemonic [%s]", peerID, mnemonic))
+			forwardFileList(peerID)
+		}
+
+		announcement, peerID, err := cs.nextAnnouncement(subContext, subscription)
 		if err != nil {
 			cs.logger.Error(fmt.Sprintf("Unable to parse message, %v", err))
 			return
 		}
-		cs.logger.Info(fmt.Sprintf("Received a new file list message for mnemonic [%s]", mnemonic))
 
-		// Forward messages that are not from us
-		if fileListMessage.ReceivedFrom == cs.me {
-			cs.logger.Info("Pubsub message skipped")
+		if announcement == nil {
 			continue
 		}
 
-		peerFileList := new(proto.FileList)
-		err = jsonpb.Unmarshal(bytes.NewReader(fileListMessage.Data), peerFileList)
-		if err != nil {
-			cs.logger.Error(fmt.Sprintf("Unmarshal error %v", err))
+		if announcement.Type == proto.FileListAnnouncement_RESYNC_REQUEST {
+			cs.handleResyncRequest(mnemonic, announcement)
 			continue
 		}
 
-		cs.logger.Info(fmt.Sprintf("Files in message: [%d]", len(peerFileList.FileList)))
+		changed, resync := receiver.handle(peerID, announcement, time.Now())
+		if resync {
+			cs.requestResync(mnemonic, peerID)
+		}
 
-		_, ok := cs.fileAggregatorMap[mnemonic]
-		if ok {
-			updateChannel <- files.FileListWrapper{
-				FileList: peerFileList,
-				PeerID:   fileListMessage.ReceivedFrom,
-			}
+		if changed {
+			cs.logger.Debug(fmt.Sprintf("File list of peer %s updated for mnemonic [%s]", peerID, mnemonic))
+			forwardFileList(peerID)
+		}
+	}
+}
+
+// startResyncListener listens for resync requests on the workspace topic, for nodes that publish
+// their file list without listening to the file lists of others
+func (cs *ClientServer) startResyncListener(mnemonic string) {
+	subscription := cs.pubsubSubscriptions[mnemonic]
+	subContext := context.Background()
+
+	// Create the stop channel
+	stopChannel := make(chan struct{})
+	cs.pubsubSubscriptionsStop[mnemonic] = stopChannel
+
+	for {
+		select {
+		case _ = <-stopChannel:
+			cs.logger.Info(fmt.Sprintf("Stopping resync listener for mnemonic [%s]", mnemonic))
+			subscription.Cancel()
+			return
+		default:
+		}
+
+		announcement, _, err := cs.nextAnnouncement(subContext, subscription)
+		if err != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to parse message, %v", err))
+			return
+		}
+
+		if announcement != nil && announcement.Type == proto.FileListAnnouncement_RESYNC_REQUEST {
+			cs.handleResyncRequest(mnemonic, announcement)
+		}
+	}
+}
+
+// nextAnnouncement waits for the next announcement of another peer on the topic.
+// Returns no announcement if nothing was received for a heartbeat interval,
+// or if the message couldn't be decoded
+func (cs *ClientServer) nextAnnouncement(
+	ctx context.Context,
+	subscription *pubsub.Subscription,
+) (*proto.FileListAnnouncement, peer.ID, error) {
+	nextCtx, cancelFn := context.WithTimeout(ctx, heartbeatInterval)
+	defer cancelFn()
+
+	message, err := subscription.Next(nextCtx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, "", nil
 		}
+
+		return nil, "", err
+	}
+
+	// Skip messages that are from us
+	peerID := message.GetFrom()
+	if peerID == cs.me {
+		return nil, "", nil
+	}
+
+	announcement, decodeErr := decodeAnnouncement(message.Data)
+	if decodeErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unmarshal error %v", decodeErr))
+
+		return nil, "", nil
+	}
+
+	return announcement, peerID, nil
+}
+
+// requestResync asks the peer for a snapshot of its file list
+func (cs *ClientServer) requestResync(mnemonic string, peerID peer.ID) {
+	cs.logger.Info(fmt.Sprintf("Requesting file list resync from peer %s for mnemonic [%s]", peerID, mnemonic))
+
+	cs.publishAnnouncement(mnemonic, &proto.FileListAnnouncement{
+		Type:       proto.FileListAnnouncement_RESYNC_REQUEST,
+		TargetPeer: peerID.Pretty(),
+	})
+}
+
+// handleResyncRequest publishes a snapshot of the local file list, if the resync request is meant for us
+func (cs *ClientServer) handleResyncRequest(mnemonic string, announcement *proto.FileListAnnouncement) {
+	if announcement.TargetPeer != cs.me.Pretty() {
+		return
+	}
+
+	cs.announcersMux.Lock()
+	publisher, ok := cs.announcers[mnemonic]
+	cs.announcersMux.Unlock()
+
+	if ok {
+		publisher.requestSnapshot()
+	}
+}
+
+// publishAnnouncement publishes the announcement to the workspace topic
+func (cs *ClientServer) publishAnnouncement(mnemonic string, announcement *proto.FileListAnnouncement) bool {
+	topic, ok := cs.pubsubTopics[mnemonic]
+	if !ok {
+		return false
+	}
+
+	data, marshalErr := protobuf.Marshal(announcement)
+	if marshalErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to marshal file list announcement, %v", marshalErr))
+
+		return false
+	}
+
+	if sendErr := topic.Publish(context.Background(), data); sendErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to publish file list announcement, %v", sendErr))
+
+		return false
 	}
+
+	return true
 }
 
-// startTopicPublisher starts up the file list sharing loop
+// startTopicPublisher starts up the file list announcement loop.
+// Peers get a snapshot of the file list when they join, and deltas when the files change
 func (cs *ClientServer) startTopicPublisher(mnemonic string) {
 	topic := cs.pubsubTopics[mnemonic]
-	topicContext := context.Background()
-	ticker := time.NewTicker(time.Second * 5)
+	changeTicker := time.NewTicker(announcementInterval)
+	heartbeatTicker := time.NewTicker(heartbeatInterval)
 
 	// Create the stop channel
 	stopChannel := make(chan struct{})
 	cs.pubsubTopicsStop[mnemonic] = stopChannel
 
-	mux, _ := cs.fileListerMuxMap[mnemonic]
+	mux := &cs.fileListerMux
 	mux.RLock()
 	fileLister := cs.fileListerMap[mnemonic]
 	fileLister.Start()
 	mux.RUnlock()
 
+	publisher := newAnnouncementPublisher()
+
+	cs.announcersMux.Lock()
+	cs.announcers[mnemonic] = publisher
+	cs.announcersMux.Unlock()
+
+	// Peers that join the topic get a snapshot
+	peerEvents, eventsErr := topic.EventHandler()
+	if eventsErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to watch topic peers, %v", eventsErr))
+	} else {
+		go cs.watchTopicPeers(peerEvents, publisher)
+	}
+
+	publishChanges := func() {
+		for _, delta := range publisher.deltas(fileLister.GetAvailableFiles()) {
+			if cs.publishAnnouncement(mnemonic, delta) {
+				cs.logger.Info(fmt.Sprintf(
+					"Workspace file list changes published [+%d -%d]",
+					len(delta.Added),
+					len(delta.Removed),
+				))
+			}
+		}
+	}
+
+	publishSnapshot := func() {
+		// The snapshot includes the latest changes
+		publishChanges()
+
+		for _, part := range publisher.snapshot() {
+			cs.publishAnnouncement(mnemonic, part)
+		}
+
+		cs.logger.Info(fmt.Sprintf("Workspace file list snapshot published [%d]", len(publisher.published)))
+	}
+
+	publisher.requestSnapshot()
+
 	for {
 		select {
 		case _ = <-stopChannel:
-			ticker.Stop()
+			changeTicker.Stop()
+			heartbeatTicker.Stop()
+
+			cs.announcersMux.Lock()
+			delete(cs.announcers, mnemonic)
+			cs.announcersMux.Unlock()
+
+			if peerEvents != nil {
+				peerEvents.Cancel()
+			}
+
 			_ = topic.Close()
 			cs.logger.Info(fmt.Sprintf("Stopping topic publisher for mnemonic [%s]", mnemonic))
 			return
+		case _ = <-publisher.requests:
+			if time.Since(publisher.lastSnapshot) < snapshotCooldown {
+				// The snapshot is published with the next change check
+				publisher.snapshotPending = true
 
-		// Every 5 seconds, share the file list
-		case _ = <-ticker.C:
-			// Compile file list
-			localFileList := fileLister.GetAvailableFiles()
-			if len(localFileList) > 0 {
+				continue
+			}
 
-				fileList := &proto.FileList{
-					FileList: localFileList,
-				}
+			publishSnapshot()
+		case _ = <-changeTicker.C:
+			if publisher.snapshotPending && time.Since(publisher.lastSnapshot) >= snapshotCooldown {
+				publishSnapshot()
 
-				// Share the file list to the topic
-				marshaler := jsonpb.Marshaler{}
-				buf := new(bytes.Buffer)
-				err := marshaler.Marshal(buf, fileList)
-				if err != nil {
-					cs.logger.Error(fmt.Sprintf("Unable to marshal file list, %v", err))
-					continue
-				}
+				continue
+			}
 
-				sendErr := topic.Publish(topicContext, buf.Bytes())
-				if sendErr != nil {
-					cs.logger.Error(fmt.Sprintf("Unable to publish local file list, %v", sendErr))
-					continue
-				}
+			publishChanges()
+		case _ = <-heartbeatTicker.C:
+			cs.publishAnnouncement(mnemonic, publisher.heartbeat())
+		}
+	}
+}
 
-				cs.logger.Info(fmt.Sprintf("Workspace file list successfully published [%d]", len(localFileList)))
-			}
+// watchTopicPeers requests a snapshot from the publisher whenever a peer joins the topic
+func (cs *ClientServer) watchTopicPeers(peerEvents *pubsub.TopicEventHandler, publisher *announcementPublisher) {
+	for {
+		peerEvent, err := peerEvents.NextPeerEvent(context.Background())
+		if err != nil {
+			// The event handler was cancelled
+			return
+		}
+
+		if peerEvent.Type == pubsub.PeerJoin {
+			publisher.requestSnapshot()
 		}
 	}
 }
@@ -654,6 +942,35 @@ func (cs *ClientServer) setupRendezvous() (storeErr error) {
 	return
 }
 
+// loadBandwidthLimits applies the stored bandwidth limits to the throttler.
+// Stored global limits take precedence over the configured ones
+func (cs *ClientServer) loadBandwidthLimits() {
+	storedLimits, getErr := storage.GetStorageHandler().GetBandwidthLimits()
+	if getErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to load bandwidth limits, %v", getErr))
+
+		return
+	}
+
+	for _, settings := range storedLimits {
+		limits := throttle.Limits{
+			UploadRate:   settings.UploadRate,
+			DownloadRate: settings.DownloadRate,
+		}
+
+		switch settings.Scope {
+		case types.BANDWIDTH_SCOPE_GLOBAL:
+			cs.throttler.SetGlobalLimits(limits)
+		case types.BANDWIDTH_SCOPE_DEFAULT_PEER:
+			cs.throttler.SetDefaultPeerLimits(limits)
+		case types.BANDWIDTH_SCOPE_WORKSPACE:
+			cs.throttler.SetWorkspaceLimits(settings.ID, limits)
+		case types.BANDWIDTH_SCOPE_PEER:
+			cs.throttler.SetPeerLimits(settings.ID, limits)
+		}
+	}
+}
+
 // dialRendezvous dials the set rendezvous nodes
 // to enable peer discovery
 func (cs *ClientServer) dialRendezvous() {
@@ -854,6 +1171,11 @@ func (cs *ClientServer) workspaceRequestToWorkspaceInfo(
 		}
 	}
 
+	workspaceInfo.HashAlgorithm = workspaceRequest.HashAlgorithm
+	if workspaceInfo.HashAlgorithm == "" {
+		workspaceInfo.HashAlgorithm = config.DefaultHashAlgorithm
+	}
+
 	switch workspaceRequest.WorkspaceType {
 	case "Send only":
 		workspaceInfo.WorkspaceType = "send-only"
@@ -889,7 +1211,7 @@ func (cs *ClientServer) findPeers(workspaceMnemonic string, workspaceCredentials
 	cs.logger.Info(fmt.Sprintf("We are %s", cs.me.String()))
 
 	// Instantiate verified peers list
-	mux, _ := cs.verifiedPeersMuxMap[workspaceMnemonic]
+	mux := &cs.verifiedPeersMux
 	mux.Lock()
 	verifiedPeers := make([]peer.ID, 0)
 	cs.verifiedPeers[workspaceMnemonic] = verifiedPeers
@@ -970,7 +1292,7 @@ type workspaceCredentials struct {
 
 // isVerifiedPeer checks if the peer is verified for that workspace
 func (cs *ClientServer) isVerifiedPeer(peerID peer.ID, mnemonic string) bool {
-	mux, _ := cs.verifiedPeersMuxMap[mnemonic]
+	mux := &cs.verifiedPeersMux
 	mux.RLock()
 	defer mux.RUnlock()
 
@@ -1140,6 +1462,7 @@ type joinRequest struct {
 	workspaceMnemonic string
 	unencryptedData   []byte
 	challenge         *proto.Challenge
+	publicKey         string // the requesters public key, empty for password challenges
 }
 
 // BeginVerification starts the verification process and returns the challenge
@@ -1255,12 +1578,28 @@ func (cs *ClientServer) BeginVerification(
 	}
 
 	// Save join request locally
-	cs.joinRequests[challenge.ChallengeId] = &joinRequest{
+	pendingJoinRequest := &joinRequest{
 		workspaceMnemonic: workspaceInfo.Mnemonic,
 		challenge:         challenge,
 		unencryptedData:   unencryptedData,
 	}
 
+	if workspaceInfo.SecurityType != "password" {
+		pendingJoinRequest.publicKey = *request.PublicKey
+	}
+
+	peerID := context.(*WrappedContext).PeerID
+	if addErr := cs.sessionManager.Add(
+		types.SESSION_TYPE_CHALLENGE,
+		challenge.ChallengeId,
+		peerID,
+		pendingJoinRequest,
+	); addErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to save join request of peer %s, %v", peerID.Pretty(), addErr))
+
+		return nil, fmt.Errorf("unable to save join request, %v", addErr)
+	}
+
 	return challenge, nil
 }
 
@@ -1269,20 +1608,18 @@ func (cs *ClientServer) FinishVerification(
 	context context.Context,
 	request *proto.ChallengeSolution,
 ) (*proto.VerificationResponse, error) {
-	// Check if we have the pending request
-	pendingJoinRequest, found := cs.joinRequests[request.ChallengeId]
-	defer func() {
-		// Remove the join request
-		delete(cs.joinRequests, request.ChallengeId)
-	}()
-
-	if !found {
+	// Check if we have the pending request.
+	// The join request is removed, so every challenge is solved only once
+	session, takeErr := cs.sessionManager.Take(types.SESSION_TYPE_CHALLENGE, request.ChallengeId)
+	if takeErr != nil {
 		defer cs.disconnectFromPeer(context.(*WrappedContext).PeerID)
 
 		return ConstructVerificationResponse("Unknown challenge", false),
 			errors.New("unknown challenge")
 	}
 
+	pendingJoinRequest := session.Value.(*joinRequest)
+
 	// Verify that the time signature is correct
 	timestamp := time.Unix(pendingJoinRequest.challenge.Timestamp, 0)
 
@@ -1300,6 +1637,10 @@ func (cs *ClientServer) FinishVerification(
 
 	// Add the peer to verified peers
 	typedContext := context.(*WrappedContext)
+	if pendingJoinRequest.publicKey != "" {
+		cs.recordPeerIdentity(typedContext.PeerID, pendingJoinRequest.publicKey)
+	}
+
 	cs.addVerifiedPeer(pendingJoinRequest.workspaceMnemonic, typedContext.PeerID)
 
 	return ConstructVerificationResponse("Verification success", true), nil
@@ -1307,9 +1648,8 @@ func (cs *ClientServer) FinishVerification(
 
 // addVerifiedPeer adds a verified peer. [Thread safe]
 func (cs *ClientServer) addVerifiedPeer(mnemonic string, newPeer peer.ID) {
-	mux, _ := cs.verifiedPeersMuxMap[mnemonic]
+	mux := &cs.verifiedPeersMux
 	mux.Lock()
-	defer mux.Unlock()
 
 	verifiedPeers, ok := cs.verifiedPeers[mnemonic]
 	if !ok {
@@ -1317,20 +1657,33 @@ func (cs *ClientServer) addVerifiedPeer(mnemonic string, newPeer peer.ID) {
 		verifiedPeers = make([]peer.ID, 0)
 	}
 
+	for _, verifiedPeer := range verifiedPeers {
+		if verifiedPeer == newPeer {
+			// Already verified
+			mux.Unlock()
+
+			return
+		}
+	}
+
 	verifiedPeers = append(verifiedPeers, newPeer)
 	cs.verifiedPeers[mnemonic] = verifiedPeers
+	mux.Unlock()
+
+	cs.publishEvent(types.EVENT_PEER_VERIFIED, mnemonic, types.PeerEventData{PeerID: newPeer.Pretty()})
 }
 
-// removeVerifiedPeer removes a peer from the verified array
-func (cs *ClientServer) removeVerifiedPeer(mnemonic string, oldPeer peer.ID) {
-	mux, _ := cs.verifiedPeersMuxMap[mnemonic]
+// removeVerifiedPeer removes a peer from the verified array,
+// and returns true if the peer was verified
+func (cs *ClientServer) removeVerifiedPeer(mnemonic string, oldPeer peer.ID) bool {
+	mux := &cs.verifiedPeersMux
 	mux.Lock()
 	defer mux.Unlock()
 
 	verifiedPeers, ok := cs.verifiedPeers[mnemonic]
 	if !ok {
 		// No peers yet
-		return
+		return false
 	}
 
 	indx := -1
@@ -1339,11 +1692,13 @@ func (cs *ClientServer) removeVerifiedPeer(mnemonic string, oldPeer peer.ID) {
 			indx = index
 		}
 	}
-	if indx >= 0 {
-		verifiedPeers = append(verifiedPeers[:indx], verifiedPeers[:indx+1]...)
+	if indx < 0 {
+		return false
 	}
 
-	cs.verifiedPeers[mnemonic] = verifiedPeers
+	cs.verifiedPeers[mnemonic] = append(verifiedPeers[:indx], verifiedPeers[indx+1:]...)
+
+	return true
 }
 
 // Workspace joining //
@@ -1389,7 +1744,7 @@ func (cs *ClientServer) TriggerWorkspaceInit(workspaceInfo *proto.WorkspaceInfo)
 
 // GetFileList is a helper function for querying the file aggregator
 func (cs *ClientServer) GetFileList(mnemonic string) []*proto.File {
-	mux, _ := cs.fileAggregatorMuxMap[mnemonic]
+	mux := &cs.fileAggregatorMux
 	mux.RLock()
 	defer mux.RUnlock()
 	fileAggregator, ok := cs.fileAggregatorMap[mnemonic]
@@ -1413,7 +1768,7 @@ func (cs *ClientServer) GetNumberOfPeers(mnemonic string) int {
 
 // GetWorkspaceSaveDir gets the directory where files should be saved for a specific workspace
 func (cs *ClientServer) GetWorkspaceSaveDir(mnemonic string) (string, error) {
-	mux, _ := cs.workspaceDirectoryMuxMap[mnemonic]
+	mux := &cs.workspaceDirectoryMux
 	mux.RLock()
 	defer mux.RUnlock()
 
@@ -1426,13 +1781,47 @@ func (cs *ClientServer) GetWorkspaceSaveDir(mnemonic string) (string, error) {
 	return fmt.Sprintf("%s/%s", directory, config.DirectoryShare), nil
 }
 
+// GetWorkspaceTempDir gets the directory where temporary data should be saved for a specific workspace
+func (cs *ClientServer) GetWorkspaceTempDir(mnemonic string) (string, error) {
+	mux := &cs.workspaceDirectoryMux
+	mux.RLock()
+	defer mux.RUnlock()
+
+	directory, ok := cs.workspaceDirectoryMap[mnemonic]
+	if !ok {
+		cs.logger.Error(fmt.Sprintf("Requesting directory for unknown mnemonic [%s]", mnemonic))
+		return "", fmt.Errorf("requesting directory for unknown mnemonic [%s]", mnemonic)
+	}
+
+	return fmt.Sprintf("%s/%s", directory, config.DirectoryTemp), nil
+}
+
+// GetWorkspaceMirrorDir gets the directory where mirrored files should be saved for a specific workspace
+func (cs *ClientServer) GetWorkspaceMirrorDir(mnemonic string) (string, error) {
+	mux := &cs.workspaceDirectoryMux
+	mux.RLock()
+	defer mux.RUnlock()
+
+	directory, ok := cs.workspaceDirectoryMap[mnemonic]
+	if !ok {
+		cs.logger.Error(fmt.Sprintf("Requesting directory for unknown mnemonic [%s]", mnemonic))
+		return "", fmt.Errorf("requesting directory for unknown mnemonic [%s]", mnemonic)
+	}
+
+	return fmt.Sprintf("%s/%s", directory, config.DirectoryMirror), nil
+}
+
+// GetThrottler returns the file sharing bandwidth throttler
+func (cs *ClientServer) GetThrottler() *throttle.Throttler {
+	return cs.throttler
+}
+
 // File Sharing //
 
 type fileMetadataWrapper struct {
 	peerID       peer.ID
 	fileMetadata *proto.FileDownloadMetadata
 	aesKey       []byte
-	hmacKey      []byte
 }
 
 // RequestFile implements file download request handling
@@ -1466,7 +1855,7 @@ func (cs *ClientServer) RequestFile(
 	}
 
 	// Check if we have the requested file
-	mux, _ := cs.fileListerMuxMap[mnemonic]
+	mux := &cs.fileListerMux
 	mux.RLock()
 	fileLister, ok := cs.fileListerMap[mnemonic]
 	if !ok {
@@ -1483,6 +1872,31 @@ func (cs *ClientServer) RequestFile(
 		return nil, fmt.Errorf("unable to find file %s", request.FileChecksum)
 	}
 
+	// Check if the requested range is valid
+	if request.Offset < 0 || request.Length < 0 || request.Offset+request.Length > file.Size {
+		cs.logger.Error(fmt.Sprintf("Invalid range requested for file %s", request.FileChecksum))
+
+		return nil, fmt.Errorf("invalid range requested for file %s", request.FileChecksum)
+	}
+
+	// Grab the Merkle proofs of the requested chunks
+	var chunkProofs []*proto.ChunkProof
+	if request.IncludeProofs {
+		proofs, proofsErr := buildChunkProofs(
+			fileLister.GetMerkleTree(request.FileChecksum),
+			request.Offset,
+			request.Length,
+			file.Size,
+		)
+		if proofsErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to build chunk proofs for file %s, %v", request.FileChecksum, proofsErr))
+
+			return nil, fmt.Errorf("unable to build chunk proofs for file %s", request.FileChecksum)
+		}
+
+		chunkProofs = proofs
+	}
+
 	// Grab our own credentials for the workspace
 	credentials, credErr := storage.GetStorageHandler().GetWorkspaceCredentials(request.Mnemonic)
 	if credErr != nil {
@@ -1498,7 +1912,6 @@ func (cs *ClientServer) RequestFile(
 	metadata = nil
 
 	var aesKey []byte
-	var hmacKey []byte
 
 	if securityType == "password" {
 		passwordMetadata, constructErr := localCrypto.GeneratePasswordFileSharingMetadata(*credentials.Password)
@@ -1509,16 +1922,20 @@ func (cs *ClientServer) RequestFile(
 		}
 
 		aesKey = passwordMetadata.AESKey
-		hmacKey = passwordMetadata.HMACKey
 
 		// Extract the relevant information
 		metadata = &proto.FileDownloadMetadata{
-			RequestId:    uuid.New().String(),
-			IV:           passwordMetadata.IV,
-			Salt:         passwordMetadata.Salt,
-			Mnemonic:     request.Mnemonic,
-			FileChecksum: request.FileChecksum,
-			FileName:     fmt.Sprintf("%s%s", file.Name, file.Extension),
+			RequestId:      uuid.New().String(),
+			IV:             passwordMetadata.IV,
+			Salt:           passwordMetadata.Salt,
+			Mnemonic:       request.Mnemonic,
+			FileChecksum:   request.FileChecksum,
+			FileName:       fmt.Sprintf("%s%s", file.Name, file.Extension),
+			Offset:         request.Offset,
+			Length:         request.Length,
+			FileSize:       file.Size,
+			FramingVersion: localCrypto.FramingVersion,
+			ChunkProofs:    chunkProofs,
 		}
 	} else {
 		if request.PublicKey == nil {
@@ -1535,7 +1952,6 @@ func (cs *ClientServer) RequestFile(
 		}
 
 		aesKey = keyMetadata.AESKey
-		hmacKey = keyMetadata.HMACKey
 
 		// Extract the relevant information
 		metadata = &proto.FileDownloadMetadata{
@@ -1546,6 +1962,11 @@ func (cs *ClientServer) RequestFile(
 			EncryptedHmacKey: keyMetadata.EncryptedHMACKey,
 			Mnemonic:         request.Mnemonic,
 			FileChecksum:     request.FileChecksum,
+			Offset:           request.Offset,
+			Length:           request.Length,
+			FileSize:         file.Size,
+			FramingVersion:   localCrypto.FramingVersion,
+			ChunkProofs:      chunkProofs,
 		}
 	}
 
@@ -1556,11 +1977,22 @@ func (cs *ClientServer) RequestFile(
 		return nil, errors.New("unable to construct metadata")
 	}
 
-	cs.downloadRequestMap[metadata.RequestId] = fileMetadataWrapper{
-		peerID:       typedContext.PeerID,
-		fileMetadata: metadata,
-		aesKey:       aesKey,
-		hmacKey:      hmacKey,
+	// Pick a compression codec both sides support, if any
+	metadata.Codec = negotiateCodec(request.AcceptedCodecs)
+
+	if addErr := cs.sessionManager.Add(
+		types.SESSION_TYPE_DOWNLOAD,
+		metadata.RequestId,
+		typedContext.PeerID,
+		fileMetadataWrapper{
+			peerID:       typedContext.PeerID,
+			fileMetadata: metadata,
+			aesKey:       aesKey,
+		},
+	); addErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to save download request of peer %s, %v", typedContext.PeerID.Pretty(), addErr))
+
+		return nil, fmt.Errorf("unable to save download request, %v", addErr)
 	}
 
 	cs.logger.Info(fmt.Sprintf("File metadata sent: %s", request.FileChecksum))
@@ -1568,7 +2000,9 @@ func (cs *ClientServer) RequestFile(
 	return metadata, nil
 }
 
-const chunkSize = int64(64 * 1024) // 64 KiB
+// chunkSize is the size of the chunks sent during file transfers.
+// Chunks line up with the Merkle tree leaves of the file
+const chunkSize = files.MerkleChunkSize
 
 // DownloadFile starts the file encryption and download process
 func (cs *ClientServer) DownloadFile(
@@ -1578,72 +2012,102 @@ func (cs *ClientServer) DownloadFile(
 	cs.logger.Info(fmt.Sprintf("Download requested: %s", requestIDWrapper.ID))
 
 	// Check if the request is valid
-	metadata, requestFound := cs.downloadRequestMap[requestIDWrapper.ID]
-	if !requestFound {
-		cs.logger.Error("Unknown request")
-
-		return errors.New("unknown request")
-	}
-
-	mux, _ := cs.fileListerMuxMap[metadata.fileMetadata.Mnemonic]
-	mux.RLock()
-	fileLister := cs.fileListerMap[metadata.fileMetadata.Mnemonic]
-	fileInfo, _ := fileLister.GetFileInfo(metadata.fileMetadata.FileChecksum)
-	mux.RUnlock()
-
-	if fileInfo == nil {
-		cs.logger.Error("Unknown file requested")
-
-		return errors.New("unknown file requested")
+	metadata, ctx, endSession, beginErr := cs.beginDownloadSession(server.Context(), requestIDWrapper.ID)
+	if beginErr != nil {
+		return beginErr
 	}
+	defer endSession()
 
-	filePath := fmt.Sprintf("%s/%s%s", fileLister.GetBaseDir(), fileInfo.Name, fileInfo.Extension)
-	inFile, err := os.Open(filePath)
+	inFile, err := cs.openSharedFile(metadata.fileMetadata.Mnemonic, metadata.fileMetadata.FileChecksum)
 	if err != nil {
-		cs.logger.Error(fmt.Sprintf("Unable to open file, %v", err))
 		return err
 	}
 	defer inFile.Close()
 
-	aes, err := aes.NewCipher(metadata.aesKey)
+	// Skip to the requested range
+	if _, seekErr := inFile.Seek(metadata.fileMetadata.Offset, io.SeekStart); seekErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to seek file, %v", seekErr))
+		return seekErr
+	}
+
+	var reader io.Reader
+	reader = inFile
+	if metadata.fileMetadata.Length > 0 {
+		reader = io.LimitReader(inFile, metadata.fileMetadata.Length)
+	}
+
+	chunkCipher, err := localCrypto.NewChunkCipher(
+		metadata.aesKey,
+		metadata.fileMetadata.IV,
+		metadata.fileMetadata.Offset,
+		metadata.fileMetadata.Length,
+	)
 	if err != nil {
 		return err
 	}
 
-	ctr := cipher.NewCTR(aes, metadata.fileMetadata.IV)
-	hmac := hmac.New(sha256.New, metadata.hmacKey)
+	// Chunks are compressed before they are sealed, if the requester accepted a codec
+	compressor := newChunkCompressor(metadata.fileMetadata.Codec)
 
-	chunk := &proto.FileChunk{}
+	// Every chunk is sealed on its own, so the receiver can verify it as soon as it arrives
+	index := int64(0)
 	buf := make([]byte, chunkSize)
 	for {
-		n, err := inFile.Read(buf)
-		if err != nil && err != io.EOF {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			cs.logger.Error("Unable to read file")
 			return err
 		}
 
-		outBuf := make([]byte, n)
+		if n == 0 {
+			break
+		}
+
+		if index == 0 && isCompressedContent(metadata.fileMetadata.FileName, buf[:n]) {
+			// Compressing already compressed content only wastes time
+			compressor = newChunkCompressor("")
+		}
+
+		data, compressed := compressor.compress(buf[:n])
+
+		var flags localCrypto.ChunkFlags
+		if compressed {
+			flags |= localCrypto.ChunkCompressed
+		}
 
-		ctr.XORKeyStream(outBuf, buf[:n])
-		chunk.Chunk = outBuf
-		hmac.Write(chunk.Chunk)
+		// Stay within the upload limits
+		if waitErr := cs.throttler.WaitUpload(
+			ctx,
+			metadata.fileMetadata.Mnemonic,
+			metadata.peerID.String(),
+			len(data),
+		); waitErr != nil {
+			return waitErr
+		}
 
-		if err := server.Send(chunk); err != nil {
+		if err := server.Send(&proto.FileChunk{
+			Chunk:      chunkCipher.Seal(index, flags, data),
+			Version:    localCrypto.FramingVersion,
+			Index:      index,
+			Compressed: compressed,
+		}); err != nil {
 			return err
 		}
 
-		if err == io.EOF {
+		index++
+
+		if err != nil {
 			break
 		}
 	}
 
-	// Include the IV in the HMAC
-	hmac.Write(metadata.fileMetadata.IV)
-
-	// Append the IV and the HMAC code to the end of the file stream
-	chunk.Chunk = append(metadata.fileMetadata.IV, hmac.Sum(nil)...)
-
-	if err := server.Send(chunk); err != nil {
+	// Mark the end of the stream, so the receiver can detect truncation
+	if err := server.Send(&proto.FileChunk{
+		Chunk:   chunkCipher.Seal(index, localCrypto.ChunkFinal, nil),
+		Version: localCrypto.FramingVersion,
+		Index:   index,
+		Final:   true,
+	}); err != nil {
 		return err
 	}
 
@@ -1652,19 +2116,203 @@ func (cs *ClientServer) DownloadFile(
 	return nil
 }
 
-type DownloadedFileWrapper struct {
-	FileName string
-	FilePath string
-}
+// DownloadDelta streams the operations that rebuild the requested file
+// out of the previous version the requester already has
+func (cs *ClientServer) DownloadDelta(
+	request *proto.DeltaRequest,
+	server proto.FileSharing_DownloadDeltaServer,
+) error {
+	cs.logger.Info(fmt.Sprintf("Delta requested: %s", request.RequestId))
+
+	// Check if the request is valid
+	metadata, ctx, endSession, beginErr := cs.beginDownloadSession(server.Context(), request.RequestId)
+	if beginErr != nil {
+		return beginErr
+	}
+	defer endSession()
+
+	// Deltas are only built for whole files
+	if metadata.fileMetadata.Offset != 0 || metadata.fileMetadata.Length != 0 {
+		cs.logger.Error("Delta requested for a file range")
+
+		return errors.New("delta requested for a file range")
+	}
+
+	if validateErr := files.ValidateDeltaBlockSize(request.BlockSize); validateErr != nil {
+		cs.logger.Error(fmt.Sprintf("Invalid delta request, %v", validateErr))
+
+		return validateErr
+	}
+
+	if len(request.Signatures) > files.MaxDeltaSignatures || request.PreviousSize < 0 {
+		cs.logger.Error("Invalid delta request signatures")
+
+		return errors.New("invalid delta request signatures")
+	}
+
+	signatures := make([]files.BlockSignature, len(request.Signatures))
+	for i, signature := range request.Signatures {
+		signatures[i] = files.BlockSignature{
+			Weak:   signature.Weak,
+			Strong: signature.Strong,
+		}
+	}
+
+	inFile, err := cs.openSharedFile(metadata.fileMetadata.Mnemonic, metadata.fileMetadata.FileChecksum)
+	if err != nil {
+		return err
+	}
+	defer inFile.Close()
+
+	chunkCipher, err := localCrypto.NewChunkCipher(
+		metadata.aesKey,
+		metadata.fileMetadata.IV,
+		metadata.fileMetadata.Offset,
+		metadata.fileMetadata.Length,
+	)
+	if err != nil {
+		return err
+	}
+
+	compressor := newChunkCompressor(metadata.fileMetadata.Codec)
+	if isCompressedContent(metadata.fileMetadata.FileName, nil) {
+		compressor = newChunkCompressor("")
+	}
+
+	// Every operation is sent as a single sealed chunk
+	index := int64(0)
+	sendOperation := func(op files.DeltaOp) error {
+		operation, marshalErr := protobuf.Marshal(&proto.DeltaOperation{
+			BlockIndex: op.BlockIndex,
+			BlockCount: op.BlockCount,
+			Data:       op.Data,
+		})
+		if marshalErr != nil {
+			return marshalErr
+		}
+
+		data, compressed := compressor.compress(operation)
+
+		var flags localCrypto.ChunkFlags
+		if compressed {
+			flags |= localCrypto.ChunkCompressed
+		}
+
+		// Stay within the upload limits
+		if waitErr := cs.throttler.WaitUpload(
+			ctx,
+			metadata.fileMetadata.Mnemonic,
+			metadata.peerID.String(),
+			len(data),
+		); waitErr != nil {
+			return waitErr
+		}
+
+		if sendErr := server.Send(&proto.FileChunk{
+			Chunk:      chunkCipher.Seal(index, flags, data),
+			Version:    localCrypto.FramingVersion,
+			Index:      index,
+			Compressed: compressed,
+		}); sendErr != nil {
+			return sendErr
+		}
+
+		index++
+
+		return nil
+	}
+
+	if deltaErr := files.ComputeDelta(
+		inFile,
+		int(request.BlockSize),
+		request.PreviousSize,
+		signatures,
+		int(chunkSize),
+		sendOperation,
+	); deltaErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to compute delta, %v", deltaErr))
+
+		return deltaErr
+	}
+
+	// Mark the end of the stream, so the receiver can detect truncation
+	if err := server.Send(&proto.FileChunk{
+		Chunk:   chunkCipher.Seal(index, localCrypto.ChunkFinal, nil),
+		Version: localCrypto.FramingVersion,
+		Index:   index,
+		Final:   true,
+	}); err != nil {
+		return err
+	}
+
+	cs.logger.Info(fmt.Sprintf("Delta sent: %s, %d operations", request.RequestId, index))
+
+	return nil
+}
+
+// openSharedFile opens a file shared in the workspace
+func (cs *ClientServer) openSharedFile(mnemonic string, fileChecksum string) (*os.File, error) {
+	mux := &cs.fileListerMux
+	mux.RLock()
+	fileLister := cs.fileListerMap[mnemonic]
+	filePath := ""
+	if fileLister != nil {
+		// Retained versions are served out of the versions directory
+		filePath = fileLister.GetFilePath(fileChecksum)
+	}
+	mux.RUnlock()
+
+	if filePath == "" {
+		cs.logger.Error("Unknown file requested")
+
+		return nil, errors.New("unknown file requested")
+	}
+
+	inFile, err := os.Open(filePath)
+	if err != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to open file, %v", err))
+
+		return nil, err
+	}
+
+	return inFile, nil
+}
+
+type DownloadedFileWrapper struct {
+	FileName string
+	FilePath string
+	Path     string // relative directory of the file in the workspace
+	FileSize int64
+	WireSize int64 // number of bytes received from peers, after compression
+}
+
+// verifiedSegmentSize is the size of the file segments that are
+// requested and verified one by one from a single peer
+const verifiedSegmentSize = int64(16 * 1024 * 1024) // 16 MiB
+
+// maxChunkProofs is the most chunk proofs sent in a single response.
+// Proofs of larger ranges don't fit in a gRPC message, so they are requested per segment
+const maxChunkProofs = verifiedSegmentSize / chunkSize
+
+// HandleFileDownload handles file downloads from a remote peer.
+// Interrupted downloads are kept in the workspace temp directory,
+// and resume from the last saved offset on the next attempt.
+// The download stops as soon as the context is canceled
+func (cs *ClientServer) HandleFileDownload(
+	ctx context.Context,
+	mnemonic string,
+	fileChecksum string,
+	progressFn ProgressFn,
+) (*DownloadedFileWrapper, error) {
+	start := time.Now()
+
+	// The checksum names the partial download files, so it has to be well-formed
+	if _, parseErr := files.ParseFileChecksum(fileChecksum); parseErr != nil {
+		return nil, parseErr
+	}
 
-// HandleFileDownload handles file downloads from a remote peer
-func (cs *ClientServer) HandleFileDownload(
-	mnemonic string,
-	fileChecksum string,
-) (*DownloadedFileWrapper, error) {
-	start := time.Now()
 	// Set the download directory
-	mux, _ := cs.workspaceDirectoryMuxMap[mnemonic]
+	mux := &cs.workspaceDirectoryMux
 	mux.RLock()
 	baseDir, _ := cs.workspaceDirectoryMap[mnemonic]
 	mux.RUnlock()
@@ -1689,196 +2337,726 @@ func (cs *ClientServer) HandleFileDownload(
 		return nil, errors.New("unknown credentials")
 	}
 
-	mux, _ = cs.fileAggregatorMuxMap[mnemonic]
+	mux = &cs.fileAggregatorMux
 	mux.RLock()
-	peers := cs.fileAggregatorMap[mnemonic].GetFilePeers(fileChecksum)
+	fileAggregator := cs.fileAggregatorMap[mnemonic]
 	mux.RUnlock()
 
-	if len(peers) < 0 {
+	if fileAggregator == nil {
+		return nil, errors.New("workspace not initialized")
+	}
+
+	// Files already stored for any workspace are linked instead of downloaded
+	storedFile := fileAggregator.GetFile(fileChecksum)
+	if storedFile != nil && cs.blobStore != nil && cs.blobStore.Has(fileChecksum) {
+		downloadedFile, linkErr := cs.linkStoredFile(mnemonic, filePath, storedFile, start)
+		if linkErr == nil {
+			return downloadedFile, nil
+		}
+
+		cs.logger.Error(fmt.Sprintf("Unable to link file %s from the blob store, %v", fileChecksum, linkErr))
+	}
+
+	peers := fileAggregator.GetFilePeers(fileChecksum)
+
+	// Peers that pushed the file can be asked for it, even if they don't advertise it yet
+	offeredFile, senders := cs.getOfferedFile(mnemonic, fileChecksum)
+	for _, sender := range senders {
+		if !containsPeer(peers, sender) {
+			peers = append(peers, sender)
+		}
+	}
+
+	if len(peers) == 0 {
 		return nil, errors.New("no peers")
 	}
 
-	var stream network.Stream
-	stream = nil
+	// Skip the peers that served a corrupted version of the file before
+	if peers = cs.filterBadPeers(fileChecksum, peers); len(peers) == 0 {
+		return nil, errors.New("no peers that served the file correctly")
+	}
+
+	// Pick up any progress from previous download attempts
+	state, stateErr := loadDownloadState(filePath, fileChecksum)
+	if stateErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to load download state, %v", stateErr))
+
+		return nil, stateErr
+	}
+
+	if state.Offset > 0 {
+		cs.logger.Info(fmt.Sprintf("Resuming download of %s from byte %d", fileChecksum, state.Offset))
+	}
+
+	state.onProgress = cs.newProgressPublisher(mnemonic, fileChecksum, progressFn)
+
+	// Grab the peers that passed verification, they are the only ones
+	// that can be asked for pieces of the file in parallel
+	verifiedPeers := make([]peer.ID, 0)
 	for _, peerID := range peers {
-		foundStream, err := cs.host.NewStream(cs.ctx, peerID, protocol.ID(config.FileSharingProto))
-		if err != nil {
-			continue
+		if cs.isVerifiedPeer(peerID, mnemonic) {
+			verifiedPeers = append(verifiedPeers, peerID)
 		}
+	}
 
-		stream = foundStream
-		break
+	fileSize := state.FileSize
+	file := fileAggregator.GetFile(fileChecksum)
+	if file == nil {
+		file = offeredFile
 	}
-	if stream == nil {
-		return nil, errors.New("unable to find available stream")
+
+	if file != nil {
+		fileSize = file.Size
+		state.Path = file.Path
+
+		// Chunks can only be checked against the Merkle tree if they line up with its leaves
+		if file.ChunkSize == chunkSize {
+			state.MerkleRoot = file.MerkleRoot
+		}
 	}
 
-	defer func(stream network.Stream) {
-		if streamCloseErr := stream.Close(); streamCloseErr != nil {
-			cs.logger.Error(fmt.Sprintf("Unable to gracefully close stream, %v", streamCloseErr))
+	// Fresh downloads of large files try to reuse a local previous version first,
+	// and fall back to a regular download if that doesn't work out
+	deltaDownloaded := false
+	if state.Offset == 0 && state.PieceSize == 0 && file != nil && fileSize >= minDeltaFileSize {
+		if previousPath := cs.findPreviousVersion(mnemonic, file); previousPath != "" {
+			deltaErr := cs.downloadDelta(ctx, peers, workspaceInfo, credentials, state, previousPath)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			if deltaErr != nil {
+				cs.logger.Error(fmt.Sprintf("Unable to download delta of %s, %v", fileChecksum, deltaErr))
+			}
+
+			deltaDownloaded = deltaErr == nil
 		}
-	}(stream)
+	}
 
-	// Grab the wrapped connection
-	clientConn := WrapStreamInClient(stream)
+	var downloadErr error
+	switch {
+	case deltaDownloaded:
+		// The file is already rebuilt out of its previous version
+	case state.PieceSize > 0 || (len(verifiedPeers) > 1 && fileSize > swarmPieceSize):
+		// Split the file into pieces, and fetch them from multiple peers at once
+		downloadErr = newSwarmDownload(ctx, cs, workspaceInfo, credentials, state, fileSize).run(verifiedPeers)
+	default:
+		// Try the peers one by one, resuming from wherever the previous one stopped.
+		// A stopped download keeps its progress for later
+		downloadErr = cs.tryPeers(ctx, peers, func(peerID peer.ID) error {
+			return cs.downloadFromPeer(ctx, peerID, workspaceInfo, credentials, state, fileSize)
+		})
+	}
 
-	// Instantiate the proto client
-	clientProto := proto.NewFileSharingClient(clientConn.(*grpc.ClientConn))
+	if downloadErr != nil {
+		return nil, downloadErr
+	}
+
+	// The chunks are only authenticated against the peers that sent them,
+	// so the whole file is checked against the requested checksum
+	if checksumErr := state.verifyChecksum(); checksumErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to verify downloaded file %s, %v", fileChecksum, checksumErr))
+
+		if errors.Is(checksumErr, ErrChecksumMismatch) {
+			cs.blameChecksumMismatch(state)
+		}
+
+		// Nothing in the partial file can be trusted
+		state.remove()
 
-	// File request
-	fileMetadata, requestErr := clientProto.RequestFile(context.Background(), &proto.FileRequest{
-		Mnemonic:     mnemonic,
-		FileChecksum: fileChecksum,
-		PublicKey:    credentials.PublicKey,
+		return nil, checksumErr
+	}
+
+	// Move the verified file to its final location,
+	// recreating the directory structure of the shared file
+	relativeDir, pathErr := files.CleanRelativePath(state.Path)
+	if pathErr != nil {
+		cs.logger.Error(fmt.Sprintf("Invalid file path %s, %v", state.Path, pathErr))
+
+		return nil, pathErr
+	}
+
+	downloadDir := filepath.Join(filePath, filepath.FromSlash(relativeDir))
+	if createErr := globalUtils.CreateDirectory(downloadDir); createErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to create download directory, %v", createErr))
+
+		return nil, errors.New("unable to create download directory")
+	}
+
+	fileName := cs.downloadFileName(mnemonic, file, fileChecksum, state.FileName)
+
+	downloadFilePath := filepath.Join(downloadDir, fileName)
+	if promoteErr := state.promote(downloadFilePath); promoteErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to save downloaded file, %v", promoteErr))
+
+		return nil, errors.New("unable to save downloaded file")
+	}
+
+	cs.addDownloadedFile(downloadFilePath, fileChecksum)
+
+	elapsed := time.Since(start)
+	cs.logger.Info(
+		fmt.Sprintf(
+			"Downloaded file %s in %s (%d bytes, %d bytes on the wire)",
+			state.FileName,
+			elapsed,
+			state.FileSize,
+			state.WireBytes,
+		),
+	)
+
+	cs.publishEvent(types.EVENT_DOWNLOAD_COMPLETE, mnemonic, types.DownloadEventData{
+		FileChecksum:    fileChecksum,
+		FileName:        fileName,
+		BytesDownloaded: state.FileSize,
+		BytesTotal:      state.FileSize,
 	})
-	if requestErr != nil {
-		cs.logger.Error(fmt.Sprintf("Unable to request file, %v", requestErr))
 
-		return nil, requestErr
+	return &DownloadedFileWrapper{
+		FileName: fileName,
+		FilePath: downloadFilePath,
+		Path:     relativeDir,
+		FileSize: state.FileSize,
+		WireSize: state.WireBytes,
+	}, nil
+}
+
+// DiscardFileDownload removes any progress of an interrupted file download
+func (cs *ClientServer) DiscardFileDownload(mnemonic string, fileChecksum string) error {
+	if _, parseErr := files.ParseFileChecksum(fileChecksum); parseErr != nil {
+		return parseErr
 	}
 
-	// Figure out the AES / HMAC keys
-	var aesKey []byte
-	var hmacKey []byte
+	tempDir, dirErr := cs.GetWorkspaceTempDir(mnemonic)
+	if dirErr != nil {
+		return dirErr
+	}
 
-	if workspaceInfo.SecurityType == "password" {
-		// Generate the data
-		if credentials.Password == nil {
-			return nil, errors.New("no password for solution")
+	newDownloadState(tempDir, fileChecksum).remove()
+
+	return nil
+}
+
+// downloadFromPeer downloads the remainder of the file described by the download state
+// from a single peer. The file is fetched in segments, and the download state only moves
+// past a segment once it is verified, so the partial file never holds unverified data
+func (cs *ClientServer) downloadFromPeer(
+	ctx context.Context,
+	peerID peer.ID,
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	state *downloadState,
+	fileSize int64,
+) error {
+	clientProto, closeFn, openErr := cs.newFileSharingClient(ctx, peerID)
+	if openErr != nil {
+		return openErr
+	}
+	defer closeFn()
+
+	return cs.downloadSegments(ctx, peerID, clientProto, workspaceInfo, credentials, state, fileSize)
+}
+
+// downloadSegments fetches the file from the saved offset segment by segment, over the opened stream.
+// Every verified segment is saved to the partial file, so an interrupted download resumes after it
+func (cs *ClientServer) downloadSegments(
+	ctx context.Context,
+	peerID peer.ID,
+	clientProto proto.FileSharingClient,
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	state *downloadState,
+	fileSize int64,
+) error {
+	// Open the partial file at the saved offset
+	partialFile, openErr := os.OpenFile(state.partialPath, os.O_CREATE|os.O_WRONLY, 0600)
+	if openErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to open partial file, %v", openErr))
+
+		return openErr
+	}
+
+	defer func() {
+		_ = partialFile.Close()
+
+		if saveErr := state.save(); saveErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to save download state, %v", saveErr))
 		}
-		if fileMetadata.Salt == nil {
-			return nil, errors.New("bad request - missing salt")
+	}()
+
+	for {
+		if _, seekErr := partialFile.Seek(state.Offset, io.SeekStart); seekErr != nil {
+			return seekErr
 		}
 
-		solution := localCrypto.GeneratePasswordFileSharingSolution(
-			*credentials.Password,
-			fileMetadata.Salt,
+		// Request the next segment, or the rest of the file if the size is unknown
+		length := verifiedSegmentSize
+		if fileSize == 0 || state.Offset+length >= fileSize {
+			length = 0
+		}
+
+		// Proofs can only be requested for ranges that start on a chunk boundary
+		merkleRoot := state.MerkleRoot
+		if state.Offset%chunkSize != 0 {
+			merkleRoot = ""
+		}
+
+		// Hash the data as it's written, so the finished file can be checked against its checksum
+		if hashErr := state.syncHash(state.Offset); hashErr != nil {
+			return hashErr
+		}
+
+		output := &countingWriter{writer: io.MultiWriter(partialFile, state.hasher)}
+		fileMetadata, wireBytes, fetchErr := cs.fetchRange(
+			ctx,
+			peerID,
+			clientProto,
+			workspaceInfo,
+			credentials,
+			state.FileChecksum,
+			merkleRoot,
+			state.Offset,
+			length,
+			output,
 		)
+		state.WireBytes += wireBytes
 
-		aesKey = solution.AESKey
-		hmacKey = solution.HMACKey
-	} else {
-		// Decrypt the data
-		if credentials.PrivateKey == nil {
-			return nil, errors.New("no private key for solution")
+		if fetchErr != nil {
+			cs.blameFetchError(state.FileChecksum, peerID, fetchErr)
+
+			// Drop anything that was written after the last verified segment
+			if truncateErr := partialFile.Truncate(state.Offset); truncateErr != nil {
+				cs.logger.Error(fmt.Sprintf("Unable to truncate partial file, %v", truncateErr))
+			}
+
+			// The hash followed the dropped data as well
+			state.hasher = nil
+
+			return fetchErr
 		}
 
-		if fileMetadata.EncryptedAesKey == nil {
-			return nil, errors.New("bad request - missing aes key")
+		state.Offset += output.written
+		state.hashedOffset = state.Offset
+		if merkleRoot == "" {
+			state.addUnverifiedSource(peerID)
 		}
+		state.FileName = fileMetadata.FileName
+		state.FileSize = fileMetadata.FileSize
+		fileSize = fileMetadata.FileSize
 
-		if fileMetadata.EncryptedHmacKey == nil {
-			return nil, errors.New("bad request - missing hmac key")
+		if saveErr := state.save(); saveErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to save download state, %v", saveErr))
 		}
 
-		solution, solErr := localCrypto.GenerateKeyFileSharingSolution(
-			*credentials.PrivateKey,
-			fileMetadata.EncryptedAesKey,
-			fileMetadata.EncryptedHmacKey,
-		)
-		if solErr != nil {
-			return nil, errors.New(fmt.Sprintf("unable to find solution, %v", solErr))
+		if length == 0 || state.Offset >= fileSize {
+			break
 		}
+	}
 
-		aesKey = solution.AESKey
-		hmacKey = solution.HMACKey
+	if state.Offset != state.FileSize {
+		return fmt.Errorf("file size mismatch, expected %d found %d", state.FileSize, state.Offset)
 	}
 
-	aes, err := aes.NewCipher(aesKey)
+	return nil
+}
+
+// countingWriter is a writer wrapper that counts the written bytes
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+// Write implements the io.Writer interface
+func (cw *countingWriter) Write(data []byte) (int, error) {
+	n, err := cw.writer.Write(data)
+	cw.written += int64(n)
+
+	return n, err
+}
+
+// newFileSharingClient opens a file sharing stream to the peer.
+// The returned function closes the stream
+func (cs *ClientServer) newFileSharingClient(
+	ctx context.Context,
+	peerID peer.ID,
+) (proto.FileSharingClient, func(), error) {
+	if cs.fileSharingClientFn != nil {
+		return cs.fileSharingClientFn(ctx, peerID)
+	}
+
+	stream, err := cs.host.NewStream(ctx, peerID, protocol.ID(config.FileSharingProto))
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("unable to instantiate stream to client node, %v", err)
 	}
 
-	ctr := cipher.NewCTR(aes, fileMetadata.IV)
-	hmac := hmac.New(sha256.New, hmacKey)
+	// Grab the wrapped connection
+	clientConn := WrapStreamInClient(stream).(*grpc.ClientConn)
+
+	closeFn := func() {
+		_ = clientConn.Close()
 
-	fileDownload, downloadErr := clientProto.DownloadFile(context.Background(), &proto.FileRequestID{
+		if streamCloseErr := stream.Close(); streamCloseErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to gracefully close stream, %v", streamCloseErr))
+		}
+	}
+
+	// Instantiate the proto client
+	return proto.NewFileSharingClient(clientConn), closeFn, nil
+}
+
+var (
+	errUnexpectedChunk    = errors.New("unexpected chunk in file stream")
+	errTruncatedStream    = errors.New("file stream is truncated")
+	errFinalChunkPayload  = errors.New("final chunk carries file data")
+	errInvalidChunkProof  = fmt.Errorf("%w, invalid chunk proof", ErrIntegrity)
+	errChunkHashMismatch  = fmt.Errorf("%w, chunk doesn't match its proof", ErrIntegrity)
+	errTooManyChunkProofs = errors.New("requested range needs too many chunk proofs")
+)
+
+// fetchRange requests a byte range of the file from the peer, and writes the decrypted
+// data to the output writer as it arrives. A length of 0 requests the rest of the file.
+// If the Merkle root of the file is known, every chunk is checked against its proof before it's written.
+// The data written to the output is only trusted if no error is returned.
+// The number of bytes received from the peer is returned even if the fetch fails
+func (cs *ClientServer) fetchRange(
+	ctx context.Context,
+	peerID peer.ID,
+	clientProto proto.FileSharingClient,
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	fileChecksum string,
+	merkleRoot string,
+	offset int64,
+	length int64,
+	output io.Writer,
+) (*proto.FileDownloadMetadata, int64, error) {
+	// Number of bytes received from the peer, after compression
+	wireBytes := int64(0)
+
+	// File request for the given range
+	fileMetadata, requestErr := clientProto.RequestFile(ctx, &proto.FileRequest{
+		Mnemonic:       workspaceInfo.Mnemonic,
+		FileChecksum:   fileChecksum,
+		PublicKey:      credentials.PublicKey,
+		Offset:         offset,
+		Length:         length,
+		IncludeProofs:  merkleRoot != "",
+		AcceptedCodecs: supportedCodecs,
+	})
+	if requestErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to request file, %v", requestErr))
+
+		return nil, wireBytes, requestErr
+	}
+
+	if fileMetadata.Offset != offset || fileMetadata.Length != length {
+		return nil, wireBytes, errors.New("bad request - range mismatch")
+	}
+
+	if checkErr := checkTransferMetadata(fileMetadata); checkErr != nil {
+		return nil, wireBytes, checkErr
+	}
+
+	// Check the chunk proofs before any data arrives
+	var chunkProofs []*proto.ChunkProof
+	if merkleRoot != "" {
+		if verifyErr := verifyChunkProofs(merkleRoot, fileMetadata); verifyErr != nil {
+			cs.logger.Error(fmt.Sprintf("Invalid chunk proofs received, %v", verifyErr))
+
+			return nil, wireBytes, verifyErr
+		}
+
+		chunkProofs = fileMetadata.ChunkProofs
+	}
+
+	chunkCipher, err := newReceiveCipher(workspaceInfo, credentials, fileMetadata)
+	if err != nil {
+		return nil, wireBytes, err
+	}
+
+	fileDownload, downloadErr := clientProto.DownloadFile(ctx, &proto.FileRequestID{
 		ID: fileMetadata.RequestId,
 	})
 	if downloadErr != nil {
-		cs.logger.Error(fmt.Sprintf("Unable to download file, %v", requestErr))
+		cs.logger.Error(fmt.Sprintf("Unable to download file, %v", downloadErr))
 
-		return nil, requestErr
+		return nil, wireBytes, downloadErr
 	}
 
-	// Start the download
-	var finalFileData []byte
-	var lastChunk []byte
-	lastChunk = nil
+	// Start the download.
+	// Every chunk is opened and checked as soon as it arrives,
+	// and the stream is only complete once the final chunk is received
+	expectedIndex := int64(0)
+	finalReceived := false
 	for {
 		chunk, err := fileDownload.Recv()
 		if err != nil {
 			if err == io.EOF {
-				cs.logger.Info("File transfer complete")
+				cs.logger.Debug("File range transfer complete")
 				break
 			}
 			cs.logger.Error("Error with file download")
 
-			return nil, err
+			return nil, wireBytes, err
+		}
+
+		wireBytes += int64(len(chunk.Chunk))
+
+		if finalReceived {
+			return nil, wireBytes, errUnexpectedChunk
+		}
+
+		// Stay within the download limits
+		if waitErr := cs.throttler.WaitDownload(ctx, workspaceInfo.Mnemonic, peerID.String(), len(chunk.Chunk)); waitErr != nil {
+			return nil, wireBytes, waitErr
+		}
+
+		if chunk.Index != expectedIndex {
+			cs.logger.Error(fmt.Sprintf("Chunk out of order, expected %d found %d", expectedIndex, chunk.Index))
+
+			return nil, wireBytes, errUnexpectedChunk
+		}
+
+		data, openErr := openChunk(chunkCipher, fileMetadata.Codec, chunk, chunkSize)
+		if openErr != nil {
+			cs.logger.Error(fmt.Sprintf("Unable to open chunk %d, %v", chunk.Index, openErr))
+
+			return nil, wireBytes, openErr
+		}
+
+		if chunk.Final && len(data) > 0 {
+			// The final chunk only marks the end of the stream, it has no proof to be checked against
+			cs.logger.Error(fmt.Sprintf("Final chunk %d carries file data", chunk.Index))
+
+			return nil, wireBytes, errFinalChunkPayload
 		}
-		if lastChunk != nil {
-			hmac.Write(lastChunk)
+
+		if chunkProofs != nil && !chunk.Final {
+			if chunk.Index >= int64(len(chunkProofs)) ||
+				!bytes.Equal(files.HashMerkleLeaf(data), chunkProofs[chunk.Index].Hash) {
+				cs.logger.Error(fmt.Sprintf("Chunk %d doesn't match its proof", chunk.Index))
+
+				return nil, wireBytes, errChunkHashMismatch
+			}
 		}
 
-		outBuf := make([]byte, len(chunk.Chunk))
-		ctr.XORKeyStream(outBuf, chunk.Chunk)
-		finalFileData = append(finalFileData, outBuf...)
+		if _, writeErr := output.Write(data); writeErr != nil {
+			return nil, wireBytes, errors.New("unable to write file data")
+		}
 
-		lastChunk = chunk.Chunk
+		expectedIndex++
+		finalReceived = chunk.Final
 	}
 
-	hmac.Write(fileMetadata.IV)
-	calculatedHMAC := hmac.Sum(nil)
+	if !finalReceived {
+		cs.logger.Error("File stream ended without the final chunk")
 
-	// Extract the IV and HMAC
-	ivSize := len(fileMetadata.IV)
-	extractedIV := lastChunk[:ivSize]
-	extractedHMAC := lastChunk[ivSize:]
+		return nil, wireBytes, errTruncatedStream
+	}
 
-	// Compare the IV
-	if bytes.Compare(extractedIV, fileMetadata.IV) != 0 {
-		cs.logger.Error("IV doesn't match")
+	if chunkProofs != nil && expectedIndex-1 != int64(len(chunkProofs)) {
+		cs.logger.Error(fmt.Sprintf("Expected %d chunks, found %d", len(chunkProofs), expectedIndex-1))
 
-		cs.logger.Debug(fmt.Sprintf("Expected %v found %v", fileMetadata.IV, extractedIV))
+		return nil, wireBytes, errTruncatedStream
+	}
+
+	return fileMetadata, wireBytes, nil
+}
+
+// chunkRange returns the indexes of the first and one past the last
+// file chunk in the byte range. A length of 0 means until the end of the file
+func chunkRange(offset int64, length int64, fileSize int64) (int64, int64, error) {
+	if offset%chunkSize != 0 {
+		return 0, 0, errors.New("range offset is not aligned to the chunk size")
+	}
 
-		return nil, errors.New("IV doesn't match")
+	end := fileSize
+	if length > 0 {
+		end = offset + length
 	}
 
-	// Compare the HMAC
-	if bytes.Compare(extractedHMAC, calculatedHMAC) != 0 {
-		cs.logger.Error("HMAC doesn't match")
+	return offset / chunkSize, (end + chunkSize - 1) / chunkSize, nil
+}
 
-		cs.logger.Debug(fmt.Sprintf("Expected %v found %v", calculatedHMAC, extractedHMAC))
+// buildChunkProofs builds the Merkle proofs of the file chunks in the byte range
+func buildChunkProofs(
+	merkleTree *files.MerkleTree,
+	offset int64,
+	length int64,
+	fileSize int64,
+) ([]*proto.ChunkProof, error) {
+	if merkleTree == nil {
+		return nil, errors.New("missing merkle tree")
+	}
 
-		return nil, errors.New("HMAC doesn't match")
+	first, end, rangeErr := chunkRange(offset, length, fileSize)
+	if rangeErr != nil {
+		return nil, rangeErr
 	}
 
-	// Write data to disk
-	downloadFilePath := fmt.Sprintf("%s/%s", filePath, fileMetadata.FileName)
-	saveFile, createErr := os.Create(
-		downloadFilePath,
-	)
-	if createErr != nil {
-		cs.logger.Error(fmt.Sprintf("Unable to create placeholder file, %v", createErr))
+	if end-first > maxChunkProofs {
+		return nil, errTooManyChunkProofs
+	}
+
+	chunkProofs := make([]*proto.ChunkProof, 0, end-first)
+	for index := first; index < end; index++ {
+		leaf, leafErr := merkleTree.Leaf(index)
+		if leafErr != nil {
+			return nil, leafErr
+		}
 
-		return nil, requestErr
+		siblings, proofErr := merkleTree.Proof(index)
+		if proofErr != nil {
+			return nil, proofErr
+		}
+
+		chunkProofs = append(chunkProofs, &proto.ChunkProof{
+			Index:    index,
+			Hash:     leaf,
+			Siblings: siblings,
+		})
 	}
-	defer saveFile.Close()
 
-	// write this byte array to the created file
-	_, writeErr := saveFile.Write(
-		finalFileData[:len(finalFileData)-len(lastChunk)],
+	return chunkProofs, nil
+}
+
+// verifyChunkProofs checks that the metadata holds a valid proof
+// against the Merkle root for every chunk in the requested range
+func verifyChunkProofs(merkleRoot string, fileMetadata *proto.FileDownloadMetadata) error {
+	root, decodeErr := hex.DecodeString(merkleRoot)
+	if decodeErr != nil {
+		return fmt.Errorf("invalid merkle root, %v", decodeErr)
+	}
+
+	first, end, rangeErr := chunkRange(fileMetadata.Offset, fileMetadata.Length, fileMetadata.FileSize)
+	if rangeErr != nil {
+		return rangeErr
+	}
+
+	if int64(len(fileMetadata.ChunkProofs)) != end-first {
+		return errInvalidChunkProof
+	}
+
+	numLeaves := files.NumMerkleLeaves(fileMetadata.FileSize, chunkSize)
+	for i, chunkProof := range fileMetadata.ChunkProofs {
+		if chunkProof.Index != first+int64(i) ||
+			!files.VerifyMerkleProof(root, chunkProof.Hash, chunkProof.Index, numLeaves, chunkProof.Siblings) {
+			return errInvalidChunkProof
+		}
+	}
+
+	return nil
+}
+
+// checkTransferMetadata checks if the framing and codec picked by the sender are supported
+func checkTransferMetadata(fileMetadata *proto.FileDownloadMetadata) error {
+	if fileMetadata.FramingVersion != localCrypto.FramingVersion {
+		return fmt.Errorf("bad request - unsupported framing version %d", fileMetadata.FramingVersion)
+	}
+
+	if fileMetadata.Codec != "" && negotiateCodec([]string{fileMetadata.Codec}) == "" {
+		return fmt.Errorf("bad request - unsupported codec %s", fileMetadata.Codec)
+	}
+
+	return nil
+}
+
+// newReceiveCipher creates the cipher for opening the chunks of the requested transfer
+func newReceiveCipher(
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	fileMetadata *proto.FileDownloadMetadata,
+) (*localCrypto.ChunkCipher, error) {
+	// Figure out the AES / HMAC keys
+	// Chunks are authenticated by the AEAD, so the HMAC key is not needed
+	aesKey, _, keysErr := deriveFileSharingKeys(workspaceInfo, credentials, fileMetadata)
+	if keysErr != nil {
+		return nil, keysErr
+	}
+
+	return localCrypto.NewChunkCipher(aesKey, fileMetadata.IV, fileMetadata.Offset, fileMetadata.Length)
+}
+
+// openChunk opens a sealed chunk, and decompresses it if needed.
+// The opened chunk can't be larger than the max size
+func openChunk(
+	chunkCipher *localCrypto.ChunkCipher,
+	codec string,
+	chunk *proto.FileChunk,
+	maxSize int64,
+) ([]byte, error) {
+	var flags localCrypto.ChunkFlags
+	if chunk.Final {
+		flags |= localCrypto.ChunkFinal
+	}
+
+	if chunk.Compressed {
+		flags |= localCrypto.ChunkCompressed
+	}
+
+	data, openErr := chunkCipher.Open(chunk.Version, chunk.Index, flags, chunk.Chunk)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	if chunk.Compressed {
+		return decompressChunk(codec, data, maxSize)
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, errChunkTooLarge
+	}
+
+	return data, nil
+}
+
+// deriveFileSharingKeys figures out the AES / HMAC keys for the file transfer
+// based on the workspace security type
+func deriveFileSharingKeys(
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	fileMetadata *proto.FileDownloadMetadata,
+) ([]byte, []byte, error) {
+	if workspaceInfo.SecurityType == "password" {
+		// Generate the data
+		if credentials.Password == nil {
+			return nil, nil, errors.New("no password for solution")
+		}
+		if fileMetadata.Salt == nil {
+			return nil, nil, errors.New("bad request - missing salt")
+		}
+
+		solution := localCrypto.GeneratePasswordFileSharingSolution(
+			*credentials.Password,
+			fileMetadata.Salt,
+		)
+
+		return solution.AESKey, solution.HMACKey, nil
+	}
+
+	// Decrypt the data
+	if credentials.PrivateKey == nil {
+		return nil, nil, errors.New("no private key for solution")
+	}
+
+	if fileMetadata.EncryptedAesKey == nil {
+		return nil, nil, errors.New("bad request - missing aes key")
+	}
+
+	if fileMetadata.EncryptedHmacKey == nil {
+		return nil, nil, errors.New("bad request - missing hmac key")
+	}
+
+	solution, solErr := localCrypto.GenerateKeyFileSharingSolution(
+		*credentials.PrivateKey,
+		fileMetadata.EncryptedAesKey,
+		fileMetadata.EncryptedHmacKey,
 	)
-	if writeErr != nil {
-		return nil, errors.New("unable to write final file data")
+	if solErr != nil {
+		return nil, nil, fmt.Errorf("unable to find solution, %v", solErr)
 	}
 
-	elapsed := time.Since(start)
-	cs.logger.Info(fmt.Sprintf("Downloaded file %s in %s", fileMetadata.FileName, elapsed))
-	return &DownloadedFileWrapper{
-		FileName: fileMetadata.FileName,
-		FilePath: downloadFilePath,
-	}, nil
+	return solution.AESKey, solution.HMACKey, nil
 }
 
 // TeardownWorkspace stops any running services and wipes the directory structure
@@ -1914,11 +3092,10 @@ func (cs *ClientServer) TeardownWorkspace(mnemonic string) error {
 	}
 
 	// Delete the verified peer entries
-	mux, _ := cs.verifiedPeersMuxMap[mnemonic]
-	mux.Lock()
+	cs.verifiedPeersMux.Lock()
 	verifiedPeers, ok := cs.verifiedPeers[mnemonic]
 	delete(cs.verifiedPeers, mnemonic)
-	mux.Unlock()
+	cs.verifiedPeersMux.Unlock()
 	if ok {
 		for _, peerID := range verifiedPeers {
 			// Disconnect from every verified peer on this workspace
@@ -1927,7 +3104,7 @@ func (cs *ClientServer) TeardownWorkspace(mnemonic string) error {
 	}
 
 	// Wipe the directory
-	mux, _ = cs.workspaceDirectoryMuxMap[mnemonic]
+	mux := &cs.workspaceDirectoryMux
 	mux.Lock()
 	baseDirectory, ok := cs.workspaceDirectoryMap[mnemonic]
 	delete(cs.workspaceDirectoryMap, mnemonic)
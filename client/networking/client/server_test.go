@@ -0,0 +1,541 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+	localCrypto "github.com/zivkovicmilos/peer_drop/crypto"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/throttle"
+	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const testPassword = "password"
+
+var (
+	testSalt = []byte("salt")
+	testIV   = make([]byte, 16)
+
+	errStreamReset = errors.New("stream reset")
+)
+
+// mockFileSharingClient serves the file the way a sharing peer does,
+// and can corrupt, forge the proof of, or break the stream at a given file chunk
+type mockFileSharingClient struct {
+	proto.FileSharingClient
+
+	data         []byte
+	merkleTree   *files.MerkleTree
+	corruptChunk int64  // file chunk served with altered data, -1 for none
+	forgeChunk   int64  // file chunk served with an altered proof, -1 for none
+	breakChunk   int64  // file chunk at which the stream breaks, -1 for none
+	finalPayload []byte // data sent along with the final chunk
+	deltaErr     error  // error the delta download fails with, if any
+
+	requests []*proto.FileRequest
+}
+
+func newMockFileSharingClient(t *testing.T, data []byte) *mockFileSharingClient {
+	t.Helper()
+
+	merkleTree, treeErr := files.NewMerkleTreeFromReader(bytes.NewReader(data), chunkSize)
+	if treeErr != nil {
+		t.Fatalf("Unable to build merkle tree, %v", treeErr)
+	}
+
+	return &mockFileSharingClient{
+		data:         data,
+		merkleTree:   merkleTree,
+		corruptChunk: -1,
+		forgeChunk:   -1,
+		breakChunk:   -1,
+	}
+}
+
+func (mc *mockFileSharingClient) RequestFile(
+	_ context.Context,
+	in *proto.FileRequest,
+	_ ...grpc.CallOption,
+) (*proto.FileDownloadMetadata, error) {
+	mc.requests = append(mc.requests, in)
+
+	metadata := &proto.FileDownloadMetadata{
+		IV:             testIV,
+		Salt:           testSalt,
+		FileChecksum:   in.FileChecksum,
+		FileName:       "data.bin",
+		RequestId:      fmt.Sprintf("request-%d", len(mc.requests)),
+		Offset:         in.Offset,
+		Length:         in.Length,
+		FileSize:       int64(len(mc.data)),
+		FramingVersion: localCrypto.FramingVersion,
+	}
+
+	if in.IncludeProofs {
+		chunkProofs, proofsErr := buildChunkProofs(mc.merkleTree, in.Offset, in.Length, int64(len(mc.data)))
+		if proofsErr != nil {
+			return nil, proofsErr
+		}
+
+		for _, chunkProof := range chunkProofs {
+			if chunkProof.Index == mc.forgeChunk {
+				chunkProof.Hash[0] ^= 0xff
+			}
+		}
+
+		metadata.ChunkProofs = chunkProofs
+	}
+
+	return metadata, nil
+}
+
+func (mc *mockFileSharingClient) DownloadFile(
+	_ context.Context,
+	_ *proto.FileRequestID,
+	_ ...grpc.CallOption,
+) (proto.FileSharing_DownloadFileClient, error) {
+	request := mc.requests[len(mc.requests)-1]
+
+	end := int64(len(mc.data))
+	if request.Length > 0 {
+		end = request.Offset + request.Length
+	}
+
+	aesKey := localCrypto.GeneratePasswordFileSharingSolution(testPassword, testSalt).AESKey
+
+	chunkCipher, cipherErr := localCrypto.NewChunkCipher(aesKey, testIV, request.Offset, request.Length)
+	if cipherErr != nil {
+		return nil, cipherErr
+	}
+
+	stream := &mockDownloadStream{}
+
+	index := int64(0)
+	for offset := request.Offset; offset < end; offset += chunkSize {
+		fileChunk := offset / chunkSize
+		if fileChunk == mc.breakChunk {
+			stream.err = errStreamReset
+
+			return stream, nil
+		}
+
+		chunkEnd := offset + chunkSize
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+
+		data := append([]byte{}, mc.data[offset:chunkEnd]...)
+		if fileChunk == mc.corruptChunk {
+			data[0] ^= 0xff
+		}
+
+		stream.chunks = append(stream.chunks, &proto.FileChunk{
+			Chunk:   chunkCipher.Seal(index, 0, data),
+			Version: localCrypto.FramingVersion,
+			Index:   index,
+		})
+
+		index++
+	}
+
+	stream.chunks = append(stream.chunks, &proto.FileChunk{
+		Chunk:   chunkCipher.Seal(index, localCrypto.ChunkFinal, mc.finalPayload),
+		Version: localCrypto.FramingVersion,
+		Index:   index,
+		Final:   true,
+	})
+
+	return stream, nil
+}
+
+func (mc *mockFileSharingClient) DownloadDelta(
+	_ context.Context,
+	in *proto.DeltaRequest,
+	_ ...grpc.CallOption,
+) (proto.FileSharing_DownloadDeltaClient, error) {
+	if mc.deltaErr != nil {
+		return nil, mc.deltaErr
+	}
+
+	aesKey := localCrypto.GeneratePasswordFileSharingSolution(testPassword, testSalt).AESKey
+
+	chunkCipher, cipherErr := localCrypto.NewChunkCipher(aesKey, testIV, 0, 0)
+	if cipherErr != nil {
+		return nil, cipherErr
+	}
+
+	signatures := make([]files.BlockSignature, len(in.Signatures))
+	for i, signature := range in.Signatures {
+		signatures[i] = files.BlockSignature{Weak: signature.Weak, Strong: signature.Strong}
+	}
+
+	stream := &mockDownloadStream{}
+
+	index := int64(0)
+	deltaErr := files.ComputeDelta(
+		bytes.NewReader(mc.data),
+		int(in.BlockSize),
+		in.PreviousSize,
+		signatures,
+		int(chunkSize),
+		func(op files.DeltaOp) error {
+			operation, marshalErr := protobuf.Marshal(&proto.DeltaOperation{
+				BlockIndex: op.BlockIndex,
+				BlockCount: op.BlockCount,
+				Data:       op.Data,
+			})
+			if marshalErr != nil {
+				return marshalErr
+			}
+
+			stream.chunks = append(stream.chunks, &proto.FileChunk{
+				Chunk:   chunkCipher.Seal(index, 0, operation),
+				Version: localCrypto.FramingVersion,
+				Index:   index,
+			})
+
+			index++
+
+			return nil
+		},
+	)
+	if deltaErr != nil {
+		return nil, deltaErr
+	}
+
+	stream.chunks = append(stream.chunks, &proto.FileChunk{
+		Chunk:   chunkCipher.Seal(index, localCrypto.ChunkFinal, nil),
+		Version: localCrypto.FramingVersion,
+		Index:   index,
+		Final:   true,
+	})
+
+	return stream, nil
+}
+
+// mockDownloadStream hands out the prepared chunks, followed by the stream error
+type mockDownloadStream struct {
+	grpc.ClientStream
+
+	chunks []*proto.FileChunk
+	err    error
+}
+
+func (ms *mockDownloadStream) Recv() (*proto.FileChunk, error) {
+	if len(ms.chunks) == 0 {
+		if ms.err != nil {
+			return nil, ms.err
+		}
+
+		return nil, io.EOF
+	}
+
+	chunk := ms.chunks[0]
+	ms.chunks = ms.chunks[1:]
+
+	return chunk, nil
+}
+
+// recordingWriter keeps track of the largest single write
+type recordingWriter struct {
+	writer   io.Writer
+	maxWrite int
+}
+
+func (rw *recordingWriter) Write(data []byte) (int, error) {
+	if len(data) > rw.maxWrite {
+		rw.maxWrite = len(data)
+	}
+
+	return rw.writer.Write(data)
+}
+
+// newTestDownloadServer creates a client server that can fetch files over mock streams
+func newTestDownloadServer() *ClientServer {
+	return &ClientServer{
+		logger:    hclog.NewNullLogger(),
+		badPeers:  make(map[badPeerKey]time.Time),
+		throttler: throttle.NewThrottler(throttle.Limits{}),
+	}
+}
+
+// testDownloadData generates file data that spans two verified segments
+func testDownloadData() []byte {
+	data := make([]byte, verifiedSegmentSize+3*chunkSize+100)
+	_, _ = rand.New(rand.NewSource(1)).Read(data)
+
+	return data
+}
+
+func TestClientServer_DownloadSegments(t *testing.T) {
+	data := testDownloadData()
+	checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+	segmentChunks := verifiedSegmentSize / chunkSize
+
+	workspaceInfo := &proto.WorkspaceInfo{Mnemonic: "mnemonic", SecurityType: "password"}
+	password := testPassword
+	credentials := &types.WorkspaceCredentials{Password: &password}
+
+	testTable := []struct {
+		name           string
+		corruptChunk   int64
+		forgeChunk     int64
+		breakChunk     int64
+		expectedErr    error
+		expectedOffset int64 // offset the download is resumed from
+		expectedBlamed bool
+	}{
+		{
+			"Corrupted chunk in the first segment",
+			2,
+			-1,
+			-1,
+			errChunkHashMismatch,
+			0,
+			true,
+		},
+		{
+			"Corrupted chunk in the second segment",
+			segmentChunks + 1,
+			-1,
+			-1,
+			errChunkHashMismatch,
+			verifiedSegmentSize,
+			true,
+		},
+		{
+			"Forged chunk proof in the second segment",
+			-1,
+			segmentChunks + 1,
+			-1,
+			errInvalidChunkProof,
+			verifiedSegmentSize,
+			true,
+		},
+		{
+			"Stream interrupted in the second segment",
+			-1,
+			-1,
+			segmentChunks + 2,
+			errStreamReset,
+			verifiedSegmentSize,
+			false,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cs := newTestDownloadServer()
+
+			state := newDownloadState(t.TempDir(), checksum)
+
+			merkleTree, _ := files.NewMerkleTreeFromReader(bytes.NewReader(data), chunkSize)
+			state.MerkleRoot = fmt.Sprintf("%x", merkleTree.Root())
+
+			badSeeder := newMockFileSharingClient(t, data)
+			badSeeder.corruptChunk = testCase.corruptChunk
+			badSeeder.forgeChunk = testCase.forgeChunk
+			badSeeder.breakChunk = testCase.breakChunk
+
+			downloadErr := cs.downloadSegments(
+				context.Background(),
+				peer.ID("bad-seeder"),
+				badSeeder,
+				workspaceInfo,
+				credentials,
+				state,
+				int64(len(data)),
+			)
+			assert.ErrorIs(t, downloadErr, testCase.expectedErr)
+
+			// Data that failed verification is reported as an integrity failure
+			assert.Equal(t, testCase.expectedBlamed, errors.Is(downloadErr, ErrIntegrity))
+
+			// Only the verified segments are kept on disk
+			assert.Equal(t, testCase.expectedOffset, state.Offset)
+
+			partialInfo, statErr := os.Stat(state.partialPath)
+			assert.NoError(t, statErr)
+			assert.Equal(t, testCase.expectedOffset, partialInfo.Size())
+
+			assert.Equal(t, testCase.expectedBlamed, cs.isBadPeer(checksum, peer.ID("bad-seeder")))
+
+			// The rest of the file is fetched again from another peer
+			goodSeeder := newMockFileSharingClient(t, data)
+
+			assert.NoError(t, cs.downloadSegments(
+				context.Background(),
+				peer.ID("good-seeder"),
+				goodSeeder,
+				workspaceInfo,
+				credentials,
+				state,
+				int64(len(data)),
+			))
+
+			assert.Equal(t, testCase.expectedOffset, goodSeeder.requests[0].Offset)
+			assert.NoError(t, state.verifyChecksum())
+
+			downloaded, readErr := os.ReadFile(state.partialPath)
+			assert.NoError(t, readErr)
+			assert.True(t, bytes.Equal(data, downloaded))
+		})
+	}
+}
+
+func TestClientServer_FetchRangeStreaming(t *testing.T) {
+	const receivedChunks = 5
+
+	data := testDownloadData()
+	password := testPassword
+
+	cs := newTestDownloadServer()
+
+	seeder := newMockFileSharingClient(t, data)
+	seeder.breakChunk = receivedChunks
+
+	partialFile, createErr := os.Create(filepath.Join(t.TempDir(), "data.bin.part"))
+	assert.NoError(t, createErr)
+
+	defer partialFile.Close()
+
+	output := &recordingWriter{writer: partialFile}
+
+	_, wireBytes, fetchErr := cs.fetchRange(
+		context.Background(),
+		peer.ID("seeder"),
+		seeder,
+		&proto.WorkspaceInfo{Mnemonic: "mnemonic", SecurityType: "password"},
+		&types.WorkspaceCredentials{Password: &password},
+		fmt.Sprintf("%x", sha256.Sum256(data)),
+		"",
+		0,
+		0,
+		output,
+	)
+	assert.ErrorIs(t, fetchErr, errStreamReset)
+	assert.Greater(t, wireBytes, int64(0))
+
+	// The chunks that arrived before the stream broke are already on disk,
+	// and no more than a single chunk was held in memory at a time
+	partialInfo, statErr := partialFile.Stat()
+	assert.NoError(t, statErr)
+	assert.Equal(t, receivedChunks*chunkSize, partialInfo.Size())
+	assert.LessOrEqual(t, int64(output.maxWrite), chunkSize)
+}
+
+func TestClientServer_FetchRangeFinalChunk(t *testing.T) {
+	data := testDownloadData()
+	password := testPassword
+
+	merkleTree, _ := files.NewMerkleTreeFromReader(bytes.NewReader(data), chunkSize)
+
+	testTable := []struct {
+		name       string
+		merkleRoot string
+	}{
+		{
+			"Range checked against proofs",
+			fmt.Sprintf("%x", merkleTree.Root()),
+		},
+		{
+			"Range without proofs",
+			"",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cs := newTestDownloadServer()
+
+			// The peer slips data past the proofs in the final chunk
+			seeder := newMockFileSharingClient(t, data)
+			seeder.finalPayload = []byte("unverified data")
+
+			output := &bytes.Buffer{}
+
+			_, _, fetchErr := cs.fetchRange(
+				context.Background(),
+				peer.ID("seeder"),
+				seeder,
+				&proto.WorkspaceInfo{Mnemonic: "mnemonic", SecurityType: "password"},
+				&types.WorkspaceCredentials{Password: &password},
+				fmt.Sprintf("%x", sha256.Sum256(data)),
+				testCase.merkleRoot,
+				verifiedSegmentSize,
+				0,
+				output,
+			)
+			assert.ErrorIs(t, fetchErr, errFinalChunkPayload)
+
+			// The payload of the final chunk is never written
+			assert.True(t, bytes.Equal(data[verifiedSegmentSize:], output.Bytes()))
+		})
+	}
+}
+
+func TestBuildChunkProofs_Limit(t *testing.T) {
+	data := testDownloadData()
+	fileSize := int64(len(data))
+
+	merkleTree, treeErr := files.NewMerkleTreeFromReader(bytes.NewReader(data), chunkSize)
+	assert.NoError(t, treeErr)
+
+	testTable := []struct {
+		name        string
+		offset      int64
+		length      int64
+		expectedErr error
+	}{
+		{
+			"Single segment",
+			0,
+			verifiedSegmentSize,
+			nil,
+		},
+		{
+			"Rest of the file after a segment",
+			verifiedSegmentSize,
+			0,
+			nil,
+		},
+		{
+			"Whole file",
+			0,
+			0,
+			errTooManyChunkProofs,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			chunkProofs, proofsErr := buildChunkProofs(merkleTree, testCase.offset, testCase.length, fileSize)
+			if testCase.expectedErr != nil {
+				assert.ErrorIs(t, proofsErr, testCase.expectedErr)
+
+				return
+			}
+
+			assert.NoError(t, proofsErr)
+
+			// The proofs of a segment fit comfortably in a single gRPC message
+			metadata := &proto.FileDownloadMetadata{ChunkProofs: chunkProofs}
+			assert.Less(t, protobuf.Size(metadata), 1024*1024)
+		})
+	}
+}
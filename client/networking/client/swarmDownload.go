@@ -0,0 +1,383 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/proto"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+const (
+	swarmPieceSize       = int64(4 * 1024 * 1024) // 4 MiB, size of a single piece fetched from a peer
+	swarmMaxPeers        = 5                      // max number of peers that are used in parallel
+	swarmMaxPeerFailures = 3                      // number of failed pieces after which a peer is dropped
+	swarmPieceTimeout    = time.Minute            // max time a single piece can take before being reassigned
+)
+
+// swarmDownload keeps track of a file download
+// that's split across multiple peers
+type swarmDownload struct {
+	ctx           context.Context
+	cs            *ClientServer
+	workspaceInfo *proto.WorkspaceInfo
+	credentials   *types.WorkspaceCredentials
+	state         *downloadState
+	partialFile   *os.File
+
+	numPieces   int64
+	pending     []int64          // pieces that are not assigned to any peer
+	inFlight    map[int64]int    // piece -> number of peers fetching it
+	completed   map[int64]bool   // pieces that are verified and written to disk
+	fileName    string           // file name received from the peers
+	piecesMux   sync.Mutex       // guards the piece structures
+	piecesCnd   *sync.Cond       // signals piece structure changes
+	peerFails   map[peer.ID]int  // peer -> number of failed pieces
+	provenPeers map[peer.ID]bool // peer -> true if it delivered at least one piece
+}
+
+// newSwarmDownload prepares a multi-source download for the given file
+func newSwarmDownload(
+	ctx context.Context,
+	cs *ClientServer,
+	workspaceInfo *proto.WorkspaceInfo,
+	credentials *types.WorkspaceCredentials,
+	state *downloadState,
+	fileSize int64,
+) *swarmDownload {
+	// Pick up any sequential progress as completed pieces
+	if state.PieceSize == 0 {
+		state.PieceSize = swarmPieceSize
+		state.CompletedPieces = make([]int64, 0)
+
+		for piece := int64(0); (piece+1)*swarmPieceSize <= state.Offset; piece++ {
+			state.CompletedPieces = append(state.CompletedPieces, piece)
+		}
+
+		state.Offset = 0
+	}
+
+	state.FileSize = fileSize
+
+	sd := &swarmDownload{
+		ctx:           ctx,
+		cs:            cs,
+		workspaceInfo: workspaceInfo,
+		credentials:   credentials,
+		state:         state,
+		numPieces:     (fileSize + state.PieceSize - 1) / state.PieceSize,
+		pending:       make([]int64, 0),
+		inFlight:      make(map[int64]int),
+		completed:     make(map[int64]bool),
+		peerFails:     make(map[peer.ID]int),
+		provenPeers:   make(map[peer.ID]bool),
+		fileName:      state.FileName,
+	}
+	sd.piecesCnd = sync.NewCond(&sd.piecesMux)
+
+	for _, piece := range state.CompletedPieces {
+		sd.completed[piece] = true
+	}
+
+	for piece := int64(0); piece < sd.numPieces; piece++ {
+		if !sd.completed[piece] {
+			sd.pending = append(sd.pending, piece)
+		}
+	}
+
+	return sd
+}
+
+// run downloads all the missing pieces from the given peers in parallel
+func (sd *swarmDownload) run(peers []peer.ID) error {
+	partialFile, openErr := os.OpenFile(sd.state.partialPath, os.O_CREATE|os.O_RDWR, 0600)
+	if openErr != nil {
+		return fmt.Errorf("unable to open partial file, %v", openErr)
+	}
+	sd.partialFile = partialFile
+
+	defer func() {
+		_ = partialFile.Close()
+
+		sd.saveState()
+	}()
+
+	if len(peers) > swarmMaxPeers {
+		peers = peers[:swarmMaxPeers]
+	}
+
+	sd.cs.logger.Info(
+		fmt.Sprintf(
+			"Starting swarm download of %s with %d peers [%d/%d pieces done]",
+			sd.state.FileChecksum,
+			len(peers),
+			len(sd.completed),
+			sd.numPieces,
+		),
+	)
+
+	var wg sync.WaitGroup
+	for _, peerID := range peers {
+		wg.Add(1)
+		go func(peerID peer.ID) {
+			defer wg.Done()
+
+			sd.peerWorker(peerID)
+		}(peerID)
+	}
+	wg.Wait()
+
+	if !sd.isDone() {
+		if sd.ctx.Err() != nil {
+			// The download was stopped, the progress is kept for later
+			return sd.ctx.Err()
+		}
+
+		return errors.New("unable to download all pieces, no peers left")
+	}
+
+	// The reassembled file is checked against its checksum by the caller,
+	// so the peers that corrupted it can be blamed
+	sd.state.FileName = sd.fileName
+
+	return nil
+}
+
+// peerWorker keeps fetching pieces from a single peer, until
+// there are no more pieces left, or the peer fails too many times
+func (sd *swarmDownload) peerWorker(peerID peer.ID) {
+	// Pieces are held in memory until they are verified, so the memory
+	// used by a swarm download is bounded by the number of peers
+	buffer := bytes.NewBuffer(make([]byte, 0, sd.state.PieceSize))
+
+	// The stream to the peer is reused for consecutive pieces
+	var clientProto proto.FileSharingClient
+	closeFn := func() {}
+	defer func() {
+		closeFn()
+	}()
+
+	for {
+		piece, found := sd.nextPiece(peerID)
+		if !found {
+			return
+		}
+
+		if clientProto == nil {
+			newClient, newCloseFn, openErr := sd.cs.newFileSharingClient(sd.ctx, peerID)
+			if openErr != nil {
+				sd.cs.logger.Error(fmt.Sprintf("Unable to open stream to peer %s, %v", peerID, openErr))
+				sd.failPiece(piece, peerID)
+
+				return
+			}
+
+			clientProto = newClient
+			closeFn = newCloseFn
+		}
+
+		offset := piece * sd.state.PieceSize
+		length := sd.state.PieceSize
+		if offset+length > sd.state.FileSize {
+			length = sd.state.FileSize - offset
+		}
+
+		buffer.Reset()
+
+		// Pieces that take too long are abandoned, so other peers can pick them up
+		ctx, cancelFn := context.WithTimeout(sd.ctx, swarmPieceTimeout)
+		fileMetadata, wireBytes, fetchErr := sd.cs.fetchRange(
+			ctx,
+			peerID,
+			clientProto,
+			sd.workspaceInfo,
+			sd.credentials,
+			sd.state.FileChecksum,
+			sd.state.MerkleRoot,
+			offset,
+			length,
+			buffer,
+		)
+		cancelFn()
+		sd.addWireBytes(wireBytes)
+
+		if fetchErr == nil && int64(buffer.Len()) != length {
+			fetchErr = fmt.Errorf("piece size mismatch, expected %d found %d", length, buffer.Len())
+		}
+
+		if fetchErr != nil {
+			sd.cs.logger.Error(fmt.Sprintf("Unable to fetch piece %d from peer %s, %v", piece, peerID, fetchErr))
+			sd.cs.blameFetchError(sd.state.FileChecksum, peerID, fetchErr)
+
+			// The stream might be broken, open a new one for the next piece
+			closeFn()
+			clientProto = nil
+			closeFn = func() {}
+
+			if !sd.failPiece(piece, peerID) {
+				sd.cs.logger.Info(fmt.Sprintf("Dropping peer %s from the swarm", peerID))
+
+				return
+			}
+
+			continue
+		}
+
+		if completeErr := sd.completePiece(piece, peerID, fileMetadata.FileName, buffer.Bytes()); completeErr != nil {
+			sd.cs.logger.Error(fmt.Sprintf("Unable to save piece %d, %v", piece, completeErr))
+
+			return
+		}
+	}
+}
+
+// nextPiece assigns the next piece to the peer. Pieces are handed out in order.
+// Once there are no more unassigned pieces, idle peers also fetch pieces that are
+// still in flight on other (possibly slow) peers, and the first copy wins
+func (sd *swarmDownload) nextPiece(peerID peer.ID) (int64, bool) {
+	sd.piecesMux.Lock()
+	defer sd.piecesMux.Unlock()
+
+	for {
+		if sd.isDoneLocked() || sd.ctx.Err() != nil {
+			return 0, false
+		}
+
+		if len(sd.pending) > 0 {
+			piece := sd.pending[0]
+			sd.pending = sd.pending[1:]
+			sd.inFlight[piece]++
+
+			return piece, true
+		}
+
+		// Only peers that already proved themselves help out with
+		// pieces that are in flight somewhere else
+		if sd.provenPeers[peerID] {
+			for _, piece := range sd.sortedInFlight() {
+				if sd.inFlight[piece] == 1 {
+					sd.inFlight[piece]++
+
+					return piece, true
+				}
+			}
+		}
+
+		// Wait for something to change
+		sd.piecesCnd.Wait()
+	}
+}
+
+// sortedInFlight returns the in flight pieces in order
+func (sd *swarmDownload) sortedInFlight() []int64 {
+	pieces := make([]int64, 0, len(sd.inFlight))
+	for piece := range sd.inFlight {
+		pieces = append(pieces, piece)
+	}
+
+	sort.Slice(pieces, func(i, j int) bool {
+		return pieces[i] < pieces[j]
+	})
+
+	return pieces
+}
+
+// failPiece puts the failed piece back in the queue.
+// Returns false if the peer should no longer be used
+func (sd *swarmDownload) failPiece(piece int64, peerID peer.ID) bool {
+	sd.piecesMux.Lock()
+	defer sd.piecesMux.Unlock()
+	defer sd.piecesCnd.Broadcast()
+
+	sd.releasePieceLocked(piece)
+
+	if !sd.completed[piece] && sd.inFlight[piece] == 0 {
+		// Put the piece at the front, so it's picked up as soon as possible
+		sd.pending = append([]int64{piece}, sd.pending...)
+	}
+
+	sd.peerFails[peerID]++
+
+	return sd.peerFails[peerID] < swarmMaxPeerFailures
+}
+
+// completePiece writes the verified piece to the partial file
+func (sd *swarmDownload) completePiece(piece int64, peerID peer.ID, fileName string, data []byte) error {
+	sd.piecesMux.Lock()
+	defer sd.piecesMux.Unlock()
+	defer sd.piecesCnd.Broadcast()
+
+	sd.releasePieceLocked(piece)
+	sd.provenPeers[peerID] = true
+
+	if sd.completed[piece] {
+		// Another peer was faster
+		return nil
+	}
+
+	if _, writeErr := sd.partialFile.WriteAt(data, piece*sd.state.PieceSize); writeErr != nil {
+		// Give the piece back, the local disk is the problem
+		sd.pending = append([]int64{piece}, sd.pending...)
+
+		return writeErr
+	}
+
+	sd.completed[piece] = true
+	sd.state.CompletedPieces = append(sd.state.CompletedPieces, piece)
+	if sd.state.MerkleRoot == "" {
+		sd.state.addUnverifiedSource(peerID)
+	}
+	sd.fileName = fileName
+
+	if saveErr := sd.state.save(); saveErr != nil {
+		sd.cs.logger.Error(fmt.Sprintf("Unable to save download state, %v", saveErr))
+	}
+
+	return nil
+}
+
+// addWireBytes adds to the number of bytes received from peers
+func (sd *swarmDownload) addWireBytes(wireBytes int64) {
+	sd.piecesMux.Lock()
+	defer sd.piecesMux.Unlock()
+
+	sd.state.WireBytes += wireBytes
+}
+
+// releasePieceLocked marks that one less peer is fetching the piece
+func (sd *swarmDownload) releasePieceLocked(piece int64) {
+	sd.inFlight[piece]--
+	if sd.inFlight[piece] <= 0 {
+		delete(sd.inFlight, piece)
+	}
+}
+
+// isDone checks if all pieces are downloaded
+func (sd *swarmDownload) isDone() bool {
+	sd.piecesMux.Lock()
+	defer sd.piecesMux.Unlock()
+
+	return sd.isDoneLocked()
+}
+
+// isDoneLocked checks if all pieces are downloaded
+func (sd *swarmDownload) isDoneLocked() bool {
+	return int64(len(sd.completed)) == sd.numPieces
+}
+
+// saveState persists the swarm download progress
+func (sd *swarmDownload) saveState() {
+	sd.piecesMux.Lock()
+	defer sd.piecesMux.Unlock()
+
+	if saveErr := sd.state.save(); saveErr != nil {
+		sd.cs.logger.Error(fmt.Sprintf("Unable to save download state, %v", saveErr))
+	}
+}
@@ -0,0 +1,293 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testPieceSize = int64(4)  // size of a single piece in the swarm tests
+	testFileSize  = int64(10) // 3 pieces, the last one is shorter
+)
+
+// Swarm step actions
+const (
+	stepNext     = "next"     // the peer asks for a piece
+	stepFail     = "fail"     // the peer fails to deliver the piece
+	stepComplete = "complete" // the peer delivers the piece
+)
+
+// swarmStep is a single step a peer takes in a swarm download
+type swarmStep struct {
+	action   string
+	peerID   peer.ID
+	piece    int64 // expected piece for next steps, the handled piece otherwise
+	expected bool  // next steps: a piece is found, fail steps: the peer is kept
+}
+
+// pieceData returns the content of the piece in the swarm tests
+func pieceData(piece int64) []byte {
+	length := testPieceSize
+	if (piece+1)*testPieceSize > testFileSize {
+		length = testFileSize - piece*testPieceSize
+	}
+
+	return bytes.Repeat([]byte{byte('a' + piece)}, int(length))
+}
+
+// newTestSwarmDownload creates a swarm download that writes to a partial file in a temporary directory
+func newTestSwarmDownload(t *testing.T, merkleRoot string, completedPieces []int64) *swarmDownload {
+	t.Helper()
+
+	state := newDownloadState(t.TempDir(), "checksum")
+	state.PieceSize = testPieceSize
+	state.CompletedPieces = completedPieces
+	state.MerkleRoot = merkleRoot
+
+	sd := newSwarmDownload(
+		context.Background(),
+		&ClientServer{logger: hclog.NewNullLogger()},
+		nil,
+		nil,
+		state,
+		testFileSize,
+	)
+
+	partialFile, openErr := os.OpenFile(state.partialPath, os.O_CREATE|os.O_RDWR, 0600)
+	if openErr != nil {
+		t.Fatalf("Unable to open partial file, %v", openErr)
+	}
+
+	t.Cleanup(func() {
+		_ = partialFile.Close()
+	})
+
+	sd.partialFile = partialFile
+
+	return sd
+}
+
+func TestSwarmDownload_Pieces(t *testing.T) {
+	peerA, peerB, peerC := peer.ID("peer-a"), peer.ID("peer-b"), peer.ID("peer-c")
+
+	testTable := []struct {
+		name              string
+		merkleRoot        string
+		completedPieces   []int64 // pieces completed by a previous attempt
+		steps             []swarmStep
+		expectedPending   []int64
+		expectedCompleted []int64
+		expectedSources   []peer.ID
+		expectedFails     map[peer.ID]int
+	}{
+		{
+			"Pieces assigned in order",
+			"",
+			nil,
+			[]swarmStep{
+				{stepNext, peerA, 0, true},
+				{stepNext, peerB, 1, true},
+				{stepNext, peerC, 2, true},
+			},
+			[]int64{},
+			[]int64{},
+			nil,
+			map[peer.ID]int{},
+		},
+		{
+			"Resumed download skips completed pieces",
+			"",
+			[]int64{0, 2},
+			[]swarmStep{
+				{stepNext, peerA, 1, true},
+				{stepComplete, peerA, 1, false},
+				{stepNext, peerA, 0, false},
+			},
+			[]int64{},
+			[]int64{0, 1, 2},
+			[]peer.ID{peerA},
+			map[peer.ID]int{},
+		},
+		{
+			"Failed piece queued at the front",
+			"",
+			nil,
+			[]swarmStep{
+				{stepNext, peerA, 0, true},
+				{stepNext, peerB, 1, true},
+				{stepFail, peerA, 0, true},
+				{stepNext, peerC, 0, true},
+			},
+			[]int64{2},
+			[]int64{},
+			nil,
+			map[peer.ID]int{peerA: 1},
+		},
+		{
+			"Peer dropped after too many failures",
+			"",
+			nil,
+			[]swarmStep{
+				{stepNext, peerA, 0, true},
+				{stepFail, peerA, 0, true},
+				{stepNext, peerA, 0, true},
+				{stepFail, peerA, 0, true},
+				{stepNext, peerA, 0, true},
+				{stepFail, peerA, 0, false},
+			},
+			[]int64{0, 1, 2},
+			[]int64{},
+			nil,
+			map[peer.ID]int{peerA: swarmMaxPeerFailures},
+		},
+		{
+			"Pieces completed by several sources",
+			"",
+			nil,
+			[]swarmStep{
+				{stepNext, peerA, 0, true},
+				{stepNext, peerB, 1, true},
+				{stepNext, peerA, 2, true},
+				{stepComplete, peerA, 0, false},
+				{stepComplete, peerB, 1, false},
+				{stepComplete, peerA, 2, false},
+				{stepNext, peerB, 0, false},
+			},
+			[]int64{},
+			[]int64{0, 1, 2},
+			[]peer.ID{peerA, peerB},
+			map[peer.ID]int{},
+		},
+		{
+			"Verified pieces don't keep their sources",
+			"root",
+			nil,
+			[]swarmStep{
+				{stepNext, peerA, 0, true},
+				{stepNext, peerB, 1, true},
+				{stepNext, peerA, 2, true},
+				{stepComplete, peerA, 0, false},
+				{stepComplete, peerB, 1, false},
+				{stepComplete, peerA, 2, false},
+			},
+			[]int64{},
+			[]int64{0, 1, 2},
+			nil,
+			map[peer.ID]int{},
+		},
+		{
+			"Source disconnecting mid-piece",
+			"",
+			nil,
+			[]swarmStep{
+				{stepNext, peerA, 0, true},
+				{stepNext, peerB, 1, true},
+				{stepNext, peerC, 2, true},
+				{stepComplete, peerB, 1, false},
+				{stepFail, peerA, 0, true},
+				{stepNext, peerB, 0, true},
+				{stepComplete, peerB, 0, false},
+				{stepComplete, peerC, 2, false},
+			},
+			[]int64{},
+			[]int64{0, 1, 2},
+			[]peer.ID{peerB, peerC},
+			map[peer.ID]int{peerA: 1},
+		},
+		{
+			"Proven peer helps with a slow piece",
+			"",
+			nil,
+			[]swarmStep{
+				{stepNext, peerA, 0, true},
+				{stepNext, peerB, 1, true},
+				{stepNext, peerC, 2, true},
+				{stepComplete, peerB, 1, false},
+				{stepNext, peerB, 0, true},
+				{stepComplete, peerB, 0, false},
+				{stepComplete, peerA, 0, false}, // the slow copy is dropped
+				{stepComplete, peerC, 2, false},
+			},
+			[]int64{},
+			[]int64{0, 1, 2},
+			[]peer.ID{peerB, peerC},
+			map[peer.ID]int{},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			sd := newTestSwarmDownload(t, testCase.merkleRoot, testCase.completedPieces)
+
+			for index, step := range testCase.steps {
+				switch step.action {
+				case stepNext:
+					piece, found := sd.nextPiece(step.peerID)
+					assert.Equal(t, step.expected, found, "step %d", index)
+
+					if step.expected {
+						assert.Equal(t, step.piece, piece, "step %d", index)
+					}
+				case stepFail:
+					assert.Equal(t, step.expected, sd.failPiece(step.piece, step.peerID), "step %d", index)
+				case stepComplete:
+					assert.NoError(t, sd.completePiece(step.piece, step.peerID, "file.txt", pieceData(step.piece)))
+				}
+			}
+
+			assert.Equal(t, testCase.expectedPending, sd.pending)
+			assert.ElementsMatch(t, testCase.expectedCompleted, sd.state.CompletedPieces)
+			assert.Equal(t, testCase.expectedFails, sd.peerFails)
+
+			expectedSources := make([]string, 0, len(testCase.expectedSources))
+			for _, source := range testCase.expectedSources {
+				expectedSources = append(expectedSources, source.Pretty())
+			}
+
+			assert.ElementsMatch(t, expectedSources, sd.state.UnverifiedSources)
+
+			if !sd.isDone() || len(testCase.completedPieces) > 0 {
+				return
+			}
+
+			// Every piece ends up at its own offset, exactly once
+			assert.Len(t, sd.inFlight, 0)
+
+			expectedData := make([]byte, 0, testFileSize)
+			for piece := int64(0); piece < sd.numPieces; piece++ {
+				expectedData = append(expectedData, pieceData(piece)...)
+			}
+
+			partialData, readErr := os.ReadFile(sd.state.partialPath)
+			assert.NoError(t, readErr)
+			assert.Equal(t, expectedData, partialData)
+		})
+	}
+}
+
+func TestSwarmDownload_WaitForPiece(t *testing.T) {
+	peerA, peerB := peer.ID("peer-a"), peer.ID("peer-b")
+
+	sd := newTestSwarmDownload(t, "", []int64{1, 2})
+
+	piece, found := sd.nextPiece(peerA)
+	assert.True(t, found)
+	assert.Equal(t, int64(0), piece)
+
+	// Peers that didn't deliver anything wait for the piece to come back
+	assigned := make(chan int64)
+	go func() {
+		waitingPiece, _ := sd.nextPiece(peerB)
+		assigned <- waitingPiece
+	}()
+
+	// The first peer disconnects, and the waiting peer picks up its piece
+	assert.True(t, sd.failPiece(0, peerA))
+	assert.Equal(t, int64(0), <-assigned)
+}
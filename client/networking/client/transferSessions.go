@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/sessions"
+)
+
+// sessionLimits are the lifetime limits of the sessions opened by remote peers.
+// Challenges need to be solved within the verification timestamp window,
+// and requested files need to start transferring soon after they are requested
+var sessionLimits = map[string]sessions.Limits{
+	types.SESSION_TYPE_CHALLENGE: {
+		TTL:        30 * time.Second,
+		MaxPerPeer: 4,
+	},
+	types.SESSION_TYPE_DOWNLOAD: {
+		TTL:        time.Minute,
+		MaxPerPeer: 16,
+	},
+}
+
+// GetSessionManager returns the manager of the sessions opened by remote peers
+func (cs *ClientServer) GetSessionManager() *sessions.SessionManager {
+	return cs.sessionManager
+}
+
+// beginDownloadSession starts the transfer of a requested file.
+// The returned context is canceled when the session is canceled,
+// and the session ends once the returned function is called
+func (cs *ClientServer) beginDownloadSession(
+	ctx context.Context,
+	requestID string,
+) (fileMetadataWrapper, context.Context, func(), error) {
+	peerID, ok := streamPeerID(ctx)
+	if !ok {
+		cs.logger.Error("Unable to find the peer of the download stream")
+
+		return fileMetadataWrapper{}, nil, nil, errors.New("unknown peer")
+	}
+
+	session, sessionCtx, endSession, beginErr := cs.sessionManager.Begin(
+		ctx,
+		types.SESSION_TYPE_DOWNLOAD,
+		requestID,
+		peerID,
+	)
+	if beginErr != nil {
+		cs.logger.Error(fmt.Sprintf("Unable to start download %s for peer %s, %v", requestID, peerID.Pretty(), beginErr))
+
+		return fileMetadataWrapper{}, nil, nil, errors.New("unknown request")
+	}
+
+	return session.Value.(fileMetadataWrapper), sessionCtx, endSession, nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// toRetentionPolicy converts the workspace version settings into the file lister retention policy
+func toRetentionPolicy(settings types.VersionSettings) files.RetentionPolicy {
+	return files.RetentionPolicy{
+		Enabled:     settings.Enabled,
+		MaxVersions: settings.MaxVersions,
+		MaxAge:      time.Duration(settings.MaxAge) * time.Second,
+	}
+}
+
+// SetVersionRetention sets which previous versions of the shared files the workspace keeps
+func (cs *ClientServer) SetVersionRetention(settings types.VersionSettings) error {
+	mux := &cs.fileListerMux
+	mux.RLock()
+	fileLister := cs.fileListerMap[settings.WorkspaceMnemonic]
+	mux.RUnlock()
+
+	if fileLister == nil {
+		return fmt.Errorf("unable to find file lister %s", settings.WorkspaceMnemonic)
+	}
+
+	fileLister.SetRetentionPolicy(toRetentionPolicy(settings))
+
+	return nil
+}
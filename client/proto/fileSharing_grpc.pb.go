@@ -20,6 +20,8 @@ const _ = grpc.SupportPackageIsVersion7
 type FileSharingClient interface {
 	RequestFile(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (*FileDownloadMetadata, error)
 	DownloadFile(ctx context.Context, in *FileRequestID, opts ...grpc.CallOption) (FileSharing_DownloadFileClient, error)
+	DownloadDelta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (FileSharing_DownloadDeltaClient, error)
+	OfferFile(ctx context.Context, in *FileOffer, opts ...grpc.CallOption) (*FileOfferAck, error)
 }
 
 type fileSharingClient struct {
@@ -71,12 +73,55 @@ func (x *fileSharingDownloadFileClient) Recv() (*FileChunk, error) {
 	return m, nil
 }
 
+func (c *fileSharingClient) DownloadDelta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (FileSharing_DownloadDeltaClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileSharing_ServiceDesc.Streams[1], "/FileSharing/DownloadDelta", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileSharingDownloadDeltaClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileSharing_DownloadDeltaClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type fileSharingDownloadDeltaClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileSharingDownloadDeltaClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileSharingClient) OfferFile(ctx context.Context, in *FileOffer, opts ...grpc.CallOption) (*FileOfferAck, error) {
+	out := new(FileOfferAck)
+	err := c.cc.Invoke(ctx, "/FileSharing/OfferFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FileSharingServer is the server API for FileSharing service.
 // All implementations must embed UnimplementedFileSharingServer
 // for forward compatibility
 type FileSharingServer interface {
 	RequestFile(context.Context, *FileRequest) (*FileDownloadMetadata, error)
 	DownloadFile(*FileRequestID, FileSharing_DownloadFileServer) error
+	DownloadDelta(*DeltaRequest, FileSharing_DownloadDeltaServer) error
+	OfferFile(context.Context, *FileOffer) (*FileOfferAck, error)
 	mustEmbedUnimplementedFileSharingServer()
 }
 
@@ -90,6 +135,12 @@ func (UnimplementedFileSharingServer) RequestFile(context.Context, *FileRequest)
 func (UnimplementedFileSharingServer) DownloadFile(*FileRequestID, FileSharing_DownloadFileServer) error {
 	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
 }
+func (UnimplementedFileSharingServer) DownloadDelta(*DeltaRequest, FileSharing_DownloadDeltaServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadDelta not implemented")
+}
+func (UnimplementedFileSharingServer) OfferFile(context.Context, *FileOffer) (*FileOfferAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OfferFile not implemented")
+}
 func (UnimplementedFileSharingServer) mustEmbedUnimplementedFileSharingServer() {}
 
 // UnsafeFileSharingServer may be embedded to opt out of forward compatibility for this service.
@@ -142,6 +193,45 @@ func (x *fileSharingDownloadFileServer) Send(m *FileChunk) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _FileSharing_DownloadDelta_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DeltaRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSharingServer).DownloadDelta(m, &fileSharingDownloadDeltaServer{stream})
+}
+
+type FileSharing_DownloadDeltaServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type fileSharingDownloadDeltaServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileSharingDownloadDeltaServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FileSharing_OfferFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FileOffer)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSharingServer).OfferFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/FileSharing/OfferFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSharingServer).OfferFile(ctx, req.(*FileOffer))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // FileSharing_ServiceDesc is the grpc.ServiceDesc for FileSharing service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,6 +243,10 @@ var FileSharing_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RequestFile",
 			Handler:    _FileSharing_RequestFile_Handler,
 		},
+		{
+			MethodName: "OfferFile",
+			Handler:    _FileSharing_OfferFile_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -160,6 +254,11 @@ var FileSharing_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _FileSharing_DownloadFile_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "DownloadDelta",
+			Handler:       _FileSharing_DownloadDelta_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "proto/fileSharing.proto",
 }
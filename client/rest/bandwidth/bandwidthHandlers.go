@@ -0,0 +1,220 @@
+package bandwidth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+	"github.com/zivkovicmilos/peer_drop/storage"
+	"github.com/zivkovicmilos/peer_drop/throttle"
+)
+
+var errInvalidLimits = errors.New("invalid bandwidth limits")
+
+// GetBandwidthLimits fetches all the bandwidth limits
+func GetBandwidthLimits(w http.ResponseWriter, r *http.Request) {
+	throttler := servicehandler.GetServiceHandler().GetClientServer().GetThrottler()
+
+	response := types.BandwidthLimitsResponse{
+		Global:      limitsToResponse(throttler.GetGlobalLimits()),
+		DefaultPeer: limitsToResponse(throttler.GetDefaultPeerLimits()),
+		Workspaces:  make(map[string]types.BandwidthLimits),
+		Peers:       make(map[string]types.BandwidthLimits),
+	}
+
+	for mnemonic, limits := range throttler.GetWorkspaceLimits() {
+		response.Workspaces[mnemonic] = limitsToResponse(limits)
+	}
+
+	for peerID, limits := range throttler.GetPeerLimits() {
+		response.Peers[peerID] = limitsToResponse(limits)
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(response)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetGlobalLimits sets the global bandwidth limits
+func SetGlobalLimits(w http.ResponseWriter, r *http.Request) {
+	limits, parseErr := parseLimits(r)
+	if parseErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if saveErr := saveLimits(types.BANDWIDTH_SCOPE_GLOBAL, "", limits); saveErr != nil {
+		http.Error(w, "Unable to save bandwidth limits", http.StatusInternalServerError)
+		return
+	}
+
+	servicehandler.GetServiceHandler().GetClientServer().GetThrottler().SetGlobalLimits(limits)
+
+	encodeErr := json.NewEncoder(w).Encode("Global limits updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetDefaultPeerLimits sets the bandwidth limits of peers without their own limits
+func SetDefaultPeerLimits(w http.ResponseWriter, r *http.Request) {
+	limits, parseErr := parseLimits(r)
+	if parseErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if saveErr := saveLimits(types.BANDWIDTH_SCOPE_DEFAULT_PEER, "", limits); saveErr != nil {
+		http.Error(w, "Unable to save bandwidth limits", http.StatusInternalServerError)
+		return
+	}
+
+	servicehandler.GetServiceHandler().GetClientServer().GetThrottler().SetDefaultPeerLimits(limits)
+
+	encodeErr := json.NewEncoder(w).Encode("Default peer limits updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetWorkspaceLimits sets the bandwidth limits of a workspace
+func SetWorkspaceLimits(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	mnemonic := params["mnemonic"]
+
+	workspaceInfo, findErr := storage.GetStorageHandler().GetWorkspaceInfo(mnemonic)
+	if findErr != nil || workspaceInfo == nil {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+
+	limits, parseErr := parseLimits(r)
+	if parseErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if saveErr := saveLimits(types.BANDWIDTH_SCOPE_WORKSPACE, mnemonic, limits); saveErr != nil {
+		http.Error(w, "Unable to save bandwidth limits", http.StatusInternalServerError)
+		return
+	}
+
+	servicehandler.GetServiceHandler().GetClientServer().GetThrottler().SetWorkspaceLimits(mnemonic, limits)
+
+	encodeErr := json.NewEncoder(w).Encode("Workspace limits updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// RemoveWorkspaceLimits removes the bandwidth limits of a workspace
+func RemoveWorkspaceLimits(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	deleteErr := storage.GetStorageHandler().DeleteBandwidthLimits(types.BANDWIDTH_SCOPE_WORKSPACE, params["mnemonic"])
+	if deleteErr != nil {
+		http.Error(w, "Unable to delete bandwidth limits", http.StatusInternalServerError)
+		return
+	}
+
+	servicehandler.GetServiceHandler().GetClientServer().GetThrottler().RemoveWorkspaceLimits(params["mnemonic"])
+
+	encodeErr := json.NewEncoder(w).Encode("Workspace limits removed")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetPeerLimits sets the bandwidth limits of a single peer
+func SetPeerLimits(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	peerID, decodeErr := peer.Decode(params["peerId"])
+	if decodeErr != nil {
+		http.Error(w, "Invalid peer ID", http.StatusBadRequest)
+		return
+	}
+
+	limits, parseErr := parseLimits(r)
+	if parseErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if saveErr := saveLimits(types.BANDWIDTH_SCOPE_PEER, peerID.String(), limits); saveErr != nil {
+		http.Error(w, "Unable to save bandwidth limits", http.StatusInternalServerError)
+		return
+	}
+
+	servicehandler.GetServiceHandler().GetClientServer().GetThrottler().SetPeerLimits(peerID.String(), limits)
+
+	encodeErr := json.NewEncoder(w).Encode("Peer limits updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// RemovePeerLimits removes the bandwidth limits of a single peer
+func RemovePeerLimits(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	peerID, decodeErr := peer.Decode(params["peerId"])
+	if decodeErr != nil {
+		http.Error(w, "Invalid peer ID", http.StatusBadRequest)
+		return
+	}
+
+	deleteErr := storage.GetStorageHandler().DeleteBandwidthLimits(types.BANDWIDTH_SCOPE_PEER, peerID.String())
+	if deleteErr != nil {
+		http.Error(w, "Unable to delete bandwidth limits", http.StatusInternalServerError)
+		return
+	}
+
+	servicehandler.GetServiceHandler().GetClientServer().GetThrottler().RemovePeerLimits(peerID.String())
+
+	encodeErr := json.NewEncoder(w).Encode("Peer limits removed")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// saveLimits stores the bandwidth limits of the scope, so they are restored after a restart
+func saveLimits(scope string, id string, limits throttle.Limits) error {
+	return storage.GetStorageHandler().SaveBandwidthLimits(types.BandwidthLimitSettings{
+		Scope:        scope,
+		ID:           id,
+		UploadRate:   limits.UploadRate,
+		DownloadRate: limits.DownloadRate,
+	})
+}
+
+// parseLimits parses the bandwidth limits from the request body
+func parseLimits(r *http.Request) (throttle.Limits, error) {
+	var limits types.BandwidthLimits
+
+	if decodeErr := json.NewDecoder(r.Body).Decode(&limits); decodeErr != nil {
+		return throttle.Limits{}, decodeErr
+	}
+
+	if limits.UploadRate < 0 || limits.DownloadRate < 0 {
+		return throttle.Limits{}, errInvalidLimits
+	}
+
+	return throttle.Limits{
+		UploadRate:   limits.UploadRate,
+		DownloadRate: limits.DownloadRate,
+	}, nil
+}
+
+// limitsToResponse converts the throttler limits into the REST response format
+func limitsToResponse(limits throttle.Limits) types.BandwidthLimits {
+	return types.BandwidthLimits{
+		UploadRate:   limits.UploadRate,
+		DownloadRate: limits.DownloadRate,
+	}
+}
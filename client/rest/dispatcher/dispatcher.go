@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"syscall"
@@ -14,11 +15,21 @@ import (
 	"github.com/hashicorp/go-hclog"
 	"github.com/rs/cors"
 	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/rest/bandwidth"
 	"github.com/zivkovicmilos/peer_drop/rest/contacts"
 	"github.com/zivkovicmilos/peer_drop/rest/crypto"
+	"github.com/zivkovicmilos/peer_drop/rest/downloads"
+	"github.com/zivkovicmilos/peer_drop/rest/events"
 	"github.com/zivkovicmilos/peer_drop/rest/identities"
+	"github.com/zivkovicmilos/peer_drop/rest/ignore"
+	"github.com/zivkovicmilos/peer_drop/rest/mirror"
+	"github.com/zivkovicmilos/peer_drop/rest/offers"
 	"github.com/zivkovicmilos/peer_drop/rest/rendezvous"
 	"github.com/zivkovicmilos/peer_drop/rest/search"
+	"github.com/zivkovicmilos/peer_drop/rest/seeding"
+	"github.com/zivkovicmilos/peer_drop/rest/sessions"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/versions"
 	"github.com/zivkovicmilos/peer_drop/rest/workspaces"
 	"github.com/zivkovicmilos/peer_drop/storage"
 )
@@ -29,6 +40,16 @@ type Dispatcher struct {
 	router     *mux.Router
 	server     *http.Server
 	storage    *storage.StorageHandler
+
+	// Event streams stay open, so they are served separately,
+	// without the write timeout of the regular requests
+	eventsRouter *mux.Router
+	eventsServer *http.Server
+
+	// Context of the served requests, canceled on shutdown
+	// so long lived requests like event streams end
+	ctx        context.Context
+	cancelFunc context.CancelFunc
 }
 
 // NewDispatcher returns a new instance of the dispatcher
@@ -63,9 +84,11 @@ func (d *Dispatcher) Start(closeChannel chan struct{}) {
 	// Set up the router and server
 	//d.setupRouter()
 	d.router = mux.NewRouter()
+	d.eventsRouter = mux.NewRouter()
 
 	// Set up the middleware
 	d.router.Use(d.commonMiddleware)
+	d.eventsRouter.Use(d.commonMiddleware)
 
 	// Register the available endpoints
 	d.registerEndpoints()
@@ -73,44 +96,69 @@ func (d *Dispatcher) Start(closeChannel chan struct{}) {
 	corsConfig := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:3000", "http://localhost:4000"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		ExposedHeaders: []string{types.SeedErrorHeader},
 	})
 
-	d.setupServer(corsConfig.Handler(d.router))
+	d.setupServer(corsConfig.Handler(d.router), corsConfig.Handler(d.eventsRouter))
 
-	// Start the handle loop
-	go func() {
-		if err := d.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
-		}
-	}()
+	// Start the handle loops
+	for _, server := range []*http.Server{d.server, d.eventsServer} {
+		go func(server *http.Server) {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listen: %s\n", err)
+			}
+		}(server)
+	}
 
 	d.logger.Info(
 		fmt.Sprintf("HTTP server started on: %s:%d", d.nodeConfig.HostAddress, d.nodeConfig.HttpPort),
 	)
+	d.logger.Info(
+		fmt.Sprintf("Event stream server started on: %s:%d", d.nodeConfig.HostAddress, d.nodeConfig.EventsPort),
+	)
 
 	<-closeChannel
 	d.logger.Info("Caught stop signal...")
 
+	d.cancelFunc()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer func() {
 		cancel()
 	}()
 
-	if err := d.server.Shutdown(ctx); err != nil {
-		d.logger.Error(fmt.Sprintf("Unable to gracefully shut down server, %v", err))
+	for _, server := range []*http.Server{d.server, d.eventsServer} {
+		if err := server.Shutdown(ctx); err != nil {
+			d.logger.Error(fmt.Sprintf("Unable to gracefully shut down server, %v", err))
+		}
 	}
 
 	d.logger.Info("HTTP server stopped gracefully")
 }
 
-// setupServer is a helper method for creating the http server
-func (d *Dispatcher) setupServer(handler http.Handler) {
+// setupServer is a helper method for creating the http servers
+func (d *Dispatcher) setupServer(handler http.Handler, eventsHandler http.Handler) {
+	d.ctx, d.cancelFunc = context.WithCancel(context.Background())
+
+	baseContext := func(_ net.Listener) context.Context {
+		return d.ctx
+	}
 
 	d.server = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", d.nodeConfig.HostAddress, d.nodeConfig.HttpPort),
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
 		Handler:      handler,
+		BaseContext:  baseContext,
+	}
+
+	// There is no write timeout, since event streams stay open.
+	// Streams are kept alive with heartbeats, and end when the dispatcher stops
+	d.eventsServer = &http.Server{
+		Addr:        fmt.Sprintf("%s:%d", d.nodeConfig.HostAddress, d.nodeConfig.EventsPort),
+		ReadTimeout: time.Second * 15,
+		Handler:     eventsHandler,
+		BaseContext: baseContext,
 	}
 }
 
@@ -166,16 +214,70 @@ func (d *Dispatcher) registerEndpoints() {
 	d.router.HandleFunc("/api/workspaces/{mnemonic}", workspaces.LeaveWorkspace).Methods("DELETE")
 	d.router.HandleFunc("/api/workspaces/{mnemonic}/files", workspaces.GetWorkspaceFiles).Methods("GET")
 	d.router.HandleFunc("/api/workspaces/{mnemonic}/peers", workspaces.GetWorkspaceNumPeers).Methods("GET")
+	d.router.HandleFunc("/api/workspaces/{mnemonic}/conflicts", workspaces.GetWorkspaceConflicts).Methods("GET")
+	d.router.HandleFunc("/api/workspaces/{mnemonic}/rehash", workspaces.RehashWorkspaceFiles).Methods("POST")
 	d.router.HandleFunc("/api/join-workspace", workspaces.JoinWorkspace).Methods("POST")
 	d.router.HandleFunc("/api/workspaces/{mnemonic}", workspaces.GetWorkspaceInfo).Methods("GET")
 	d.router.HandleFunc("/api/workspaces/upload", workspaces.AddFileToWorkspace).Methods("POST")
 	d.router.HandleFunc("/api/workspaces/download", workspaces.DownloadWorkspaceFile).Methods("POST")
 
+	// Downloads
+	d.router.HandleFunc("/api/downloads", downloads.GetDownloads).Methods("GET")
+	d.router.HandleFunc("/api/downloads", downloads.CreateDownload).Methods("POST")
+	d.router.HandleFunc("/api/downloads/{jobId}", downloads.GetDownload).Methods("GET")
+	d.router.HandleFunc("/api/downloads/{jobId}", downloads.DeleteDownload).Methods("DELETE")
+	d.router.HandleFunc("/api/downloads/{jobId}/file", downloads.GetDownloadFile).Methods("GET")
+	d.router.HandleFunc("/api/downloads/{jobId}/pause", downloads.PauseDownload).Methods("PUT")
+	d.router.HandleFunc("/api/downloads/{jobId}/resume", downloads.ResumeDownload).Methods("PUT")
+	d.router.HandleFunc("/api/downloads/{jobId}/cancel", downloads.CancelDownload).Methods("PUT")
+	d.router.HandleFunc("/api/downloads/{jobId}/priority", downloads.SetDownloadPriority).Methods("PUT")
+
+	// Offers
+	d.router.HandleFunc("/api/offers", offers.GetFileOffers).Methods("GET")
+	d.router.HandleFunc("/api/offers", offers.CreateFileOffer).Methods("POST")
+	d.router.HandleFunc("/api/offers/{offerId}", offers.GetFileOffer).Methods("GET")
+	d.router.HandleFunc("/api/offers/{offerId}/accept", offers.AcceptFileOffer).Methods("PUT")
+	d.router.HandleFunc("/api/offers/{offerId}/reject", offers.RejectFileOffer).Methods("PUT")
+
+	// Mirror
+	d.router.HandleFunc("/api/mirror", mirror.GetMirrorStatuses).Methods("GET")
+	d.router.HandleFunc("/api/mirror/{mnemonic}", mirror.GetMirrorStatus).Methods("GET")
+	d.router.HandleFunc("/api/mirror/{mnemonic}", mirror.SetMirrorSettings).Methods("PUT")
+
+	// Versions
+	d.router.HandleFunc("/api/versions/{mnemonic}", versions.GetVersionSettings).Methods("GET")
+	d.router.HandleFunc("/api/versions/{mnemonic}", versions.SetVersionSettings).Methods("PUT")
+
+	// Seeding
+	d.router.HandleFunc("/api/seeding/{mnemonic}", seeding.GetSeedSettings).Methods("GET")
+	d.router.HandleFunc("/api/seeding/{mnemonic}", seeding.SetSeedSettings).Methods("PUT")
+
+	// Ignore patterns
+	d.router.HandleFunc("/api/ignore/{mnemonic}", ignore.GetIgnoreSettings).Methods("GET")
+	d.router.HandleFunc("/api/ignore/{mnemonic}", ignore.SetIgnoreSettings).Methods("PUT")
+
+	// Bandwidth
+	d.router.HandleFunc("/api/bandwidth", bandwidth.GetBandwidthLimits).Methods("GET")
+	d.router.HandleFunc("/api/bandwidth/global", bandwidth.SetGlobalLimits).Methods("PUT")
+	d.router.HandleFunc("/api/bandwidth/default-peer", bandwidth.SetDefaultPeerLimits).Methods("PUT")
+	d.router.HandleFunc("/api/bandwidth/workspaces/{mnemonic}", bandwidth.SetWorkspaceLimits).Methods("PUT")
+	d.router.HandleFunc("/api/bandwidth/workspaces/{mnemonic}", bandwidth.RemoveWorkspaceLimits).Methods("DELETE")
+	d.router.HandleFunc("/api/bandwidth/peers/{peerId}", bandwidth.SetPeerLimits).Methods("PUT")
+	d.router.HandleFunc("/api/bandwidth/peers/{peerId}", bandwidth.RemovePeerLimits).Methods("DELETE")
+
+	// Sessions
+	d.router.HandleFunc("/api/sessions", sessions.GetSessions).Methods("GET")
+	d.router.HandleFunc("/api/sessions/peers/{peerId}", sessions.CancelPeerSessions).Methods("DELETE")
+
 	// Rendezvous
 	d.router.HandleFunc("/api/rendezvous", rendezvous.GetRendezvousNodes).Methods("GET")
 	d.router.HandleFunc("/api/rendezvous", rendezvous.AddRendezvousNode).Methods("POST")
 	d.router.HandleFunc("/api/rendezvous", rendezvous.RemoveRendezvousNode).Methods("DELETE")
 
+	// Events, served on the event stream port
+	d.eventsRouter.HandleFunc("/api/events", events.StreamEvents).Methods("GET")
+	d.eventsRouter.NotFoundHandler = http.HandlerFunc(NotFoundHandler)
+
 	// Search
 	d.router.HandleFunc("/api/search", search.GetSearchResults).Methods("GET")
 
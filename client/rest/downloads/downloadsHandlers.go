@@ -0,0 +1,203 @@
+package downloads
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	downloadmanager "github.com/zivkovicmilos/peer_drop/downloads"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+)
+
+// GetDownloads fetches all the download jobs, with their progress
+func GetDownloads(w http.ResponseWriter, r *http.Request) {
+	jobs := servicehandler.GetServiceHandler().GetDownloadManager().GetJobs()
+
+	encodeErr := json.NewEncoder(w).Encode(types.DownloadJobsResponse{
+		Data:  jobs,
+		Count: len(jobs),
+	})
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetDownload fetches a single download job
+func GetDownload(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	job, jobErr := servicehandler.GetServiceHandler().GetDownloadManager().GetJob(params["jobId"])
+	if jobErr != nil {
+		writeJobError(w, jobErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(job)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// CreateDownload queues a new file download
+func CreateDownload(w http.ResponseWriter, r *http.Request) {
+	var downloadRequest types.NewDownloadRequest
+
+	decodeErr := json.NewDecoder(r.Body).Decode(&downloadRequest)
+	if decodeErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	job, addErr := servicehandler.GetServiceHandler().GetDownloadManager().AddJob(
+		downloadRequest.WorkspaceMnemonic,
+		downloadRequest.FileChecksum,
+		downloadRequest.Priority,
+		downloadRequest.Seed,
+	)
+	if addErr != nil {
+		writeJobError(w, addErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(job)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// PauseDownload pauses a download job
+func PauseDownload(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if pauseErr := servicehandler.GetServiceHandler().GetDownloadManager().PauseJob(params["jobId"]); pauseErr != nil {
+		writeJobError(w, pauseErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Download paused")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// ResumeDownload resumes a paused or failed download job
+func ResumeDownload(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if resumeErr := servicehandler.GetServiceHandler().GetDownloadManager().ResumeJob(params["jobId"]); resumeErr != nil {
+		writeJobError(w, resumeErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Download resumed")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// CancelDownload cancels a download job
+func CancelDownload(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if cancelErr := servicehandler.GetServiceHandler().GetDownloadManager().CancelJob(params["jobId"]); cancelErr != nil {
+		writeJobError(w, cancelErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Download canceled")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetDownloadPriority changes the priority of a download job
+func SetDownloadPriority(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	var priorityRequest types.DownloadPriorityRequest
+
+	decodeErr := json.NewDecoder(r.Body).Decode(&priorityRequest)
+	if decodeErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if priorityErr := servicehandler.GetServiceHandler().GetDownloadManager().SetJobPriority(
+		params["jobId"],
+		priorityRequest.Priority,
+	); priorityErr != nil {
+		writeJobError(w, priorityErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Download priority updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// DeleteDownload removes a download job from the list
+func DeleteDownload(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if removeErr := servicehandler.GetServiceHandler().GetDownloadManager().RemoveJob(params["jobId"]); removeErr != nil {
+		writeJobError(w, removeErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Download removed")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetDownloadFile serves the file of a completed download job
+func GetDownloadFile(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	job, jobErr := servicehandler.GetServiceHandler().GetDownloadManager().GetJob(params["jobId"])
+	if jobErr != nil {
+		writeJobError(w, jobErr)
+		return
+	}
+
+	if job.Status != types.DOWNLOAD_STATUS_COMPLETED {
+		http.Error(w, "Download not completed", http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(job.FilePath)
+	if err != nil {
+		http.Error(w, "Unable to open downloaded file", http.StatusInternalServerError)
+		return
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(job.FileName))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+	w.Header().Set("Expires", "0")
+
+	http.ServeContent(w, r, job.FilePath, time.Now(), f)
+}
+
+// writeJobError writes the download manager error with the appropriate status code
+func writeJobError(w http.ResponseWriter, err error) {
+	switch err {
+	case downloadmanager.ErrJobNotFound:
+		http.Error(w, "Download not found", http.StatusNotFound)
+	case downloadmanager.ErrInvalidJobState:
+		http.Error(w, "Invalid download state", http.StatusConflict)
+	case downloadmanager.ErrInvalidJobRequest:
+		http.Error(w, "Invalid download request", http.StatusBadRequest)
+	default:
+		http.Error(w, "Unable to handle download", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+)
+
+const (
+	subscriptionBufferSize = 64               // events buffered for a single stream
+	heartbeatInterval      = 15 * time.Second // interval at which idle streams are kept alive
+)
+
+// StreamEvents streams the client events as server-sent events.
+// Events can be filtered by workspace with the mnemonic query param,
+// and by type with a comma separated list in the types query param
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	mnemonic := ""
+	if mnemonicParam := r.URL.Query().Get("mnemonic"); mnemonicParam != "" {
+		outputArr := strings.Split(mnemonicParam, "-")
+		mnemonic = strings.Join(outputArr[:], " ")
+	}
+
+	eventTypes := make(map[string]bool)
+	if typesParam := r.URL.Query().Get("types"); typesParam != "" {
+		for _, eventType := range strings.Split(typesParam, ",") {
+			eventTypes[strings.TrimSpace(eventType)] = true
+		}
+	}
+
+	subscription, unsubscribe := servicehandler.GetServiceHandler().GetClientServer().GetEventBus().Subscribe(
+		subscriptionBufferSize,
+	)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			// Comments are ignored by the clients, but keep the connection alive
+			if _, writeErr := fmt.Fprint(w, ": heartbeat\n\n"); writeErr != nil {
+				return
+			}
+
+			flusher.Flush()
+		case event, open := <-subscription:
+			if !open {
+				return
+			}
+
+			if mnemonic != "" && event.WorkspaceMnemonic != mnemonic {
+				continue
+			}
+
+			if len(eventTypes) > 0 && !eventTypes[event.Type] {
+				continue
+			}
+
+			data, marshalErr := json.Marshal(event)
+			if marshalErr != nil {
+				continue
+			}
+
+			if _, writeErr := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); writeErr != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
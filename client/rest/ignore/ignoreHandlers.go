@@ -0,0 +1,99 @@
+package ignore
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/utils"
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+// GetIgnoreSettings fetches the ignore patterns of a workspace
+func GetIgnoreSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	mnemonic := workspaceInfo.Mnemonic
+
+	settings, findErr := storage.GetStorageHandler().GetIgnoreSettings(mnemonic)
+	if findErr != nil {
+		http.Error(w, "Unable to fetch ignore settings", http.StatusInternalServerError)
+		return
+	}
+
+	if settings == nil {
+		// Only the default patterns apply
+		settings = &types.IgnoreSettings{
+			WorkspaceMnemonic: mnemonic,
+			Patterns:          make([]string, 0),
+			MinFileAge:        int64(config.MinFileAge),
+		}
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(settings)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetIgnoreSettings sets which files in the sharing directory of a workspace are not shared
+func SetIgnoreSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	mnemonic := workspaceInfo.Mnemonic
+
+	var settingsRequest types.IgnoreSettingsRequest
+
+	decodeErr := json.NewDecoder(r.Body).Decode(&settingsRequest)
+	if decodeErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if settingsRequest.MinFileAge < 0 {
+		http.Error(w, "Invalid ignore settings", http.StatusBadRequest)
+		return
+	}
+
+	patterns := make([]string, 0, len(settingsRequest.Patterns))
+	for _, pattern := range settingsRequest.Patterns {
+		if strings.ContainsAny(pattern, "\r\n") {
+			http.Error(w, "Invalid ignore pattern", http.StatusBadRequest)
+			return
+		}
+
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	settings := types.IgnoreSettings{
+		WorkspaceMnemonic: mnemonic,
+		Patterns:          patterns,
+		MinFileAge:        settingsRequest.MinFileAge,
+	}
+
+	if saveErr := storage.GetStorageHandler().SaveIgnoreSettings(settings); saveErr != nil {
+		http.Error(w, "Unable to save ignore settings", http.StatusInternalServerError)
+		return
+	}
+
+	if setErr := servicehandler.GetServiceHandler().GetClientServer().SetIgnoreSettings(settings); setErr != nil {
+		http.Error(w, "Unable to apply ignore settings", http.StatusInternalServerError)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Ignore settings updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
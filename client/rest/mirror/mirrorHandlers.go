@@ -0,0 +1,73 @@
+package mirror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/utils"
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+// GetMirrorStatuses fetches the mirror status of all workspaces with mirror settings
+func GetMirrorStatuses(w http.ResponseWriter, r *http.Request) {
+	statuses := servicehandler.GetServiceHandler().GetMirrorService().GetStatuses()
+
+	encodeErr := json.NewEncoder(w).Encode(types.MirrorStatusesResponse{
+		Data:  statuses,
+		Count: len(statuses),
+	})
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetMirrorStatus fetches the mirror status of a single workspace
+func GetMirrorStatus(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	mnemonic := workspaceInfo.Mnemonic
+
+	status := servicehandler.GetServiceHandler().GetMirrorService().GetStatus(mnemonic)
+
+	encodeErr := json.NewEncoder(w).Encode(status)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetMirrorSettings enables or disables the auto-mirror mode of a workspace
+func SetMirrorSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	mnemonic := workspaceInfo.Mnemonic
+
+	var settingsRequest types.MirrorSettingsRequest
+
+	decodeErr := json.NewDecoder(r.Body).Decode(&settingsRequest)
+	if decodeErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if setErr := servicehandler.GetServiceHandler().GetMirrorService().SetSettings(types.MirrorSettings{
+		WorkspaceMnemonic: mnemonic,
+		Enabled:           settingsRequest.Enabled,
+		RemoveMissing:     settingsRequest.RemoveMissing,
+	}); setErr != nil {
+		http.Error(w, "Unable to save mirror settings", http.StatusInternalServerError)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Mirror settings updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
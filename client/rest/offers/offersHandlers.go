@@ -0,0 +1,140 @@
+package offers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zivkovicmilos/peer_drop/networking/client"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+)
+
+// offerTimeout is the time the receiving peer has to take the offer
+const offerTimeout = 30 * time.Second
+
+// GetFileOffers fetches the files pushed by other peers
+func GetFileOffers(w http.ResponseWriter, r *http.Request) {
+	offers := servicehandler.GetServiceHandler().GetClientServer().GetFileOffers()
+
+	encodeErr := json.NewEncoder(w).Encode(types.FileOffersResponse{
+		Data:  offers,
+		Count: len(offers),
+	})
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetFileOffer fetches a single incoming file offer
+func GetFileOffer(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	offer, offerErr := servicehandler.GetServiceHandler().GetClientServer().GetFileOffer(params["offerId"])
+	if offerErr != nil {
+		writeOfferError(w, offerErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(offer)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// CreateFileOffer pushes a shared file to a single verified peer
+func CreateFileOffer(w http.ResponseWriter, r *http.Request) {
+	var offerRequest types.NewFileOfferRequest
+
+	decodeErr := json.NewDecoder(r.Body).Decode(&offerRequest)
+	if decodeErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), offerTimeout)
+	defer cancel()
+
+	offerID, offerErr := servicehandler.GetServiceHandler().GetClientServer().SendFileOffer(
+		ctx,
+		offerRequest.WorkspaceMnemonic,
+		offerRequest.FileChecksum,
+		offerRequest.PeerID,
+	)
+	if offerErr != nil {
+		writeOfferError(w, offerErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(types.NewFileOfferResponse{OfferID: offerID})
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// AcceptFileOffer accepts an incoming file offer, and queues the file download
+func AcceptFileOffer(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientServer := servicehandler.GetServiceHandler().GetClientServer()
+
+	// The offer is claimed first, so concurrent accepts can't queue the download twice
+	offer, acceptErr := clientServer.AcceptFileOffer(params["offerId"])
+	if acceptErr != nil {
+		writeOfferError(w, acceptErr)
+		return
+	}
+
+	job, addErr := servicehandler.GetServiceHandler().GetDownloadManager().AddJob(
+		offer.WorkspaceMnemonic,
+		offer.FileChecksum,
+		0,
+		false,
+	)
+	if addErr != nil {
+		clientServer.ReleaseFileOffer(offer.ID)
+
+		http.Error(w, "Unable to queue download", http.StatusInternalServerError)
+		return
+	}
+
+	// The job is queued either way, the offer only keeps track of it
+	_ = clientServer.SetFileOfferJob(offer.ID, job.ID)
+
+	encodeErr := json.NewEncoder(w).Encode(job)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// RejectFileOffer rejects an incoming file offer
+func RejectFileOffer(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	if rejectErr := servicehandler.GetServiceHandler().GetClientServer().RejectFileOffer(params["offerId"]); rejectErr != nil {
+		writeOfferError(w, rejectErr)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Offer rejected")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// writeOfferError writes the file offer error with the appropriate status code
+func writeOfferError(w http.ResponseWriter, err error) {
+	switch err {
+	case client.ErrOfferNotFound:
+		http.Error(w, "Offer not found", http.StatusNotFound)
+	case client.ErrInvalidOfferState:
+		http.Error(w, "Invalid offer state", http.StatusConflict)
+	case client.ErrUnknownPeer:
+		http.Error(w, "Unknown peer", http.StatusBadRequest)
+	case client.ErrUnknownFile:
+		http.Error(w, "Unknown file", http.StatusBadRequest)
+	default:
+		http.Error(w, "Unable to handle offer", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,72 @@
+package seeding
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zivkovicmilos/peer_drop/config"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/utils"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+// GetSeedSettings fetches the re-seeding settings of a workspace
+func GetSeedSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	settings, findErr := storage.GetStorageHandler().GetSeedSettings(workspaceInfo.Mnemonic)
+	if findErr != nil {
+		http.Error(w, "Unable to fetch seed settings", http.StatusInternalServerError)
+		return
+	}
+
+	if settings == nil {
+		// Downloaded files aren't seeded by default
+		settings = &types.SeedSettings{WorkspaceMnemonic: workspaceInfo.Mnemonic}
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(settings)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetSeedSettings sets if the files a workspace downloads are shared back with it
+func SetSeedSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	var settingsRequest types.SeedSettingsRequest
+
+	decodeErr := json.NewDecoder(r.Body).Decode(&settingsRequest)
+	if decodeErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	// Only nodes that publish their file list can act as a source
+	if settingsRequest.Enabled && workspaceInfo.WorkspaceType != config.WORKSPACE_TYPE_SEND_RECEIVE {
+		http.Error(w, "Seeding is only available in send-receive workspaces", http.StatusBadRequest)
+		return
+	}
+
+	settings := types.SeedSettings{
+		WorkspaceMnemonic: workspaceInfo.Mnemonic,
+		Enabled:           settingsRequest.Enabled,
+	}
+
+	if saveErr := storage.GetStorageHandler().SaveSeedSettings(settings); saveErr != nil {
+		http.Error(w, "Unable to save seed settings", http.StatusInternalServerError)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Seed settings updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,43 @@
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+)
+
+// GetSessions fetches the number of open sessions of every session type
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	stats := servicehandler.GetServiceHandler().GetClientServer().GetSessionManager().GetStats()
+
+	encodeErr := json.NewEncoder(w).Encode(types.SessionsResponse{
+		Data:  stats,
+		Count: len(stats),
+	})
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// CancelPeerSessions cancels the pending sessions and running transfers of a peer
+func CancelPeerSessions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	peerID, decodeErr := peer.Decode(params["peerId"])
+	if decodeErr != nil {
+		http.Error(w, "Invalid peer ID", http.StatusBadRequest)
+		return
+	}
+
+	canceled := servicehandler.GetServiceHandler().GetClientServer().GetSessionManager().CancelPeer(peerID)
+
+	encodeErr := json.NewEncoder(w).Encode(fmt.Sprintf("Canceled %d sessions", canceled))
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,31 @@
+package types
+
+// BandwidthLimits are the file sharing rates in bytes per second, 0 means unlimited
+type BandwidthLimits struct {
+	UploadRate   int64 `json:"uploadRate"`
+	DownloadRate int64 `json:"downloadRate"`
+}
+
+type BandwidthLimitsResponse struct {
+	Global      BandwidthLimits            `json:"global"`
+	DefaultPeer BandwidthLimits            `json:"defaultPeer"`
+	Workspaces  map[string]BandwidthLimits `json:"workspaces"`
+	Peers       map[string]BandwidthLimits `json:"peers"`
+}
+
+// Bandwidth limit scopes
+const (
+	BANDWIDTH_SCOPE_GLOBAL       = "global"
+	BANDWIDTH_SCOPE_DEFAULT_PEER = "defaultPeer"
+	BANDWIDTH_SCOPE_WORKSPACE    = "workspace"
+	BANDWIDTH_SCOPE_PEER         = "peer"
+)
+
+// BandwidthLimitSettings are the stored bandwidth limits of a single scope.
+// The ID is the workspace mnemonic or the peer ID, and empty for the other scopes
+type BandwidthLimitSettings struct {
+	Scope        string
+	ID           string
+	UploadRate   int64
+	DownloadRate int64
+}
@@ -0,0 +1,12 @@
+package types
+
+// ChecksumCacheEntry is the cached checksum of a shared file.
+// The entry is only valid while the file keeps the same size, modification time and inode
+type ChecksumCacheEntry struct {
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	ModTime      int64  `json:"modTime"` // unix nano
+	Inode        uint64 `json:"inode"`
+	Checksum     string `json:"checksum"`
+	MerkleLeaves []byte `json:"-"` // leaf hashes of the file Merkle tree, one after the other
+}
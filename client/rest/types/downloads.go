@@ -0,0 +1,54 @@
+package types
+
+// Download job statuses
+var (
+	DOWNLOAD_STATUS_QUEUED    = "queued"
+	DOWNLOAD_STATUS_RUNNING   = "running"
+	DOWNLOAD_STATUS_PAUSED    = "paused"
+	DOWNLOAD_STATUS_COMPLETED = "completed"
+	DOWNLOAD_STATUS_FAILED    = "failed"
+	DOWNLOAD_STATUS_CANCELED  = "canceled"
+)
+
+// Download job error types
+var (
+	DOWNLOAD_ERROR_NETWORK   = "network"   // the file couldn't be fetched from the peers
+	DOWNLOAD_ERROR_INTEGRITY = "integrity" // the fetched data failed verification
+)
+
+type DownloadJob struct {
+	ID                string `json:"id"`
+	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	FileChecksum      string `json:"fileChecksum"`
+	FileName          string `json:"fileName"`
+	FilePath          string `json:"-"`
+	Status            string `json:"status"`
+	Priority          int    `json:"priority"`  // jobs with a higher priority are started first
+	DateAdded         int64  `json:"dateAdded"` // unix
+	Attempts          int    `json:"attempts"`
+	Error             string `json:"error"`
+	ErrorType         string `json:"errorType"`
+	Seed              bool   `json:"seed"`    // the downloaded file is shared back with the workspace
+	Seeding           bool   `json:"seeding"` // the downloaded file is shared by the node
+
+	// Progress //
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+	BytesTotal      int64 `json:"bytesTotal"`
+	BytesOnWire     int64 `json:"bytesOnWire"` // bytes received from peers, after compression
+}
+
+type NewDownloadRequest struct {
+	FileChecksum      string `json:"fileChecksum"`
+	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	Priority          int    `json:"priority"`
+	Seed              bool   `json:"seed"`
+}
+
+type DownloadPriorityRequest struct {
+	Priority int `json:"priority"`
+}
+
+type DownloadJobsResponse struct {
+	Data  []*DownloadJob `json:"data"`
+	Count int            `json:"count"`
+}
@@ -0,0 +1,33 @@
+package types
+
+// Event types
+var (
+	EVENT_PEER_VERIFIED         = "peer-verified"
+	EVENT_PEER_LEFT             = "peer-left"
+	EVENT_FILE_LIST_CHANGED     = "file-list-changed"
+	EVENT_DOWNLOAD_PROGRESS     = "download-progress"
+	EVENT_DOWNLOAD_COMPLETE     = "download-complete"
+	EVENT_WORKSPACE_INITIALIZED = "workspace-initialized"
+)
+
+type Event struct {
+	Type              string      `json:"type"`
+	WorkspaceMnemonic string      `json:"workspaceMnemonic"`
+	Timestamp         int64       `json:"timestamp"` // unix
+	Data              interface{} `json:"data,omitempty"`
+}
+
+type PeerEventData struct {
+	PeerID string `json:"peerID"`
+}
+
+type FileListEventData struct {
+	NumFiles int `json:"numFiles"`
+}
+
+type DownloadEventData struct {
+	FileChecksum    string `json:"fileChecksum"`
+	FileName        string `json:"fileName,omitempty"`
+	BytesDownloaded int64  `json:"bytesDownloaded"`
+	BytesTotal      int64  `json:"bytesTotal"`
+}
@@ -0,0 +1,14 @@
+package types
+
+// IgnoreSettings decide which files in the sharing directory of a workspace are not shared.
+// They are applied along with the patterns in the .peerdropignore file of the directory
+type IgnoreSettings struct {
+	WorkspaceMnemonic string   `json:"workspaceMnemonic"`
+	Patterns          []string `json:"patterns"`   // gitignore-style patterns
+	MinFileAge        int64    `json:"minFileAge"` // seconds since the last change before a file is shared
+}
+
+type IgnoreSettingsRequest struct {
+	Patterns   []string `json:"patterns"`
+	MinFileAge int64    `json:"minFileAge"`
+}
@@ -0,0 +1,28 @@
+package types
+
+// MirrorSettings are the auto-mirror settings of a workspace
+type MirrorSettings struct {
+	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	Enabled           bool   `json:"enabled"`       // new files are downloaded automatically
+	RemoveMissing     bool   `json:"removeMissing"` // files no peer advertises anymore are removed
+}
+
+type MirrorStatus struct {
+	MirrorSettings
+
+	MirrorDirectory string `json:"mirrorDirectory"`
+	MirroredFiles   int    `json:"mirroredFiles"`
+	PendingFiles    int    `json:"pendingFiles"`
+	FailedFiles     int    `json:"failedFiles"`  // files whose download failed
+	SkippedFiles    int    `json:"skippedFiles"` // files whose download was canceled or removed by the user
+}
+
+type MirrorSettingsRequest struct {
+	Enabled       bool `json:"enabled"`
+	RemoveMissing bool `json:"removeMissing"`
+}
+
+type MirrorStatusesResponse struct {
+	Data  []MirrorStatus `json:"data"`
+	Count int            `json:"count"`
+}
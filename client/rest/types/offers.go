@@ -0,0 +1,39 @@
+package types
+
+// File offer statuses
+var (
+	OFFER_STATUS_PENDING  = "pending"
+	OFFER_STATUS_ACCEPTED = "accepted"
+)
+
+type FileOffer struct {
+	ID                string `json:"id"`
+	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	FileChecksum      string `json:"fileChecksum"`
+	FileName          string `json:"fileName"`
+	FileSize          int64  `json:"fileSize"` // in bytes
+	Status            string `json:"status"`
+	DateReceived      int64  `json:"dateReceived"`  // unix
+	DownloadJobID     string `json:"downloadJobID"` // set once the offer is accepted
+
+	// Sender //
+	SenderPeerID      string `json:"senderPeerID"`
+	SenderName        string `json:"senderName"`        // contact name, or the name reported by the sender
+	SenderPublicKeyID string `json:"senderPublicKeyID"` // key the sender passed verification with
+	SenderContactID   string `json:"senderContactID"`   // contact with the same public key ID, if any
+}
+
+type FileOffersResponse struct {
+	Data  []*FileOffer `json:"data"`
+	Count int          `json:"count"`
+}
+
+type NewFileOfferRequest struct {
+	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	FileChecksum      string `json:"fileChecksum"`
+	PeerID            string `json:"peerID"`
+}
+
+type NewFileOfferResponse struct {
+	OfferID string `json:"offerID"`
+}
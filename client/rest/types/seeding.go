@@ -0,0 +1,11 @@
+package types
+
+// SeedSettings decide if the files a workspace downloads are shared back with it
+type SeedSettings struct {
+	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	Enabled           bool   `json:"enabled"`
+}
+
+type SeedSettingsRequest struct {
+	Enabled bool `json:"enabled"`
+}
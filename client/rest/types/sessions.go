@@ -0,0 +1,18 @@
+package types
+
+// Transfer session types
+var (
+	SESSION_TYPE_CHALLENGE = "challenge"
+	SESSION_TYPE_DOWNLOAD  = "download"
+)
+
+type SessionStats struct {
+	SessionType string `json:"sessionType"`
+	Pending     int    `json:"pending"` // sessions waiting to be used
+	Active      int    `json:"active"`  // sessions with a running transfer
+}
+
+type SessionsResponse struct {
+	Data  []SessionStats `json:"data"`
+	Count int            `json:"count"`
+}
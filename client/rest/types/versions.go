@@ -0,0 +1,15 @@
+package types
+
+// VersionSettings decide which previous versions of the shared files a workspace keeps
+type VersionSettings struct {
+	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	Enabled           bool   `json:"enabled"`
+	MaxVersions       int    `json:"maxVersions"` // previous versions kept per file, 0 means no limit
+	MaxAge            int64  `json:"maxAge"`      // seconds a replaced version is kept for, 0 means no limit
+}
+
+type VersionSettingsRequest struct {
+	Enabled     bool  `json:"enabled"`
+	MaxVersions int   `json:"maxVersions"`
+	MaxAge      int64 `json:"maxAge"`
+}
@@ -5,6 +5,7 @@ type NewWorkspaceRequest struct {
 	WorkspaceType              string `json:"workspaceType"`
 	WorkspaceAccessControlType string `json:"workspaceAccessControlType"`
 	BaseWorkspaceOwnerKeyID    string `json:"baseWorkspaceOwnerKeyID"`
+	HashAlgorithm              string `json:"hashAlgorithm"` // multihash name, the default algorithm if empty
 
 	WorkspaceAccessControl NewWorkspaceACType `json:"workspaceAccessControl"`
 	WorkspaceOwners        []string           `json:"workspaceAdditionalOwnerPublicKeys"`
@@ -46,18 +47,41 @@ type WorkspaceDetailedResponse struct {
 	WorkspaceMnemonic string `json:"workspaceMnemonic"`
 	WorkspaceName     string `json:"workspaceName"`
 	WorkspaceType     string `json:"workspaceType"`
+	HashAlgorithm     string `json:"hashAlgorithm"`
 
 	WorkspaceFiles []FileInfo `json:"workspaceFiles"`
 
+	// Folder browsing //
+	// Only set when the files are browsed by folder
+	CurrentPath      string       `json:"currentPath"`
+	WorkspaceFolders []FolderInfo `json:"workspaceFolders,omitempty"`
+
 	WorkspaceOwnerKeyIDs []string `json:"workspaceOwnerKeyIDs"`
 }
 
 type FileInfo struct {
 	Name         string `json:"name"`
+	Path         string `json:"path"` // relative directory of the file, empty for the root
 	Extension    string `json:"extension"`
 	Size         int64  `json:"size"`
 	DateModified int64  `json:"dateModified"`
 	Checksum     string `json:"checksum"`
+	Algorithm    string `json:"algorithm"` // hash algorithm of the checksum
+	Version      int64  `json:"version"`   // 0 if the workspace doesn't retain versions
+	Retained     bool   `json:"retained"`  // set for retained previous versions
+
+	// Conflicts //
+	// Set when peers share different files under the same path,
+	// along with the peers that share this one
+	Conflict bool       `json:"conflict"`
+	Peers    []FilePeer `json:"peers,omitempty"`
+}
+
+type FolderInfo struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	NumFiles int    `json:"numFiles"` // number of files in the folder tree
+	Size     int64  `json:"size"`     // size of the files in the folder tree
 }
 
 type WorkspacePeersResponse struct {
@@ -67,4 +91,26 @@ type WorkspacePeersResponse struct {
 type FileDownloadRequest struct {
 	FileChecksum      string `json:"fileChecksum"`
 	WorkspaceMnemonic string `json:"workspaceMnemonic"`
+	Seed              bool   `json:"seed"` // keep the file, and share it back with the workspace
+}
+
+// SeedErrorHeader is set on a file download response if the file
+// was downloaded, but couldn't be shared back with the workspace
+const SeedErrorHeader = "X-Seed-Error"
+
+type FilePeer struct {
+	PeerID      string `json:"peerID"`
+	PublicKeyID string `json:"publicKeyID"` // identity the peer verified with, empty for password workspaces
+	ContactID   string `json:"contactID"`   // set if the identity is a saved contact
+	ContactName string `json:"contactName"`
+}
+
+type FileConflict struct {
+	Path  string     `json:"path"` // relative path the files are shared under
+	Files []FileInfo `json:"files"`
+}
+
+type FileConflictsResponse struct {
+	Data  []FileConflict `json:"data"`
+	Count int            `json:"count"`
 }
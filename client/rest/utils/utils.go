@@ -1,6 +1,13 @@
 package utils
 
-import "strconv"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/zivkovicmilos/peer_drop/proto"
+)
 
 type PaginationLimits struct {
 	Limit int
@@ -91,3 +98,25 @@ func ParseSortParams(sortParam string, sortDirection string) SortParams {
 		return DefaultSort
 	}
 }
+
+// WorkspaceInfoGetter looks up the saved workspace info
+type WorkspaceInfoGetter interface {
+	GetWorkspaceInfo(mnemonic string) (*proto.WorkspaceInfo, error)
+}
+
+// FindWorkspace resolves the workspace from the request,
+// and writes the error response if the workspace is unknown
+func FindWorkspace(w http.ResponseWriter, r *http.Request, getter WorkspaceInfoGetter) (*proto.WorkspaceInfo, bool) {
+	params := mux.Vars(r)
+
+	outputArr := strings.Split(params["mnemonic"], "-")
+	mnemonic := strings.Join(outputArr[:], " ")
+
+	workspaceInfo, findErr := getter.GetWorkspaceInfo(mnemonic)
+	if findErr != nil || workspaceInfo == nil {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return workspaceInfo, true
+}
@@ -0,0 +1,82 @@
+package versions
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+	"github.com/zivkovicmilos/peer_drop/rest/utils"
+	servicehandler "github.com/zivkovicmilos/peer_drop/service-handler"
+	"github.com/zivkovicmilos/peer_drop/storage"
+)
+
+// GetVersionSettings fetches the version retention settings of a workspace
+func GetVersionSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	mnemonic := workspaceInfo.Mnemonic
+
+	settings, findErr := storage.GetStorageHandler().GetVersionSettings(mnemonic)
+	if findErr != nil {
+		http.Error(w, "Unable to fetch version settings", http.StatusInternalServerError)
+		return
+	}
+
+	if settings == nil {
+		// Versions aren't retained by default
+		settings = &types.VersionSettings{WorkspaceMnemonic: mnemonic}
+	}
+
+	encodeErr := json.NewEncoder(w).Encode(settings)
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SetVersionSettings sets which previous versions of the shared files a workspace keeps
+func SetVersionSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceInfo, found := utils.FindWorkspace(w, r, storage.GetStorageHandler())
+	if !found {
+		return
+	}
+
+	mnemonic := workspaceInfo.Mnemonic
+
+	var settingsRequest types.VersionSettingsRequest
+
+	decodeErr := json.NewDecoder(r.Body).Decode(&settingsRequest)
+	if decodeErr != nil {
+		http.Error(w, "Unable to parse input", http.StatusBadRequest)
+		return
+	}
+
+	if settingsRequest.MaxVersions < 0 || settingsRequest.MaxAge < 0 {
+		http.Error(w, "Invalid version settings", http.StatusBadRequest)
+		return
+	}
+
+	settings := types.VersionSettings{
+		WorkspaceMnemonic: mnemonic,
+		Enabled:           settingsRequest.Enabled,
+		MaxVersions:       settingsRequest.MaxVersions,
+		MaxAge:            settingsRequest.MaxAge,
+	}
+
+	if saveErr := storage.GetStorageHandler().SaveVersionSettings(settings); saveErr != nil {
+		http.Error(w, "Unable to save version settings", http.StatusInternalServerError)
+		return
+	}
+
+	if setErr := servicehandler.GetServiceHandler().GetClientServer().SetVersionRetention(settings); setErr != nil {
+		http.Error(w, "Unable to apply version settings", http.StatusInternalServerError)
+		return
+	}
+
+	encodeErr := json.NewEncoder(w).Encode("Version settings updated")
+	if encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
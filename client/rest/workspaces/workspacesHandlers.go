@@ -3,17 +3,24 @@ package workspaces
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/gorilla/mux"
+	"github.com/zivkovicmilos/peer_drop/config"
 	"github.com/zivkovicmilos/peer_drop/crypto"
+	"github.com/zivkovicmilos/peer_drop/files"
+	"github.com/zivkovicmilos/peer_drop/networking/client"
 	"github.com/zivkovicmilos/peer_drop/proto"
 	"github.com/zivkovicmilos/peer_drop/rest/types"
 	"github.com/zivkovicmilos/peer_drop/rest/utils"
@@ -42,6 +49,11 @@ func CreateWorkspace(w http.ResponseWriter, r *http.Request) {
 
 	workspaceRequest.WorkspaceOwners = append(workspaceRequest.WorkspaceOwners, identity.PublicKey)
 
+	if workspaceRequest.HashAlgorithm != "" && !files.IsHashAlgorithm(workspaceRequest.HashAlgorithm) {
+		http.Error(w, "Unknown hash algorithm", http.StatusBadRequest)
+		return
+	}
+
 	// Contact the Rendezvous servers with the creation request
 	clientServer := servicehandler.GetServiceHandler().GetClientServer()
 	workspaceInfo, createErr := clientServer.CreateWorkspace(workspaceRequest)
@@ -180,17 +192,97 @@ func formatFileList(fileList []*proto.File) []types.FileInfo {
 	for _, file := range fileList {
 		responseList = append(responseList, types.FileInfo{
 			Name:         file.Name,
+			Path:         file.Path,
 			Extension:    file.Extension,
 			Size:         file.Size,
 			DateModified: file.DateModified,
 			Checksum:     file.FileChecksum,
+			Algorithm:    files.ChecksumAlgorithm(file.FileChecksum),
+			Version:      file.Version,
+			Retained:     file.Retained,
 		})
 	}
 
 	return responseList
 }
 
-// GetWorkspaceFiles fetches all available files for download
+// workspaceHashAlgorithm returns the algorithm the workspace files are hashed with
+func workspaceHashAlgorithm(workspaceInfo *proto.WorkspaceInfo) string {
+	if workspaceInfo.HashAlgorithm == "" {
+		return config.DefaultHashAlgorithm
+	}
+
+	return workspaceInfo.HashAlgorithm
+}
+
+// markConflicts flags the files that peers share under the same path as other files,
+// and lists the peers that share them
+func markConflicts(mnemonic string, fileInfos []types.FileInfo) {
+	clientServer := servicehandler.GetServiceHandler().GetClientServer()
+	conflicting := files.ConflictingChecksums(clientServer.GetFileConflicts(mnemonic))
+
+	for index := range fileInfos {
+		if !conflicting[fileInfos[index].Checksum] {
+			continue
+		}
+
+		fileInfos[index].Conflict = true
+		fileInfos[index].Peers = clientServer.GetFileSources(mnemonic, fileInfos[index].Checksum)
+	}
+}
+
+// browseFileList splits the file list into the files directly in the given folder,
+// and the folders directly under it
+func browseFileList(fileList []*proto.File, folderPath string) ([]*proto.File, []types.FolderInfo) {
+	folderFiles := make([]*proto.File, 0)
+	folderMap := make(map[string]*types.FolderInfo)
+
+	for _, file := range fileList {
+		if file.Path == folderPath {
+			folderFiles = append(folderFiles, file)
+
+			continue
+		}
+
+		// Check if the file is somewhere in the folder tree
+		var subPath string
+		switch {
+		case folderPath == "":
+			subPath = file.Path
+		case strings.HasPrefix(file.Path, folderPath+"/"):
+			subPath = strings.TrimPrefix(file.Path, folderPath+"/")
+		default:
+			continue
+		}
+
+		subFolderName := strings.SplitN(subPath, "/", 2)[0]
+		subFolder, ok := folderMap[subFolderName]
+		if !ok {
+			subFolder = &types.FolderInfo{
+				Name: subFolderName,
+				Path: path.Join(folderPath, subFolderName),
+			}
+			folderMap[subFolderName] = subFolder
+		}
+
+		subFolder.NumFiles++
+		subFolder.Size += file.Size
+	}
+
+	folders := make([]types.FolderInfo, 0, len(folderMap))
+	for _, folder := range folderMap {
+		folders = append(folders, *folder)
+	}
+
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Name < folders[j].Name
+	})
+
+	return folderFiles, folders
+}
+
+// GetWorkspaceFiles fetches all available files for download.
+// If the path query parameter is set, only the files and folders in that folder are returned
 func GetWorkspaceFiles(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 
@@ -224,13 +316,33 @@ func GetWorkspaceFiles(w http.ResponseWriter, r *http.Request) {
 	clientServer := servicehandler.GetServiceHandler().GetClientServer()
 	fileList := clientServer.GetFileList(mnemonic)
 
+	var (
+		folderPath string
+		folders    []types.FolderInfo
+	)
+
+	if _, browsing := r.URL.Query()["path"]; browsing {
+		cleanPath, pathErr := files.CleanRelativePath(r.URL.Query().Get("path"))
+		if pathErr != nil {
+			http.Error(w, "Invalid folder path", http.StatusBadRequest)
+			return
+		}
+
+		folderPath = cleanPath
+		fileList, folders = browseFileList(fileList, folderPath)
+	}
+
 	formattedList := formatFileList(fileList)
+	markConflicts(mnemonic, formattedList)
 
 	detailedResponse := &types.WorkspaceDetailedResponse{
 		WorkspaceMnemonic:    workspaceInfo.Mnemonic,
 		WorkspaceName:        workspaceInfo.Name,
 		WorkspaceType:        workspaceInfo.WorkspaceType,
+		HashAlgorithm:        workspaceHashAlgorithm(workspaceInfo),
 		WorkspaceFiles:       formattedList,
+		CurrentPath:          folderPath,
+		WorkspaceFolders:     folders,
 		WorkspaceOwnerKeyIDs: workspaceOwnerKeyIDs,
 	}
 
@@ -240,6 +352,76 @@ func GetWorkspaceFiles(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetWorkspaceConflicts returns the different files peers share under the same path
+func GetWorkspaceConflicts(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	outputArr := strings.Split(params["mnemonic"], "-")
+	mnemonic := strings.Join(outputArr[:], " ")
+
+	// Check if we know this workspace
+	workspaceInfo, workspaceError := storage.GetStorageHandler().GetWorkspaceInfo(mnemonic)
+	if workspaceError != nil {
+		http.Error(w, "Unable to fetch workspace info", http.StatusInternalServerError)
+		return
+	}
+
+	if workspaceInfo == nil {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+
+	clientServer := servicehandler.GetServiceHandler().GetClientServer()
+
+	conflicts := make([]types.FileConflict, 0)
+	for _, conflict := range clientServer.GetFileConflicts(mnemonic) {
+		conflictFiles := formatFileList(conflict.Files)
+		markConflicts(mnemonic, conflictFiles)
+
+		conflicts = append(conflicts, types.FileConflict{
+			Path:  conflict.RelativePath,
+			Files: conflictFiles,
+		})
+	}
+
+	if encodeErr := json.NewEncoder(w).Encode(types.FileConflictsResponse{
+		Data:  conflicts,
+		Count: len(conflicts),
+	}); encodeErr != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// RehashWorkspaceFiles hashes the shared workspace files again, ignoring the cached checksums
+func RehashWorkspaceFiles(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	outputArr := strings.Split(params["mnemonic"], "-")
+	mnemonic := strings.Join(outputArr[:], " ")
+
+	// Check if we know this workspace
+	workspaceInfo, workspaceError := storage.GetStorageHandler().GetWorkspaceInfo(mnemonic)
+	if workspaceError != nil {
+		http.Error(w, "Unable to fetch workspace info", http.StatusInternalServerError)
+		return
+	}
+
+	if workspaceInfo == nil {
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+		return
+	}
+
+	clientServer := servicehandler.GetServiceHandler().GetClientServer()
+
+	if rehashErr := clientServer.RehashWorkspaceFiles(mnemonic); rehashErr != nil {
+		http.Error(w, "Unable to rehash workspace files", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 // GetWorkspaceNumPeers returns the number of connected workspace peers
 func GetWorkspaceNumPeers(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
@@ -297,6 +479,12 @@ func LeaveWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Stop mirroring the workspace
+	if mirrorErr := servicehandler.GetServiceHandler().GetMirrorService().RemoveWorkspace(mnemonic); mirrorErr != nil {
+		http.Error(w, "Unable to remove mirror settings", http.StatusInternalServerError)
+		return
+	}
+
 	// Wipe the workspace from the local DB, along with any credentials
 	deleteErr := storage.GetStorageHandler().DeleteWorkspaceInfo(mnemonic)
 	if deleteErr != nil {
@@ -310,6 +498,32 @@ func LeaveWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	deleteErr = storage.GetStorageHandler().DeleteVersionSettings(mnemonic)
+	if deleteErr != nil {
+		http.Error(w, "Unable to delete version settings", http.StatusInternalServerError)
+		return
+	}
+
+	deleteErr = storage.GetStorageHandler().DeleteSeedSettings(mnemonic)
+	if deleteErr != nil {
+		http.Error(w, "Unable to delete seed settings", http.StatusInternalServerError)
+		return
+	}
+
+	deleteErr = storage.GetStorageHandler().DeleteIgnoreSettings(mnemonic)
+	if deleteErr != nil {
+		http.Error(w, "Unable to delete ignore settings", http.StatusInternalServerError)
+		return
+	}
+
+	servicehandler.GetServiceHandler().GetClientServer().GetThrottler().RemoveWorkspaceLimits(mnemonic)
+
+	deleteErr = storage.GetStorageHandler().DeleteBandwidthLimits(types.BANDWIDTH_SCOPE_WORKSPACE, mnemonic)
+	if deleteErr != nil {
+		http.Error(w, "Unable to delete bandwidth limits", http.StatusInternalServerError)
+		return
+	}
+
 	if encodeErr := json.NewEncoder(w).Encode("Workspace deleted"); encodeErr != nil {
 		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
 		return
@@ -422,13 +636,19 @@ func JoinWorkspace(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// uploadMemoryLimit is the max amount of upload data kept in memory,
+// anything above it is buffered on disk while the form is parsed
+const uploadMemoryLimit = 32 * 1024 * 1024 // 32 MiB
+
 // AddFileToWorkspace uploads a new file to the workspace
 func AddFileToWorkspace(w http.ResponseWriter, r *http.Request) {
-	// Max size for now is 1 GB
-	if parseErr := r.ParseMultipartForm(1 * 1024 * 1024 * 1024); parseErr != nil {
+	if parseErr := r.ParseMultipartForm(uploadMemoryLimit); parseErr != nil {
 		http.Error(w, "Unable to parse file", http.StatusBadRequest)
 		return
 	}
+	defer func() {
+		_ = r.MultipartForm.RemoveAll()
+	}()
 
 	formMnemonic := r.FormValue("mnemonic")
 	outputArr := strings.Split(formMnemonic, "-")
@@ -449,27 +669,53 @@ func AddFileToWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the file in the save directory
-	saveFile, createErr := os.Create(
-		fmt.Sprintf("%s/%s", saveDirectory, handler.Filename),
-	)
+	tempDirectory, findErr := clientServer.GetWorkspaceTempDir(mnemonic)
+	if findErr != nil {
+		http.Error(w, "Unknown workspace", http.StatusInternalServerError)
+		return
+	}
+
+	// Write the file to the temp directory first, so it isn't
+	// shared with other peers before it's completely written
+	saveFile, createErr := ioutil.TempFile(tempDirectory, "upload-*")
 	if createErr != nil {
 		http.Error(w, "Unable to create file", http.StatusInternalServerError)
 		return
 	}
 
-	defer saveFile.Close()
+	defer func() {
+		_ = saveFile.Close()
+		_ = os.Remove(saveFile.Name())
+	}()
 
-	// Read from the uploaded file
-	fileBytes, err := ioutil.ReadAll(formFile)
-	if err != nil {
-		http.Error(w, "Unable to read file", http.StatusInternalServerError)
+	// Stream the uploaded file to the created file
+	if _, copyErr := io.Copy(saveFile, formFile); copyErr != nil {
+		http.Error(w, "Unable to save file", http.StatusInternalServerError)
 		return
 	}
 
-	// write this byte array to the created file
-	_, writeErr := saveFile.Write(fileBytes)
-	if writeErr != nil {
+	if closeErr := saveFile.Close(); closeErr != nil {
+		http.Error(w, "Unable to save file", http.StatusInternalServerError)
+		return
+	}
+
+	// Files can be uploaded into a folder of the shared directory
+	folderPath, pathErr := files.CleanRelativePath(r.FormValue("path"))
+	if pathErr != nil {
+		http.Error(w, "Invalid folder path", http.StatusBadRequest)
+		return
+	}
+
+	saveFolder := filepath.Join(saveDirectory, filepath.FromSlash(folderPath))
+	if createErr := os.MkdirAll(saveFolder, os.ModePerm); createErr != nil {
+		http.Error(w, "Unable to create folder", http.StatusInternalServerError)
+		return
+	}
+
+	if renameErr := os.Rename(
+		saveFile.Name(),
+		filepath.Join(saveFolder, filepath.Base(handler.Filename)),
+	); renameErr != nil {
 		http.Error(w, "Unable to save file", http.StatusInternalServerError)
 		return
 	}
@@ -480,6 +726,17 @@ func AddFileToWorkspace(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// WriteDownloadError writes the response of a failed download.
+// Integrity failures are reported on their own, they point to a peer that served corrupted data
+func WriteDownloadError(w http.ResponseWriter, downloadErr error) {
+	if errors.Is(downloadErr, client.ErrIntegrity) {
+		http.Error(w, "Downloaded file failed the integrity check", http.StatusBadGateway)
+		return
+	}
+
+	http.Error(w, "Unable to download file", http.StatusInternalServerError)
+}
+
 func DownloadWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 	var downloadFileRequest types.FileDownloadRequest
 
@@ -489,17 +746,42 @@ func DownloadWorkspaceFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, parseErr := files.ParseFileChecksum(downloadFileRequest.FileChecksum); parseErr != nil {
+		http.Error(w, "Invalid file checksum", http.StatusBadRequest)
+		return
+	}
+
 	clientServer := servicehandler.GetServiceHandler().GetClientServer()
 	downloadInfo, downloadErr := clientServer.HandleFileDownload(
+		r.Context(),
 		downloadFileRequest.WorkspaceMnemonic,
 		downloadFileRequest.FileChecksum,
+		nil,
 	)
 
 	if downloadErr != nil {
-		http.Error(w, "Unable to download file", http.StatusInternalServerError)
+		WriteDownloadError(w, downloadErr)
 		return
 	}
 
+	// The served copy is removed, but the file stays shared if it's seeded
+	_, seedErr := clientServer.SeedDownloadedFile(
+		downloadFileRequest.WorkspaceMnemonic,
+		downloadFileRequest.FileChecksum,
+		downloadInfo,
+		downloadFileRequest.Seed,
+	)
+	if seedErr != nil && downloadFileRequest.Seed {
+		// The file passed verification, so it's still served.
+		// The seeding error is reported alongside it
+		seedMessage := "Unable to seed file"
+		if seedErr == client.ErrSeedingUnavailable {
+			seedMessage = "Seeding is only available in send-receive workspaces"
+		}
+
+		w.Header().Set(types.SeedErrorHeader, seedMessage)
+	}
+
 	f, err := os.Open(downloadInfo.FilePath)
 	if err != nil {
 		http.Error(w, "Unable to download file", http.StatusInternalServerError)
@@ -4,12 +4,16 @@ import (
 	"os"
 	"sync"
 
+	"github.com/zivkovicmilos/peer_drop/downloads"
+	"github.com/zivkovicmilos/peer_drop/mirror"
 	"github.com/zivkovicmilos/peer_drop/networking/client"
 )
 
 type ServiceHandler struct {
-	closeChannel chan os.Signal
-	clientServer *client.ClientServer
+	closeChannel    chan os.Signal
+	clientServer    *client.ClientServer
+	downloadManager *downloads.DownloadManager
+	mirrorService   *mirror.MirrorService
 
 	serviceListeners map[string]chan struct{}
 }
@@ -43,6 +47,26 @@ func (sh *ServiceHandler) GetClientServer() *client.ClientServer {
 	return sh.clientServer
 }
 
+// SetDownloadManager sets the download manager
+func (sh *ServiceHandler) SetDownloadManager(downloadManager *downloads.DownloadManager) {
+	sh.downloadManager = downloadManager
+}
+
+// GetDownloadManager returns a reference to the download manager
+func (sh *ServiceHandler) GetDownloadManager() *downloads.DownloadManager {
+	return sh.downloadManager
+}
+
+// SetMirrorService sets the workspace mirror service
+func (sh *ServiceHandler) SetMirrorService(mirrorService *mirror.MirrorService) {
+	sh.mirrorService = mirrorService
+}
+
+// GetMirrorService returns a reference to the workspace mirror service
+func (sh *ServiceHandler) GetMirrorService() *mirror.MirrorService {
+	return sh.mirrorService
+}
+
 // BroadcastNotifier waits for a term signal and alerts all listening services
 func (sh *ServiceHandler) BroadcastNotifier() {
 	<-sh.closeChannel
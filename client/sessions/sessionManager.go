@@ -0,0 +1,306 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+const cleanupInterval = 10 * time.Second // interval at which expired sessions are removed
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionLimit    = errors.New("too many sessions for peer")
+	ErrSessionActive   = errors.New("session already active")
+	ErrSessionPeer     = errors.New("session belongs to another peer")
+)
+
+// Limits are the lifetime limits of a single session type
+type Limits struct {
+	TTL        time.Duration // time after which an unused session expires
+	MaxPerPeer int           // max number of sessions a single peer can hold, 0 means unlimited
+}
+
+// Session is a pending exchange with a remote peer, like an issued challenge
+// or a file request that is waiting for its transfer
+type Session struct {
+	ID          string
+	SessionType string
+	PeerID      peer.ID
+	Value       interface{}
+	ExpiresAt   time.Time
+
+	active     bool               // the session is in use, and doesn't expire
+	cancelFunc context.CancelFunc // cancels the context of the active session
+}
+
+// SessionManager owns the sessions opened by remote peers.
+// Unused sessions expire after their TTL, and every peer
+// can only hold a limited number of sessions of each type
+type SessionManager struct {
+	logger hclog.Logger
+	limits map[string]Limits // session type -> limits
+
+	sessions    map[string]*Session // session id -> session
+	sessionsMux sync.Mutex
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+}
+
+// NewSessionManager creates a new session manager with the given limits per session type
+func NewSessionManager(logger hclog.Logger, limits map[string]Limits) *SessionManager {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	return &SessionManager{
+		logger:     logger.Named("sessions"),
+		limits:     limits,
+		sessions:   make(map[string]*Session),
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+	}
+}
+
+// Start runs the cleanup loop of expired sessions.
+// Blocks until the session manager is stopped
+func (sm *SessionManager) Start() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := sm.removeExpired(time.Now()); removed > 0 {
+				sm.logger.Debug(fmt.Sprintf("Removed %d expired sessions", removed))
+			}
+		}
+	}
+}
+
+// Stop cancels all sessions and stops the cleanup loop
+func (sm *SessionManager) Stop() {
+	sm.cancelFunc()
+
+	sm.sessionsMux.Lock()
+	defer sm.sessionsMux.Unlock()
+
+	for id := range sm.sessions {
+		sm.removeLocked(id)
+	}
+}
+
+// Add opens a new session for the peer.
+// Fails if the peer already holds the max number of sessions of the type
+func (sm *SessionManager) Add(sessionType string, id string, peerID peer.ID, value interface{}) error {
+	sm.sessionsMux.Lock()
+	defer sm.sessionsMux.Unlock()
+
+	now := time.Now()
+	limits := sm.limits[sessionType]
+
+	if limits.MaxPerPeer > 0 {
+		numSessions := 0
+		for _, session := range sm.sessions {
+			if session.SessionType == sessionType && session.PeerID == peerID && !session.isExpired(now) {
+				numSessions++
+			}
+		}
+
+		if numSessions >= limits.MaxPerPeer {
+			return ErrSessionLimit
+		}
+	}
+
+	session := &Session{
+		ID:          id,
+		SessionType: sessionType,
+		PeerID:      peerID,
+		Value:       value,
+	}
+
+	if limits.TTL > 0 {
+		session.ExpiresAt = now.Add(limits.TTL)
+	}
+
+	sm.sessions[id] = session
+
+	return nil
+}
+
+// Take removes the session and returns it. Sessions taken this way can't be used again
+func (sm *SessionManager) Take(sessionType string, id string) (Session, error) {
+	sm.sessionsMux.Lock()
+	defer sm.sessionsMux.Unlock()
+
+	session, err := sm.findLocked(sessionType, id)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if session.active {
+		return Session{}, ErrSessionActive
+	}
+
+	sm.removeLocked(id)
+
+	return *session, nil
+}
+
+// Begin marks the session of the peer as active until the returned end function is called.
+// The returned context is canceled when the session is canceled, or the parent context is done
+func (sm *SessionManager) Begin(
+	ctx context.Context,
+	sessionType string,
+	id string,
+	peerID peer.ID,
+) (Session, context.Context, func(), error) {
+	sm.sessionsMux.Lock()
+	defer sm.sessionsMux.Unlock()
+
+	session, err := sm.findLocked(sessionType, id)
+	if err != nil {
+		return Session{}, nil, nil, err
+	}
+
+	if session.PeerID != peerID {
+		return Session{}, nil, nil, ErrSessionPeer
+	}
+
+	if session.active {
+		return Session{}, nil, nil, ErrSessionActive
+	}
+
+	sessionCtx, cancelFunc := context.WithCancel(ctx)
+	session.active = true
+	session.cancelFunc = cancelFunc
+
+	end := func() {
+		sm.sessionsMux.Lock()
+		defer sm.sessionsMux.Unlock()
+
+		if sm.sessions[id] == session {
+			sm.removeLocked(id)
+		}
+
+		cancelFunc()
+	}
+
+	return *session, sessionCtx, end, nil
+}
+
+// CancelPeer cancels and removes all sessions of the peer
+func (sm *SessionManager) CancelPeer(peerID peer.ID) int {
+	sm.sessionsMux.Lock()
+	defer sm.sessionsMux.Unlock()
+
+	canceled := 0
+	for id, session := range sm.sessions {
+		if session.PeerID == peerID {
+			sm.removeLocked(id)
+			canceled++
+		}
+	}
+
+	return canceled
+}
+
+// GetStats returns the number of open sessions of every session type, sorted by type
+func (sm *SessionManager) GetStats() []types.SessionStats {
+	sm.sessionsMux.Lock()
+	defer sm.sessionsMux.Unlock()
+
+	now := time.Now()
+	statsMap := make(map[string]*types.SessionStats)
+	for sessionType := range sm.limits {
+		statsMap[sessionType] = &types.SessionStats{SessionType: sessionType}
+	}
+
+	for _, session := range sm.sessions {
+		if session.isExpired(now) {
+			continue
+		}
+
+		stats, ok := statsMap[session.SessionType]
+		if !ok {
+			stats = &types.SessionStats{SessionType: session.SessionType}
+			statsMap[session.SessionType] = stats
+		}
+
+		if session.active {
+			stats.Active++
+		} else {
+			stats.Pending++
+		}
+	}
+
+	allStats := make([]types.SessionStats, 0, len(statsMap))
+	for _, stats := range statsMap {
+		allStats = append(allStats, *stats)
+	}
+
+	sort.Slice(allStats, func(i, j int) bool {
+		return allStats[i].SessionType < allStats[j].SessionType
+	})
+
+	return allStats
+}
+
+// removeExpired removes the unused sessions that are past their expiry time
+func (sm *SessionManager) removeExpired(now time.Time) int {
+	sm.sessionsMux.Lock()
+	defer sm.sessionsMux.Unlock()
+
+	removed := 0
+	for id, session := range sm.sessions {
+		if session.isExpired(now) {
+			sm.removeLocked(id)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// findLocked returns the session with the id and type, if it hasn't expired
+func (sm *SessionManager) findLocked(sessionType string, id string) (*Session, error) {
+	session, ok := sm.sessions[id]
+	if !ok || session.SessionType != sessionType {
+		return nil, ErrSessionNotFound
+	}
+
+	if session.isExpired(time.Now()) {
+		sm.removeLocked(id)
+
+		return nil, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// removeLocked removes the session, and cancels it if it's active
+func (sm *SessionManager) removeLocked(id string) {
+	session, ok := sm.sessions[id]
+	if !ok {
+		return
+	}
+
+	if session.cancelFunc != nil {
+		session.cancelFunc()
+	}
+
+	delete(sm.sessions, id)
+}
+
+// isExpired checks if the session is unused past its expiry time
+func (s *Session) isExpired(now time.Time) bool {
+	return !s.active && !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
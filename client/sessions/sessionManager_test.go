@@ -0,0 +1,124 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+func newTestManager() *SessionManager {
+	return NewSessionManager(hclog.NewNullLogger(), map[string]Limits{
+		types.SESSION_TYPE_CHALLENGE: {TTL: time.Minute, MaxPerPeer: 2},
+		types.SESSION_TYPE_DOWNLOAD:  {TTL: time.Minute},
+	})
+}
+
+func TestSessionManager_PeerLimit(t *testing.T) {
+	testTable := []struct {
+		name        string
+		sessionType string
+		peerID      peer.ID
+		expectedErr error
+	}{
+		{
+			"Peer over the limit",
+			types.SESSION_TYPE_CHALLENGE,
+			peer.ID("first"),
+			ErrSessionLimit,
+		},
+		{
+			"Other peer",
+			types.SESSION_TYPE_CHALLENGE,
+			peer.ID("second"),
+			nil,
+		},
+		{
+			"Other session type",
+			types.SESSION_TYPE_DOWNLOAD,
+			peer.ID("first"),
+			nil,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			sm := newTestManager()
+
+			assert.NoError(t, sm.Add(types.SESSION_TYPE_CHALLENGE, "a", peer.ID("first"), nil))
+			assert.NoError(t, sm.Add(types.SESSION_TYPE_CHALLENGE, "b", peer.ID("first"), nil))
+
+			assert.ErrorIs(t, sm.Add(testCase.sessionType, "c", testCase.peerID, nil), testCase.expectedErr)
+		})
+	}
+}
+
+func TestSessionManager_Take(t *testing.T) {
+	sm := newTestManager()
+
+	assert.NoError(t, sm.Add(types.SESSION_TYPE_CHALLENGE, "challenge", peer.ID("peer"), "value"))
+
+	// Sessions are only found with their own type
+	_, takeErr := sm.Take(types.SESSION_TYPE_DOWNLOAD, "challenge")
+	assert.ErrorIs(t, takeErr, ErrSessionNotFound)
+
+	session, takeErr := sm.Take(types.SESSION_TYPE_CHALLENGE, "challenge")
+	assert.NoError(t, takeErr)
+	assert.Equal(t, "value", session.Value)
+
+	// Taken sessions can't be used again
+	_, takeErr = sm.Take(types.SESSION_TYPE_CHALLENGE, "challenge")
+	assert.ErrorIs(t, takeErr, ErrSessionNotFound)
+}
+
+func TestSessionManager_Expiry(t *testing.T) {
+	sm := newTestManager()
+
+	assert.NoError(t, sm.Add(types.SESSION_TYPE_CHALLENGE, "unused", peer.ID("peer"), nil))
+	assert.NoError(t, sm.Add(types.SESSION_TYPE_DOWNLOAD, "active", peer.ID("peer"), nil))
+
+	_, _, endSession, beginErr := sm.Begin(context.Background(), types.SESSION_TYPE_DOWNLOAD, "active", peer.ID("peer"))
+	assert.NoError(t, beginErr)
+	defer endSession()
+
+	// Only unused sessions expire
+	assert.Equal(t, 1, sm.removeExpired(time.Now().Add(2*time.Minute)))
+
+	_, takeErr := sm.Take(types.SESSION_TYPE_CHALLENGE, "unused")
+	assert.ErrorIs(t, takeErr, ErrSessionNotFound)
+
+	assert.Equal(t, []types.SessionStats{
+		{SessionType: types.SESSION_TYPE_CHALLENGE},
+		{SessionType: types.SESSION_TYPE_DOWNLOAD, Active: 1},
+	}, sm.GetStats())
+}
+
+func TestSessionManager_Begin(t *testing.T) {
+	sm := newTestManager()
+
+	assert.NoError(t, sm.Add(types.SESSION_TYPE_DOWNLOAD, "download", peer.ID("peer"), nil))
+
+	// Sessions can only be used by the peer that opened them
+	_, _, _, beginErr := sm.Begin(context.Background(), types.SESSION_TYPE_DOWNLOAD, "download", peer.ID("other"))
+	assert.ErrorIs(t, beginErr, ErrSessionPeer)
+
+	_, ctx, endSession, beginErr := sm.Begin(context.Background(), types.SESSION_TYPE_DOWNLOAD, "download", peer.ID("peer"))
+	assert.NoError(t, beginErr)
+
+	_, _, _, beginErr = sm.Begin(context.Background(), types.SESSION_TYPE_DOWNLOAD, "download", peer.ID("peer"))
+	assert.ErrorIs(t, beginErr, ErrSessionActive)
+
+	// Canceling the peer sessions cancels the running transfer
+	assert.Equal(t, 1, sm.CancelPeer(peer.ID("peer")))
+	assert.Error(t, ctx.Err())
+
+	endSession()
+	assert.Equal(t, []types.SessionStats{
+		{SessionType: types.SESSION_TYPE_CHALLENGE},
+		{SessionType: types.SESSION_TYPE_DOWNLOAD},
+	}, sm.GetStats())
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"sort"
@@ -38,6 +40,27 @@ var (
 
 	// Credentials used for interacting with a specific workspace and its peers
 	WORKSPACE_CREDENTIALS = []byte("workspaceCredentials")
+
+	// Download jobs handled by the download manager
+	DOWNLOAD_JOBS = []byte("downloadJobs")
+
+	// Auto-mirror settings of the workspaces
+	MIRROR_SETTINGS = []byte("mirrorSettings")
+
+	// Version retention settings of the workspaces
+	VERSION_SETTINGS = []byte("versionSettings")
+
+	// Re-seeding settings of the workspaces
+	SEED_SETTINGS = []byte("seedSettings")
+
+	// Ignore patterns of the workspaces
+	IGNORE_SETTINGS = []byte("ignoreSettings")
+
+	// Checksums of the shared files, so unchanged files aren't hashed again
+	CHECKSUM_CACHE = []byte("checksumCache")
+
+	// Bandwidth limits of the file sharing
+	BANDWIDTH_LIMITS = []byte("bandwidthLimits")
 )
 
 // Sub-prefixes
@@ -64,6 +87,7 @@ var (
 	// RENDEZVOUS NODES //
 	WORKSPACE_INFO_MNEMONIC             = []byte("mnemonic")
 	WORKSPACE_INFO_TYPE                 = []byte("type")
+	WORKSPACE_INFO_HASH_ALGORITHM       = []byte("hashAlgorithm")
 	WORKSPACE_INFO_WORKSPACE_OWNER      = []byte("workspaceOwner")
 	WORKSPACE_INFO_SECURITY_TYPE        = []byte("securityType")
 	WORKSPACE_INFO_NAME                 = []byte("name")
@@ -77,6 +101,56 @@ var (
 	WORKSPACE_CREDENTIALS_PRIVATE_KEY = []byte("privateKey")
 	WORKSPACE_CREDENTIALS_PUBLIC_KEY  = []byte("publicKey")
 	WORKSPACE_CREDENTIALS_PASSWORD    = []byte("password")
+
+	// DOWNLOAD JOBS //
+	DOWNLOAD_JOB_WORKSPACE_MNEMONIC = []byte("workspaceMnemonic")
+	DOWNLOAD_JOB_FILE_CHECKSUM      = []byte("fileChecksum")
+	DOWNLOAD_JOB_FILE_NAME          = []byte("fileName")
+	DOWNLOAD_JOB_FILE_PATH          = []byte("filePath")
+	DOWNLOAD_JOB_STATUS             = []byte("status")
+	DOWNLOAD_JOB_PRIORITY           = []byte("priority")
+	DOWNLOAD_JOB_DATE_ADDED         = []byte("dateAdded")
+	DOWNLOAD_JOB_ATTEMPTS           = []byte("attempts")
+	DOWNLOAD_JOB_ERROR              = []byte("error")
+	DOWNLOAD_JOB_ERROR_TYPE         = []byte("errorType")
+	DOWNLOAD_JOB_BYTES_DOWNLOADED   = []byte("bytesDownloaded")
+	DOWNLOAD_JOB_BYTES_TOTAL        = []byte("bytesTotal")
+	DOWNLOAD_JOB_BYTES_ON_WIRE      = []byte("bytesOnWire")
+	DOWNLOAD_JOB_SEED               = []byte("seed")
+	DOWNLOAD_JOB_SEEDING            = []byte("seeding")
+
+	// MIRROR SETTINGS //
+
+	MIRROR_SETTINGS_ENABLED        = []byte("enabled")
+	MIRROR_SETTINGS_REMOVE_MISSING = []byte("removeMissing")
+
+	// VERSION SETTINGS //
+
+	VERSION_SETTINGS_ENABLED      = []byte("enabled")
+	VERSION_SETTINGS_MAX_VERSIONS = []byte("maxVersions")
+	VERSION_SETTINGS_MAX_AGE      = []byte("maxAge")
+
+	// SEED SETTINGS //
+
+	SEED_SETTINGS_ENABLED = []byte("enabled")
+
+	// IGNORE SETTINGS //
+
+	IGNORE_SETTINGS_PATTERNS     = []byte("patterns")
+	IGNORE_SETTINGS_MIN_FILE_AGE = []byte("minFileAge")
+
+	// CHECKSUM CACHE //
+
+	CHECKSUM_CACHE_SIZE          = []byte("size")
+	CHECKSUM_CACHE_MOD_TIME      = []byte("modTime")
+	CHECKSUM_CACHE_INODE         = []byte("inode")
+	CHECKSUM_CACHE_CHECKSUM      = []byte("checksum")
+	CHECKSUM_CACHE_MERKLE_LEAVES = []byte("merkleLeaves")
+
+	// BANDWIDTH LIMITS //
+
+	BANDWIDTH_LIMITS_UPLOAD_RATE   = []byte("uploadRate")
+	BANDWIDTH_LIMITS_DOWNLOAD_RATE = []byte("downloadRate")
 )
 
 // Indexes //
@@ -688,6 +762,8 @@ func (sh *StorageHandler) GetWorkspaceInfo(mnemonic string) (*proto.WorkspaceInf
 			foundWorkspaceInfo.SecurityType = value
 		case "type":
 			foundWorkspaceInfo.WorkspaceType = value
+		case "hashAlgorithm":
+			foundWorkspaceInfo.HashAlgorithm = value
 		case "passwordHash":
 			foundWorkspaceInfo.SecuritySettings = &proto.WorkspaceInfo_PasswordHash{PasswordHash: value}
 		case "publicKey":
@@ -811,6 +887,10 @@ func (sh *StorageHandler) CreateWorkspaceInfo(workspaceInfo *proto.WorkspaceInfo
 			WORKSPACE_INFO_TYPE,
 			[]byte(workspaceInfo.WorkspaceType),
 		},
+		{
+			WORKSPACE_INFO_HASH_ALGORITHM,
+			[]byte(workspaceInfo.HashAlgorithm),
+		},
 	}
 
 	// Set the base fields
@@ -1070,3 +1150,709 @@ func (sh *StorageHandler) GetWorkspaceCredentials(mnemonic string) (*types.Works
 
 	return foundCredentials, err
 }
+
+// DOWNLOAD JOBS //
+
+// SaveDownloadJob stores the download job into the DB, overwriting any previous version
+func (sh *StorageHandler) SaveDownloadJob(job types.DownloadJob) error {
+	fieldPairs := []struct {
+		key   []byte
+		value []byte
+	}{
+		{
+			DOWNLOAD_JOB_WORKSPACE_MNEMONIC,
+			[]byte(job.WorkspaceMnemonic),
+		},
+		{
+			DOWNLOAD_JOB_FILE_CHECKSUM,
+			[]byte(job.FileChecksum),
+		},
+		{
+			DOWNLOAD_JOB_FILE_NAME,
+			[]byte(job.FileName),
+		},
+		{
+			DOWNLOAD_JOB_FILE_PATH,
+			[]byte(job.FilePath),
+		},
+		{
+			DOWNLOAD_JOB_STATUS,
+			[]byte(job.Status),
+		},
+		{
+			DOWNLOAD_JOB_PRIORITY,
+			big.NewInt(int64(job.Priority)).Bytes(),
+		},
+		{
+			DOWNLOAD_JOB_DATE_ADDED,
+			big.NewInt(job.DateAdded).Bytes(),
+		},
+		{
+			DOWNLOAD_JOB_ATTEMPTS,
+			big.NewInt(int64(job.Attempts)).Bytes(),
+		},
+		{
+			DOWNLOAD_JOB_ERROR,
+			[]byte(job.Error),
+		},
+		{
+			DOWNLOAD_JOB_ERROR_TYPE,
+			[]byte(job.ErrorType),
+		},
+		{
+			DOWNLOAD_JOB_BYTES_DOWNLOADED,
+			big.NewInt(job.BytesDownloaded).Bytes(),
+		},
+		{
+			DOWNLOAD_JOB_BYTES_TOTAL,
+			big.NewInt(job.BytesTotal).Bytes(),
+		},
+		{
+			DOWNLOAD_JOB_BYTES_ON_WIRE,
+			big.NewInt(job.BytesOnWire).Bytes(),
+		},
+		{
+			DOWNLOAD_JOB_SEED,
+			boolToBytes(job.Seed),
+		},
+		{
+			DOWNLOAD_JOB_SEEDING,
+			boolToBytes(job.Seeding),
+		},
+	}
+
+	entityKeyBase := append(append(DOWNLOAD_JOBS, delimiter...), append([]byte(job.ID), delimiter...)...)
+	for _, field := range fieldPairs {
+		putError := sh.db.Put(append(entityKeyBase, field.key...), field.value, nil)
+		if putError != nil {
+			return putError
+		}
+	}
+
+	return nil
+}
+
+// GetDownloadJobs fetches all download jobs
+func (sh *StorageHandler) GetDownloadJobs() ([]*types.DownloadJob, error) {
+	foundJobs := make([]*types.DownloadJob, 0)
+
+	keyBase := append(DOWNLOAD_JOBS, delimiter...)
+	iter := sh.db.NewIterator(util.BytesPrefix(keyBase), nil)
+
+	var currentJob *types.DownloadJob
+	for iter.Next() {
+		// downloadJobs:id:attributeName => value
+		keyParts := strings.Split(string(iter.Key()), ":")
+		attributeName := keyParts[len(keyParts)-1]
+
+		if currentJob == nil || currentJob.ID != keyParts[1] {
+			currentJob = &types.DownloadJob{ID: keyParts[1]}
+			foundJobs = append(foundJobs, currentJob)
+		}
+
+		value := string(iter.Value())
+		switch attributeName {
+		case "workspaceMnemonic":
+			currentJob.WorkspaceMnemonic = value
+		case "fileChecksum":
+			currentJob.FileChecksum = value
+		case "fileName":
+			currentJob.FileName = value
+		case "filePath":
+			currentJob.FilePath = value
+		case "status":
+			currentJob.Status = value
+		case "priority":
+			currentJob.Priority = int(big.NewInt(0).SetBytes(iter.Value()).Int64())
+		case "dateAdded":
+			currentJob.DateAdded = big.NewInt(0).SetBytes(iter.Value()).Int64()
+		case "attempts":
+			currentJob.Attempts = int(big.NewInt(0).SetBytes(iter.Value()).Int64())
+		case "error":
+			currentJob.Error = value
+		case "errorType":
+			currentJob.ErrorType = value
+		case "bytesDownloaded":
+			currentJob.BytesDownloaded = big.NewInt(0).SetBytes(iter.Value()).Int64()
+		case "bytesTotal":
+			currentJob.BytesTotal = big.NewInt(0).SetBytes(iter.Value()).Int64()
+		case "bytesOnWire":
+			currentJob.BytesOnWire = big.NewInt(0).SetBytes(iter.Value()).Int64()
+		case "seed":
+			currentJob.Seed = bytes.Equal(iter.Value(), []byte{1})
+		case "seeding":
+			currentJob.Seeding = bytes.Equal(iter.Value(), []byte{1})
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+
+	return foundJobs, err
+}
+
+// DeleteDownloadJob deletes the download job from the DB
+func (sh *StorageHandler) DeleteDownloadJob(id string) error {
+	entityKeyBase := append(append(DOWNLOAD_JOBS, delimiter...), append([]byte(id), delimiter...)...)
+
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+	for iter.Next() {
+		if deleteErr := sh.db.Delete(iter.Key(), nil); deleteErr != nil {
+			iter.Release()
+
+			return deleteErr
+		}
+	}
+
+	iter.Release()
+
+	return iter.Error()
+}
+
+// MIRROR SETTINGS //
+
+// boolToBytes converts the boolean value into its DB form
+func boolToBytes(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+
+	return []byte{0}
+}
+
+// SaveMirrorSettings stores the workspace mirror settings into the DB
+func (sh *StorageHandler) SaveMirrorSettings(settings types.MirrorSettings) error {
+	fieldPairs := []struct {
+		key   []byte
+		value []byte
+	}{
+		{
+			MIRROR_SETTINGS_ENABLED,
+			boolToBytes(settings.Enabled),
+		},
+		{
+			MIRROR_SETTINGS_REMOVE_MISSING,
+			boolToBytes(settings.RemoveMissing),
+		},
+	}
+
+	entityKeyBase := append(
+		append(MIRROR_SETTINGS, delimiter...),
+		append([]byte(settings.WorkspaceMnemonic), delimiter...)...,
+	)
+	for _, field := range fieldPairs {
+		putError := sh.db.Put(append(entityKeyBase, field.key...), field.value, nil)
+		if putError != nil {
+			return putError
+		}
+	}
+
+	return nil
+}
+
+// GetMirrorSettings fetches the mirror settings of all workspaces
+func (sh *StorageHandler) GetMirrorSettings() ([]*types.MirrorSettings, error) {
+	foundSettings := make([]*types.MirrorSettings, 0)
+
+	keyBase := append(MIRROR_SETTINGS, delimiter...)
+	iter := sh.db.NewIterator(util.BytesPrefix(keyBase), nil)
+
+	var currentSettings *types.MirrorSettings
+	for iter.Next() {
+		// mirrorSettings:mnemonic:attributeName => value
+		keyParts := strings.Split(string(iter.Key()), ":")
+		attributeName := keyParts[len(keyParts)-1]
+
+		if currentSettings == nil || currentSettings.WorkspaceMnemonic != keyParts[1] {
+			currentSettings = &types.MirrorSettings{WorkspaceMnemonic: keyParts[1]}
+			foundSettings = append(foundSettings, currentSettings)
+		}
+
+		value := bytes.Equal(iter.Value(), []byte{1})
+		switch attributeName {
+		case "enabled":
+			currentSettings.Enabled = value
+		case "removeMissing":
+			currentSettings.RemoveMissing = value
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+
+	return foundSettings, err
+}
+
+// DeleteMirrorSettings deletes the workspace mirror settings from the DB
+func (sh *StorageHandler) DeleteMirrorSettings(mnemonic string) error {
+	entityKeyBase := append(append(MIRROR_SETTINGS, delimiter...), append([]byte(mnemonic), delimiter...)...)
+
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+	for iter.Next() {
+		if deleteErr := sh.db.Delete(iter.Key(), nil); deleteErr != nil {
+			iter.Release()
+
+			return deleteErr
+		}
+	}
+
+	iter.Release()
+
+	return iter.Error()
+}
+
+// SaveVersionSettings stores the workspace version retention settings into the DB
+func (sh *StorageHandler) SaveVersionSettings(settings types.VersionSettings) error {
+	fieldPairs := []struct {
+		key   []byte
+		value []byte
+	}{
+		{
+			VERSION_SETTINGS_ENABLED,
+			boolToBytes(settings.Enabled),
+		},
+		{
+			VERSION_SETTINGS_MAX_VERSIONS,
+			big.NewInt(int64(settings.MaxVersions)).Bytes(),
+		},
+		{
+			VERSION_SETTINGS_MAX_AGE,
+			big.NewInt(settings.MaxAge).Bytes(),
+		},
+	}
+
+	entityKeyBase := append(
+		append(VERSION_SETTINGS, delimiter...),
+		append([]byte(settings.WorkspaceMnemonic), delimiter...)...,
+	)
+	for _, field := range fieldPairs {
+		putError := sh.db.Put(append(entityKeyBase, field.key...), field.value, nil)
+		if putError != nil {
+			return putError
+		}
+	}
+
+	return nil
+}
+
+// GetVersionSettings fetches the version retention settings of the workspace, if any
+func (sh *StorageHandler) GetVersionSettings(mnemonic string) (*types.VersionSettings, error) {
+	var foundSettings *types.VersionSettings
+
+	entityKeyBase := append(append(VERSION_SETTINGS, delimiter...), append([]byte(mnemonic), delimiter...)...)
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+
+	for iter.Next() {
+		// versionSettings:mnemonic:attributeName => value
+		keyParts := strings.Split(string(iter.Key()), ":")
+		attributeName := keyParts[len(keyParts)-1]
+
+		if foundSettings == nil {
+			foundSettings = &types.VersionSettings{WorkspaceMnemonic: mnemonic}
+		}
+
+		switch attributeName {
+		case "enabled":
+			foundSettings.Enabled = bytes.Equal(iter.Value(), []byte{1})
+		case "maxVersions":
+			foundSettings.MaxVersions = int(big.NewInt(0).SetBytes(iter.Value()).Int64())
+		case "maxAge":
+			foundSettings.MaxAge = big.NewInt(0).SetBytes(iter.Value()).Int64()
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+
+	return foundSettings, err
+}
+
+// DeleteVersionSettings deletes the workspace version retention settings from the DB
+func (sh *StorageHandler) DeleteVersionSettings(mnemonic string) error {
+	entityKeyBase := append(append(VERSION_SETTINGS, delimiter...), append([]byte(mnemonic), delimiter...)...)
+
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+	for iter.Next() {
+		if deleteErr := sh.db.Delete(iter.Key(), nil); deleteErr != nil {
+			iter.Release()
+
+			return deleteErr
+		}
+	}
+
+	iter.Release()
+
+	return iter.Error()
+}
+
+// SEED SETTINGS //
+
+// SaveSeedSettings stores the workspace re-seeding settings into the DB
+func (sh *StorageHandler) SaveSeedSettings(settings types.SeedSettings) error {
+	entityKeyBase := append(
+		append(SEED_SETTINGS, delimiter...),
+		append([]byte(settings.WorkspaceMnemonic), delimiter...)...,
+	)
+
+	return sh.db.Put(append(entityKeyBase, SEED_SETTINGS_ENABLED...), boolToBytes(settings.Enabled), nil)
+}
+
+// GetSeedSettings fetches the re-seeding settings of the workspace, if any
+func (sh *StorageHandler) GetSeedSettings(mnemonic string) (*types.SeedSettings, error) {
+	var foundSettings *types.SeedSettings
+
+	entityKeyBase := append(append(SEED_SETTINGS, delimiter...), append([]byte(mnemonic), delimiter...)...)
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+
+	for iter.Next() {
+		// seedSettings:mnemonic:attributeName => value
+		keyParts := strings.Split(string(iter.Key()), ":")
+		attributeName := keyParts[len(keyParts)-1]
+
+		if foundSettings == nil {
+			foundSettings = &types.SeedSettings{WorkspaceMnemonic: mnemonic}
+		}
+
+		switch attributeName {
+		case "enabled":
+			foundSettings.Enabled = bytes.Equal(iter.Value(), []byte{1})
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+
+	return foundSettings, err
+}
+
+// DeleteSeedSettings deletes the workspace re-seeding settings from the DB
+func (sh *StorageHandler) DeleteSeedSettings(mnemonic string) error {
+	entityKeyBase := append(append(SEED_SETTINGS, delimiter...), append([]byte(mnemonic), delimiter...)...)
+
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+	for iter.Next() {
+		if deleteErr := sh.db.Delete(iter.Key(), nil); deleteErr != nil {
+			iter.Release()
+
+			return deleteErr
+		}
+	}
+
+	iter.Release()
+
+	return iter.Error()
+}
+
+// IGNORE SETTINGS //
+
+// SaveIgnoreSettings stores the workspace ignore patterns into the DB
+func (sh *StorageHandler) SaveIgnoreSettings(settings types.IgnoreSettings) error {
+	fieldPairs := []struct {
+		key   []byte
+		value []byte
+	}{
+		{
+			IGNORE_SETTINGS_PATTERNS,
+			[]byte(strings.Join(settings.Patterns, "\n")),
+		},
+		{
+			IGNORE_SETTINGS_MIN_FILE_AGE,
+			big.NewInt(settings.MinFileAge).Bytes(),
+		},
+	}
+
+	entityKeyBase := append(
+		append(IGNORE_SETTINGS, delimiter...),
+		append([]byte(settings.WorkspaceMnemonic), delimiter...)...,
+	)
+	for _, field := range fieldPairs {
+		putError := sh.db.Put(append(entityKeyBase, field.key...), field.value, nil)
+		if putError != nil {
+			return putError
+		}
+	}
+
+	return nil
+}
+
+// GetIgnoreSettings fetches the ignore patterns of the workspace, if any
+func (sh *StorageHandler) GetIgnoreSettings(mnemonic string) (*types.IgnoreSettings, error) {
+	var foundSettings *types.IgnoreSettings
+
+	entityKeyBase := append(append(IGNORE_SETTINGS, delimiter...), append([]byte(mnemonic), delimiter...)...)
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+
+	for iter.Next() {
+		// ignoreSettings:mnemonic:attributeName => value
+		keyParts := strings.Split(string(iter.Key()), ":")
+		attributeName := keyParts[len(keyParts)-1]
+
+		if foundSettings == nil {
+			foundSettings = &types.IgnoreSettings{WorkspaceMnemonic: mnemonic, Patterns: make([]string, 0)}
+		}
+
+		switch attributeName {
+		case "patterns":
+			if len(iter.Value()) > 0 {
+				foundSettings.Patterns = strings.Split(string(iter.Value()), "\n")
+			}
+		case "minFileAge":
+			foundSettings.MinFileAge = big.NewInt(0).SetBytes(iter.Value()).Int64()
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+
+	return foundSettings, err
+}
+
+// DeleteIgnoreSettings deletes the workspace ignore patterns from the DB
+func (sh *StorageHandler) DeleteIgnoreSettings(mnemonic string) error {
+	entityKeyBase := append(append(IGNORE_SETTINGS, delimiter...), append([]byte(mnemonic), delimiter...)...)
+
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+	for iter.Next() {
+		if deleteErr := sh.db.Delete(iter.Key(), nil); deleteErr != nil {
+			iter.Release()
+
+			return deleteErr
+		}
+	}
+
+	iter.Release()
+
+	return iter.Error()
+}
+
+// CHECKSUM CACHE //
+
+// checksumCacheKeyBase returns the key base of the cached checksum of the file.
+// Paths are hex encoded, as they can contain the key delimiter
+func checksumCacheKeyBase(path string) []byte {
+	return append(append(CHECKSUM_CACHE, delimiter...), []byte(hex.EncodeToString([]byte(path)))...)
+}
+
+// decodeModTime decodes a stored modification time. Entries saved before
+// the times were stored with their sign are shorter, and never negative
+func decodeModTime(value []byte) int64 {
+	if len(value) > 8 {
+		return 0
+	}
+
+	padded := make([]byte, 8)
+	copy(padded[8-len(value):], value)
+
+	return int64(binary.BigEndian.Uint64(padded))
+}
+
+// SaveChecksumEntry stores the cached checksum of the file into the DB, overwriting any previous one
+func (sh *StorageHandler) SaveChecksumEntry(entry types.ChecksumCacheEntry) error {
+	// Modification times can be before the epoch, so they are stored with their sign
+	modTime := make([]byte, 8)
+	binary.BigEndian.PutUint64(modTime, uint64(entry.ModTime))
+
+	fieldPairs := []struct {
+		key   []byte
+		value []byte
+	}{
+		{
+			CHECKSUM_CACHE_SIZE,
+			big.NewInt(entry.Size).Bytes(),
+		},
+		{
+			CHECKSUM_CACHE_MOD_TIME,
+			modTime,
+		},
+		{
+			CHECKSUM_CACHE_INODE,
+			new(big.Int).SetUint64(entry.Inode).Bytes(),
+		},
+		{
+			CHECKSUM_CACHE_CHECKSUM,
+			[]byte(entry.Checksum),
+		},
+		{
+			CHECKSUM_CACHE_MERKLE_LEAVES,
+			entry.MerkleLeaves,
+		},
+	}
+
+	batch := new(leveldb.Batch)
+
+	entityKeyBase := append(checksumCacheKeyBase(entry.Path), delimiter...)
+	for _, field := range fieldPairs {
+		batch.Put(append(entityKeyBase, field.key...), field.value)
+	}
+
+	return sh.db.Write(batch, nil)
+}
+
+// GetChecksumEntry fetches the cached checksum of the file, if any
+func (sh *StorageHandler) GetChecksumEntry(path string) (*types.ChecksumCacheEntry, error) {
+	var foundEntry *types.ChecksumCacheEntry
+
+	entityKeyBase := append(checksumCacheKeyBase(path), delimiter...)
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+
+	for iter.Next() {
+		// checksumCache:hexPath:attributeName => value
+		keyParts := strings.Split(string(iter.Key()), ":")
+		attributeName := keyParts[len(keyParts)-1]
+
+		if foundEntry == nil {
+			foundEntry = &types.ChecksumCacheEntry{Path: path}
+		}
+
+		switch attributeName {
+		case "size":
+			foundEntry.Size = big.NewInt(0).SetBytes(iter.Value()).Int64()
+		case "modTime":
+			foundEntry.ModTime = decodeModTime(iter.Value())
+		case "inode":
+			foundEntry.Inode = big.NewInt(0).SetBytes(iter.Value()).Uint64()
+		case "checksum":
+			foundEntry.Checksum = string(iter.Value())
+		case "merkleLeaves":
+			foundEntry.MerkleLeaves = append([]byte{}, iter.Value()...)
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+
+	return foundEntry, err
+}
+
+// DeleteChecksumEntries deletes the cached checksum of the file at the path,
+// or of all files under it if the path is a directory
+func (sh *StorageHandler) DeleteChecksumEntries(path string) error {
+	batch := new(leveldb.Batch)
+
+	for _, prefix := range [][]byte{
+		append(checksumCacheKeyBase(path), delimiter...),
+		checksumCacheKeyBase(strings.TrimSuffix(path, "/") + "/"),
+	} {
+		iter := sh.db.NewIterator(util.BytesPrefix(prefix), nil)
+		for iter.Next() {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+
+		iter.Release()
+		if iterErr := iter.Error(); iterErr != nil {
+			return iterErr
+		}
+	}
+
+	return sh.db.Write(batch, nil)
+}
+
+// ClearChecksumCache deletes all cached checksums from the DB
+func (sh *StorageHandler) ClearChecksumCache() error {
+	batch := new(leveldb.Batch)
+
+	iter := sh.db.NewIterator(util.BytesPrefix(append(CHECKSUM_CACHE, delimiter...)), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+
+	iter.Release()
+	if iterErr := iter.Error(); iterErr != nil {
+		return iterErr
+	}
+
+	return sh.db.Write(batch, nil)
+}
+
+// BANDWIDTH LIMITS //
+
+// bandwidthLimitsKeyBase returns the key base of the limits in the given scope
+func bandwidthLimitsKeyBase(scope string, id string) []byte {
+	// bandwidthLimits:scope:id:attributeName => value
+	return append(
+		append(BANDWIDTH_LIMITS, delimiter...),
+		[]byte(fmt.Sprintf("%s:%s:", scope, id))...,
+	)
+}
+
+// SaveBandwidthLimits stores the bandwidth limits of a single scope into the DB
+func (sh *StorageHandler) SaveBandwidthLimits(settings types.BandwidthLimitSettings) error {
+	fieldPairs := []struct {
+		key   []byte
+		value []byte
+	}{
+		{
+			BANDWIDTH_LIMITS_UPLOAD_RATE,
+			big.NewInt(settings.UploadRate).Bytes(),
+		},
+		{
+			BANDWIDTH_LIMITS_DOWNLOAD_RATE,
+			big.NewInt(settings.DownloadRate).Bytes(),
+		},
+	}
+
+	entityKeyBase := bandwidthLimitsKeyBase(settings.Scope, settings.ID)
+	for _, field := range fieldPairs {
+		putError := sh.db.Put(append(entityKeyBase, field.key...), field.value, nil)
+		if putError != nil {
+			return putError
+		}
+	}
+
+	return nil
+}
+
+// GetBandwidthLimits fetches the stored bandwidth limits of all scopes
+func (sh *StorageHandler) GetBandwidthLimits() ([]*types.BandwidthLimitSettings, error) {
+	foundSettings := make([]*types.BandwidthLimitSettings, 0)
+
+	keyBase := append(BANDWIDTH_LIMITS, delimiter...)
+	iter := sh.db.NewIterator(util.BytesPrefix(keyBase), nil)
+
+	var currentSettings *types.BandwidthLimitSettings
+	for iter.Next() {
+		// bandwidthLimits:scope:id:attributeName => value
+		keyParts := strings.Split(string(iter.Key()), ":")
+		if len(keyParts) != 4 {
+			continue
+		}
+
+		scope, id, attributeName := keyParts[1], keyParts[2], keyParts[3]
+
+		if currentSettings == nil || currentSettings.Scope != scope || currentSettings.ID != id {
+			currentSettings = &types.BandwidthLimitSettings{Scope: scope, ID: id}
+			foundSettings = append(foundSettings, currentSettings)
+		}
+
+		value := big.NewInt(0).SetBytes(iter.Value()).Int64()
+		switch attributeName {
+		case "uploadRate":
+			currentSettings.UploadRate = value
+		case "downloadRate":
+			currentSettings.DownloadRate = value
+		}
+	}
+
+	iter.Release()
+	err := iter.Error()
+
+	return foundSettings, err
+}
+
+// DeleteBandwidthLimits deletes the bandwidth limits of a single scope from the DB
+func (sh *StorageHandler) DeleteBandwidthLimits(scope string, id string) error {
+	entityKeyBase := bandwidthLimitsKeyBase(scope, id)
+
+	iter := sh.db.NewIterator(util.BytesPrefix(entityKeyBase), nil)
+	for iter.Next() {
+		if deleteErr := sh.db.Delete(iter.Key(), nil); deleteErr != nil {
+			iter.Release()
+
+			return deleteErr
+		}
+	}
+
+	iter.Release()
+
+	return iter.Error()
+}
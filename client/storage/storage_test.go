@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	leveldbStorage "github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/zivkovicmilos/peer_drop/rest/types"
+)
+
+// newTestStorageHandler creates a storage handler backed by an in-memory DB
+func newTestStorageHandler(t *testing.T) *StorageHandler {
+	t.Helper()
+
+	db, openErr := leveldb.Open(leveldbStorage.NewMemStorage(), nil)
+	if openErr != nil {
+		t.Fatalf("Unable to open DB, %v", openErr)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return &StorageHandler{db: db}
+}
+
+func TestStorageHandler_ChecksumEntryModTime(t *testing.T) {
+	testTable := []struct {
+		name    string
+		modTime int64
+	}{
+		{
+			"Recent modification time",
+			1634450000123456789,
+		},
+		{
+			"Modification time at the epoch",
+			0,
+		},
+		{
+			"Modification time before the epoch",
+			-86400000000000,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			sh := newTestStorageHandler(t)
+
+			assert.NoError(t, sh.SaveChecksumEntry(types.ChecksumCacheEntry{
+				Path:     "/shared/file.txt",
+				Size:     10,
+				ModTime:  testCase.modTime,
+				Checksum: "checksum",
+			}))
+
+			entry, getErr := sh.GetChecksumEntry("/shared/file.txt")
+			assert.NoError(t, getErr)
+			assert.Equal(t, testCase.modTime, entry.ModTime)
+		})
+	}
+}
+
+func TestDecodeModTime_LegacyEntries(t *testing.T) {
+	for _, modTime := range []int64{0, 1, 1634450000123456789} {
+		assert.Equal(t, modTime, decodeModTime(big.NewInt(modTime).Bytes()))
+	}
+}
+
+func TestStorageHandler_BandwidthLimits(t *testing.T) {
+	sh := newTestStorageHandler(t)
+
+	storedLimits := []types.BandwidthLimitSettings{
+		{Scope: types.BANDWIDTH_SCOPE_GLOBAL, UploadRate: 1024, DownloadRate: 2048},
+		{Scope: types.BANDWIDTH_SCOPE_DEFAULT_PEER, UploadRate: 512},
+		{Scope: types.BANDWIDTH_SCOPE_WORKSPACE, ID: "alpha beta gamma", DownloadRate: 4096},
+		{Scope: types.BANDWIDTH_SCOPE_PEER, ID: "QmPeer", UploadRate: 256, DownloadRate: 128},
+	}
+
+	for _, settings := range storedLimits {
+		assert.NoError(t, sh.SaveBandwidthLimits(settings))
+	}
+
+	foundLimits, getErr := sh.GetBandwidthLimits()
+	assert.NoError(t, getErr)
+
+	expectedLimits := make([]*types.BandwidthLimitSettings, 0, len(storedLimits))
+	for index := range storedLimits {
+		expectedLimits = append(expectedLimits, &storedLimits[index])
+	}
+
+	assert.ElementsMatch(t, expectedLimits, foundLimits)
+
+	// Removed limits are gone, the others are kept
+	assert.NoError(t, sh.DeleteBandwidthLimits(types.BANDWIDTH_SCOPE_PEER, "QmPeer"))
+
+	foundLimits, getErr = sh.GetBandwidthLimits()
+	assert.NoError(t, getErr)
+	assert.ElementsMatch(t, expectedLimits[:3], foundLimits)
+}
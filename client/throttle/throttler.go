@@ -0,0 +1,231 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+)
+
+// Limits are the upload and download rates in bytes per second.
+// A rate of 0 means unlimited
+type Limits struct {
+	UploadRate   int64
+	DownloadRate int64
+}
+
+// limitBuckets are the token buckets enforcing a single set of limits
+type limitBuckets struct {
+	upload   *TokenBucket
+	download *TokenBucket
+}
+
+func newLimitBuckets(limits Limits) *limitBuckets {
+	return &limitBuckets{
+		upload:   NewTokenBucket(limits.UploadRate),
+		download: NewTokenBucket(limits.DownloadRate),
+	}
+}
+
+// set changes the limits, without resetting the bucket state
+func (lb *limitBuckets) set(limits Limits) {
+	lb.upload.SetRate(limits.UploadRate)
+	lb.download.SetRate(limits.DownloadRate)
+}
+
+// limits returns the current limits
+func (lb *limitBuckets) limits() Limits {
+	return Limits{
+		UploadRate:   lb.upload.Rate(),
+		DownloadRate: lb.download.Rate(),
+	}
+}
+
+// Throttler enforces the file sharing bandwidth limits on three levels:
+// globally, per workspace, and per remote peer. Traffic has to fit within all of them
+type Throttler struct {
+	global     *limitBuckets
+	workspaces map[string]*limitBuckets // mnemonic -> buckets
+
+	// Peers without their own limits share the default peer limits,
+	// but every peer still gets its own buckets
+	defaultPeerLimits Limits
+	peerLimits        map[string]Limits        // peer ID -> limits set for that peer
+	peers             map[string]*limitBuckets // peer ID -> buckets
+
+	throttlerMux sync.RWMutex
+}
+
+// NewThrottler creates a new throttler with the given global limits
+func NewThrottler(globalLimits Limits) *Throttler {
+	return &Throttler{
+		global:     newLimitBuckets(globalLimits),
+		workspaces: make(map[string]*limitBuckets),
+		peerLimits: make(map[string]Limits),
+		peers:      make(map[string]*limitBuckets),
+	}
+}
+
+// SetGlobalLimits changes the global limits
+func (t *Throttler) SetGlobalLimits(limits Limits) {
+	t.global.set(limits)
+}
+
+// GetGlobalLimits returns the global limits
+func (t *Throttler) GetGlobalLimits() Limits {
+	return t.global.limits()
+}
+
+// SetWorkspaceLimits changes the limits of the workspace
+func (t *Throttler) SetWorkspaceLimits(mnemonic string, limits Limits) {
+	t.throttlerMux.Lock()
+	defer t.throttlerMux.Unlock()
+
+	if buckets, ok := t.workspaces[mnemonic]; ok {
+		buckets.set(limits)
+
+		return
+	}
+
+	t.workspaces[mnemonic] = newLimitBuckets(limits)
+}
+
+// RemoveWorkspaceLimits removes the limits of the workspace
+func (t *Throttler) RemoveWorkspaceLimits(mnemonic string) {
+	t.throttlerMux.Lock()
+	defer t.throttlerMux.Unlock()
+
+	delete(t.workspaces, mnemonic)
+}
+
+// GetWorkspaceLimits returns the limits of all workspaces that have them
+func (t *Throttler) GetWorkspaceLimits() map[string]Limits {
+	t.throttlerMux.RLock()
+	defer t.throttlerMux.RUnlock()
+
+	workspaceLimits := make(map[string]Limits)
+	for mnemonic, buckets := range t.workspaces {
+		workspaceLimits[mnemonic] = buckets.limits()
+	}
+
+	return workspaceLimits
+}
+
+// SetDefaultPeerLimits changes the limits of the peers that don't have their own limits
+func (t *Throttler) SetDefaultPeerLimits(limits Limits) {
+	t.throttlerMux.Lock()
+	defer t.throttlerMux.Unlock()
+
+	t.defaultPeerLimits = limits
+
+	for peerID, buckets := range t.peers {
+		if _, ok := t.peerLimits[peerID]; !ok {
+			buckets.set(limits)
+		}
+	}
+}
+
+// GetDefaultPeerLimits returns the limits of the peers that don't have their own limits
+func (t *Throttler) GetDefaultPeerLimits() Limits {
+	t.throttlerMux.RLock()
+	defer t.throttlerMux.RUnlock()
+
+	return t.defaultPeerLimits
+}
+
+// SetPeerLimits changes the limits of a single peer
+func (t *Throttler) SetPeerLimits(peerID string, limits Limits) {
+	t.throttlerMux.Lock()
+	defer t.throttlerMux.Unlock()
+
+	t.peerLimits[peerID] = limits
+
+	if buckets, ok := t.peers[peerID]; ok {
+		buckets.set(limits)
+	}
+}
+
+// RemovePeerLimits removes the limits of a single peer, so it falls back to the default peer limits
+func (t *Throttler) RemovePeerLimits(peerID string) {
+	t.throttlerMux.Lock()
+	defer t.throttlerMux.Unlock()
+
+	delete(t.peerLimits, peerID)
+
+	if buckets, ok := t.peers[peerID]; ok {
+		buckets.set(t.defaultPeerLimits)
+	}
+}
+
+// GetPeerLimits returns the limits of all peers that have their own limits
+func (t *Throttler) GetPeerLimits() map[string]Limits {
+	t.throttlerMux.RLock()
+	defer t.throttlerMux.RUnlock()
+
+	peerLimits := make(map[string]Limits)
+	for peerID, limits := range t.peerLimits {
+		peerLimits[peerID] = limits
+	}
+
+	return peerLimits
+}
+
+// RemovePeer drops the buckets of a disconnected peer.
+// The limits set for the peer are kept, and apply again once it reconnects
+func (t *Throttler) RemovePeer(peerID string) {
+	t.throttlerMux.Lock()
+	defer t.throttlerMux.Unlock()
+
+	delete(t.peers, peerID)
+}
+
+// bucketsFor returns all the buckets the workspace and peer traffic goes through
+func (t *Throttler) bucketsFor(mnemonic string, peerID string) []*limitBuckets {
+	t.throttlerMux.RLock()
+	workspaceBuckets := t.workspaces[mnemonic]
+	peerBuckets, peerFound := t.peers[peerID]
+	t.throttlerMux.RUnlock()
+
+	if !peerFound {
+		t.throttlerMux.Lock()
+		if peerBuckets, peerFound = t.peers[peerID]; !peerFound {
+			limits, ok := t.peerLimits[peerID]
+			if !ok {
+				limits = t.defaultPeerLimits
+			}
+
+			peerBuckets = newLimitBuckets(limits)
+			t.peers[peerID] = peerBuckets
+		}
+		t.throttlerMux.Unlock()
+	}
+
+	buckets := []*limitBuckets{t.global, peerBuckets}
+	if workspaceBuckets != nil {
+		buckets = append(buckets, workspaceBuckets)
+	}
+
+	return buckets
+}
+
+// WaitUpload blocks until n bytes can be sent to the peer in the given workspace
+func (t *Throttler) WaitUpload(ctx context.Context, mnemonic string, peerID string, n int) error {
+	buckets := t.bucketsFor(mnemonic, peerID)
+
+	uploadBuckets := make([]*TokenBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		uploadBuckets = append(uploadBuckets, bucket.upload)
+	}
+
+	return WaitN(ctx, int64(n), uploadBuckets...)
+}
+
+// WaitDownload blocks until n bytes can be received from the peer in the given workspace
+func (t *Throttler) WaitDownload(ctx context.Context, mnemonic string, peerID string, n int) error {
+	buckets := t.bucketsFor(mnemonic, peerID)
+
+	downloadBuckets := make([]*TokenBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		downloadBuckets = append(downloadBuckets, bucket.download)
+	}
+
+	return WaitN(ctx, int64(n), downloadBuckets...)
+}
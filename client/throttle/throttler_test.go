@@ -0,0 +1,27 @@
+package throttle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottler_RemovePeer(t *testing.T) {
+	throttler := NewThrottler(Limits{})
+	throttler.SetDefaultPeerLimits(Limits{UploadRate: 100})
+	throttler.SetPeerLimits("peer-a", Limits{UploadRate: 200})
+
+	throttler.bucketsFor("mnemonic", "peer-a")
+	throttler.bucketsFor("mnemonic", "peer-b")
+	assert.Len(t, throttler.peers, 2)
+
+	// Disconnected peers don't keep their buckets
+	throttler.RemovePeer("peer-a")
+	throttler.RemovePeer("peer-b")
+	assert.Len(t, throttler.peers, 0)
+
+	// The limits set for the peer apply again once it reconnects
+	buckets := throttler.bucketsFor("mnemonic", "peer-a")
+	assert.Equal(t, int64(200), buckets[1].upload.Rate())
+	assert.Equal(t, map[string]Limits{"peer-a": {UploadRate: 200}}, throttler.GetPeerLimits())
+}
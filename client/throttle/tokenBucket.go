@@ -0,0 +1,124 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket limits the throughput to a number of bytes per second.
+// The bucket holds at most a second worth of tokens, so short bursts are allowed.
+// Requests larger than the available tokens put the bucket in debt, which is paid off
+// by waiting, so any request size can go through
+type TokenBucket struct {
+	rate       int64   // bytes per second, 0 means unlimited
+	tokens     float64 // available tokens, negative if the bucket is in debt
+	lastRefill time.Time
+	bucketMux  sync.Mutex
+
+	now func() time.Time
+}
+
+// NewTokenBucket creates a new token bucket with the given rate in bytes per second.
+// A rate of 0 means unlimited
+func NewTokenBucket(rate int64) *TokenBucket {
+	tb := &TokenBucket{
+		now: time.Now,
+	}
+
+	tb.SetRate(rate)
+
+	return tb
+}
+
+// SetRate changes the rate of the bucket. A rate of 0 means unlimited
+func (tb *TokenBucket) SetRate(rate int64) {
+	tb.bucketMux.Lock()
+	defer tb.bucketMux.Unlock()
+
+	if rate < 0 {
+		rate = 0
+	}
+
+	tb.refillLocked()
+
+	tb.rate = rate
+	if tb.tokens > float64(rate) {
+		tb.tokens = float64(rate)
+	}
+}
+
+// Rate returns the rate of the bucket in bytes per second
+func (tb *TokenBucket) Rate() int64 {
+	tb.bucketMux.Lock()
+	defer tb.bucketMux.Unlock()
+
+	return tb.rate
+}
+
+// refillLocked adds the tokens accumulated since the last refill
+func (tb *TokenBucket) refillLocked() {
+	now := tb.now()
+	elapsed := now.Sub(tb.lastRefill).Seconds()
+	tb.lastRefill = now
+
+	if tb.rate == 0 {
+		tb.tokens = 0
+
+		return
+	}
+
+	tb.tokens += elapsed * float64(tb.rate)
+	if tb.tokens > float64(tb.rate) {
+		tb.tokens = float64(tb.rate)
+	}
+}
+
+// reserve takes n tokens from the bucket, and returns
+// how long the caller needs to wait before using them
+func (tb *TokenBucket) reserve(n int64) time.Duration {
+	tb.bucketMux.Lock()
+	defer tb.bucketMux.Unlock()
+
+	tb.refillLocked()
+
+	if tb.rate == 0 {
+		return 0
+	}
+
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / float64(tb.rate) * float64(time.Second))
+}
+
+// WaitN blocks until n bytes can go through all the given buckets,
+// or the context is canceled
+func WaitN(ctx context.Context, n int64, buckets ...*TokenBucket) error {
+	delay := time.Duration(0)
+	for _, bucket := range buckets {
+		if bucket == nil {
+			continue
+		}
+
+		if bucketDelay := bucket.reserve(n); bucketDelay > delay {
+			delay = bucketDelay
+		}
+	}
+
+	if delay == 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBucket creates a token bucket with a manually advanced clock
+func newTestBucket(rate int64) (*TokenBucket, func(time.Duration)) {
+	now := time.Unix(0, 0)
+
+	bucket := &TokenBucket{
+		now: func() time.Time {
+			return now
+		},
+	}
+	bucket.SetRate(rate)
+
+	return bucket, func(elapsed time.Duration) {
+		now = now.Add(elapsed)
+	}
+}
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	testTable := []struct {
+		name          string
+		rate          int64
+		elapsed       time.Duration
+		requests      []int64
+		expectedDelay time.Duration
+	}{
+		{
+			"Unlimited rate",
+			0,
+			0,
+			[]int64{1024 * 1024},
+			0,
+		},
+		{
+			"Request within the available tokens",
+			1000,
+			time.Second,
+			[]int64{500},
+			0,
+		},
+		{
+			"Tokens are capped at a second worth",
+			1000,
+			10 * time.Second,
+			[]int64{1000, 500},
+			500 * time.Millisecond,
+		},
+		{
+			"Request larger than the bucket",
+			1000,
+			0,
+			[]int64{3000},
+			3 * time.Second,
+		},
+		{
+			"Debt adds up",
+			1000,
+			0,
+			[]int64{1000, 1000},
+			2 * time.Second,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			bucket, advance := newTestBucket(testCase.rate)
+			advance(testCase.elapsed)
+
+			delay := time.Duration(0)
+			for _, request := range testCase.requests {
+				delay = bucket.reserve(request)
+			}
+
+			assert.Equal(t, testCase.expectedDelay, delay)
+		})
+	}
+}
+
+func TestTokenBucket_SetRate(t *testing.T) {
+	bucket, advance := newTestBucket(1000)
+	advance(time.Second)
+
+	// Lowering the rate drops the extra tokens
+	bucket.SetRate(100)
+	assert.Equal(t, int64(100), bucket.Rate())
+	assert.Equal(t, time.Duration(0), bucket.reserve(100))
+	assert.Equal(t, time.Second, bucket.reserve(100))
+
+	// Removing the limit lets everything through
+	bucket.SetRate(0)
+	assert.Equal(t, time.Duration(0), bucket.reserve(1024*1024))
+}
+
+func TestWaitN_Canceled(t *testing.T) {
+	bucket, _ := newTestBucket(1)
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+
+	assert.ErrorIs(t, WaitN(ctx, 10, bucket), context.Canceled)
+}